@@ -10,26 +10,32 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/peterh/liner"
 
 	"github.com/lexlapax/cogmem/pkg/cogmem"
 	"github.com/lexlapax/cogmem/pkg/config"
 	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/ingest"
 	"github.com/lexlapax/cogmem/pkg/log"
 )
 
 // Constants for the command-line interface
 const (
-	cmdHelp     = "!help"
-	cmdQuit     = "!quit"
-	cmdEntity   = "!entity"
-	cmdUser     = "!user"
-	cmdRemember = "!remember"
-	cmdLookup   = "!lookup"
-	cmdSearch   = "!search"  // New semantic search command
-	cmdQuery    = "!query"
-	cmdReflect  = "!reflect"
-	cmdConfig   = "!config"
+	cmdHelp       = "!help"
+	cmdQuit       = "!quit"
+	cmdEntity     = "!entity"
+	cmdUser       = "!user"
+	cmdRemember   = "!remember"
+	cmdLookup     = "!lookup"
+	cmdSearch     = "!search"  // New semantic search command
+	cmdQuery      = "!query"
+	cmdReflect    = "!reflect"
+	cmdConfig     = "!config"
+	cmdIngest     = "!ingest"
+	cmdSession    = "!session"
+	cmdSessions   = "!sessions"
+	cmdTranscript = "!transcript"
 )
 
 // Command-line help text
@@ -44,6 +50,10 @@ CogMem Client - Command Reference:
 !search <query>       - Retrieve memories using semantic (vector) search
 !query <question>     - Ask a question using context from memories
 !reflect              - Trigger a reflection cycle manually
+!ingest <path>        - Store a file or folder of documents (.md, .html, .csv, .jsonl, .txt)
+!session [id]         - Show the current conversation session, or switch to one ("new" starts a fresh session)
+!sessions             - List your conversation sessions
+!transcript [id]      - Show the turns of the current or given session
 !config               - Show current configuration
 !quit                 - Exit the application
 
@@ -57,6 +67,17 @@ Notes:
 // historyFile is the file where command history is stored
 const historyFile = ".cogmem_history"
 
+// ingestStateFile is the file where the content hashes of ingested files are stored
+const ingestStateFile = ".cogmem_ingest.json"
+
+// ingestUsage describes the ingest subcommand
+const ingestUsage = `Usage: example-client [-config path] ingest [flags] <path>...
+
+Stores every Markdown, HTML, CSV, JSONL and text file under each path in
+long-term memory, skipping files unchanged since they were last ingested.
+
+Flags:`
+
 func main() {
 	// Parse command-line flags
 	configPath := flag.String("config", "", "Path to configuration file")
@@ -78,6 +99,11 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Run the ingest subcommand instead of the interactive client if requested
+	if flag.Arg(0) == "ingest" {
+		os.Exit(runIngest(clientInstance, flag.Args()[1:]))
+	}
+
 	// Load config for CLI display purposes only
 	cfg, err := config.LoadFromFile(*configPath)
 	if err != nil {
@@ -94,7 +120,7 @@ func runCLI(clientInstance *cogmem.CogMemClientImpl, cfg *config.Config, stdinMo
 	// Initialize with default entity and user
 	currentEntity := entity.EntityID("default-entity")
 	currentUser := "default-user"
-	entityCtx := entity.NewContext(currentEntity, currentUser)
+	entityCtx := newSessionContext(currentEntity, currentUser)
 
 	// Different handling based on mode
 	if stdinMode {
@@ -156,7 +182,7 @@ func runCLI(clientInstance *cogmem.CogMemClientImpl, cfg *config.Config, stdinMo
 	
 	// Set tab completion
 	line.SetCompleter(func(line string) (c []string) {
-		commands := []string{cmdHelp, cmdQuit, cmdEntity, cmdUser, cmdRemember, cmdLookup, cmdSearch, cmdQuery, cmdReflect, cmdConfig}
+		commands := []string{cmdHelp, cmdQuit, cmdEntity, cmdUser, cmdRemember, cmdLookup, cmdSearch, cmdQuery, cmdReflect, cmdConfig, cmdIngest, cmdSession, cmdSessions, cmdTranscript}
 		for _, cmd := range commands {
 			if strings.HasPrefix(cmd, line) {
 				c = append(c, cmd)
@@ -258,13 +284,13 @@ func processCommand(input string,
 					entityIDInput, err := line.Prompt("Enter new entity ID (or press Enter to keep current): ")
 					if err == nil && strings.TrimSpace(entityIDInput) != "" {
 						*currentEntity = entity.EntityID(strings.TrimSpace(entityIDInput))
-						*entityCtx = entity.NewContext(*currentEntity, *currentUser)
+						*entityCtx = newSessionContext(*currentEntity, *currentUser)
 						fmt.Printf("Entity set to: %s\n", *currentEntity)
 					}
 				}
 			} else {
 				*currentEntity = entity.EntityID(parts[1])
-				*entityCtx = entity.NewContext(*currentEntity, *currentUser)
+				*entityCtx = newSessionContext(*currentEntity, *currentUser)
 				fmt.Printf("Entity set to: %s\n", *currentEntity)
 			}
 
@@ -276,13 +302,13 @@ func processCommand(input string,
 					userIDInput, err := line.Prompt("Enter new user ID (or press Enter to keep current): ")
 					if err == nil && strings.TrimSpace(userIDInput) != "" {
 						*currentUser = strings.TrimSpace(userIDInput)
-						*entityCtx = entity.NewContext(*currentEntity, *currentUser)
+						*entityCtx = newSessionContext(*currentEntity, *currentUser)
 						fmt.Printf("User set to: %s\n", *currentUser)
 					}
 				}
 			} else {
 				*currentUser = parts[1]
-				*entityCtx = entity.NewContext(*currentEntity, *currentUser)
+				*entityCtx = newSessionContext(*currentEntity, *currentUser)
 				fmt.Printf("User set to: %s\n", *currentUser)
 			}
 
@@ -419,6 +445,74 @@ func processCommand(input string,
 				fmt.Println(response)
 			}
 			
+		case cmdIngest:
+			if len(parts) == 1 || strings.TrimSpace(parts[1]) == "" {
+				fmt.Println("Path to ingest required")
+				return true
+			}
+			
+			ctx := entity.ContextWithEntity(context.Background(), *entityCtx)
+			if err := ingestPath(ctx, clientInstance, strings.TrimSpace(parts[1]), ingest.DefaultLoaderConfig()); err != nil {
+				fmt.Printf("Error ingesting documents: %v\n", err)
+			}
+			
+		case cmdSession:
+			if len(parts) == 1 || strings.TrimSpace(parts[1]) == "" {
+				fmt.Printf("Current session: %s\n", entityCtx.SessionID)
+				return true
+			}
+			
+			sessionID := strings.TrimSpace(parts[1])
+			if sessionID == "new" {
+				*entityCtx = newSessionContext(*currentEntity, *currentUser)
+			} else {
+				entityCtx.SessionID = sessionID
+			}
+			fmt.Printf("Session set to: %s\n", entityCtx.SessionID)
+			
+		case cmdSessions:
+			ctx := entity.ContextWithEntity(context.Background(), *entityCtx)
+			sessions, err := clientInstance.ListSessions(ctx)
+			if err != nil {
+				fmt.Printf("Error listing sessions: %v\n", err)
+				return true
+			}
+			if len(sessions) == 0 {
+				fmt.Println("No sessions recorded yet.")
+				return true
+			}
+			for _, session := range sessions {
+				fmt.Printf("%s  %d turns  %s - %s\n",
+					session.SessionID,
+					session.TurnCount,
+					session.StartedAt.Local().Format(time.RFC3339),
+					session.LastActiveAt.Local().Format(time.RFC3339))
+			}
+			
+		case cmdTranscript:
+			sessionID := ""
+			if len(parts) > 1 {
+				sessionID = strings.TrimSpace(parts[1])
+			}
+			
+			ctx := entity.ContextWithEntity(context.Background(), *entityCtx)
+			turns, err := clientInstance.SessionTranscript(ctx, sessionID)
+			if err != nil {
+				fmt.Printf("Error fetching transcript: %v\n", err)
+				return true
+			}
+			if len(turns) == 0 {
+				fmt.Println("No turns recorded for this session.")
+				return true
+			}
+			for _, turn := range turns {
+				fmt.Printf("[%d] %s (%s): %s\n",
+					turn.Index,
+					turn.Role,
+					turn.Timestamp.Local().Format(time.Kitchen),
+					turn.Content)
+			}
+			
 		case cmdConfig:
 			// Display current configuration
 			fmt.Println("\nCurrent Configuration:")
@@ -449,6 +543,7 @@ func processCommand(input string,
 			fmt.Printf("\nLog Level: %s\n", cfg.Logging.Level)
 			fmt.Printf("Entity: %s\n", *currentEntity)
 			fmt.Printf("User: %s\n", *currentUser)
+			fmt.Printf("Session: %s\n", entityCtx.SessionID)
 
 		default:
 			fmt.Printf("Unknown command: %s\nType !help for available commands.\n", cmd)
@@ -465,4 +560,72 @@ func processCommand(input string,
 	}
 	
 	return true
-}
\ No newline at end of file
+}
+
+// newSessionContext returns an entity context for a new conversation session.
+func newSessionContext(entityID entity.EntityID, userID string) entity.Context {
+	entityCtx := entity.NewContext(entityID, userID)
+	entityCtx.SessionID = uuid.New().String()
+	return entityCtx
+}
+
+// runIngest runs the ingest subcommand and returns the process exit code
+func runIngest(clientInstance *cogmem.CogMemClientImpl, args []string) int {
+	flags := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	entityID := flags.String("entity", "default-entity", "Entity to store the documents for")
+	userID := flags.String("user", "default-user", "User to store the documents as")
+	csvTemplate := flags.String("csv-template", "", "Template for CSV rows, e.g. \"{{.name}} lives in {{.city}}\"")
+	jsonlContent := flags.String("jsonl-content", "", "JSONL field holding each record's content")
+	jsonlTitle := flags.String("jsonl-title", "title", "JSONL field holding each record's title")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), ingestUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	
+	loaders := ingest.DefaultLoaderConfig()
+	loaders.CSVTemplate = *csvTemplate
+	loaders.JSONLContentField = *jsonlContent
+	loaders.JSONLTitleField = *jsonlTitle
+	
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext(entity.EntityID(*entityID), *userID))
+	exitCode := 0
+	for _, path := range flags.Args() {
+		if err := ingestPath(ctx, clientInstance, path, loaders); err != nil {
+			fmt.Printf("Error ingesting %s: %v\n", path, err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// ingestPath stores the documents under path, printing a summary and
+// recording file hashes so unchanged files are skipped next time
+func ingestPath(ctx context.Context, clientInstance *cogmem.CogMemClientImpl, path string, loaders ingest.LoaderConfig) error {
+	hashes, err := ingest.NewFileHashStore(ingestStateFile)
+	if err != nil {
+		return err
+	}
+	
+	fmt.Printf("Ingesting %s...\n", path)
+	result, err := clientInstance.IngestPath(ctx, path, ingest.WalkOptions{Loaders: loaders, Hashes: hashes})
+	if saveErr := hashes.Save(); saveErr != nil {
+		fmt.Printf("Warning: failed to save ingestion state: %v\n", saveErr)
+	}
+	if err != nil {
+		return err
+	}
+	
+	fmt.Printf("Files: %d | Ingested: %d | Unchanged: %d | Documents stored: %d | Failed: %d\n",
+		result.Files, result.Ingested, result.Skipped, result.Documents, len(result.Failed))
+	for _, failure := range result.Failed {
+		fmt.Printf("  %v\n", failure)
+	}
+	return nil
+}
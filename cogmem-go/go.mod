@@ -12,10 +12,12 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.27
 	github.com/peterh/liner v1.2.2
 	github.com/philippgille/chromem-go v0.7.0
+	github.com/pkoukk/tiktoken-go-loader v0.0.2
 	github.com/sashabaranov/go-openai v1.38.1
 	github.com/stretchr/testify v1.10.0
 	github.com/yuin/gopher-lua v1.1.1
 	go.etcd.io/bbolt v1.4.0
+	golang.org/x/net v0.33.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
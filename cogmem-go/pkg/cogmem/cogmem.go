@@ -9,7 +9,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/lexlapax/cogmem/pkg/config"
+	"github.com/lexlapax/cogmem/pkg/contextbuilder"
 	"github.com/lexlapax/cogmem/pkg/entity"
 	"github.com/lexlapax/cogmem/pkg/log"
 	"github.com/lexlapax/cogmem/pkg/mem/ltm"
@@ -50,6 +52,9 @@ const (
 	InputTypeQuery InputType = "query"
 )
 
+// MetadataKeyPinned is the metadata key that marks a memory as pinned
+const MetadataKeyPinned = "pinned"
+
 // CogMemClient is the main facade for the CogMem library.
 type CogMemClient interface {
 	// Process handles input and produces a response based on the client's capabilities.
@@ -63,6 +68,33 @@ type Config struct {
 	
 	// ReflectionFrequency is how often reflection occurs (in ops count)
 	ReflectionFrequency int
+	
+	// ReflectPerUser counts operations and reflects on them separately for
+	// each user within an entity, rather than for the entity as a whole
+	ReflectPerUser bool
+	
+	// EnableIterativeRetrieval lets queries retrieve context over several rounds,
+	// with the reasoning engine proposing follow-up searches for multi-hop questions
+	EnableIterativeRetrieval bool
+	
+	// MaxRetrievalRounds limits the rounds of an iterative retrieval
+	MaxRetrievalRounds int
+	
+	// RetrievalTokenBudget caps the estimated tokens of context gathered by an iterative retrieval
+	RetrievalTokenBudget int
+	
+	// ContextTokenBudget caps the tokens of memory context placed in query prompts
+	ContextTokenBudget int
+	
+	// ContextOrder arranges memories in query prompts by score or chronologically
+	ContextOrder contextbuilder.Order
+	
+	// IncludePinnedMemories adds memories whose metadata marks them as pinned
+	// to every query prompt, ahead of retrieved memories
+	IncludePinnedMemories bool
+	
+	// MaxPinnedMemories limits the pinned memories considered per query
+	MaxPinnedMemories int
 }
 
 // DefaultConfig returns the default configuration for the client.
@@ -70,10 +102,18 @@ func DefaultConfig() Config {
 	return Config{
 		EnableReflection:    true,
 		ReflectionFrequency: 10,
+		EnableIterativeRetrieval: false,
+		MaxRetrievalRounds:       3,
+		RetrievalTokenBudget:     2000,
+		ContextTokenBudget:       2000,
+		ContextOrder:             contextbuilder.OrderScore,
+		IncludePinnedMemories:    false,
+		MaxPinnedMemories:        5,
 	}
 }
 
 // CogMemClientImpl is the implementation of the CogMemClient interface.
+// It is safe for concurrent use by multiple goroutines and entities.
 type CogMemClientImpl struct {
 	// memoryManager is the MMU for memory operations
 	memoryManager mmu.MMU
@@ -90,18 +130,12 @@ type CogMemClientImpl struct {
 	// config contains client configuration options
 	config Config
 	
-	// opCount tracks operations for triggering reflection
-	opCount int
+	// contextBuilder fits memories into query prompts
+	contextBuilder *contextbuilder.ContextBuilder
 	
-	// operationHistory stores recent operations for reflection
-	operationHistory []OperationRecord
-}
-
-// OperationRecord represents a single operation performed by the client
-type OperationRecord struct {
-	InputType InputType `json:"input_type"`
-	Input     string    `json:"input"`
-	Response  string    `json:"response"`
+	// operations tracks the operation counts and recent operations of each
+	// entity for triggering reflection
+	operations *operationTracker
 }
 
 // NewCogMem creates a new CogMemClient with the specified dependencies.
@@ -118,8 +152,12 @@ func NewCogMem(
 		scriptingEngine:  scriptingEngine,
 		reflectionModule: reflectionModule,
 		config:           config,
-		opCount:          0,
-		operationHistory: make([]OperationRecord, 0, 10), // Keep last 10 operations for reflection
+		contextBuilder:   contextbuilder.New(contextbuilder.Config{
+			TokenBudget: config.ContextTokenBudget,
+			Tokenizer:   reasoning.TokenizerFor(reasoningEngine),
+			Order:       config.ContextOrder,
+		}),
+		operations:       newOperationTracker(config.ReflectPerUser),
 	}
 	
 	log.Debug("CogMemClient initialized", 
@@ -138,14 +176,21 @@ func (c *CogMemClientImpl) Process(ctx context.Context, inputType InputType, inp
 		return "", entity.ErrMissingEntityContext
 	}
 	
+	// Every hook run for this input sees the same ctx.request_id
+	if scripting.RequestID(ctx) == "" {
+		ctx = scripting.WithRequestID(ctx, uuid.NewString())
+	}
+	
 	log.DebugContext(ctx, "Processing input", 
 		"entity_id", entityCtx.EntityID,
 		"input_type", inputType,
 		"input_length", len(input),
 	)
 	
-	// Increment operation count
-	c.opCount++
+	// Increment the operation count of this entity
+	opKey := c.operations.keyFor(entityCtx)
+	opCount := c.operations.increment(opKey)
+	startedAt := time.Now()
 	
 	// Process based on input type
 	var response string
@@ -165,15 +210,24 @@ func (c *CogMemClientImpl) Process(ctx context.Context, inputType InputType, inp
 	
 	// If operation was successful, record it for reflection
 	if err == nil {
-		c.recordOperation(inputType, input, response)
+		c.operations.record(opKey, OperationRecord{
+			InputType: inputType,
+			Input:     input,
+			Response:  response,
+		})
+		
+		// Queries within a session are also stored as conversation turns
+		if inputType == InputTypeQuery {
+			c.recordTurns(ctx, input, response, startedAt)
+		}
 		
 		// Check if reflection should be triggered
-		if c.shouldReflect() {
+		if c.shouldReflect(opCount) {
 			log.DebugContext(ctx, "Triggering reflection after operation", 
-				"operation_count", c.opCount,
+				"operation_count", opCount,
 				"reflection_frequency", c.config.ReflectionFrequency,
 			)
-			c.reflect(ctx)
+			c.reflect(ctx, c.operations.history(opKey), opCount)
 		}
 	}
 	
@@ -255,19 +309,10 @@ func (c *CogMemClientImpl) handleQuery(ctx context.Context, input string) (strin
 	}
 	
 	// Configure retrieval for semantic search
-	options := mmu.RetrievalOptions{
-		MaxResults:     5,   // Limit to most relevant memories
-		Strategy:       "semantic",
-		IncludeMetadata: true,
-	}
+	options := queryRetrievalOptions()
 	
-	// Create a semantic query for related memories
-	query := map[string]interface{}{
-		"text": input, 
-	}
-	
-	// Retrieve relevant context from LTM
-	memories, err := c.memoryManager.RetrieveFromLTM(ctx, query, options)
+	// Retrieve relevant context from LTM, iteratively for regular queries when enabled
+	memories, err := c.retrieveQueryContext(ctx, input, options, !isSemanticSearchRequest)
 	if err != nil {
 		log.ErrorContext(ctx, "Failed to retrieve context for query", "error", err)
 		return "", err
@@ -285,11 +330,9 @@ func (c *CogMemClientImpl) handleQuery(ctx context.Context, input string) (strin
 		for i, memory := range memories {
 			resultBuilder.WriteString(fmt.Sprintf("Memory %d: %s\n", i+1, memory.Content))
 			
-			// Include similarity score if available
-			if memory.Metadata != nil {
-				if score, ok := memory.Metadata["score"].(float64); ok {
-					resultBuilder.WriteString(fmt.Sprintf("  Similarity: %.2f%%\n", score*100))
-				}
+			// Include the normalized similarity score if available
+			if memory.Score > 0 {
+				resultBuilder.WriteString(fmt.Sprintf("  Similarity: %.2f%%\n", memory.Score*100))
 			}
 			
 			// Add creation time if available
@@ -302,77 +345,153 @@ func (c *CogMemClientImpl) handleQuery(ctx context.Context, input string) (strin
 		return resultBuilder.String(), nil
 	}
 	
-	// For regular queries, build prompt with context if available
-	var prompt string
-	if len(memories) > 0 {
-		log.DebugContext(ctx, "Found relevant context memories", "count", len(memories))
-		
-		// Format memories for context
-		var contextBuilder strings.Builder
-		contextBuilder.WriteString("Context from memory:\n")
+	// For regular queries, answer with the memories as cited context
+	response, _, err := c.answerWithContext(ctx, input, memories)
+	return response, err
+}
+
+// QueryWithCitations answers a question using memories as context, like a
+// query passed to Process, and also returns the built context. Its Markers map
+// the citation markers the model was asked to use (e.g. "[1]") to memory IDs,
+// so statements in the answer can be attributed to their sources.
+func (c *CogMemClientImpl) QueryWithCitations(ctx context.Context, question string) (string, *contextbuilder.Result, error) {
+	if _, ok := entity.GetEntityContext(ctx); !ok {
+		return "", nil, entity.ErrMissingEntityContext
+	}
+	
+	memories, err := c.retrieveQueryContext(ctx, question, queryRetrievalOptions(), true)
+	if err != nil {
+		log.ErrorContext(ctx, "Failed to retrieve context for query", "error", err)
+		return "", nil, err
+	}
+	
+	return c.answerWithContext(ctx, question, memories)
+}
+
+// queryRetrievalOptions returns the retrieval options used to gather context for queries.
+func queryRetrievalOptions() mmu.RetrievalOptions {
+	return mmu.RetrievalOptions{
+		MaxResults:     5,   // Limit to most relevant memories
+		Strategy:       "semantic",
+		IncludeMetadata: true,
+		Diversity:      0.7, // Avoid filling the context with near-duplicates
+		MinScore:       0.3, // Drop weak matches rather than padding the prompt
+		ImportanceWeight: 0.2, // Let important memories outrank slightly closer matches
+	}
+}
+
+// retrieveQueryContext retrieves the memories relevant to a query, over
+// several rounds when iterative retrieval is enabled and allowed.
+func (c *CogMemClientImpl) retrieveQueryContext(ctx context.Context, input string, options mmu.RetrievalOptions, allowIterative bool) ([]ltm.MemoryRecord, error) {
+	// Create a semantic query for related memories
+	query := map[string]interface{}{
+		"text": input, 
+	}
+	
+	var memories []ltm.MemoryRecord
+	var err error
+	if retriever, ok := c.memoryManager.(mmu.IterativeRetriever); ok && c.config.EnableIterativeRetrieval && allowIterative {
+		iterativeOptions := mmu.DefaultIterativeRetrievalOptions()
+		iterativeOptions.Retrieval = options
+		iterativeOptions.MaxRounds = c.config.MaxRetrievalRounds
+		iterativeOptions.TokenBudget = c.config.RetrievalTokenBudget
 		
-		for i, memory := range memories {
-			contextBuilder.WriteString(fmt.Sprintf("Memory %d: %s\n", i+1, memory.Content))
+		var result *mmu.IterativeRetrievalResult
+		result, err = retriever.RetrieveIteratively(ctx, input, iterativeOptions)
+		if result != nil {
+			memories = result.Records
+			for i, round := range result.Rounds {
+				log.DebugContext(ctx, "Iterative retrieval sub-query",
+					"round", i+1,
+					"query", round.Query,
+					"added", round.Added)
+			}
+			log.DebugContext(ctx, "Iterative retrieval finished", "stop_reason", result.StopReason)
 		}
-		
-		prompt = fmt.Sprintf(
-			"Using the following context, please answer this question:\n\n%s\n\nQuestion: %s",
-			contextBuilder.String(),
-			input,
-		)
+	} else {
+		memories, err = c.memoryManager.RetrieveFromLTM(ctx, query, options)
+	}
+	
+	return memories, err
+}
+
+// answerWithContext fits the retrieved memories, pinned memories and working
+// memory into the context budget and asks the reasoning engine to answer.
+func (c *CogMemClientImpl) answerWithContext(ctx context.Context, input string, memories []ltm.MemoryRecord) (string, *contextbuilder.Result, error) {
+	contextInput := contextbuilder.Input{
+		Retrieved: memories,
+		Pinned:    c.pinnedMemories(ctx),
+	}
+	if provider, ok := c.memoryManager.(mmu.WorkingMemoryProvider); ok {
+		contextInput.Working = provider.WorkingMemory(ctx)
+	}
+	
+	prompt, built := c.contextBuilder.BuildPrompt(input, contextInput)
+	if len(built.Citations) > 0 {
+		log.DebugContext(ctx, "Built memory context for query",
+			"memories", len(built.Citations),
+			"tokens", built.Tokens,
+			"omitted", len(built.Omitted),
+			"duplicates", len(built.Duplicates))
 	} else {
 		log.DebugContext(ctx, "No relevant context found for query")
-		prompt = fmt.Sprintf("Please answer this question: %s", input)
 	}
 	
 	// Process the query with the reasoning engine
 	response, err := c.reasoningEngine.Process(ctx, prompt)
 	if err != nil {
 		log.ErrorContext(ctx, "Failed to process query", "error", err)
-		return "", err
+		return "", nil, err
 	}
 	
 	log.DebugContext(ctx, "Query processed successfully", "response_length", len(response))
-	return response, nil
+	return response, built, nil
 }
 
-// recordOperation adds an operation to the history for reflection
-func (c *CogMemClientImpl) recordOperation(inputType InputType, input, response string) {
-	record := OperationRecord{
-		InputType: inputType,
-		Input:     input,
-		Response:  response,
+// pinnedMemories retrieves the memories marked as pinned, when enabled.
+// Failures are logged and yield no pinned memories.
+func (c *CogMemClientImpl) pinnedMemories(ctx context.Context) []ltm.MemoryRecord {
+	if !c.config.IncludePinnedMemories {
+		return nil
+	}
+	
+	options := mmu.DefaultRetrievalOptions()
+	options.MaxResults = c.config.MaxPinnedMemories
+	query := map[string]interface{}{
+		"filters": map[string]interface{}{MetadataKeyPinned: true},
 	}
 	
-	// Keep last 10 operations maximum
-	c.operationHistory = append(c.operationHistory, record)
-	if len(c.operationHistory) > 10 {
-		c.operationHistory = c.operationHistory[1:]
+	pinned, err := c.memoryManager.RetrieveFromLTM(ctx, query, options)
+	if err != nil {
+		log.WarnContext(ctx, "Failed to retrieve pinned memories", "error", err)
+		return nil
 	}
+	return pinned
 }
 
-// shouldReflect determines if reflection should be triggered
-func (c *CogMemClientImpl) shouldReflect() bool {
+// shouldReflect determines if reflection should be triggered after the
+// opCount-th operation of an entity
+func (c *CogMemClientImpl) shouldReflect(opCount int) bool {
 	// Skip if reflection is disabled
 	if !c.config.EnableReflection {
 		return false
 	}
 	
 	// Check if enough operations have been performed
-	return c.opCount > 0 && c.opCount%c.config.ReflectionFrequency == 0
+	return c.config.ReflectionFrequency > 0 && opCount > 0 && opCount%c.config.ReflectionFrequency == 0
 }
 
-// reflect performs reflection on recent operations
-func (c *CogMemClientImpl) reflect(ctx context.Context) {
+// reflect performs reflection on the recent operations of the entity in ctx
+func (c *CogMemClientImpl) reflect(ctx context.Context, history []OperationRecord, opCount int) {
 	// Skip if there's no reflection module or no operations to reflect on
-	if c.reflectionModule == nil || len(c.operationHistory) == 0 {
+	if c.reflectionModule == nil || len(history) == 0 {
 		return
 	}
 	
-	log.DebugContext(ctx, "Performing reflection", "history_length", len(c.operationHistory))
+	log.DebugContext(ctx, "Performing reflection", "history_length", len(history))
 	
 	// Also store the recent operation history in LTM before reflection
-	historyJSON, err := json.Marshal(c.operationHistory)
+	historyJSON, err := json.Marshal(history)
 	if err != nil {
 		log.ErrorContext(ctx, "Failed to marshal operation history for reflection", "error", err)
 		return
@@ -383,11 +502,16 @@ func (c *CogMemClientImpl) reflect(ctx context.Context) {
 		"content": string(historyJSON),
 		"metadata": map[string]interface{}{
 			"type":           "operation_history",
-			"operation_count": c.opCount,
+			"operation_count": opCount,
 			"timestamp":      time.Now().Format(time.RFC3339),
 		},
 	}
 	
+	// A user's own history is not shared with the rest of the entity
+	if c.config.ReflectPerUser {
+		historyData["access_level"] = int(entity.PrivateToUser)
+	}
+	
 	// Store the history in LTM (ignore errors, this is just for context)
 	_, _ = c.memoryManager.EncodeToLTM(ctx, historyData)
 	
@@ -400,7 +524,7 @@ func (c *CogMemClientImpl) reflect(ctx context.Context) {
 	
 	log.DebugContext(ctx, "Reflection completed", 
 		"insight_count", len(insights),
-		"operation_count", c.opCount)
+		"operation_count", opCount)
 }
 
 // NewCogMemFromConfig creates a new CogMemClient using the provided configuration file.
@@ -435,15 +559,30 @@ func NewCogMemFromConfig(configPath string) (*CogMemClientImpl, error) {
 		ltmStore,
 		reasoningEngine,
 		scriptEngine,
-		mmu.DefaultConfig(),
+		mmuConfig(cfg),
 	)
+	if cfg.Retrieval.Rerank {
+		rerankerConfig := mmu.DefaultLLMRerankerConfig()
+		if cfg.Retrieval.RerankTopN > 0 {
+			rerankerConfig.TopN = cfg.Retrieval.RerankTopN
+		}
+		if cfg.Retrieval.RerankTimeoutMs > 0 {
+			rerankerConfig.Timeout = time.Duration(cfg.Retrieval.RerankTimeoutMs) * time.Millisecond
+		}
+		mmuInstance.SetReranker(mmu.NewLLMReranker(reasoningEngine, rerankerConfig))
+	}
 
 	// Initialize the Reflection Module
+	reflectionConfig := reflection.DefaultConfig()
+	if cfg.Reflection.MaxMemoriesToAnalyze > 0 {
+		reflectionConfig.MaxMemoriesToAnalyze = cfg.Reflection.MaxMemoriesToAnalyze
+	}
+	reflectionConfig.MaxAnalysisTokens = cfg.Reflection.MaxAnalysisTokens
 	reflectionModule := reflection.NewReflectionModule(
 		mmuInstance,
 		reasoningEngine,
 		scriptEngine,
-		reflection.DefaultConfig(),
+		reflectionConfig,
 	)
 
 	// Create the client instance
@@ -451,6 +590,23 @@ func NewCogMemFromConfig(configPath string) (*CogMemClientImpl, error) {
 	if cfg.Reflection.Enabled {
 		clientConfig.EnableReflection = true
 		clientConfig.ReflectionFrequency = cfg.Reflection.TriggerFrequency
+		clientConfig.ReflectPerUser = cfg.Reflection.PerUser
+	}
+	if cfg.Retrieval.ContextTokenBudget > 0 {
+		clientConfig.ContextTokenBudget = cfg.Retrieval.ContextTokenBudget
+	}
+	if cfg.Retrieval.ContextOrder != "" {
+		clientConfig.ContextOrder = contextbuilder.Order(cfg.Retrieval.ContextOrder)
+	}
+	clientConfig.IncludePinnedMemories = cfg.Retrieval.IncludePinned
+	if cfg.Retrieval.Iterative {
+		clientConfig.EnableIterativeRetrieval = true
+		if cfg.Retrieval.MaxRounds > 0 {
+			clientConfig.MaxRetrievalRounds = cfg.Retrieval.MaxRounds
+		}
+		if cfg.Retrieval.TokenBudget > 0 {
+			clientConfig.RetrievalTokenBudget = cfg.Retrieval.TokenBudget
+		}
 	}
 
 	// Create and return the client
@@ -709,6 +865,62 @@ func initPgVectorStore(cfg *config.Config) (ltm.LTMStore, error) {
 	return pgvectorAdapter, nil
 }
 
+// mmuConfig applies the configured memory settings over the MMU defaults
+func mmuConfig(cfg *config.Config) mmu.Config {
+	mmuConfig := mmu.DefaultConfig()
+	mmuConfig.EnableImportanceScoring = cfg.Retrieval.ImportanceScoring
+	return mmuConfig
+}
+
+// scriptEngineConfig applies the configured engine settings over the defaults
+func scriptEngineConfig(cfg config.ScriptingEngineConfig) scripting.Config {
+	engineConfig := scripting.DefaultConfig()
+	if cfg.EnableSandboxing != nil {
+		engineConfig.EnableSandboxing = *cfg.EnableSandboxing
+	}
+	if cfg.ScriptTimeoutMs > 0 {
+		engineConfig.ScriptTimeoutMs = cfg.ScriptTimeoutMs
+	}
+	if cfg.MaxMemoryMB > 0 {
+		engineConfig.MaxMemoryMB = cfg.MaxMemoryMB
+	}
+	if cfg.PoolSize > 0 {
+		engineConfig.PoolSize = cfg.PoolSize
+	}
+	if cfg.MaxInstructions > 0 {
+		engineConfig.MaxInstructions = cfg.MaxInstructions
+	}
+	if cfg.MaxMemoryOps > 0 {
+		engineConfig.MaxMemoryOps = cfg.MaxMemoryOps
+	}
+	if cfg.MaxLLMCalls > 0 {
+		engineConfig.MaxLLMCalls = cfg.MaxLLMCalls
+	}
+	if cfg.MaxLLMTokens > 0 {
+		engineConfig.MaxLLMTokens = cfg.MaxLLMTokens
+	}
+	if cfg.CallStackSize > 0 {
+		engineConfig.CallStackSize = cfg.CallStackSize
+	}
+	if cfg.RegistrySize > 0 {
+		engineConfig.RegistrySize = cfg.RegistrySize
+	}
+	if len(cfg.HookLimits) > 0 {
+		engineConfig.HookLimits = make(map[string]scripting.Limits, len(cfg.HookLimits))
+		for funcName, limits := range cfg.HookLimits {
+			engineConfig.HookLimits[funcName] = scripting.Limits{
+				ScriptTimeoutMs: limits.ScriptTimeoutMs,
+				MaxMemoryMB:     limits.MaxMemoryMB,
+				MaxInstructions: limits.MaxInstructions,
+				MaxMemoryOps:    limits.MaxMemoryOps,
+				MaxLLMCalls:     limits.MaxLLMCalls,
+				MaxLLMTokens:    limits.MaxLLMTokens,
+			}
+		}
+	}
+	return engineConfig
+}
+
 // initScriptEngine initializes the Lua scripting engine
 func initScriptEngine(cfg *config.Config) (scripting.Engine, error) {
 	// Get script paths from config
@@ -719,7 +931,7 @@ func initScriptEngine(cfg *config.Config) (scripting.Engine, error) {
 	}
 
 	// Create script engine
-	scriptEngine, err := scripting.NewLuaEngine(scripting.DefaultConfig())
+	scriptEngine, err := scripting.NewLuaEngine(scriptEngineConfig(cfg.Scripting.Engine))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Lua engine: %w", err)
 	}
@@ -753,9 +965,37 @@ func initScriptEngine(cfg *config.Config) (scripting.Engine, error) {
 		log.Warn("No scripts were loaded from any path")
 	}
 
+	if err := loadEntityScripts(scriptEngine, cfg.Scripting.Entities); err != nil {
+		scriptEngine.Close()
+		return nil, err
+	}
+
 	return scriptEngine, nil
 }
 
+// loadEntityScripts loads the scripts configured for individual entities.
+// Unlike the global script paths, every configured path must load, since a
+// missing override would silently leave the entity with the global hooks.
+func loadEntityScripts(loader scripting.EntityScriptLoader, entities map[string][]string) error {
+	for entityID, paths := range entities {
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err == nil {
+				if info.IsDir() {
+					err = loader.LoadEntityScriptDir(entity.EntityID(entityID), path)
+				} else {
+					err = loader.LoadEntityScriptFile(entity.EntityID(entityID), path)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("failed to load scripts for entity %s: %w", entityID, err)
+			}
+		}
+		log.Info("Loaded entity scripts", "entity_id", entityID, "paths", paths)
+	}
+	return nil
+}
+
 // initReasoningEngine initializes the reasoning engine based on configuration
 func initReasoningEngine(cfg *config.Config) (reasoning.Engine, error) {
 	provider := strings.ToLower(cfg.Reasoning.Provider)
@@ -3,16 +3,24 @@ package cogmem
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/ingest"
 	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	ltmMock "github.com/lexlapax/cogmem/pkg/mem/ltm/adapters/mock"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm/adapters/vector/chromem_go"
 	"github.com/lexlapax/cogmem/pkg/mmu"
 	"github.com/lexlapax/cogmem/pkg/config"
 	"github.com/lexlapax/cogmem/pkg/reasoning"
+	reasoningMock "github.com/lexlapax/cogmem/pkg/reasoning/adapters/mock"
 	"github.com/lexlapax/cogmem/pkg/reflection"
+	"github.com/lexlapax/cogmem/pkg/scripting"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -112,9 +120,11 @@ func setupClientTest(t *testing.T) (*CogMemClientImpl, *MockMMU, *MockReasoningE
 		DefaultConfig(),
 	)
 
-	// Create a context with entity information
+	// Create a context with entity information. Its request ID is kept by
+	// Process, so the mocks see the same context.
 	entityCtx := entity.NewContext("test-entity", "test-user")
 	ctx := entity.ContextWithEntity(context.Background(), entityCtx)
+	ctx = scripting.WithRequestID(ctx, "test-request")
 
 	return client, mockMMU, mockReasoning, mockScripting, mockReflection, ctx
 }
@@ -326,6 +336,221 @@ func TestCogMemClient_Process_Query_ReasoningError(t *testing.T) {
 	mockReasoning.AssertExpectations(t)
 }
 
+func TestCogMemClient_QueryWithCitations(t *testing.T) {
+	// Setup
+	client, mockMMU, mockReasoning, _, _, ctx := setupClientTest(t)
+	client.config.IncludePinnedMemories = true
+
+	retrieved := []ltm.MemoryRecord{
+		{ID: "memory-1", Content: "Alice recommended the bistro", Score: 0.6},
+		{ID: "memory-2", Content: "I met Alice in Paris", Score: 0.9},
+	}
+	pinned := []ltm.MemoryRecord{
+		{ID: "pinned-1", Content: "User prefers short answers", Metadata: map[string]interface{}{MetadataKeyPinned: true}},
+	}
+
+	// Pinned memories are retrieved by metadata filter, context by query text
+	mockMMU.On("RetrieveFromLTM", ctx, mock.MatchedBy(func(q interface{}) bool {
+		query, ok := q.(map[string]interface{})
+		return ok && query["filters"] != nil
+	}), mock.Anything).Return(pinned, nil)
+	mockMMU.On("RetrieveFromLTM", ctx, mock.Anything, mock.Anything).Return(retrieved, nil)
+
+	var prompt string
+	mockReasoning.On("Process", ctx, mock.Anything).Run(func(args mock.Arguments) {
+		prompt = args.String(1)
+	}).Return("Alice recommended the bistro [2][3].", nil)
+
+	// Test query with citations
+	response, built, err := client.QueryWithCitations(ctx, "What did the person I met in Paris recommend?")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice recommended the bistro [2][3].", response)
+
+	// Pinned memories come first, then retrieved memories in retrieval order
+	assert.Equal(t, map[string]string{"[1]": "pinned-1", "[2]": "memory-1", "[3]": "memory-2"}, built.Markers)
+	assert.Contains(t, prompt, "[1] User prefers short answers\n[2] Alice recommended the bistro\n[3] I met Alice in Paris\n")
+	assert.Contains(t, prompt, "Question: What did the person I met in Paris recommend?")
+
+	// Missing entity context
+	_, _, err = client.QueryWithCitations(context.Background(), "question")
+	assert.ErrorIs(t, err, entity.ErrMissingEntityContext)
+}
+
+func TestCogMemClient_IngestPath(t *testing.T) {
+	client, mockMMU, _, _, _, ctx := setupClientTest(t)
+	
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "people.csv"), []byte("name\nAda\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "guide.md"), []byte("# Guide\nRead me."), 0o644))
+	
+	// CSV rows are stored as single records; chunked documents need a DocumentIngester
+	mockMMU.On("EncodeToLTM", ctx, mock.MatchedBy(func(data map[string]interface{}) bool {
+		metadata := data["metadata"].(map[string]interface{})
+		return data["content"] == "name: Ada" && metadata[ingest.MetadataKeyRow] == 1
+	})).Return("memory-1", nil).Once()
+	
+	result, err := client.IngestPath(ctx, root, ingest.WalkOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Files)
+	assert.Equal(t, 1, result.Ingested)
+	require.Len(t, result.Failed, 1)
+	assert.ErrorIs(t, result.Failed[0], ErrIngestionUnsupported)
+	mockMMU.AssertExpectations(t)
+	
+	_, err = client.IngestPath(context.Background(), root, ingest.WalkOptions{})
+	assert.ErrorIs(t, err, entity.ErrMissingEntityContext)
+}
+
+func TestCogMemClient_IngestPath_ChangedFile(t *testing.T) {
+	ltmStore := ltmMock.NewMockStore()
+	memoryManager := mmu.NewMMU(ltmStore, reasoningMock.NewMockEngine(), nil, mmu.DefaultConfig())
+	config := DefaultConfig()
+	config.EnableReflection = false
+	client := NewCogMem(memoryManager, reasoningMock.NewMockEngine(), nil, nil, config)
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	root := t.TempDir()
+	path := filepath.Join(root, "guide.md")
+	require.NoError(t, os.WriteFile(path, []byte("# Guide\nThe office opens at nine."), 0o644))
+	_, err := memoryManager.EncodeToLTM(ctx, "The office is in Lisbon")
+	require.NoError(t, err)
+	
+	hashes, err := ingest.NewFileHashStore(filepath.Join(t.TempDir(), "hashes.json"))
+	require.NoError(t, err)
+	options := ingest.WalkOptions{Hashes: hashes}
+	
+	stored := func() []ltm.MemoryRecord {
+		records, err := ltmStore.Retrieve(ctx, ltm.LTMQuery{Filters: map[string]interface{}{ingest.MetadataKeyPath: path}})
+		require.NoError(t, err)
+		return records
+	}
+	
+	_, err = client.IngestPath(ctx, root, options)
+	require.NoError(t, err)
+	first := stored()
+	require.NotEmpty(t, first)
+	
+	// Re-walking the modified file replaces its memories
+	require.NoError(t, os.WriteFile(path, []byte("# Guide\nThe office opens at ten."), 0o644))
+	result, err := client.IngestPath(ctx, root, options)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Ingested)
+	
+	second := stored()
+	require.Len(t, second, len(first))
+	for _, record := range second {
+		assert.NotContains(t, record.Content, "nine", "memories of the old file content are removed")
+	}
+	
+	other, err := ltmStore.Retrieve(ctx, ltm.LTMQuery{Text: "Lisbon"})
+	require.NoError(t, err)
+	assert.Len(t, other, 1, "unrelated memories are kept")
+}
+
+func TestCogMemClient_Process_RequestID(t *testing.T) {
+	scriptEngine, err := scripting.NewLuaEngine(scripting.DefaultConfig())
+	require.NoError(t, err)
+	t.Cleanup(func() { scriptEngine.Close() })
+	require.NoError(t, scriptEngine.LoadScript("hooks", []byte(`
+		function before_retrieve(query)
+			cogmem.memory.store("retrieve", {hook = "before_retrieve", request_id = ctx.request_id})
+			return query
+		end
+		
+		function before_encode(content)
+			return {metadata = {hook = "before_encode", request_id = ctx.request_id}}
+		end
+	`)))
+	
+	ltmStore := ltmMock.NewMockStore()
+	memoryManager := mmu.NewMMU(ltmStore, reasoningMock.NewMockEngine(), scriptEngine, mmu.DefaultConfig())
+	config := DefaultConfig()
+	config.EnableReflection = false
+	client := NewCogMem(memoryManager, reasoningMock.NewMockEngine(), scriptEngine, nil, config)
+	
+	entityCtx := entity.NewContext("test-entity", "test-user")
+	entityCtx.SessionID = "session-1"
+	ctx := entity.ContextWithEntity(context.Background(), entityCtx)
+	
+	// A query retrieves, then records the question and answer as turns
+	_, err = client.Process(ctx, InputTypeQuery, "first question")
+	require.NoError(t, err)
+	_, err = client.Process(ctx, InputTypeQuery, "second question")
+	require.NoError(t, err)
+	
+	records, err := ltmStore.Retrieve(ctx, ltm.LTMQuery{})
+	require.NoError(t, err)
+	hooksByRequest := make(map[string][]string)
+	for _, record := range records {
+		requestID, _ := record.Metadata["request_id"].(string)
+		require.NotEmpty(t, requestID, record.Content)
+		hooksByRequest[requestID] = append(hooksByRequest[requestID], record.Metadata["hook"].(string))
+	}
+	
+	// One request ID per call, shared by the retrieve and encode hooks
+	require.Len(t, hooksByRequest, 2)
+	for requestID, hooks := range hooksByRequest {
+		assert.ElementsMatch(t, []string{"before_retrieve", "before_encode", "before_encode"}, hooks, requestID)
+	}
+	
+	// A request ID set by the caller is kept
+	_, err = client.Process(scripting.WithRequestID(ctx, "caller-request"), InputTypeStore, "a fact")
+	require.NoError(t, err)
+	records, err = ltmStore.Retrieve(ctx, ltm.LTMQuery{Filters: map[string]interface{}{"request_id": "caller-request"}})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "a fact", records[0].Content)
+}
+
+func TestCogMemClient_Sessions(t *testing.T) {
+	memoryManager := mmu.NewMMU(ltmMock.NewMockStore(), reasoningMock.NewMockEngine(), nil, mmu.DefaultConfig())
+	reasoningEngine := reasoningMock.NewMockEngine(reasoningMock.WithDefaultResponse("Lisbon in June."))
+	config := DefaultConfig()
+	config.EnableReflection = false
+	client := NewCogMem(memoryManager, reasoningEngine, nil, nil, config)
+	
+	entityCtx := entity.NewContext("test-entity", "test-user")
+	entityCtx.SessionID = "session-1"
+	ctx := entity.ContextWithEntity(context.Background(), entityCtx)
+	
+	_, err := client.Process(ctx, InputTypeQuery, "Where is the offsite?")
+	require.NoError(t, err)
+	_, err = client.Process(ctx, InputTypeStore, "The offsite budget is 10k")
+	require.NoError(t, err)
+	
+	// Only queries are conversation turns
+	turns, err := client.SessionTranscript(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, turns, 2)
+	assert.Equal(t, mmu.RoleUser, turns[0].Role)
+	assert.Equal(t, "Where is the offsite?", turns[0].Content)
+	assert.Equal(t, mmu.RoleAssistant, turns[1].Role)
+	assert.Equal(t, "Lisbon in June.", turns[1].Content)
+	assert.False(t, turns[1].Timestamp.Before(turns[0].Timestamp))
+	
+	// Queries outside a session are not recorded
+	noSession := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	_, err = client.Process(noSession, InputTypeQuery, "Anything else?")
+	require.NoError(t, err)
+	
+	sessions, err := client.ListSessions(ctx)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "session-1", sessions[0].SessionID)
+	assert.Equal(t, 2, sessions[0].TurnCount)
+	
+	results, err := client.SearchSessions(ctx, "offsite", "session-1")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Where is the offsite?", results[0].Content)
+	
+	t.Run("unsupported memory manager", func(t *testing.T) {
+		client, _, _, _, _, ctx := setupClientTest(t)
+		_, err := client.ListSessions(ctx)
+		assert.ErrorIs(t, err, ErrEpisodicMemoryUnsupported)
+	})
+}
+
 func TestCogMemClient_Process_InvalidInputType(t *testing.T) {
 	// Setup
 	client, _, _, _, _, ctx := setupClientTest(t)
@@ -356,9 +581,10 @@ func TestCogMemClient_Reflection(t *testing.T) {
 		},
 	)
 
-	// Create a context with entity information
+	// Create a context with entity information and a request ID, which Process keeps
 	entityCtx := entity.NewContext("test-entity", "test-user")
 	ctx := entity.ContextWithEntity(context.Background(), entityCtx)
+	ctx = scripting.WithRequestID(ctx, "test-request")
 
 	// Set up mock expectations for first operation (no reflection)
 	mockMMU.On("RetrieveFromLTM", ctx, mock.Anything, mock.Anything).Return([]ltm.MemoryRecord{}, nil)
@@ -400,6 +626,232 @@ func TestCogMemClient_Reflection(t *testing.T) {
 	mockReflection.AssertExpectations(t)
 }
 
+func TestCogMemClient_Reflection_PerEntity(t *testing.T) {
+	mockMMU := new(MockMMU)
+	mockReasoning := new(MockReasoningEngine)
+	mockReflection := new(MockReflectionModule)
+	client := NewCogMem(mockMMU, mockReasoning, nil, mockReflection, Config{
+		EnableReflection:    true,
+		ReflectionFrequency: 2,
+	})
+	
+	ctxA := entity.ContextWithEntity(context.Background(), entity.NewContext("entity-a", "user"))
+	ctxB := entity.ContextWithEntity(context.Background(), entity.NewContext("entity-b", "user"))
+	
+	mockMMU.On("EncodeToLTM", mock.Anything, mock.Anything).Return("memory-id", nil)
+	mockReflection.On("TriggerReflection", mock.Anything).Return([]*reflection.Insight{}, nil)
+	
+	// Interleaved operations: neither entity has reached the frequency on its own
+	_, err := client.Process(ctxA, InputTypeStore, "entity A secret")
+	require.NoError(t, err)
+	_, err = client.Process(ctxB, InputTypeStore, "entity B note")
+	require.NoError(t, err)
+	mockReflection.AssertNotCalled(t, "TriggerReflection", mock.Anything)
+	
+	// B's second operation reflects on B's history only, in B's context
+	_, err = client.Process(ctxB, InputTypeStore, "entity B follow-up")
+	require.NoError(t, err)
+	mockReflection.AssertNumberOfCalls(t, "TriggerReflection", 1)
+	
+	var histories []string
+	for _, call := range mockMMU.Calls {
+		data, ok := call.Arguments.Get(1).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		metadata, _ := data["metadata"].(map[string]interface{})
+		if metadata["type"] != "operation_history" {
+			continue
+		}
+		callEntity, _ := entity.GetEntityContext(call.Arguments.Get(0).(context.Context))
+		assert.Equal(t, entity.EntityID("entity-b"), callEntity.EntityID)
+		histories = append(histories, data["content"].(string))
+	}
+	require.Len(t, histories, 1)
+	assert.Contains(t, histories[0], "entity B note")
+	assert.Contains(t, histories[0], "entity B follow-up")
+	assert.NotContains(t, histories[0], "entity A secret")
+	
+	t.Run("per user", func(t *testing.T) {
+		client := NewCogMem(mockMMU, mockReasoning, nil, mockReflection, Config{
+			EnableReflection:    true,
+			ReflectionFrequency: 2,
+			ReflectPerUser:      true,
+		})
+		ada := entity.ContextWithEntity(context.Background(), entity.NewContext("entity-a", "ada"))
+		grace := entity.ContextWithEntity(context.Background(), entity.NewContext("entity-a", "grace"))
+		
+		_, err := client.Process(ada, InputTypeStore, "ada note")
+		require.NoError(t, err)
+		_, err = client.Process(grace, InputTypeStore, "grace note")
+		require.NoError(t, err)
+		mockReflection.AssertNumberOfCalls(t, "TriggerReflection", 1)
+		
+		key := client.operations.keyFor(entity.NewContext("entity-a", "ada"))
+		require.Len(t, client.operations.history(key), 1)
+		assert.Equal(t, "ada note", client.operations.history(key)[0].Input)
+		
+		// Ada's reflection stores her history privately
+		_, err = client.Process(ada, InputTypeStore, "ada follow-up")
+		require.NoError(t, err)
+		mockReflection.AssertNumberOfCalls(t, "TriggerReflection", 2)
+		
+		last := mockMMU.Calls[len(mockMMU.Calls)-1]
+		data := last.Arguments.Get(1).(map[string]interface{})
+		assert.Equal(t, "operation_history", data["metadata"].(map[string]interface{})["type"])
+		assert.Equal(t, int(entity.PrivateToUser), data["access_level"])
+	})
+}
+
+func TestOperationTracker_EvictsLeastRecentlyUsed(t *testing.T) {
+	tracker := newOperationTracker(false)
+	
+	// Find three entities sharing a shard, and let the shard hold two logs
+	var keys []operationKey
+	for i := 0; len(keys) < 3; i++ {
+		entityID := entity.EntityID(fmt.Sprintf("entity-%d", i))
+		if entityID.Shard(operationShardCount) == 0 {
+			keys = append(keys, tracker.keyFor(entity.NewContext(entityID, "")))
+		}
+	}
+	tracker.shards[0].maxLogs = 2
+	
+	tracker.increment(keys[0])
+	tracker.increment(keys[1])
+	tracker.record(keys[0], OperationRecord{Input: "recent"})
+	tracker.increment(keys[2])
+	
+	assert.Len(t, tracker.shards[0].logs, 2)
+	assert.Equal(t, []OperationRecord{{Input: "recent"}}, tracker.history(keys[0]), "recently used logs are kept")
+	assert.Nil(t, tracker.history(keys[1]), "the least recently used log is evicted")
+	assert.Equal(t, 2, tracker.increment(keys[2]))
+}
+
+func TestCogMemClient_ConcurrentProcess(t *testing.T) {
+	const (
+		entities   = 10
+		users      = 3
+		goroutines = 200
+		operations = 3
+	)
+	
+	// Hooks run on pooled Lua states shared by every entity
+	scriptEngine, err := scripting.NewLuaEngine(scripting.DefaultConfig())
+	require.NoError(t, err)
+	t.Cleanup(func() { scriptEngine.Close() })
+	require.NoError(t, scriptEngine.LoadScript("hooks", []byte(`
+		function before_encode(content)
+			return {metadata = {encoded_by = ctx.entity_id .. "/" .. ctx.user_id}}
+		end
+		
+		function after_retrieve(results)
+			for _, record in ipairs(results) do
+				record.metadata.retrieved_by = ctx.entity_id
+			end
+			return results
+		end
+	`)))
+	
+	memoryManager := mmu.NewMMU(ltmMock.NewMockStore(), reasoningMock.NewMockEngine(), scriptEngine, mmu.DefaultConfig())
+	mockReflection := new(MockReflectionModule)
+	mockReflection.On("TriggerReflection", mock.Anything).Return([]*reflection.Insight{}, nil)
+	client := NewCogMem(memoryManager, reasoningMock.NewMockEngine(), scriptEngine, mockReflection, Config{
+		EnableReflection:    true,
+		ReflectionFrequency: 10,
+		ContextTokenBudget:  2000,
+		MaxPinnedMemories:   5,
+	})
+	
+	// Goroutines of the same entity and user share a session, so their turns interleave
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines*operations)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			entityID := entity.EntityID(fmt.Sprintf("entity-%d", g%entities))
+			entityCtx := entity.NewContext(entityID, fmt.Sprintf("user-%d", g%users))
+			entityCtx.SessionID = "shared-session"
+			ctx := entity.ContextWithEntity(context.Background(), entityCtx)
+			
+			for i := 0; i < operations; i++ {
+				var err error
+				switch i % 3 {
+				case 0:
+					_, err = client.Process(ctx, InputTypeStore, fmt.Sprintf("%s fact %d-%d", entityID, g, i))
+				case 1:
+					_, err = client.Process(ctx, InputTypeRetrieve, "fact")
+				case 2:
+					_, err = client.Process(ctx, InputTypeQuery, "What do you know?")
+				}
+				if err != nil {
+					errs <- err
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	
+	// Every entity counted exactly its own operations and sees only its own memories
+	perEntity := goroutines / entities * operations
+	for e := 0; e < entities; e++ {
+		entityID := entity.EntityID(fmt.Sprintf("entity-%d", e))
+		key := client.operations.keyFor(entity.NewContext(entityID, ""))
+		assert.Equal(t, perEntity+1, client.operations.increment(key), "operation count of %s", entityID)
+		
+		ctx := entity.ContextWithEntity(context.Background(), entity.NewContext(entityID, "user-0"))
+		options := mmu.DefaultRetrievalOptions()
+		options.MaxResults = 1000
+		memories, err := memoryManager.RetrieveFromLTM(ctx, "fact", options)
+		require.NoError(t, err)
+		facts := 0
+		for _, memory := range memories {
+			if memory.Metadata["type"] == "operation_history" {
+				for other := 0; other < entities; other++ {
+					if other != e {
+						assert.NotContains(t, memory.Content, fmt.Sprintf("entity-%d fact", other), "history of %s", entityID)
+					}
+				}
+				continue
+			}
+			assert.True(t, strings.HasPrefix(memory.Content, string(entityID)+" "), memory.Content)
+			assert.True(t, strings.HasPrefix(memory.Metadata["encoded_by"].(string), string(entityID)+"/"), "before_encode saw the caller's ctx")
+			facts++
+		}
+		assert.Equal(t, goroutines/entities, facts)
+		
+		for _, record := range memoryManager.WorkingMemory(ctx) {
+			assert.Equal(t, entityID, record.EntityID, "working memory of %s", entityID)
+		}
+	}
+	mockReflection.AssertNumberOfCalls(t, "TriggerReflection", entities*(perEntity/10))
+	
+	// Each user's shared session numbers its turns uniquely despite concurrent queries
+	for e := 0; e < entities; e++ {
+		for u := 0; u < users; u++ {
+			queries := 0
+			for g := 0; g < goroutines; g++ {
+				if g%entities == e && g%users == u {
+					queries++
+				}
+			}
+			
+			entityCtx := entity.NewContext(entity.EntityID(fmt.Sprintf("entity-%d", e)), fmt.Sprintf("user-%d", u))
+			entityCtx.SessionID = "shared-session"
+			turns, err := client.SessionTranscript(entity.ContextWithEntity(context.Background(), entityCtx), "")
+			require.NoError(t, err)
+			require.Len(t, turns, 2*queries)
+			for i, turn := range turns {
+				assert.Equal(t, i, turn.Index, "turn %d of entity-%d/user-%d", i, e, u)
+			}
+		}
+	}
+}
+
 func TestCogMemClient_ReflectionDisabled(t *testing.T) {
 	// Setup
 	mockMMU := new(MockMMU)
@@ -419,9 +871,10 @@ func TestCogMemClient_ReflectionDisabled(t *testing.T) {
 		},
 	)
 
-	// Create a context with entity information
+	// Create a context with entity information and a request ID, which Process keeps
 	entityCtx := entity.NewContext("test-entity", "test-user")
 	ctx := entity.ContextWithEntity(context.Background(), entityCtx)
+	ctx = scripting.WithRequestID(ctx, "test-request")
 
 	// Set up mock expectations for operation (no reflection)
 	mockMMU.On("RetrieveFromLTM", ctx, mock.Anything, mock.Anything).Return([]ltm.MemoryRecord{}, nil)
@@ -479,4 +932,72 @@ func TestNewCogMemFromConfig(t *testing.T) {
 	_, err = NewCogMemFromConfig("/path/does/not/exist.yaml")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to load configuration")
-}
\ No newline at end of file
+}
+
+func TestMMUConfig(t *testing.T) {
+	cfg := &config.Config{}
+	assert.False(t, mmuConfig(cfg).EnableImportanceScoring)
+	
+	cfg.Retrieval.ImportanceScoring = true
+	assert.True(t, mmuConfig(cfg).EnableImportanceScoring)
+	assert.Equal(t, mmu.DefaultConfig().WorkingMemoryLimit, mmuConfig(cfg).WorkingMemoryLimit)
+}
+
+func TestCogMemClient_QueryWithCitations_Importance(t *testing.T) {
+	ltmStore, err := chromem_go.NewChromemGoAdapterWithConfig(&chromem_go.ChromemGoConfig{Collection: "importance-test"})
+	require.NoError(t, err)
+	reasoningEngine := reasoningMock.NewMockEngine(reasoningMock.WithDefaultEmbedding([]float32{1, 0, 0, 0, 0}))
+	memoryManager := mmu.NewMMU(ltmStore, reasoningEngine, nil, mmu.DefaultConfig())
+	config := DefaultConfig()
+	config.EnableReflection = false
+	client := NewCogMem(memoryManager, reasoningEngine, nil, nil, config)
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	// The trivial memory is slightly closer to the question than the critical one
+	for _, record := range []ltm.MemoryRecord{
+		{ID: "trivial", Content: "The office plant was watered", Embedding: []float32{1, 0.1, 0, 0, 0}, Metadata: map[string]interface{}{mmu.MetadataKeyImportance: 2.0}},
+		{ID: "critical", Content: "The production API key was rotated", Embedding: []float32{1, 0.3, 0, 0, 0}, Metadata: map[string]interface{}{mmu.MetadataKeyImportance: 9.0}},
+	} {
+		record.EntityID = "test-entity"
+		record.AccessLevel = entity.SharedWithinEntity
+		_, err := ltmStore.Store(ctx, record)
+		require.NoError(t, err)
+	}
+	
+	_, result, err := client.QueryWithCitations(ctx, "What happened?")
+	require.NoError(t, err)
+	require.Len(t, result.Citations, 2)
+	assert.Equal(t, "critical", result.Citations[0].MemoryID)
+	assert.Equal(t, "trivial", result.Citations[1].MemoryID)
+}
+
+func TestInitScriptEngine_EntityScripts(t *testing.T) {
+	tempDir := t.TempDir()
+	tenantDir := filepath.Join(tempDir, "tenant-a")
+	require.NoError(t, os.Mkdir(tenantDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tenantDir, "hooks.lua"), []byte(`
+		function greet()
+			return "hello from tenant-a"
+		end
+	`), 0644))
+	
+	cfg := &config.Config{
+		Scripting: config.ScriptingConfig{
+			Paths:    []string{filepath.Join(tempDir, "global")},
+			Entities: map[string][]string{"tenant-a": {tenantDir}},
+		},
+	}
+	engine, err := initScriptEngine(cfg)
+	require.NoError(t, err)
+	defer engine.Close()
+	
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("tenant-a", "user"))
+	result, err := engine.ExecuteFunction(ctx, "greet")
+	require.NoError(t, err)
+	assert.Equal(t, "hello from tenant-a", result)
+	
+	// Entity scripts that cannot be loaded are an error
+	cfg.Scripting.Entities["tenant-b"] = []string{filepath.Join(tempDir, "missing")}
+	_, err = initScriptEngine(cfg)
+	assert.ErrorContains(t, err, "tenant-b")
+}
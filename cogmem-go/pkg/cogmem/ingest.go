@@ -0,0 +1,75 @@
+package cogmem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/ingest"
+	"github.com/lexlapax/cogmem/pkg/log"
+	"github.com/lexlapax/cogmem/pkg/mmu"
+)
+
+// ErrIngestionUnsupported is returned when the memory manager cannot split
+// documents into chunks.
+var ErrIngestionUnsupported = errors.New("memory manager does not support document ingestion")
+
+// IngestDocument stores a loaded document in long-term memory. Documents with
+// a chunking strategy are split into chunks linked to the whole document;
+// others, such as CSV rows, are stored as a single record.
+func (c *CogMemClientImpl) IngestDocument(ctx context.Context, doc ingest.Document) error {
+	if doc.Strategy == "" {
+		_, err := c.memoryManager.EncodeToLTM(ctx, map[string]interface{}{
+			"content":  doc.Content,
+			"metadata": doc.Metadata,
+		})
+		return err
+	}
+	
+	ingester, ok := c.memoryManager.(mmu.DocumentIngester)
+	if !ok {
+		return ErrIngestionUnsupported
+	}
+	options := mmu.DefaultIngestOptions()
+	options.Chunking.Strategy = doc.Strategy
+	options.Metadata = doc.Metadata
+	_, err := ingester.IngestDocument(ctx, doc.Content, options)
+	return err
+}
+
+// IngestPath loads every supported file under path, which may be a directory
+// or a single file, and stores its documents in long-term memory. Unless
+// options.KeyPrefix is set, file hashes are namespaced by the entity in the
+// context so the same files can be ingested for several entities. Unless
+// options.Remove is set, the memories stored from a changed file are removed
+// before it is ingested again.
+func (c *CogMemClientImpl) IngestPath(ctx context.Context, path string, options ingest.WalkOptions) (*ingest.WalkResult, error) {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return nil, entity.ErrMissingEntityContext
+	}
+	if options.KeyPrefix == "" {
+		options.KeyPrefix = string(entityCtx.EntityID) + ":"
+	}
+	if remover, ok := c.memoryManager.(mmu.MemoryRemover); ok && options.Remove == nil {
+		options.Remove = func(ctx context.Context, path string) error {
+			_, err := remover.RemoveByMetadata(ctx, map[string]interface{}{ingest.MetadataKeyPath: path})
+			return err
+		}
+	}
+	
+	result, err := ingest.Walk(ctx, path, options, c.IngestDocument)
+	if err != nil {
+		return result, fmt.Errorf("failed to ingest %s: %w", path, err)
+	}
+	
+	log.InfoContext(ctx, "Ingested documents",
+		"path", path,
+		"files", result.Files,
+		"skipped", result.Skipped,
+		"documents", result.Documents,
+		"failed", len(result.Failed))
+	
+	return result, nil
+}
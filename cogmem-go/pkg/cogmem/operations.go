@@ -0,0 +1,151 @@
+package cogmem
+
+import (
+	"sync"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+)
+
+const (
+	// maxOperationHistory is the number of recent operations kept per entity for reflection
+	maxOperationHistory = 10
+	
+	// operationShardCount is the number of independently locked shards the
+	// operation logs are split into
+	operationShardCount = 32
+	
+	// maxOperationLogsPerShard bounds the logs kept per shard; the least
+	// recently used log is evicted to make room for a new one
+	maxOperationLogsPerShard = 128
+)
+
+// OperationRecord represents a single operation performed by the client
+type OperationRecord struct {
+	InputType InputType `json:"input_type"`
+	Input     string    `json:"input"`
+	Response  string    `json:"response"`
+}
+
+// operationKey identifies whose operations are counted and reflected on together.
+type operationKey struct {
+	entityID entity.EntityID
+	userID   string
+}
+
+// operationLog holds the operation count and recent operations of one entity,
+// or of one user within an entity.
+type operationLog struct {
+	count    int
+	history  []OperationRecord
+	lastUsed uint64
+}
+
+// operationShard holds the operation logs of the entities that hash to it.
+type operationShard struct {
+	mutex   sync.Mutex
+	logs    map[operationKey]*operationLog
+	maxLogs int
+	
+	// tick orders log accesses for least recently used eviction
+	tick uint64
+}
+
+// operationTracker keeps the operation logs of every entity apart, so that
+// one entity's operations never appear in another's reflection. Logs are
+// sharded by entity so concurrent callers rarely contend for a lock, and each
+// shard keeps only its most recently used logs, so an evicted entity starts
+// counting again. It is safe for concurrent use.
+type operationTracker struct {
+	perUser bool
+	shards  [operationShardCount]operationShard
+}
+
+// newOperationTracker creates a tracker with a log per entity, or per user
+// within each entity if perUser is set.
+func newOperationTracker(perUser bool) *operationTracker {
+	tracker := &operationTracker{perUser: perUser}
+	for i := range tracker.shards {
+		tracker.shards[i].logs = make(map[operationKey]*operationLog)
+		tracker.shards[i].maxLogs = maxOperationLogsPerShard
+	}
+	return tracker
+}
+
+// keyFor returns the key of the log that operations in entityCtx belong to.
+func (t *operationTracker) keyFor(entityCtx entity.Context) operationKey {
+	key := operationKey{entityID: entityCtx.EntityID}
+	if t.perUser {
+		key.userID = entityCtx.UserID
+	}
+	return key
+}
+
+// shardFor returns the shard holding the log for key.
+func (t *operationTracker) shardFor(key operationKey) *operationShard {
+	return &t.shards[key.entityID.Shard(operationShardCount)]
+}
+
+// logFor returns the log for key, creating it if needed and evicting the least
+// recently used log when the shard is full. The caller must hold the shard's mutex.
+func (s *operationShard) logFor(key operationKey) *operationLog {
+	opLog, ok := s.logs[key]
+	if !ok {
+		if s.maxLogs > 0 && len(s.logs) >= s.maxLogs {
+			s.evictOldest()
+		}
+		opLog = &operationLog{history: make([]OperationRecord, 0, maxOperationHistory)}
+		s.logs[key] = opLog
+	}
+	s.tick++
+	opLog.lastUsed = s.tick
+	return opLog
+}
+
+// evictOldest removes the least recently used log. The caller must hold the shard's mutex.
+func (s *operationShard) evictOldest() {
+	var oldestKey operationKey
+	var oldest *operationLog
+	for key, opLog := range s.logs {
+		if oldest == nil || opLog.lastUsed < oldest.lastUsed {
+			oldestKey, oldest = key, opLog
+		}
+	}
+	if oldest != nil {
+		delete(s.logs, oldestKey)
+	}
+}
+
+// increment counts an operation for key and returns the new count.
+func (t *operationTracker) increment(key operationKey) int {
+	shard := t.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	opLog := shard.logFor(key)
+	opLog.count++
+	return opLog.count
+}
+
+// record adds a completed operation to the history for key, keeping the most
+// recent maxOperationHistory operations.
+func (t *operationTracker) record(key operationKey, record OperationRecord) {
+	shard := t.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	opLog := shard.logFor(key)
+	opLog.history = append(opLog.history, record)
+	if len(opLog.history) > maxOperationHistory {
+		opLog.history = opLog.history[len(opLog.history)-maxOperationHistory:]
+	}
+}
+
+// history returns a copy of the recent operations for key.
+func (t *operationTracker) history(key operationKey) []OperationRecord {
+	shard := t.shardFor(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	opLog, ok := shard.logs[key]
+	if !ok {
+		return nil
+	}
+	return append([]OperationRecord(nil), opLog.history...)
+}
@@ -0,0 +1,90 @@
+package cogmem
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/log"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/mmu"
+)
+
+// ErrEpisodicMemoryUnsupported is returned when the memory manager cannot
+// store conversation sessions.
+var ErrEpisodicMemoryUnsupported = errors.New("memory manager does not support episodic memory")
+
+// episodicMemory returns the memory manager's session support.
+func (c *CogMemClientImpl) episodicMemory() (mmu.EpisodicMemory, error) {
+	episodic, ok := c.memoryManager.(mmu.EpisodicMemory)
+	if !ok {
+		return nil, ErrEpisodicMemoryUnsupported
+	}
+	return episodic, nil
+}
+
+// SessionTranscript returns the turns of a session in order. An empty
+// sessionID uses the session in the context.
+func (c *CogMemClientImpl) SessionTranscript(ctx context.Context, sessionID string) ([]mmu.Turn, error) {
+	episodic, err := c.episodicMemory()
+	if err != nil {
+		return nil, err
+	}
+	if sessionID == "" {
+		sessionID = sessionIDFrom(ctx)
+	}
+	return episodic.SessionTranscript(ctx, sessionID)
+}
+
+// ListSessions returns the sessions of the user in the context, most
+// recently active first.
+func (c *CogMemClientImpl) ListSessions(ctx context.Context) ([]mmu.SessionSummary, error) {
+	episodic, err := c.episodicMemory()
+	if err != nil {
+		return nil, err
+	}
+	return episodic.ListSessions(ctx)
+}
+
+// SearchSessions retrieves the conversation turns most relevant to query using
+// semantic search, within one session or, if sessionID is empty, across all
+// of the user's sessions.
+func (c *CogMemClientImpl) SearchSessions(ctx context.Context, query string, sessionID string) ([]ltm.MemoryRecord, error) {
+	episodic, err := c.episodicMemory()
+	if err != nil {
+		return nil, err
+	}
+	options := mmu.DefaultRetrievalOptions()
+	options.Strategy = "semantic"
+	return episodic.SearchSessions(ctx, query, sessionID, options)
+}
+
+// recordTurns stores a query and its response as turns of the session in the
+// context. Queries outside a session, or with a memory manager that cannot
+// store sessions, are not recorded. Failures are logged since the response
+// has already been produced.
+func (c *CogMemClientImpl) recordTurns(ctx context.Context, input, response string, askedAt time.Time) {
+	sessionID := sessionIDFrom(ctx)
+	if sessionID == "" {
+		return
+	}
+	episodic, err := c.episodicMemory()
+	if err != nil {
+		return
+	}
+	
+	_, err = episodic.RecordTurns(ctx, sessionID,
+		mmu.Turn{Role: mmu.RoleUser, Content: input, Timestamp: askedAt},
+		mmu.Turn{Role: mmu.RoleAssistant, Content: response, Timestamp: time.Now()},
+	)
+	if err != nil {
+		log.WarnContext(ctx, "Failed to record conversation turns", "session_id", sessionID, "error", err)
+	}
+}
+
+// sessionIDFrom returns the session ID of the entity context in ctx, if any.
+func sessionIDFrom(ctx context.Context) string {
+	entityCtx, _ := entity.GetEntityContext(ctx)
+	return entityCtx.SessionID
+}
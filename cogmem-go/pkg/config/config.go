@@ -14,6 +14,9 @@ type Config struct {
 	// Reflection configures the reflection module
 	Reflection ReflectionConfig `yaml:"reflection"`
 	
+	// Retrieval configures how queries retrieve context from memory
+	Retrieval RetrievalConfig `yaml:"retrieval"`
+	
 	// Logging configures the logging behavior
 	Logging LoggingConfig `yaml:"logging"`
 }
@@ -79,6 +82,70 @@ type PostgresHStoreConfig struct {
 type ScriptingConfig struct {
 	// Paths is a list of directories containing Lua scripts
 	Paths []string `yaml:"paths"`
+	
+	// Entities maps entity IDs to directories or files of Lua scripts that
+	// override the global scripts for that entity
+	Entities map[string][]string `yaml:"entities"`
+	
+	// Engine configures the Lua engine that runs the scripts
+	Engine ScriptingEngineConfig `yaml:"engine"`
+}
+
+// ScriptingEngineConfig configures the Lua engine. Zero values keep the engine defaults.
+type ScriptingEngineConfig struct {
+	// EnableSandboxing restricts scripts to safe Lua libraries (default true)
+	EnableSandboxing *bool `yaml:"enable_sandboxing"`
+	
+	// ScriptTimeoutMs is the maximum execution time of a script function in milliseconds
+	ScriptTimeoutMs int `yaml:"script_timeout_ms"`
+	
+	// MaxMemoryMB is the maximum memory usage of a Lua state in megabytes
+	MaxMemoryMB int `yaml:"max_memory_mb"`
+	
+	// PoolSize is the number of Lua states that can run script functions in parallel
+	PoolSize int `yaml:"pool_size"`
+	
+	// MaxInstructions is the maximum number of Lua instructions per function call
+	MaxInstructions int64 `yaml:"max_instructions"`
+	
+	// MaxMemoryOps is the maximum number of cogmem.memory operations per function call
+	MaxMemoryOps int `yaml:"max_memory_ops"`
+	
+	// MaxLLMCalls is the maximum number of cogmem.llm calls per function call
+	MaxLLMCalls int `yaml:"max_llm_calls"`
+	
+	// MaxLLMTokens is the maximum number of tokens sent to and generated by cogmem.llm per function call
+	MaxLLMTokens int `yaml:"max_llm_tokens"`
+	
+	// CallStackSize caps the depth of Lua calls
+	CallStackSize int `yaml:"call_stack_size"`
+	
+	// RegistrySize caps the number of values on the Lua stack
+	RegistrySize int `yaml:"registry_size"`
+	
+	// HookLimits overrides the limits for individual hook functions, keyed by function name
+	HookLimits map[string]ScriptLimitsConfig `yaml:"hook_limits"`
+}
+
+// ScriptLimitsConfig bounds the resources of one hook function. Zero values keep the engine-wide limits.
+type ScriptLimitsConfig struct {
+	// ScriptTimeoutMs is the maximum execution time in milliseconds
+	ScriptTimeoutMs int `yaml:"script_timeout_ms"`
+	
+	// MaxMemoryMB is the maximum memory usage in MB
+	MaxMemoryMB int `yaml:"max_memory_mb"`
+	
+	// MaxInstructions is the maximum number of Lua instructions
+	MaxInstructions int64 `yaml:"max_instructions"`
+	
+	// MaxMemoryOps is the maximum number of cogmem.memory operations
+	MaxMemoryOps int `yaml:"max_memory_ops"`
+	
+	// MaxLLMCalls is the maximum number of cogmem.llm calls
+	MaxLLMCalls int `yaml:"max_llm_calls"`
+	
+	// MaxLLMTokens is the maximum number of cogmem.llm tokens
+	MaxLLMTokens int `yaml:"max_llm_tokens"`
 }
 
 // ReasoningConfig configures the reasoning engine (LLM).
@@ -158,9 +225,15 @@ type ReflectionConfig struct {
 	// TriggerFrequency is the number of interactions between reflection cycles
 	TriggerFrequency int `yaml:"trigger_frequency"`
 	
+	// PerUser counts interactions and reflects separately for each user within an entity
+	PerUser bool `yaml:"per_user"`
+	
 	// MaxMemoriesToAnalyze sets the maximum number of memories to include in analysis
 	MaxMemoriesToAnalyze int `yaml:"max_memories_to_analyze"`
 	
+	// MaxAnalysisTokens caps the tokens of memory content included in analysis (0 disables it)
+	MaxAnalysisTokens int `yaml:"max_analysis_tokens"`
+	
 	// AnalysisModel specifies the model to use for analysis (uses default if empty)
 	AnalysisModel string `yaml:"analysis_model"`
 	
@@ -168,6 +241,40 @@ type ReflectionConfig struct {
 	AnalysisTemperature float64 `yaml:"analysis_temperature"`
 }
 
+// RetrievalConfig configures how queries retrieve context from memory.
+type RetrievalConfig struct {
+	// Iterative enables multi-round retrieval with LLM-proposed follow-up queries
+	Iterative bool `yaml:"iterative"`
+	
+	// MaxRounds limits the rounds of an iterative retrieval
+	MaxRounds int `yaml:"max_rounds"`
+	
+	// TokenBudget caps the estimated tokens of context gathered by an iterative retrieval
+	TokenBudget int `yaml:"token_budget"`
+	
+	// Rerank enables LLM re-ranking of semantic retrieval results
+	Rerank bool `yaml:"rerank"`
+	
+	// RerankTopN is the number of leading results re-ranked
+	RerankTopN int `yaml:"rerank_top_n"`
+	
+	// RerankTimeoutMs bounds the re-ranking stage in milliseconds
+	RerankTimeoutMs int `yaml:"rerank_timeout_ms"`
+	
+	// ContextTokenBudget caps the tokens of memory context placed in query prompts
+	ContextTokenBudget int `yaml:"context_token_budget"`
+	
+	// ContextOrder arranges memories in query prompts ("score", "chronological")
+	ContextOrder string `yaml:"context_order"`
+	
+	// IncludePinned adds memories with "pinned: true" metadata to every query prompt
+	IncludePinned bool `yaml:"include_pinned"`
+	
+	// ImportanceScoring rates the importance of new memories with the LLM, so
+	// retrieval can rank important memories above slightly closer matches
+	ImportanceScoring bool `yaml:"importance_scoring"`
+}
+
 // LoggingConfig configures logging behavior.
 type LoggingConfig struct {
 	// Level is the logging level ("debug", "info", "warn", "error")
@@ -0,0 +1,264 @@
+package contextbuilder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/tokenizer"
+)
+
+// Order determines how included memories are arranged in the context.
+type Order string
+
+const (
+	// OrderScore lists memories by priority: pinned first, then retrieved
+	// memories in their ranked order, then working memory
+	OrderScore Order = "score"
+	
+	// OrderChronological lists memories from oldest to newest
+	OrderChronological Order = "chronological"
+)
+
+// Source identifies where a memory in the context came from.
+type Source string
+
+const (
+	// SourcePinned marks memories that should always be included when they fit
+	SourcePinned Source = "pinned"
+	
+	// SourceRetrieved marks memories retrieved from LTM for the query
+	SourceRetrieved Source = "retrieved"
+	
+	// SourceWorking marks memories held in working memory
+	SourceWorking Source = "working"
+)
+
+// Config contains configuration options for the ContextBuilder.
+type Config struct {
+	// TokenBudget is the maximum number of tokens for the memory context block
+	TokenBudget int
+	
+	// Tokenizer counts tokens (defaults to the heuristic tokenizer)
+	Tokenizer tokenizer.Tokenizer
+	
+	// Order determines how included memories are arranged
+	Order Order
+	
+	// Header introduces the memory context block
+	Header string
+}
+
+// DefaultConfig returns the default configuration for the ContextBuilder.
+func DefaultConfig() Config {
+	return Config{
+		TokenBudget: 2000,
+		Tokenizer:   tokenizer.NewHeuristic(),
+		Order:       OrderScore,
+		Header:      "Context from memory:",
+	}
+}
+
+// Input holds the memories competing for a place in the context. Pinned
+// memories are considered first, then retrieved memories in the order given,
+// then working memory from newest to oldest.
+type Input struct {
+	// Pinned are memories that should always be included when they fit
+	Pinned []ltm.MemoryRecord
+	
+	// Retrieved are memories retrieved from LTM for the query, most relevant first.
+	// Their order is kept, so re-ranking by a reranker or Lua hook carries through.
+	Retrieved []ltm.MemoryRecord
+	
+	// Working are records held in working memory
+	Working []ltm.MemoryRecord
+}
+
+// Citation maps a citation marker to the memory it cites.
+type Citation struct {
+	// Marker is the citation marker as it appears in the context, e.g. "[1]"
+	Marker string `json:"marker"`
+	
+	// MemoryID is the ID of the cited memory
+	MemoryID string `json:"memory_id"`
+	
+	// Source is where the memory came from
+	Source Source `json:"source"`
+}
+
+// Result is a built memory context.
+type Result struct {
+	// Context is the memory context block with a citation marker before each memory,
+	// empty when no memory was included
+	Context string
+	
+	// Citations lists the included memories in context order
+	Citations []Citation
+	
+	// Markers maps each citation marker to the cited memory ID
+	Markers map[string]string
+	
+	// Tokens is the token count of Context
+	Tokens int
+	
+	// Omitted lists the IDs of memories left out because they did not fit the budget
+	Omitted []string
+	
+	// Duplicates lists the IDs of memories left out as duplicates of included ones
+	Duplicates []string
+}
+
+// ContextBuilder fits memories into a token budget and formats them for a
+// prompt with stable citation markers.
+type ContextBuilder struct {
+	// config contains configuration options
+	config Config
+}
+
+// New creates a new ContextBuilder.
+func New(config Config) *ContextBuilder {
+	defaults := DefaultConfig()
+	if config.Tokenizer == nil {
+		config.Tokenizer = defaults.Tokenizer
+	}
+	if config.Order == "" {
+		config.Order = defaults.Order
+	}
+	if config.Header == "" {
+		config.Header = defaults.Header
+	}
+	
+	return &ContextBuilder{config: config}
+}
+
+// candidate is a memory competing for a place in the context
+type candidate struct {
+	record ltm.MemoryRecord
+	source Source
+}
+
+// Build selects memories from input that fit the token budget and formats
+// them as a context block. Memories are deduplicated by ID and by content.
+// Markers are numbered in context order, so the same input always yields the
+// same markers.
+func (b *ContextBuilder) Build(input Input) *Result {
+	result := &Result{
+		Citations: []Citation{},
+		Markers:   make(map[string]string),
+	}
+	
+	budget := b.config.TokenBudget
+	used := b.config.Tokenizer.CountTokens(b.config.Header + "\n")
+	
+	seenIDs := make(map[string]bool)
+	seenContent := make(map[string]bool)
+	var selected []candidate
+	
+	for _, c := range b.prioritize(input) {
+		content := normalizeContent(c.record.Content)
+		if content == "" {
+			continue
+		}
+		if (c.record.ID != "" && seenIDs[c.record.ID]) || seenContent[content] {
+			result.Duplicates = append(result.Duplicates, c.record.ID)
+			continue
+		}
+		
+		// Memories that do not fit are skipped so smaller ones can still be included
+		tokens := b.config.Tokenizer.CountTokens(formatLine(len(selected)+1, c.record.Content))
+		if budget > 0 && used+tokens > budget {
+			result.Omitted = append(result.Omitted, c.record.ID)
+			continue
+		}
+		
+		used += tokens
+		seenIDs[c.record.ID] = true
+		seenContent[content] = true
+		selected = append(selected, c)
+	}
+	
+	if len(selected) == 0 {
+		return result
+	}
+	
+	b.arrange(selected)
+	
+	var sb strings.Builder
+	sb.WriteString(b.config.Header)
+	sb.WriteString("\n")
+	for i, c := range selected {
+		marker := fmt.Sprintf("[%d]", i+1)
+		sb.WriteString(formatLine(i+1, c.record.Content))
+		result.Citations = append(result.Citations, Citation{
+			Marker:   marker,
+			MemoryID: c.record.ID,
+			Source:   c.source,
+		})
+		result.Markers[marker] = c.record.ID
+	}
+	
+	result.Context = sb.String()
+	result.Tokens = b.config.Tokenizer.CountTokens(result.Context)
+	return result
+}
+
+// BuildPrompt builds the memory context and wraps it in a question-answering
+// prompt that asks the model to cite memories by marker.
+func (b *ContextBuilder) BuildPrompt(question string, input Input) (string, *Result) {
+	result := b.Build(input)
+	if result.Context == "" {
+		return fmt.Sprintf("Please answer this question: %s", question), result
+	}
+	
+	prompt := fmt.Sprintf(
+		"Using the following context, please answer this question. "+
+			"When you use a memory, cite it with its marker, e.g. [1].\n\n%s\nQuestion: %s",
+		result.Context,
+		question,
+	)
+	return prompt, result
+}
+
+// prioritize orders candidates by their claim on the budget: pinned memories
+// and retrieved memories in the given order, then working memory from newest
+// to oldest.
+func (b *ContextBuilder) prioritize(input Input) []candidate {
+	candidates := make([]candidate, 0, len(input.Pinned)+len(input.Retrieved)+len(input.Working))
+	
+	for _, record := range input.Pinned {
+		candidates = append(candidates, candidate{record: record, source: SourcePinned})
+	}
+	
+	for _, record := range input.Retrieved {
+		candidates = append(candidates, candidate{record: record, source: SourceRetrieved})
+	}
+	
+	for i := len(input.Working) - 1; i >= 0; i-- {
+		candidates = append(candidates, candidate{record: input.Working[i], source: SourceWorking})
+	}
+	
+	return candidates
+}
+
+// arrange sorts the selected memories into the configured output order.
+func (b *ContextBuilder) arrange(selected []candidate) {
+	if b.config.Order != OrderChronological {
+		// Selection order already lists pinned memories first, then by rank
+		return
+	}
+	
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].record.CreatedAt.Before(selected[j].record.CreatedAt)
+	})
+}
+
+// formatLine formats a memory as a context line with its citation marker.
+func formatLine(number int, content string) string {
+	return fmt.Sprintf("[%d] %s\n", number, strings.TrimSpace(content))
+}
+
+// normalizeContent folds content for duplicate detection.
+func normalizeContent(content string) string {
+	return strings.ToLower(strings.Join(strings.Fields(content), " "))
+}
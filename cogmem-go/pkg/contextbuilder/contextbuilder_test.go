@@ -0,0 +1,114 @@
+package contextbuilder
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wordTokenizer counts whitespace-separated words, for predictable budgets
+type wordTokenizer struct{}
+
+func (wordTokenizer) Name() string { return "words" }
+
+func (wordTokenizer) CountTokens(text string) int { return len(strings.Fields(text)) }
+
+func TestContextBuilder_Build(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	input := Input{
+		Pinned: []ltm.MemoryRecord{
+			{ID: "pin", Content: "User prefers metric units", CreatedAt: base.Add(3 * time.Hour)},
+		},
+		Retrieved: []ltm.MemoryRecord{
+			{ID: "high", Content: "User met Alice in Paris", Score: 0.9, CreatedAt: base.Add(time.Hour)},
+			{ID: "dup", Content: "user  met Alice in Paris", Score: 0.8, CreatedAt: base.Add(2 * time.Hour)},
+			{ID: "low", Content: "User visited Paris", Score: 0.4, CreatedAt: base},
+		},
+		Working: []ltm.MemoryRecord{
+			{ID: "pin", Content: "User prefers metric units"},
+			{ID: "wm", Content: "Asked about restaurants", CreatedAt: base.Add(4 * time.Hour)},
+		},
+	}
+	
+	t.Run("orders by rank with pinned first", func(t *testing.T) {
+		builder := New(Config{Tokenizer: wordTokenizer{}})
+		result := builder.Build(input)
+		
+		ids := make([]string, len(result.Citations))
+		for i, citation := range result.Citations {
+			ids[i] = citation.MemoryID
+		}
+		assert.Equal(t, []string{"pin", "high", "low", "wm"}, ids)
+		assert.Equal(t, SourcePinned, result.Citations[0].Source)
+		assert.Equal(t, SourceWorking, result.Citations[3].Source)
+		assert.ElementsMatch(t, []string{"dup", "pin"}, result.Duplicates)
+		
+		assert.Equal(t, "high", result.Markers["[2]"])
+		assert.True(t, strings.HasPrefix(result.Context, "Context from memory:\n[1] User prefers metric units\n[2] User met Alice in Paris\n"))
+		assert.Equal(t, wordTokenizer{}.CountTokens(result.Context), result.Tokens)
+	})
+	
+	t.Run("keeps the retrieval order over scores", func(t *testing.T) {
+		// A reranker may place a lower-scored memory first
+		builder := New(Config{Tokenizer: wordTokenizer{}})
+		result := builder.Build(Input{Retrieved: []ltm.MemoryRecord{
+			{ID: "reranked-first", Content: "Alice recommended the bistro", Score: 0.3},
+			{ID: "reranked-second", Content: "User met Alice in Paris", Score: 0.9},
+		}})
+		
+		require.Len(t, result.Citations, 2)
+		assert.Equal(t, "reranked-first", result.Markers["[1]"])
+		assert.Equal(t, "reranked-second", result.Markers["[2]"])
+	})
+	
+	t.Run("fits the token budget", func(t *testing.T) {
+		// Header (3) + pinned (5) + high (6) uses the whole budget; "low" and "wm" (4 each) do not fit
+		builder := New(Config{Tokenizer: wordTokenizer{}, TokenBudget: 14})
+		result := builder.Build(input)
+		
+		require.Len(t, result.Citations, 2)
+		assert.LessOrEqual(t, result.Tokens, 14)
+		assert.Equal(t, []string{"low", "wm"}, result.Omitted)
+	})
+	
+	t.Run("chronological order", func(t *testing.T) {
+		builder := New(Config{Tokenizer: wordTokenizer{}, Order: OrderChronological})
+		result := builder.Build(input)
+		
+		ids := make([]string, len(result.Citations))
+		for i, citation := range result.Citations {
+			ids[i] = citation.MemoryID
+		}
+		assert.Equal(t, []string{"low", "high", "pin", "wm"}, ids)
+		assert.Equal(t, "low", result.Markers["[1]"])
+	})
+	
+	t.Run("markers are stable", func(t *testing.T) {
+		builder := New(DefaultConfig())
+		assert.Equal(t, builder.Build(input).Context, builder.Build(input).Context)
+	})
+	
+	t.Run("empty input", func(t *testing.T) {
+		result := New(DefaultConfig()).Build(Input{})
+		assert.Empty(t, result.Context)
+		assert.Empty(t, result.Citations)
+	})
+}
+
+func TestContextBuilder_BuildPrompt(t *testing.T) {
+	builder := New(DefaultConfig())
+	
+	prompt, result := builder.BuildPrompt("Where did I meet Alice?", Input{
+		Retrieved: []ltm.MemoryRecord{{ID: "m1", Content: "User met Alice in Paris"}},
+	})
+	assert.Contains(t, prompt, "[1] User met Alice in Paris")
+	assert.Contains(t, prompt, "Question: Where did I meet Alice?")
+	assert.Equal(t, map[string]string{"[1]": "m1"}, result.Markers)
+	
+	prompt, _ = builder.BuildPrompt("Where did I meet Alice?", Input{})
+	assert.Equal(t, "Please answer this question: Where did I meet Alice?", prompt)
+}
@@ -1,6 +1,9 @@
 package entity
 
-import "errors"
+import (
+	"errors"
+	"hash/fnv"
+)
 
 // Common errors related to entity operations
 var (
@@ -12,6 +15,17 @@ var (
 // Each entity has its own isolated memory space.
 type EntityID string
 
+// Shard maps the entity ID onto one of n shards, so that per-entity state can
+// be partitioned across independently locked shards.
+func (id EntityID) Shard(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(n))
+}
+
 // AccessLevel defines the visibility of memory records.
 type AccessLevel int
 
@@ -30,6 +44,9 @@ type Context struct {
 	
 	// UserID is optional and used for PrivateToUser access level filtering
 	UserID string
+	
+	// SessionID is optional and groups the turns of a conversation
+	SessionID string
 }
 
 // NewContext creates a new Context with the specified entity ID and optional user ID.
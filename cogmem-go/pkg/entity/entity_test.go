@@ -1,3 +1,22 @@
 package entity
 
-// Tests for entity types to be implemented
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntityID_Shard(t *testing.T) {
+	used := make(map[int]bool)
+	for _, id := range []EntityID{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		shard := id.Shard(4)
+		assert.GreaterOrEqual(t, shard, 0)
+		assert.Less(t, shard, 4)
+		assert.Equal(t, shard, id.Shard(4), "shards are stable")
+		used[shard] = true
+	}
+	assert.Greater(t, len(used), 1, "entities are spread across shards")
+	
+	assert.Equal(t, 0, EntityID("a").Shard(1))
+	assert.Equal(t, 0, EntityID("a").Shard(0))
+}
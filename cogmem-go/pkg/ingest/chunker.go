@@ -0,0 +1,384 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lexlapax/cogmem/pkg/tokenizer"
+)
+
+// Strategy names a way of splitting a document into chunks.
+type Strategy string
+
+const (
+	// StrategyTokenWindow splits text into windows of at most ChunkSize tokens,
+	// consecutive windows sharing about Overlap tokens
+	StrategyTokenWindow Strategy = "token_window"
+	
+	// StrategySentence groups whole sentences into chunks of at most ChunkSize tokens
+	StrategySentence Strategy = "sentence"
+	
+	// StrategyMarkdown splits Markdown at headings, dividing sections larger
+	// than ChunkSize tokens by sentence
+	StrategyMarkdown Strategy = "markdown"
+)
+
+// ErrUnknownStrategy is returned when a chunking strategy is not recognised.
+var ErrUnknownStrategy = errors.New("unknown chunking strategy")
+
+// Chunk is a contiguous piece of a document.
+type Chunk struct {
+	// Index is the position of the chunk in the document, starting at 0
+	Index int `json:"index"`
+	
+	// Content is the text of the chunk
+	Content string `json:"content"`
+	
+	// Start is the byte offset of the chunk in the document
+	Start int `json:"start"`
+	
+	// End is the byte offset just past the end of the chunk in the document
+	End int `json:"end"`
+	
+	// Heading is the Markdown heading of the section containing the chunk, if any
+	Heading string `json:"heading,omitempty"`
+}
+
+// Chunker splits documents into chunks.
+type Chunker interface {
+	// Chunk splits text into chunks in document order
+	Chunk(text string) []Chunk
+}
+
+// Config contains configuration options for chunking.
+type Config struct {
+	// Strategy determines how documents are split
+	Strategy Strategy
+	
+	// ChunkSize is the maximum number of tokens in a chunk
+	ChunkSize int
+	
+	// Overlap is the number of tokens consecutive token windows share
+	Overlap int
+	
+	// Tokenizer counts tokens (defaults to the heuristic tokenizer)
+	Tokenizer tokenizer.Tokenizer
+}
+
+// DefaultConfig returns the default configuration for chunking.
+func DefaultConfig() Config {
+	return Config{
+		Strategy:  StrategyTokenWindow,
+		ChunkSize: 512,
+		Overlap:   64,
+		Tokenizer: tokenizer.NewHeuristic(),
+	}
+}
+
+// New creates a Chunker for the configured strategy.
+func New(config Config) (Chunker, error) {
+	defaults := DefaultConfig()
+	if config.Strategy == "" {
+		config.Strategy = defaults.Strategy
+	}
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = defaults.ChunkSize
+	}
+	if config.Overlap < 0 || config.Overlap >= config.ChunkSize {
+		config.Overlap = 0
+	}
+	if config.Tokenizer == nil {
+		config.Tokenizer = defaults.Tokenizer
+	}
+	
+	switch config.Strategy {
+	case StrategyTokenWindow:
+		return &tokenWindowChunker{config: config}, nil
+	case StrategySentence:
+		return &sentenceChunker{config: config}, nil
+	case StrategyMarkdown:
+		return &markdownChunker{config: config}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownStrategy, config.Strategy)
+	}
+}
+
+// span is a half-open byte range of a document.
+type span struct {
+	start int
+	end   int
+}
+
+// tokenWindowChunker implements StrategyTokenWindow.
+type tokenWindowChunker struct {
+	config Config
+}
+
+// Chunk implements the Chunker interface.
+func (c *tokenWindowChunker) Chunk(text string) []Chunk {
+	var chunks []Chunk
+	for _, s := range windowSpans(text, span{0, len(text)}, c.config) {
+		chunks = appendChunk(chunks, text, s, "")
+	}
+	return chunks
+}
+
+// windowSpans splits a region of text into word-aligned windows of at most
+// ChunkSize tokens, stepping back about Overlap tokens between windows.
+// A single word larger than ChunkSize becomes a window of its own.
+func windowSpans(text string, region span, config Config) []span {
+	words := wordSpans(text, region)
+	if len(words) == 0 {
+		return nil
+	}
+	
+	// Count each word together with the whitespace before it so the sum
+	// approximates the count of the joined text
+	counts := make([]int, len(words))
+	prev := region.start
+	for i, w := range words {
+		counts[i] = config.Tokenizer.CountTokens(text[prev:w.end])
+		prev = w.end
+	}
+	
+	var windows []span
+	for first := 0; first < len(words); {
+		last := first
+		total := counts[first]
+		for last+1 < len(words) && total+counts[last+1] <= config.ChunkSize {
+			last++
+			total += counts[last]
+		}
+		windows = append(windows, span{words[first].start, words[last].end})
+		if last == len(words)-1 {
+			break
+		}
+		
+		// Start the next window far enough back to share Overlap tokens,
+		// while always making progress
+		next := last + 1
+		overlap := 0
+		for next-1 > first && overlap+counts[next-1] <= config.Overlap {
+			next--
+			overlap += counts[next]
+		}
+		first = next
+	}
+	return windows
+}
+
+// wordSpans returns the whitespace-separated words of a region of text.
+func wordSpans(text string, region span) []span {
+	var words []span
+	start := -1
+	for i := region.start; i < region.end; {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				words = append(words, span{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+		i += size
+	}
+	if start >= 0 {
+		words = append(words, span{start, region.end})
+	}
+	return words
+}
+
+// sentenceChunker implements StrategySentence.
+type sentenceChunker struct {
+	config Config
+}
+
+// Chunk implements the Chunker interface.
+func (c *sentenceChunker) Chunk(text string) []Chunk {
+	var chunks []Chunk
+	for _, s := range sentenceGroupSpans(text, span{0, len(text)}, c.config) {
+		chunks = appendChunk(chunks, text, s, "")
+	}
+	return chunks
+}
+
+// sentenceGroupSpans groups consecutive sentences of a region of text into
+// spans of at most ChunkSize tokens. Sentences larger than ChunkSize are
+// split into token windows.
+func sentenceGroupSpans(text string, region span, config Config) []span {
+	var groups []span
+	current := span{-1, -1}
+	for _, sentence := range sentenceSpans(text, region) {
+		count := config.Tokenizer.CountTokens(text[sentence.start:sentence.end])
+		if count > config.ChunkSize {
+			if current.start >= 0 {
+				groups = append(groups, current)
+				current = span{-1, -1}
+			}
+			windowConfig := config
+			windowConfig.Overlap = 0
+			groups = append(groups, windowSpans(text, sentence, windowConfig)...)
+			continue
+		}
+		
+		if current.start >= 0 {
+			joined := config.Tokenizer.CountTokens(text[current.start:sentence.end])
+			if joined <= config.ChunkSize {
+				current.end = sentence.end
+				continue
+			}
+			groups = append(groups, current)
+		}
+		current = sentence
+	}
+	if current.start >= 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// sentenceSpans splits a region of text into sentences. A sentence ends at
+// '.', '!' or '?' followed by whitespace, or at a blank line.
+func sentenceSpans(text string, region span) []span {
+	var sentences []span
+	start := region.start
+	for i := region.start; i < region.end; {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		next := i + size
+		
+		end := -1
+		switch {
+		case r == '.' || r == '!' || r == '?':
+			// Keep runs of terminators and closing quotes with the sentence
+			for next < region.end && strings.ContainsRune(`.!?"')]`, rune(text[next])) {
+				next++
+			}
+			if next == region.end || isSpaceAt(text, next) {
+				end = next
+			}
+		case r == '\n' && strings.HasPrefix(strings.TrimLeft(text[next:region.end], " \t\r"), "\n"):
+			end = i
+		}
+		
+		if end >= 0 {
+			if s, ok := trimSpan(text, span{start, end}); ok {
+				sentences = append(sentences, s)
+			}
+			start = end
+		}
+		i = next
+	}
+	if s, ok := trimSpan(text, span{start, region.end}); ok {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+// markdownChunker implements StrategyMarkdown.
+type markdownChunker struct {
+	config Config
+}
+
+// Chunk implements the Chunker interface.
+func (c *markdownChunker) Chunk(text string) []Chunk {
+	var chunks []Chunk
+	for _, section := range markdownSections(text) {
+		s, ok := trimSpan(text, section.span)
+		if !ok {
+			continue
+		}
+		if c.config.Tokenizer.CountTokens(text[s.start:s.end]) <= c.config.ChunkSize {
+			chunks = appendChunk(chunks, text, s, section.heading)
+			continue
+		}
+		for _, part := range sentenceGroupSpans(text, s, c.config) {
+			chunks = appendChunk(chunks, text, part, section.heading)
+		}
+	}
+	return chunks
+}
+
+// markdownSection is a heading and the text up to the next heading.
+type markdownSection struct {
+	span
+	heading string
+}
+
+// markdownSections splits Markdown text at ATX headings ("# Title"),
+// ignoring lines inside fenced code blocks.
+func markdownSections(text string) []markdownSection {
+	var sections []markdownSection
+	current := markdownSection{}
+	inFence := false
+	for offset := 0; offset < len(text); {
+		lineEnd := strings.IndexByte(text[offset:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += offset + 1
+		}
+		line := strings.TrimSpace(text[offset:lineEnd])
+		
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			inFence = !inFence
+		} else if heading, ok := parseHeading(line); ok && !inFence {
+			if offset > current.start {
+				current.end = offset
+				sections = append(sections, current)
+			}
+			current = markdownSection{span: span{start: offset}, heading: heading}
+		}
+		offset = lineEnd
+	}
+	current.end = len(text)
+	if current.end > current.start {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// parseHeading returns the title of a Markdown ATX heading line.
+func parseHeading(line string) (string, bool) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 {
+		return "", false
+	}
+	if level < len(line) && line[level] != ' ' && line[level] != '\t' {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimRight(line[level:], "#")), true
+}
+
+// appendChunk appends the span of text as the next chunk.
+func appendChunk(chunks []Chunk, text string, s span, heading string) []Chunk {
+	return append(chunks, Chunk{
+		Index:   len(chunks),
+		Content: text[s.start:s.end],
+		Start:   s.start,
+		End:     s.end,
+		Heading: heading,
+	})
+}
+
+// trimSpan narrows a span to exclude surrounding whitespace, reporting false
+// if nothing remains.
+func trimSpan(text string, s span) (span, bool) {
+	content := text[s.start:s.end]
+	trimmed := strings.TrimLeftFunc(content, unicode.IsSpace)
+	s.start += len(content) - len(trimmed)
+	s.end = s.start + len(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+	return s, s.end > s.start
+}
+
+// isSpaceAt reports whether text has a whitespace rune at byte offset i.
+func isSpaceAt(text string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return unicode.IsSpace(r)
+}
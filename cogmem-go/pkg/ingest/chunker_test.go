@@ -0,0 +1,113 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wordTokenizer counts one token per whitespace-separated word
+type wordTokenizer struct{}
+
+func (wordTokenizer) Name() string { return "words" }
+
+func (wordTokenizer) CountTokens(text string) int { return len(strings.Fields(text)) }
+
+func newTestChunker(t *testing.T, strategy Strategy, size, overlap int) Chunker {
+	chunker, err := New(Config{Strategy: strategy, ChunkSize: size, Overlap: overlap, Tokenizer: wordTokenizer{}})
+	require.NoError(t, err)
+	return chunker
+}
+
+// assertOffsets checks that every chunk's offsets locate its content in the document
+func assertOffsets(t *testing.T, text string, chunks []Chunk) {
+	for i, chunk := range chunks {
+		assert.Equal(t, i, chunk.Index)
+		assert.Equal(t, chunk.Content, text[chunk.Start:chunk.End])
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{Strategy: "paragraph"})
+	assert.ErrorIs(t, err, ErrUnknownStrategy)
+	
+	chunker, err := New(Config{})
+	require.NoError(t, err)
+	assert.IsType(t, &tokenWindowChunker{}, chunker)
+}
+
+func TestTokenWindowChunker(t *testing.T) {
+	text := "one two three four five six seven eight nine ten"
+	
+	t.Run("windows with overlap", func(t *testing.T) {
+		chunks := newTestChunker(t, StrategyTokenWindow, 4, 1).Chunk(text)
+		require.Len(t, chunks, 3)
+		assert.Equal(t, "one two three four", chunks[0].Content)
+		assert.Equal(t, "four five six seven", chunks[1].Content)
+		assert.Equal(t, "seven eight nine ten", chunks[2].Content)
+		assertOffsets(t, text, chunks)
+	})
+	
+	t.Run("windows without overlap", func(t *testing.T) {
+		chunks := newTestChunker(t, StrategyTokenWindow, 4, 0).Chunk(text)
+		require.Len(t, chunks, 3)
+		assert.Equal(t, "nine ten", chunks[2].Content)
+		assertOffsets(t, text, chunks)
+	})
+	
+	t.Run("empty text", func(t *testing.T) {
+		assert.Empty(t, newTestChunker(t, StrategyTokenWindow, 4, 1).Chunk("  \n "))
+	})
+}
+
+func TestSentenceChunker(t *testing.T) {
+	t.Run("groups sentences", func(t *testing.T) {
+		text := "The cat sat. It was happy! Was the dog there? No.\n\nA new paragraph without a stop"
+		chunks := newTestChunker(t, StrategySentence, 6, 0).Chunk(text)
+		require.Len(t, chunks, 3)
+		assert.Equal(t, "The cat sat. It was happy!", chunks[0].Content)
+		assert.Equal(t, "Was the dog there? No.", chunks[1].Content)
+		assert.Equal(t, "A new paragraph without a stop", chunks[2].Content)
+		assertOffsets(t, text, chunks)
+	})
+	
+	t.Run("splits long sentences", func(t *testing.T) {
+		text := "Short one. This sentence has far too many words to fit."
+		chunks := newTestChunker(t, StrategySentence, 4, 0).Chunk(text)
+		require.Len(t, chunks, 4)
+		assert.Equal(t, "Short one.", chunks[0].Content)
+		assert.Equal(t, "This sentence has far", chunks[1].Content)
+		assert.Equal(t, "fit.", chunks[3].Content)
+		assertOffsets(t, text, chunks)
+	})
+}
+
+func TestMarkdownChunker(t *testing.T) {
+	text := strings.Join([]string{
+		"Intro text.",
+		"",
+		"# Setup",
+		"Install it.",
+		"",
+		"```sh",
+		"# not a heading",
+		"```",
+		"",
+		"## Usage ##",
+		"Run it. Then check the output. Finally clean up after yourself.",
+	}, "\n")
+	
+	chunks := newTestChunker(t, StrategyMarkdown, 10, 0).Chunk(text)
+	require.Len(t, chunks, 4)
+	assert.Equal(t, "Intro text.", chunks[0].Content)
+	assert.Equal(t, "", chunks[0].Heading)
+	assert.Equal(t, "# Setup\nInstall it.\n\n```sh\n# not a heading\n```", chunks[1].Content)
+	assert.Equal(t, "Setup", chunks[1].Heading)
+	assert.Equal(t, "## Usage ##\nRun it. Then check the output.", chunks[2].Content)
+	assert.Equal(t, "Usage", chunks[2].Heading)
+	assert.Equal(t, "Finally clean up after yourself.", chunks[3].Content)
+	assert.Equal(t, "Usage", chunks[3].Heading)
+	assertOffsets(t, text, chunks)
+}
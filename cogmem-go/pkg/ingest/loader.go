@@ -0,0 +1,617 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// MetadataKeyPath is the metadata key holding the file a document was loaded from
+	MetadataKeyPath = "path"
+	
+	// MetadataKeyTitle is the metadata key holding a document's title
+	MetadataKeyTitle = "title"
+	
+	// MetadataKeyFormat is the metadata key holding the format a document was loaded from
+	MetadataKeyFormat = "format"
+	
+	// MetadataKeyHeadings is the metadata key holding the headings of a document, in order
+	MetadataKeyHeadings = "headings"
+	
+	// MetadataKeyRow is the metadata key holding the 1-based data row of a CSV document
+	MetadataKeyRow = "row"
+	
+	// MetadataKeyLine is the metadata key holding the 1-based line of a JSONL document
+	MetadataKeyLine = "line"
+	
+	// MetadataKeyContentHash is the metadata key holding the SHA-256 of the file a
+	// walked document was loaded from, identifying records from earlier versions
+	MetadataKeyContentHash = "content_hash"
+)
+
+// Supported document formats
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatCSV      = "csv"
+	FormatJSONL    = "jsonl"
+	FormatText     = "text"
+)
+
+// ErrUnsupportedFormat is returned when no loader handles a file's extension.
+var ErrUnsupportedFormat = errors.New("unsupported document format")
+
+// Document is a unit of content loaded from a file, ready to be stored in memory.
+type Document struct {
+	// Path is the file the document was loaded from
+	Path string
+	
+	// Title is the document's title, if known
+	Title string
+	
+	// Content is the text of the document
+	Content string
+	
+	// Metadata describes the document, including its path, title and format
+	Metadata map[string]interface{}
+	
+	// Strategy is how the document should be chunked; empty stores it as a single record
+	Strategy Strategy
+}
+
+// Loader turns the contents of a file into documents.
+type Loader interface {
+	// Load reads a file's contents and returns the documents in it
+	Load(r io.Reader, path string) ([]Document, error)
+}
+
+// LoaderConfig contains configuration options for the format loaders.
+type LoaderConfig struct {
+	// CSVTemplate is a text/template rendered for each CSV row, with the row's
+	// columns available by header name (e.g. "{{.name}} lives in {{.city}}").
+	// Empty renders one "header: value" line per column.
+	CSVTemplate string
+	
+	// JSONLContentField is the field holding the content of each JSONL record.
+	// Empty uses "content" or "text"; records without it are stored as JSON.
+	JSONLContentField string
+	
+	// JSONLTitleField is the field holding the title of each JSONL record
+	JSONLTitleField string
+	
+	// JSONLMetadataFields are the fields copied into each JSONL record's
+	// metadata. Empty copies every other scalar field.
+	JSONLMetadataFields []string
+}
+
+// DefaultLoaderConfig returns the default configuration for the format loaders.
+func DefaultLoaderConfig() LoaderConfig {
+	return LoaderConfig{
+		JSONLTitleField: "title",
+	}
+}
+
+// LoaderFor returns the loader for a file based on its extension.
+func LoaderFor(path string, config LoaderConfig) (Loader, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return &MarkdownLoader{}, nil
+	case ".html", ".htm":
+		return &HTMLLoader{}, nil
+	case ".csv":
+		return &CSVLoader{Template: config.CSVTemplate}, nil
+	case ".jsonl", ".ndjson":
+		return &JSONLLoader{
+			ContentField:   config.JSONLContentField,
+			TitleField:     config.JSONLTitleField,
+			MetadataFields: config.JSONLMetadataFields,
+		}, nil
+	case ".txt", ".text":
+		return &TextLoader{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, path)
+	}
+}
+
+// newDocument creates a document with the common metadata set.
+func newDocument(path, format, title, content string, strategy Strategy) Document {
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return Document{
+		Path:    path,
+		Title:   title,
+		Content: content,
+		Metadata: map[string]interface{}{
+			MetadataKeyPath:   path,
+			MetadataKeyTitle:  title,
+			MetadataKeyFormat: format,
+		},
+		Strategy: strategy,
+	}
+}
+
+// TextLoader loads plain text files as a single document chunked by sentence.
+type TextLoader struct{}
+
+// Load implements the Loader interface.
+func (l *TextLoader) Load(r io.Reader, path string) ([]Document, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	text := strings.TrimSpace(string(content))
+	if text == "" {
+		return nil, nil
+	}
+	return []Document{newDocument(path, FormatText, "", text, StrategySentence)}, nil
+}
+
+// MarkdownLoader loads Markdown files as a single document chunked by heading.
+// YAML front-matter is parsed into the document's metadata, and its "title"
+// field takes precedence over the first heading.
+type MarkdownLoader struct{}
+
+// Load implements the Loader interface.
+func (l *MarkdownLoader) Load(r io.Reader, path string) ([]Document, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	
+	frontMatter, body, err := splitFrontMatter(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse front-matter of %s: %w", path, err)
+	}
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, nil
+	}
+	
+	var headings []interface{}
+	for _, section := range markdownSections(body) {
+		if section.heading != "" {
+			headings = append(headings, section.heading)
+		}
+	}
+	
+	title, _ := frontMatter[MetadataKeyTitle].(string)
+	if title == "" && len(headings) > 0 {
+		title = headings[0].(string)
+	}
+	
+	doc := newDocument(path, FormatMarkdown, title, body, StrategyMarkdown)
+	for key, value := range frontMatter {
+		if _, reserved := doc.Metadata[key]; !reserved {
+			doc.Metadata[key] = value
+		}
+	}
+	if len(headings) > 0 {
+		doc.Metadata[MetadataKeyHeadings] = headings
+	}
+	return []Document{doc}, nil
+}
+
+// splitFrontMatter separates YAML front-matter delimited by "---" lines from
+// the rest of a Markdown document.
+func splitFrontMatter(content string) (map[string]interface{}, string, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	if !strings.HasPrefix(content, "---\n") && !strings.HasPrefix(content, "---\r\n") {
+		return nil, content, nil
+	}
+	
+	rest := content[strings.IndexByte(content, '\n')+1:]
+	for offset := 0; offset < len(rest); {
+		lineEnd := strings.IndexByte(rest[offset:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(rest)
+		} else {
+			lineEnd += offset + 1
+		}
+		line := strings.TrimRight(rest[offset:lineEnd], "\r\n")
+		if line == "---" || line == "..." {
+			frontMatter := make(map[string]interface{})
+			if err := yaml.Unmarshal([]byte(rest[:offset]), &frontMatter); err != nil {
+				return nil, "", err
+			}
+			return frontMatter, rest[lineEnd:], nil
+		}
+		offset = lineEnd
+	}
+	
+	// An unterminated block is not front-matter
+	return nil, content, nil
+}
+
+// HTMLLoader loads HTML files as a single document chunked by heading. Tags
+// are stripped, scripts and styles dropped, and structure is kept by writing
+// headings as Markdown headings, list items as "- " lines and blocks as
+// paragraphs.
+type HTMLLoader struct{}
+
+// Load implements the Loader interface.
+func (l *HTMLLoader) Load(r io.Reader, path string) ([]Document, error) {
+	root, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	
+	w := &htmlTextWriter{}
+	if title := findElement(root, "title"); title != nil {
+		w.title = strings.Join(strings.Fields(nodeText(title)), " ")
+	}
+	w.walk(root)
+	content := w.text()
+	if content == "" {
+		return nil, nil
+	}
+	
+	title := w.title
+	if title == "" && len(w.headings) > 0 {
+		title = w.headings[0].(string)
+	}
+	
+	doc := newDocument(path, FormatHTML, title, content, StrategyMarkdown)
+	if len(w.headings) > 0 {
+		doc.Metadata[MetadataKeyHeadings] = w.headings
+	}
+	return []Document{doc}, nil
+}
+
+// htmlSkippedElements are not rendered as text
+var htmlSkippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "iframe": true, "object": true, "head": true,
+}
+
+// htmlBlockElements start and end a paragraph
+var htmlBlockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true,
+	"header": true, "footer": true, "nav": true, "aside": true, "blockquote": true,
+	"table": true, "ul": true, "ol": true, "dl": true, "dt": true,
+	"dd": true, "figure": true, "figcaption": true, "pre": true, "form": true,
+	"address": true, "details": true, "summary": true, "hr": true,
+}
+
+// htmlTextWriter renders an HTML tree as structured plain text.
+type htmlTextWriter struct {
+	buf      []byte
+	title    string
+	headings []interface{}
+	inPre    int
+}
+
+// walk renders a node and its children.
+func (w *htmlTextWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.writeText(n.Data)
+		return
+	case html.ElementNode:
+		if htmlSkippedElements[n.Data] {
+			return
+		}
+		if level := headingLevel(n.Data); level > 0 {
+			heading := strings.Join(strings.Fields(nodeText(n)), " ")
+			if heading != "" {
+				w.headings = append(w.headings, heading)
+				w.breakLines(2)
+				w.buf = append(w.buf, strings.Repeat("#", level)+" "+heading...)
+				w.breakLines(2)
+			}
+			return
+		}
+		
+		switch {
+		case n.Data == "br" || n.Data == "tr":
+			w.breakLines(1)
+		case n.Data == "li":
+			w.breakLines(1)
+			w.buf = append(w.buf, "- "...)
+		case n.Data == "td" || n.Data == "th":
+			if n.PrevSibling != nil {
+				w.buf = append(w.buf, " | "...)
+			}
+		case htmlBlockElements[n.Data]:
+			w.breakLines(2)
+		}
+		if n.Data == "pre" {
+			w.inPre++
+			defer func() { w.inPre-- }()
+		}
+	}
+	
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		w.walk(child)
+	}
+	
+	if n.Type == html.ElementNode && (htmlBlockElements[n.Data] || n.Data == "li" || n.Data == "tr") {
+		w.breakLines(1)
+	}
+}
+
+// writeText appends text, collapsing whitespace outside of <pre> blocks.
+func (w *htmlTextWriter) writeText(text string) {
+	if w.inPre > 0 {
+		w.buf = append(w.buf, text...)
+		return
+	}
+	fields := strings.Fields(text)
+	if text != "" && isHTMLSpace(text[0]) {
+		w.space()
+	}
+	if len(fields) == 0 {
+		return
+	}
+	w.buf = append(w.buf, strings.Join(fields, " ")...)
+	if isHTMLSpace(text[len(text)-1]) {
+		w.space()
+	}
+}
+
+// space separates the next text from the previous text on the same line.
+func (w *htmlTextWriter) space() {
+	if n := len(w.buf); n > 0 && w.buf[n-1] != ' ' && w.buf[n-1] != '\n' {
+		w.buf = append(w.buf, ' ')
+	}
+}
+
+// breakLines ends the current line and ensures at least n line breaks.
+func (w *htmlTextWriter) breakLines(n int) {
+	for len(w.buf) > 0 && w.buf[len(w.buf)-1] == ' ' {
+		w.buf = w.buf[:len(w.buf)-1]
+	}
+	if len(w.buf) == 0 {
+		return
+	}
+	existing := 0
+	for existing < len(w.buf) && w.buf[len(w.buf)-1-existing] == '\n' {
+		existing++
+	}
+	for ; existing < n; existing++ {
+		w.buf = append(w.buf, '\n')
+	}
+}
+
+// text returns the rendered text with trailing spaces and extra blank lines removed.
+func (w *htmlTextWriter) text() string {
+	lines := strings.Split(string(w.buf), "\n")
+	kept := make([]string, 0, len(lines))
+	blank := 0
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			blank++
+			if blank > 1 {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// findElement returns the first element with the given tag in document order.
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// nodeText returns the concatenated text of a node's descendants.
+func nodeText(n *html.Node) string {
+	var buf strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+			buf.WriteByte(' ')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(n)
+	return buf.String()
+}
+
+// headingLevel returns 1-6 for h1-h6 elements and 0 otherwise.
+func headingLevel(tag string) int {
+	if len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6' {
+		return int(tag[1] - '0')
+	}
+	return 0
+}
+
+// isHTMLSpace reports whether b is HTML inter-element whitespace.
+func isHTMLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+// CSVLoader loads each row of a CSV file with a header row as its own
+// single-record document, rendering the row's content with a template.
+type CSVLoader struct {
+	// Template renders each row; see LoaderConfig.CSVTemplate
+	Template string
+}
+
+// Load implements the Loader interface.
+func (l *CSVLoader) Load(r io.Reader, path string) ([]Document, error) {
+	var tmpl *template.Template
+	if l.Template != "" {
+		var err error
+		tmpl, err = template.New("row").Option("missingkey=zero").Parse(l.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV row template: %w", err)
+		}
+	}
+	
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header of %s: %w", path, err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+	
+	var docs []Document
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return docs, fmt.Errorf("failed to read row %d of %s: %w", row, path, err)
+		}
+		
+		values := make(map[string]string, len(header))
+		empty := true
+		for i, column := range header {
+			if i < len(record) {
+				values[column] = record[i]
+				empty = empty && strings.TrimSpace(record[i]) == ""
+			}
+		}
+		if empty {
+			continue
+		}
+		
+		var content string
+		if tmpl != nil {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, values); err != nil {
+				return docs, fmt.Errorf("failed to render row %d of %s: %w", row, path, err)
+			}
+			content = buf.String()
+		} else {
+			lines := make([]string, 0, len(header))
+			for _, column := range header {
+				if value := strings.TrimSpace(values[column]); value != "" {
+					lines = append(lines, column+": "+value)
+				}
+			}
+			content = strings.Join(lines, "\n")
+		}
+		content = strings.TrimSpace(content)
+		if content == "" {
+			continue
+		}
+		
+		doc := newDocument(path, FormatCSV, values["title"], content, "")
+		doc.Metadata[MetadataKeyRow] = row
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// JSONLLoader loads each line of a JSON Lines file as its own single-record
+// document, mapping fields to content, title and metadata.
+type JSONLLoader struct {
+	// ContentField is the field holding the content; see LoaderConfig.JSONLContentField
+	ContentField string
+	
+	// TitleField is the field holding the title
+	TitleField string
+	
+	// MetadataFields are the fields copied into metadata; see LoaderConfig.JSONLMetadataFields
+	MetadataFields []string
+}
+
+// Load implements the Loader interface.
+func (l *JSONLLoader) Load(r io.Reader, path string) ([]Document, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	
+	var docs []Document
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		
+		var fields map[string]interface{}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return docs, fmt.Errorf("invalid JSON on line %d of %s: %w", line, path, err)
+		}
+		
+		contentField := l.ContentField
+		if contentField == "" {
+			contentField = "content"
+			if _, ok := fields[contentField]; !ok {
+				contentField = "text"
+			}
+		}
+		content, ok := fields[contentField].(string)
+		if !ok {
+			contentField = ""
+			content = string(raw)
+		}
+		content = strings.TrimSpace(content)
+		if content == "" {
+			continue
+		}
+		
+		title, _ := fields[l.TitleField].(string)
+		doc := newDocument(path, FormatJSONL, title, content, "")
+		doc.Metadata[MetadataKeyLine] = line
+		
+		for _, field := range l.metadataFields(fields, contentField) {
+			if _, reserved := doc.Metadata[field]; reserved {
+				continue
+			}
+			if value, ok := fields[field]; ok {
+				doc.Metadata[field] = value
+			}
+		}
+		docs = append(docs, doc)
+	}
+	if err := scanner.Err(); err != nil {
+		return docs, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return docs, nil
+}
+
+// metadataFields returns the configured metadata fields, or every scalar
+// field other than the content field if none are configured.
+func (l *JSONLLoader) metadataFields(fields map[string]interface{}, contentField string) []string {
+	if len(l.MetadataFields) > 0 {
+		return l.MetadataFields
+	}
+	var names []string
+	for name, value := range fields {
+		if name == contentField {
+			continue
+		}
+		switch value.(type) {
+		case string, float64, bool:
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,138 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadOne(t *testing.T, loader Loader, path, content string) Document {
+	docs, err := loader.Load(strings.NewReader(content), path)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	return docs[0]
+}
+
+func TestLoaderFor(t *testing.T) {
+	for path, expected := range map[string]Loader{
+		"a/notes.md":   &MarkdownLoader{},
+		"page.HTML":    &HTMLLoader{},
+		"rows.csv":     &CSVLoader{},
+		"events.jsonl": &JSONLLoader{},
+		"readme.txt":   &TextLoader{},
+	} {
+		loader, err := LoaderFor(path, LoaderConfig{})
+		require.NoError(t, err, path)
+		assert.IsType(t, expected, loader, path)
+	}
+	
+	_, err := LoaderFor("image.png", LoaderConfig{})
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestMarkdownLoader(t *testing.T) {
+	t.Run("front-matter", func(t *testing.T) {
+		content := "---\ntitle: Deploy Guide\ntags: [ops]\nformat: ignored\n---\n# Overview\nText.\n\n## Steps\nMore."
+		doc := loadOne(t, &MarkdownLoader{}, "docs/deploy.md", content)
+		assert.Equal(t, "Deploy Guide", doc.Title)
+		assert.Equal(t, "# Overview\nText.\n\n## Steps\nMore.", doc.Content)
+		assert.Equal(t, StrategyMarkdown, doc.Strategy)
+		assert.Equal(t, "docs/deploy.md", doc.Metadata[MetadataKeyPath])
+		assert.Equal(t, FormatMarkdown, doc.Metadata[MetadataKeyFormat], "front-matter cannot override loader metadata")
+		assert.Equal(t, []interface{}{"ops"}, doc.Metadata["tags"])
+		assert.Equal(t, []interface{}{"Overview", "Steps"}, doc.Metadata[MetadataKeyHeadings])
+	})
+	
+	t.Run("title from heading", func(t *testing.T) {
+		doc := loadOne(t, &MarkdownLoader{}, "notes.md", "# Meeting Notes\nWe met.")
+		assert.Equal(t, "Meeting Notes", doc.Title)
+	})
+	
+	t.Run("title from file name", func(t *testing.T) {
+		doc := loadOne(t, &MarkdownLoader{}, "dir/notes.md", "Just text.")
+		assert.Equal(t, "notes", doc.Title)
+	})
+}
+
+func TestHTMLLoader(t *testing.T) {
+	content := `<html><head><title>Team Page</title><style>p { color: red }</style></head>
+<body>
+  <h1>Welcome</h1>
+  <p>We build <b>memory</b>
+     systems.</p>
+  <script>alert("hi")</script>
+  <ul><li>Fast</li><li>Safe</li></ul>
+  <table><tr><th>Name</th><th>Role</th></tr><tr><td>Ada</td><td>Lead</td></tr></table>
+  <h2>Contact</h2>
+  <p>Mail us.<br>Or call.</p>
+</body></html>`
+	
+	doc := loadOne(t, &HTMLLoader{}, "site/team.html", content)
+	assert.Equal(t, "Team Page", doc.Title)
+	assert.Equal(t, "# Welcome\n\nWe build memory systems.\n\n- Fast\n- Safe\n\nName | Role\nAda | Lead\n\n## Contact\n\nMail us.\nOr call.", doc.Content)
+	assert.Equal(t, []interface{}{"Welcome", "Contact"}, doc.Metadata[MetadataKeyHeadings])
+	assert.Equal(t, StrategyMarkdown, doc.Strategy)
+}
+
+func TestCSVLoader(t *testing.T) {
+	content := "name,city,title\nAda,London,Engineer\n,,\nGrace,New York,Admiral\n"
+	
+	t.Run("default rendering", func(t *testing.T) {
+		docs, err := (&CSVLoader{}).Load(strings.NewReader(content), "people.csv")
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+		assert.Equal(t, "name: Ada\ncity: London\ntitle: Engineer", docs[0].Content)
+		assert.Equal(t, "Engineer", docs[0].Title)
+		assert.Equal(t, 1, docs[0].Metadata[MetadataKeyRow])
+		assert.Equal(t, 3, docs[1].Metadata[MetadataKeyRow])
+		assert.Equal(t, Strategy(""), docs[1].Strategy)
+	})
+	
+	t.Run("template", func(t *testing.T) {
+		docs, err := (&CSVLoader{Template: "{{.name}} lives in {{.city}}"}).Load(strings.NewReader(content), "people.csv")
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+		assert.Equal(t, "Grace lives in New York", docs[1].Content)
+	})
+	
+	t.Run("invalid template", func(t *testing.T) {
+		_, err := (&CSVLoader{Template: "{{.name"}).Load(strings.NewReader(content), "people.csv")
+		assert.Error(t, err)
+	})
+}
+
+func TestJSONLLoader(t *testing.T) {
+	content := `{"text": "First event", "title": "One", "level": "info", "nested": {"a": 1}}
+
+{"message": "no content field", "level": "warn"}
+`
+	
+	t.Run("default mapping", func(t *testing.T) {
+		docs, err := (&JSONLLoader{TitleField: "title"}).Load(strings.NewReader(content), "events.jsonl")
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+		assert.Equal(t, "First event", docs[0].Content)
+		assert.Equal(t, "One", docs[0].Title)
+		assert.Equal(t, "info", docs[0].Metadata["level"])
+		assert.NotContains(t, docs[0].Metadata, "nested")
+		assert.Equal(t, 1, docs[0].Metadata[MetadataKeyLine])
+		assert.Equal(t, `{"message": "no content field", "level": "warn"}`, docs[1].Content)
+		assert.Equal(t, 3, docs[1].Metadata[MetadataKeyLine])
+	})
+	
+	t.Run("field mapping", func(t *testing.T) {
+		loader := &JSONLLoader{ContentField: "message", MetadataFields: []string{"level"}}
+		docs, err := loader.Load(strings.NewReader(content), "events.jsonl")
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+		assert.Equal(t, "no content field", docs[1].Content)
+		assert.Equal(t, "warn", docs[1].Metadata["level"])
+	})
+	
+	t.Run("invalid JSON", func(t *testing.T) {
+		_, err := (&JSONLLoader{}).Load(strings.NewReader("{not json}\n"), "bad.jsonl")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,240 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// HashStore remembers the content hash of each ingested file so unchanged
+// files can be skipped.
+type HashStore interface {
+	// Hash returns the hash recorded for key, if any
+	Hash(key string) (string, bool)
+	
+	// SetHash records the hash for key
+	SetHash(key, hash string)
+}
+
+// FileHashStore is a HashStore kept in memory and saved to a JSON file.
+type FileHashStore struct {
+	path   string
+	mutex  sync.RWMutex
+	hashes map[string]string
+}
+
+// NewFileHashStore creates a hash store backed by the JSON file at path,
+// loading any hashes already saved there.
+func NewFileHashStore(path string) (*FileHashStore, error) {
+	store := &FileHashStore{path: path, hashes: make(map[string]string)}
+	
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash store: %w", err)
+	}
+	if err := json.Unmarshal(data, &store.hashes); err != nil {
+		return nil, fmt.Errorf("failed to parse hash store %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// Hash implements the HashStore interface.
+func (s *FileHashStore) Hash(key string) (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	hash, ok := s.hashes[key]
+	return hash, ok
+}
+
+// SetHash implements the HashStore interface.
+func (s *FileHashStore) SetHash(key, hash string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.hashes[key] = hash
+}
+
+// Save writes the hashes to the store's file.
+func (s *FileHashStore) Save() error {
+	s.mutex.RLock()
+	data, err := json.MarshalIndent(s.hashes, "", "  ")
+	s.mutex.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode hash store: %w", err)
+	}
+	
+	// Write to a temporary file first so an interrupted save keeps the old hashes
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write hash store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write hash store: %w", err)
+	}
+	return nil
+}
+
+// WalkOptions configures a directory walk.
+type WalkOptions struct {
+	// Loaders configures the format loaders
+	Loaders LoaderConfig
+	
+	// Hashes records the content hash of ingested files; files whose hash is
+	// unchanged are skipped. Nil ingests every file.
+	Hashes HashStore
+	
+	// KeyPrefix namespaces the keys in Hashes, e.g. by entity, so the same
+	// files can be ingested separately for each
+	KeyPrefix string
+	
+	// IncludeHidden walks files and directories whose names start with "."
+	IncludeHidden bool
+	
+	// Remove deletes what an earlier walk stored for a file before its
+	// documents are handled again, so a changed file leaves no stale records.
+	// Nil keeps earlier records.
+	Remove DocumentRemover
+}
+
+// FileError records a file that could not be ingested.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+// Error implements the error interface.
+func (e FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// WalkResult summarises a directory walk.
+type WalkResult struct {
+	// Files is the number of files in a supported format
+	Files int `json:"files"`
+	
+	// Skipped is the number of files unchanged since they were last ingested
+	Skipped int `json:"skipped"`
+	
+	// Ingested is the number of files whose documents were all handled
+	Ingested int `json:"ingested"`
+	
+	// Documents is the number of documents handled
+	Documents int `json:"documents"`
+	
+	// Failed lists the files that could not be loaded or handled
+	Failed []FileError `json:"-"`
+}
+
+// DocumentHandler stores a loaded document.
+type DocumentHandler func(ctx context.Context, doc Document) error
+
+// DocumentRemover deletes the documents stored for the file at path.
+type DocumentRemover func(ctx context.Context, path string) error
+
+// Walk loads every supported file under root, which may also be a single
+// file, and passes each document to handle. Files in unsupported formats are
+// ignored. A file's hash is recorded only once all of its documents have been
+// handled, so failed files are retried on the next walk. Failures are
+// collected in the result; Walk itself only fails if root cannot be walked or
+// ctx is cancelled.
+func Walk(ctx context.Context, root string, options WalkOptions, handle DocumentHandler) (*WalkResult, error) {
+	result := &WalkResult{}
+	
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			result.Failed = append(result.Failed, FileError{Path: path, Err: err})
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		
+		hidden := path != root && strings.HasPrefix(d.Name(), ".")
+		if d.IsDir() {
+			if hidden && !options.IncludeHidden {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if (hidden && !options.IncludeHidden) || !d.Type().IsRegular() {
+			return nil
+		}
+		
+		loader, err := LoaderFor(path, options.Loaders)
+		if err != nil {
+			return nil
+		}
+		result.Files++
+		
+		if err := walkFile(ctx, path, loader, options, handle, result); err != nil {
+			result.Failed = append(result.Failed, FileError{Path: path, Err: err})
+		}
+		return nil
+	})
+	return result, err
+}
+
+// walkFile loads and handles the documents of a single file.
+func walkFile(ctx context.Context, path string, loader Loader, options WalkOptions, handle DocumentHandler, result *WalkResult) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	key := path
+	if abs, err := filepath.Abs(path); err == nil {
+		key = abs
+	}
+	key = options.KeyPrefix + key
+	
+	if options.Hashes != nil {
+		if previous, ok := options.Hashes.Hash(key); ok && previous == hash {
+			result.Skipped++
+			return nil
+		}
+	}
+	
+	docs, err := loader.Load(bytes.NewReader(data), path)
+	if err != nil {
+		return err
+	}
+	if options.Remove != nil {
+		if err := options.Remove(ctx, path); err != nil {
+			return fmt.Errorf("failed to remove previous documents: %w", err)
+		}
+	}
+	for _, doc := range docs {
+		doc.Metadata[MetadataKeyContentHash] = hash
+		if err := handle(ctx, doc); err != nil {
+			return err
+		}
+		result.Documents++
+	}
+	
+	result.Ingested++
+	if options.Hashes != nil {
+		options.Hashes.SetHash(key, hash)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "guide.md"), "# Guide\nRead me.")
+	writeTestFile(t, filepath.Join(root, "sub", "people.csv"), "name\nAda\nGrace\n")
+	writeTestFile(t, filepath.Join(root, "sub", "image.png"), "not text")
+	writeTestFile(t, filepath.Join(root, ".git", "notes.txt"), "hidden")
+	
+	hashes, err := NewFileHashStore(filepath.Join(t.TempDir(), "hashes.json"))
+	require.NoError(t, err)
+	options := WalkOptions{Hashes: hashes, KeyPrefix: "entity-a:"}
+	
+	var handled []Document
+	handle := func(ctx context.Context, doc Document) error {
+		handled = append(handled, doc)
+		return nil
+	}
+	
+	result, err := Walk(context.Background(), root, options, handle)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Files)
+	assert.Equal(t, 2, result.Ingested)
+	assert.Equal(t, 3, result.Documents)
+	assert.Empty(t, result.Failed)
+	require.Len(t, handled, 3)
+	assert.NotEmpty(t, handled[0].Metadata[MetadataKeyContentHash])
+	
+	t.Run("unchanged files are skipped", func(t *testing.T) {
+		require.NoError(t, hashes.Save())
+		reloaded, err := NewFileHashStore(hashes.path)
+		require.NoError(t, err)
+		options.Hashes = reloaded
+		
+		writeTestFile(t, filepath.Join(root, "guide.md"), "# Guide\nRead me again.")
+		handled = nil
+		result, err := Walk(context.Background(), root, options, handle)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Skipped)
+		assert.Equal(t, 1, result.Ingested)
+		require.Len(t, handled, 1)
+		assert.Equal(t, "# Guide\nRead me again.", handled[0].Content)
+	})
+	
+	t.Run("hash keys are namespaced", func(t *testing.T) {
+		options.KeyPrefix = "entity-b:"
+		result, err := Walk(context.Background(), root, options, handle)
+		require.NoError(t, err)
+		assert.Equal(t, 0, result.Skipped)
+	})
+	
+	t.Run("failed files are retried", func(t *testing.T) {
+		writeTestFile(t, filepath.Join(root, "guide.md"), "# Guide\nChanged.")
+		failing := func(ctx context.Context, doc Document) error {
+			return errors.New("store unavailable")
+		}
+		options.KeyPrefix = "entity-a:"
+		result, err := Walk(context.Background(), root, options, failing)
+		require.NoError(t, err)
+		require.Len(t, result.Failed, 1)
+		assert.Equal(t, filepath.Join(root, "guide.md"), result.Failed[0].Path)
+		
+		result, err = Walk(context.Background(), root, options, handle)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Ingested)
+	})
+	
+	t.Run("changed files replace their previous documents", func(t *testing.T) {
+		var events []string
+		options.Remove = func(ctx context.Context, path string) error {
+			events = append(events, "remove "+filepath.Base(path))
+			return nil
+		}
+		recording := func(ctx context.Context, doc Document) error {
+			events = append(events, "handle "+filepath.Base(doc.Metadata[MetadataKeyPath].(string)))
+			return nil
+		}
+		defer func() { options.Remove = nil }()
+		
+		writeTestFile(t, filepath.Join(root, "guide.md"), "# Guide\nRewritten.")
+		result, err := Walk(context.Background(), root, options, recording)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Ingested)
+		assert.Equal(t, []string{"remove guide.md", "handle guide.md"}, events, "unchanged files are not removed")
+		
+		events = nil
+		writeTestFile(t, filepath.Join(root, "guide.md"), "# Guide\nRewritten again.")
+		options.Remove = func(ctx context.Context, path string) error {
+			return errors.New("store unavailable")
+		}
+		result, err = Walk(context.Background(), root, options, recording)
+		require.NoError(t, err)
+		require.Len(t, result.Failed, 1)
+		assert.Empty(t, events, "documents are not handled when removal fails")
+	})
+	
+	t.Run("missing root", func(t *testing.T) {
+		_, err := Walk(context.Background(), filepath.Join(root, "missing"), options, handle)
+		assert.Error(t, err)
+	})
+}
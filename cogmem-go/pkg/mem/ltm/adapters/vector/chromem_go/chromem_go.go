@@ -204,10 +204,10 @@ func (a *ChromemGoAdapter) Retrieve(ctx context.Context, query ltm.LTMQuery) ([]
 	var results []chromem.Result
 	var err error
 
-	switch {
-	case query.ExactMatch != nil && query.ExactMatch["id"] != nil:
+	switch id, hasID := query.ExactMatchID(); {
+	case hasID:
 		// ID-based lookup
-		recordID, ok := query.ExactMatch["id"].(string)
+		recordID, ok := id.(string)
 		if !ok {
 			return nil, errors.New("invalid record ID in query")
 		}
@@ -215,6 +215,20 @@ func (a *ChromemGoAdapter) Retrieve(ctx context.Context, query ltm.LTMQuery) ([]
 	case len(query.Embedding) > 0:
 		// Semantic search with vector
 		results, err = a.retrieveSemantic(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		
+		// chromem-go reports cosine similarity, which becomes the record score
+		similarities := make(map[string]float32, len(results))
+		for _, result := range results {
+			similarities[result.ID] = result.Similarity
+		}
+		records := a.convertToMemoryRecords(results)
+		for i := range records {
+			records[i].Score = ltm.SimilarityScore(float64(similarities[records[i].ID]))
+		}
+		return records, nil
 	default:
 		// Filter-based search
 		results, err = a.retrieveByFilters(ctx, query)
@@ -242,6 +256,11 @@ func (a *ChromemGoAdapter) retrieveByID(ctx context.Context, recordID string) ([
 		MetadataKeyID: recordID,
 	}
 	
+	// The collection is shared, so lookups with an entity are scoped to it
+	if entityCtx, ok := entity.GetEntityContext(ctx); ok {
+		where[MetadataKeyEntityID] = string(entityCtx.EntityID)
+	}
+	
 	// Try to get an estimated count to handle limit better
 	count, err := a.getEstimatedCount(ctx)
 	if err != nil {
@@ -294,10 +313,12 @@ func (a *ChromemGoAdapter) retrieveSemantic(ctx context.Context, query ltm.LTMQu
 	where := make(map[string]string)
 	
 	// Process system field mappings
-	// Handle entity_id
+	// Handle entity_id, defaulting to the caller's entity
 	if entityID, ok := query.Filters["entity_id"].(entity.EntityID); ok && entityID != "" {
 		where[MetadataKeyEntityID] = string(entityID)
 		log.Debug("Added entity filter for semantic search", "entity_id", entityID)
+	} else if entityCtx, ok := entity.GetEntityContext(ctx); ok {
+		where[MetadataKeyEntityID] = string(entityCtx.EntityID)
 	}
 	
 	// Handle user_id
@@ -394,10 +415,12 @@ func (a *ChromemGoAdapter) retrieveByFilters(ctx context.Context, query ltm.LTMQ
 	log.Debug("Retrieving by filters", "collection", a.collectionName)
 	
 	// Process system field mappings
-	// Handle entity_id
+	// Handle entity_id, defaulting to the caller's entity
 	if entityID, ok := query.Filters["entity_id"].(entity.EntityID); ok && entityID != "" {
 		where[MetadataKeyEntityID] = string(entityID)
 		log.Debug("Added entity filter", "entity_id", entityID)
+	} else if entityCtx, ok := entity.GetEntityContext(ctx); ok {
+		where[MetadataKeyEntityID] = string(entityCtx.EntityID)
 	}
 	
 	// Handle user_id
@@ -415,7 +438,7 @@ func (a *ChromemGoAdapter) retrieveByFilters(ctx context.Context, query ltm.LTMQ
 	// Process exact match criteria (other than system fields)
 	if query.ExactMatch != nil {
 		for k, v := range query.ExactMatch {
-			if k == "id" {
+			if k == "id" || k == "ID" {
 				continue // Skip ID as it's handled separately
 			}
 			
@@ -541,20 +564,13 @@ func (a *ChromemGoAdapter) retrieveByFilters(ctx context.Context, query ltm.LTMQ
 	return results, nil
 }
 
-// getEstimatedCount returns an estimated count of documents in the collection
-// This is a more reliable approach than the previous countDocumentsInCollection function
+// getEstimatedCount returns the number of documents in the collection. Queries
+// fail if they ask for more results than that.
 func (a *ChromemGoAdapter) getEstimatedCount(ctx context.Context) (int, error) {
 	if a.collection == nil {
 		return 0, ErrChromemGoUnavailable
 	}
-	
-	// Unfortunately, ChromemGo v0.7.0 doesn't have a direct way to count documents
-	// We'll check if the collection has any documents by querying with a high limit
-	// and assuming it's not empty if no error occurs
-	
-	// Return a safe non-zero value, since we can't accurately determine the count
-	// This is a workaround for the "nResults must be <= the number of documents" error
-	return 10000, nil
+	return a.collection.Count(), nil
 }
 
 // Update modifies an existing memory record
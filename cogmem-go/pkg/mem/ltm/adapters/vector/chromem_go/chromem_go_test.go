@@ -143,6 +143,67 @@ func TestChromemGoAdapter_Retrieve_Semantic(t *testing.T) {
 	require.LessOrEqual(t, len(results), 2)
 }
 
+func TestChromemGoAdapter_Retrieve_Scores(t *testing.T) {
+	client, cleanup := testutil.CreateTempChromemGoClient(t)
+	defer cleanup()
+	
+	adapter, err := NewChromemGoAdapter(client, "test-collection-scores")
+	require.NoError(t, err)
+	
+	entityID := uuid.New().String()
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext(entity.EntityID(entityID), "test-user"))
+	
+	// Unit-length embeddings at decreasing similarity to the query
+	queryVector := []float32{1, 0, 0}
+	embeddings := map[string][]float32{
+		"same":       {1, 0, 0},
+		"close":      {0.8, 0.6, 0},
+		"orthogonal": {0, 1, 0},
+		"opposite":   {-1, 0, 0},
+	}
+	for content, embedding := range embeddings {
+		record := createTestRecord(entityID, "test-user", content)
+		record.Embedding = embedding
+		_, err := adapter.Store(ctx, record)
+		require.NoError(t, err)
+	}
+	
+	results, err := adapter.Retrieve(ctx, ltm.LTMQuery{Embedding: queryVector, Limit: len(embeddings)})
+	require.NoError(t, err)
+	require.Len(t, results, len(embeddings))
+	
+	for i, result := range results {
+		embedding := embeddings[result.Content]
+		cosine := ltm.CosineSimilarity(queryVector, embedding)
+		
+		// chromem-go compares by cosine similarity, which for unit-length
+		// embeddings is also what the cosine and dot metrics score
+		assert.InDelta(t, ltm.NormalizeScore(ltm.DistanceCosine, 1-cosine), result.Score, 1e-6, result.Content)
+		assert.InDelta(t, ltm.NormalizeScore(ltm.DistanceDot, -ltm.DotProduct(queryVector, embedding)), result.Score, 1e-6, result.Content)
+		
+		// and it ranks them as the euclidean metric would
+		if i > 0 {
+			previous := embeddings[results[i-1].Content]
+			assert.GreaterOrEqual(t,
+				ltm.NormalizeScore(ltm.DistanceEuclidean, euclideanDistance(queryVector, previous)),
+				ltm.NormalizeScore(ltm.DistanceEuclidean, euclideanDistance(queryVector, embedding)))
+		}
+	}
+	assert.Equal(t, "same", results[0].Content)
+	assert.InDelta(t, 1.0, results[0].Score, 1e-6)
+	assert.InDelta(t, 0.8, results[1].Score, 1e-6)
+	assert.Equal(t, 0.0, results[3].Score, "opposing embeddings score zero")
+}
+
+// euclideanDistance returns the L2 distance between two vectors of equal length
+func euclideanDistance(a, b []float32) float64 {
+	diff := make([]float32, len(a))
+	for i := range a {
+		diff[i] = a[i] - b[i]
+	}
+	return ltm.Norm(diff)
+}
+
 func TestChromemGoAdapter_Retrieve_Filtering(t *testing.T) {
 	// Skip this test due to limitations in ChromemGo v0.7.0
 	t.Skip("Skipping filtering test due to ChromemGo v0.7.0 limitations with filtering")
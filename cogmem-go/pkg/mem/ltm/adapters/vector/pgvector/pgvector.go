@@ -26,6 +26,9 @@ var (
 	ErrPgvectorUnavailable = errors.New("pgvector client unavailable")
 )
 
+// distanceColumn is the name of the column semantic searches report the distance in
+const distanceColumn = "distance"
+
 // PgvectorAdapter implements the ltm.VectorCapableLTMStore interface using PostgreSQL with pgvector extension
 type PgvectorAdapter struct {
 	db            *pgxpool.Pool
@@ -224,9 +227,10 @@ func (a *PgvectorAdapter) Store(ctx context.Context, record ltm.MemoryRecord) (s
 		record.UpdatedAt = now
 	}
 
-	// Check if we have an embedding
-	if record.Embedding == nil || len(record.Embedding) == 0 {
-		return "", errors.New("record must have an embedding for vector storage")
+	// Records without an embedding, such as whole documents, get a zero vector
+	// placeholder, which semantic search never returns
+	if len(record.Embedding) == 0 {
+		record.Embedding = make([]float32, a.dimensionSize)
 	}
 
 	if len(record.Embedding) != a.dimensionSize {
@@ -312,10 +316,10 @@ func (a *PgvectorAdapter) Retrieve(ctx context.Context, query ltm.LTMQuery) ([]l
 	var rows pgx.Rows
 	var err error
 
-	switch {
-	case query.ExactMatch != nil && query.ExactMatch["id"] != nil:
+	switch id, hasID := query.ExactMatchID(); {
+	case hasID:
 		// ID-based lookup
-		recordID, ok := query.ExactMatch["id"].(string)
+		recordID, ok := id.(string)
 		if !ok {
 			return nil, errors.New("invalid record ID in query")
 		}
@@ -426,14 +430,15 @@ func (a *PgvectorAdapter) retrieveSemantic(ctx context.Context, query ltm.LTMQue
 		distanceFunc = "embedding <#> $%d"
 	}
 
-	// Build the query
+	// Build the query, selecting the distance so it can be normalized into a score
+	distanceExpr := fmt.Sprintf(distanceFunc, len(args))
 	sqlQuery := fmt.Sprintf(`
-		SELECT id, entity_id, user_id, access_level, content, metadata, embedding, created_at, updated_at
+		SELECT id, entity_id, user_id, access_level, content, metadata, embedding, created_at, updated_at, %s AS %s
 		FROM %s
-		WHERE %s
+		WHERE %s AND vector_norm(embedding) > 0
 		ORDER BY %s
 		LIMIT %d
-	`, a.tableName, whereClause, fmt.Sprintf(distanceFunc, len(args)), limit)
+	`, distanceExpr, distanceColumn, a.tableName, whereClause, distanceColumn, limit)
 
 	// Execute the query
 	rows, err := a.db.Query(ctx, sqlQuery, args...)
@@ -514,7 +519,7 @@ func (a *PgvectorAdapter) buildWhereClause(query ltm.LTMQuery) (string, []interf
 	// Process exact match criteria
 	if query.ExactMatch != nil {
 		for k, v := range query.ExactMatch {
-			if k == "id" {
+			if k == "id" || k == "ID" {
 				continue // Skip ID as it's handled separately
 			}
 
@@ -664,17 +669,26 @@ func (a *PgvectorAdapter) SupportsVectorSearch() bool {
 	return true
 }
 
-// convertRowsToMemoryRecords converts database rows to MemoryRecord objects
+// convertRowsToMemoryRecords converts database rows to MemoryRecord objects.
+// Rows from a semantic search carry a trailing distance column, which is
+// normalized into the record's Score according to the configured metric.
 func (a *PgvectorAdapter) convertRowsToMemoryRecords(ctx context.Context, rows pgx.Rows) ([]ltm.MemoryRecord, error) {
 	var records []ltm.MemoryRecord
+	hasDistance := false
+	for _, field := range rows.FieldDescriptions() {
+		if field.Name == distanceColumn {
+			hasDistance = true
+		}
+	}
 
 	for rows.Next() {
 		var record ltm.MemoryRecord
 		var entityIDStr string
 		var accessLevel int
 		var embeddingStr string
+		var distance float64
 
-		err := rows.Scan(
+		dest := []interface{}{
 			&record.ID,
 			&entityIDStr,
 			&record.UserID,
@@ -684,7 +698,12 @@ func (a *PgvectorAdapter) convertRowsToMemoryRecords(ctx context.Context, rows p
 			&embeddingStr,
 			&record.CreatedAt,
 			&record.UpdatedAt,
-		)
+		}
+		if hasDistance {
+			dest = append(dest, &distance)
+		}
+
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
@@ -692,6 +711,12 @@ func (a *PgvectorAdapter) convertRowsToMemoryRecords(ctx context.Context, rows p
 		record.EntityID = entity.EntityID(entityIDStr)
 		record.AccessLevel = entity.AccessLevel(accessLevel)
 		record.Embedding = stringToEmbed(embeddingStr)
+		if isPlaceholder(record.Embedding) {
+			record.Embedding = nil
+		}
+		if hasDistance {
+			record.Score = a.score(distance)
+		}
 
 		records = append(records, record)
 	}
@@ -703,6 +728,23 @@ func (a *PgvectorAdapter) convertRowsToMemoryRecords(ctx context.Context, rows p
 	return records, nil
 }
 
+// score normalizes a distance reported by pgvector into a record score
+// according to the configured metric.
+func (a *PgvectorAdapter) score(distance float64) float64 {
+	return ltm.NormalizeScore(a.distanceMetric, distance)
+}
+
+// isPlaceholder reports whether an embedding is the zero vector stored for
+// records without one.
+func isPlaceholder(embedding []float32) bool {
+	for _, v := range embedding {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // Helper function to convert []float32 to string for pgvector
 func embedToString(embedding []float32) string {
 	elements := make([]string, len(embedding))
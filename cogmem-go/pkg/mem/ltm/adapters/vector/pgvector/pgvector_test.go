@@ -2,6 +2,7 @@ package pgvector
 
 import (
 	"context"
+	"math"
 	"os"
 	"testing"
 	"time"
@@ -43,6 +44,10 @@ func createTestRecord(entityID string, userID string, content string) ltm.Memory
 }
 
 func setupTestAdapter(t *testing.T) (*PgvectorAdapter, context.Context) {
+	return setupTestAdapterWithMetric(t, "cosine")
+}
+
+func setupTestAdapterWithMetric(t *testing.T, metric string) (*PgvectorAdapter, context.Context) {
 	pgvectorURL := skipIfNoPgvector(t)
 	
 	// Create a context with a test entity
@@ -58,7 +63,7 @@ func setupTestAdapter(t *testing.T) (*PgvectorAdapter, context.Context) {
 		ConnectionString: pgvectorURL,
 		TableName:        tableName,
 		DimensionSize:    testDimension,
-		DistanceMetric:   "cosine",
+		DistanceMetric:   metric,
 	}
 	
 	adapter, err := NewPgvectorAdapter(ctx, config)
@@ -173,6 +178,78 @@ func TestPgvectorAdapter_Retrieve_Semantic(t *testing.T) {
 	require.LessOrEqual(t, len(results), 2)
 }
 
+// scoreTestEmbeddings are unit-length embeddings at decreasing similarity to scoreTestQuery
+var (
+	scoreTestQuery      = []float32{1, 0, 0, 0, 0}
+	scoreTestEmbeddings = map[string][]float32{
+		"same":       {1, 0, 0, 0, 0},
+		"close":      {0.8, 0.6, 0, 0, 0},
+		"orthogonal": {0, 1, 0, 0, 0},
+	}
+)
+
+// pgvectorDistance returns the distance pgvector's operator for metric reports
+func pgvectorDistance(metric string, a, b []float32) float64 {
+	switch metric {
+	case ltm.DistanceEuclidean:
+		diff := make([]float32, len(a))
+		for i := range a {
+			diff[i] = a[i] - b[i]
+		}
+		return ltm.Norm(diff)
+	case ltm.DistanceDot:
+		return -ltm.DotProduct(a, b)
+	default:
+		return 1 - ltm.CosineSimilarity(a, b)
+	}
+}
+
+func TestPgvectorAdapter_Score(t *testing.T) {
+	expected := map[string]map[string]float64{
+		ltm.DistanceCosine:    {"same": 1, "close": 0.8, "orthogonal": 0},
+		ltm.DistanceEuclidean: {"same": 1, "close": 1 / (1 + math.Sqrt(0.4)), "orthogonal": 1 / (1 + math.Sqrt2)},
+		ltm.DistanceDot:       {"same": 1, "close": 0.8, "orthogonal": 0},
+	}
+	for metric, scores := range expected {
+		t.Run(metric, func(t *testing.T) {
+			adapter := &PgvectorAdapter{distanceMetric: metric}
+			for content, score := range scores {
+				distance := pgvectorDistance(metric, scoreTestQuery, scoreTestEmbeddings[content])
+				assert.InDelta(t, score, adapter.score(distance), 1e-6, content)
+			}
+		})
+	}
+}
+
+func TestPgvectorAdapter_Retrieve_Scores(t *testing.T) {
+	skipIfNoPgvector(t)
+	
+	for _, metric := range []string{ltm.DistanceCosine, ltm.DistanceEuclidean, ltm.DistanceDot} {
+		t.Run(metric, func(t *testing.T) {
+			adapter, ctx := setupTestAdapterWithMetric(t, metric)
+			for content, embedding := range scoreTestEmbeddings {
+				record := createTestRecord("test-entity", "test-user", content)
+				record.Embedding = embedding
+				_, err := adapter.Store(ctx, record)
+				require.NoError(t, err)
+			}
+			
+			results, err := adapter.Retrieve(ctx, ltm.LTMQuery{Embedding: scoreTestQuery, Limit: len(scoreTestEmbeddings)})
+			require.NoError(t, err)
+			require.Len(t, results, len(scoreTestEmbeddings))
+			
+			assert.Equal(t, "same", results[0].Content)
+			for i, result := range results {
+				distance := pgvectorDistance(metric, scoreTestQuery, scoreTestEmbeddings[result.Content])
+				assert.InDelta(t, ltm.NormalizeScore(metric, distance), result.Score, 1e-6, result.Content)
+				if i > 0 {
+					assert.LessOrEqual(t, result.Score, results[i-1].Score, "results are ordered by score")
+				}
+			}
+		})
+	}
+}
+
 func TestPgvectorAdapter_Retrieve_Filtering(t *testing.T) {
 	// Skip if no PgVector connection
 	skipIfNoPgvector(t)
@@ -441,17 +518,22 @@ func TestPgvectorAdapter_EdgeCases(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "embedding dimension mismatch")
 	
-	// Test empty embedding
-	record = createTestRecord(string(entityID), userID, "Record with empty embedding")
-	record.Embedding = []float32{} // Empty embedding
-	_, err = adapter.Store(ctx, record)
-	assert.Error(t, err)
-	
-	// Test nil embedding
+	// Records without an embedding are stored, but not found by semantic search
 	record = createTestRecord(string(entityID), userID, "Record with nil embedding")
 	record.Embedding = nil // Nil embedding
-	_, err = adapter.Store(ctx, record)
-	assert.Error(t, err)
+	unembeddedID, err := adapter.Store(ctx, record)
+	require.NoError(t, err)
+	
+	stored, err := adapter.Retrieve(ctx, ltm.LTMQuery{ExactMatch: map[string]interface{}{"id": unembeddedID}})
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Nil(t, stored[0].Embedding)
+	
+	similar, err := adapter.Retrieve(ctx, ltm.LTMQuery{Embedding: []float32{0.1, 0.2, 0.3, 0.4, 0.5}, Limit: 10})
+	require.NoError(t, err)
+	for _, result := range similar {
+		assert.NotEqual(t, unembeddedID, result.ID)
+	}
 	
 	// Test with correct embedding
 	record = createTestRecord(string(entityID), userID, "Record with correct embedding")
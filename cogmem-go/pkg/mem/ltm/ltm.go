@@ -10,50 +10,67 @@ import (
 // MemoryRecord represents a single memory entry in long-term memory.
 type MemoryRecord struct {
 	// ID is a unique identifier for the record
-	ID string
+	ID string `lua:"id"`
 	
 	// EntityID is the entity that owns this memory
-	EntityID entity.EntityID
+	EntityID entity.EntityID `lua:"entity_id"`
 	
 	// UserID is optional and indicates a specific user within the entity
 	// Used with AccessLevel.PrivateToUser
-	UserID string
+	UserID string `lua:"user_id"`
 	
 	// AccessLevel determines the visibility of this memory within the entity
-	AccessLevel entity.AccessLevel
+	AccessLevel entity.AccessLevel `lua:"access_level"`
 	
 	// Content is the actual memory content (text)
-	Content string
+	Content string `lua:"content"`
 	
 	// Metadata is additional structured data about this memory
-	Metadata map[string]interface{}
+	Metadata map[string]interface{} `lua:"metadata"`
 	
 	// Embedding is the vector representation for semantic search (empty for SQL/KV stores)
-	Embedding []float32
+	Embedding []float32 `lua:"embedding"`
 	
 	// CreatedAt is when this memory was initially stored
-	CreatedAt time.Time
+	CreatedAt time.Time `lua:"created_at"`
 	
 	// UpdatedAt is when this memory was last modified
-	UpdatedAt time.Time
+	UpdatedAt time.Time `lua:"updated_at"`
+	
+	// Score is the normalized similarity of this record to the query embedding
+	// of a semantic retrieval, in the range [0, 1] where higher is more similar.
+	// Vector adapters derive it from their native distance using NormalizeScore.
+	// It is zero for non-semantic retrievals and is never persisted.
+	Score float64 `lua:"score"`
 }
 
 // LTMQuery represents a query to retrieve memories from LTM.
 type LTMQuery struct {
 	// ExactMatch is used for key-based exact matching (SQL, KV stores)
-	ExactMatch map[string]interface{}
+	ExactMatch map[string]interface{} `lua:"exact_match"`
 	
 	// TextMatch is used for text-based search (SQL, potentially Vector stores)
-	Text string
+	Text string `lua:"text"`
 	
 	// EmbeddingMatch is used for semantic search (Vector stores)
-	Embedding []float32
+	Embedding []float32 `lua:"embedding"`
 	
 	// Filters is used for metadata filtering
-	Filters map[string]interface{}
+	Filters map[string]interface{} `lua:"filters"`
 	
 	// Limit is the maximum number of results to return
-	Limit int
+	Limit int `lua:"limit"`
+}
+
+// ExactMatchID returns the record ID of an ID lookup. Both the "id" key and the
+// "ID" key used by the key-value and SQL stores are accepted.
+func (q LTMQuery) ExactMatchID() (interface{}, bool) {
+	for _, key := range []string{"id", "ID"} {
+		if id, ok := q.ExactMatch[key]; ok && id != nil {
+			return id, true
+		}
+	}
+	return nil, false
 }
 
 // LTMStore is the interface that all long-term memory store adapters must implement.
@@ -0,0 +1,23 @@
+package ltm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLTMQuery_ExactMatchID(t *testing.T) {
+	id, ok := LTMQuery{ExactMatch: map[string]interface{}{"id": "lower"}}.ExactMatchID()
+	assert.True(t, ok)
+	assert.Equal(t, "lower", id)
+	
+	id, ok = LTMQuery{ExactMatch: map[string]interface{}{"ID": "upper"}}.ExactMatchID()
+	assert.True(t, ok)
+	assert.Equal(t, "upper", id)
+	
+	_, ok = LTMQuery{ExactMatch: map[string]interface{}{"id": nil}}.ExactMatchID()
+	assert.False(t, ok, "a nil ID is no lookup")
+	
+	_, ok = LTMQuery{Filters: map[string]interface{}{"id": "filter"}}.ExactMatchID()
+	assert.False(t, ok)
+}
@@ -0,0 +1,89 @@
+package ltm
+
+import "math"
+
+// Distance metrics supported by vector adapters
+const (
+	// DistanceCosine is cosine distance (1 - cosine similarity)
+	DistanceCosine = "cosine"
+	
+	// DistanceEuclidean is Euclidean (L2) distance
+	DistanceEuclidean = "euclidean"
+	
+	// DistanceDot is the negative inner product, as reported by pgvector's <#> operator
+	DistanceDot = "dot"
+)
+
+// DotProduct returns the inner product of two vectors.
+// Vectors of different lengths are compared over their common prefix.
+func DotProduct(a, b []float32) float64 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	
+	var sum float64
+	for i := 0; i < n; i++ {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// Norm returns the Euclidean length of a vector.
+func Norm(v []float32) float64 {
+	return math.Sqrt(DotProduct(v, v))
+}
+
+// CosineSimilarity returns the cosine of the angle between two vectors,
+// in the range [-1, 1]. It returns 0 if either vector is empty or zero.
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	
+	normA, normB := Norm(a), Norm(b)
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return DotProduct(a, b) / (normA * normB)
+}
+
+// SimilarityScore converts a cosine similarity in [-1, 1] into a
+// MemoryRecord.Score. Negative (opposing) similarities score zero.
+func SimilarityScore(cosine float64) float64 {
+	return clampScore(cosine)
+}
+
+// NormalizeScore converts a raw distance reported by a vector backend into a
+// MemoryRecord.Score in [0, 1], where higher is more similar:
+//
+//   - cosine: 1 - distance, i.e. the cosine similarity clamped at zero
+//   - euclidean: 1 / (1 + distance)
+//   - dot: the inner product (the negated distance) clamped to [0, 1]; for
+//     unit-length embeddings, such as OpenAI's, this equals cosine similarity
+//
+// Unknown metrics are treated as cosine.
+func NormalizeScore(metric string, distance float64) float64 {
+	switch metric {
+	case DistanceEuclidean:
+		if distance < 0 {
+			distance = 0
+		}
+		return 1 / (1 + distance)
+	case DistanceDot:
+		return clampScore(-distance)
+	default:
+		return clampScore(1 - distance)
+	}
+}
+
+// clampScore limits a score to the range [0, 1].
+func clampScore(score float64) float64 {
+	if math.IsNaN(score) || score < 0 {
+		return 0
+	}
+	if score > 1 {
+		return 1
+	}
+	return score
+}
@@ -0,0 +1,48 @@
+package ltm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1.0, CosineSimilarity([]float32{1, 2, 3}, []float32{2, 4, 6}), 1e-9)
+	assert.InDelta(t, 0.0, CosineSimilarity([]float32{1, 0}, []float32{0, 1}), 1e-9)
+	assert.InDelta(t, -1.0, CosineSimilarity([]float32{1, 0}, []float32{-1, 0}), 1e-9)
+	
+	// Empty and zero vectors have no direction
+	assert.Equal(t, 0.0, CosineSimilarity(nil, []float32{1}))
+	assert.Equal(t, 0.0, CosineSimilarity([]float32{0, 0}, []float32{1, 1}))
+}
+
+func TestDotProductAndNorm(t *testing.T) {
+	assert.Equal(t, 11.0, DotProduct([]float32{1, 2}, []float32{3, 4}))
+	assert.Equal(t, 5.0, Norm([]float32{3, 4}))
+	
+	// Mismatched lengths use the common prefix
+	assert.Equal(t, 3.0, DotProduct([]float32{1, 2, 9}, []float32{3}))
+}
+
+func TestNormalizeScore(t *testing.T) {
+	// Cosine distance is 1 - cosine similarity
+	assert.InDelta(t, 0.8, NormalizeScore(DistanceCosine, 0.2), 1e-9)
+	assert.Equal(t, 0.0, NormalizeScore(DistanceCosine, 1.5))
+	
+	// Euclidean distance decays towards zero
+	assert.Equal(t, 1.0, NormalizeScore(DistanceEuclidean, 0))
+	assert.InDelta(t, 0.5, NormalizeScore(DistanceEuclidean, 1), 1e-9)
+	
+	// pgvector reports the negative inner product
+	assert.InDelta(t, 0.9, NormalizeScore(DistanceDot, -0.9), 1e-9)
+	assert.Equal(t, 0.0, NormalizeScore(DistanceDot, 0.3))
+	
+	// Unknown metrics fall back to cosine
+	assert.InDelta(t, 0.75, NormalizeScore("", 0.25), 1e-9)
+}
+
+func TestSimilarityScore(t *testing.T) {
+	assert.Equal(t, 0.5, SimilarityScore(0.5))
+	assert.Equal(t, 0.0, SimilarityScore(-0.3))
+	assert.Equal(t, 1.0, SimilarityScore(1.0000001))
+}
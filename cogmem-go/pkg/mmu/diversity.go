@@ -0,0 +1,92 @@
+package mmu
+
+import (
+	"math"
+
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+)
+
+// defaultDiversityFetchFactor is the over-retrieval factor used when none is configured
+const defaultDiversityFetchFactor = 3
+
+// diversityFetchFactor returns the candidate over-retrieval factor for MMR.
+func diversityFetchFactor(options RetrievalOptions) int {
+	if options.DiversityFetchFactor < 1 {
+		return defaultDiversityFetchFactor
+	}
+	return options.DiversityFetchFactor
+}
+
+// applyMMR selects up to k records using Maximal Marginal Relevance.
+// Each step picks the candidate maximising
+//
+//	lambda * relevance(candidate) - (1 - lambda) * max sim(candidate, selected)
+//
+// using the stored embeddings, so near-duplicates of already selected
+// records are pushed down. Relevance is the candidate's score, or its
+// similarity to the query if it has none, blended with its importance by
+// importanceWeight. Records without embeddings cannot be compared and are
+// only selected, in their original order, after all others.
+func applyMMR(queryEmbedding []float32, candidates []ltm.MemoryRecord, lambda float64, k int, importanceWeight float64) []ltm.MemoryRecord {
+	if lambda > 1 {
+		lambda = 1
+	}
+	if k <= 0 || k > len(candidates) {
+		k = len(candidates)
+	}
+	
+	relevance := make([]float64, len(candidates))
+	for i, candidate := range candidates {
+		similarity := candidate.Score
+		if similarity == 0 {
+			similarity = ltm.SimilarityScore(ltm.CosineSimilarity(queryEmbedding, candidate.Embedding))
+		}
+		relevance[i] = blendedScore(candidate, similarity, importanceWeight)
+	}
+	
+	// maxSimilarity[i] tracks the highest similarity of candidate i to any selected record
+	maxSimilarity := make([]float64, len(candidates))
+	used := make([]bool, len(candidates))
+	selected := make([]ltm.MemoryRecord, 0, k)
+	
+	for len(selected) < k {
+		best := -1
+		bestScore := math.Inf(-1)
+		for i, candidate := range candidates {
+			if used[i] || len(candidate.Embedding) == 0 {
+				continue
+			}
+			score := lambda*relevance[i] - (1-lambda)*maxSimilarity[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			// Only records without embeddings remain; keep their original order
+			for i := range candidates {
+				if !used[i] {
+					best = i
+					break
+				}
+			}
+		}
+		if best < 0 {
+			break
+		}
+		
+		used[best] = true
+		selected = append(selected, candidates[best])
+		
+		// Update redundancy of the remaining candidates against the new pick
+		for i := range candidates {
+			if used[i] {
+				continue
+			}
+			if sim := ltm.CosineSimilarity(candidates[i].Embedding, candidates[best].Embedding); sim > maxSimilarity[i] {
+				maxSimilarity[i] = sim
+			}
+		}
+	}
+	
+	return selected
+}
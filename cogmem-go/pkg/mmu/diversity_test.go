@@ -0,0 +1,81 @@
+package mmu
+
+import (
+	"testing"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// diversityTestRecords returns two near-duplicate records and one distinct record
+func diversityTestRecords() []ltm.MemoryRecord {
+	return []ltm.MemoryRecord{
+		{ID: "dup-a", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "dog fact a", Embedding: []float32{1, 0.2, 0}},
+		{ID: "dup-b", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "dog fact b", Embedding: []float32{1, 0.25, 0}},
+		{ID: "distinct", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "dog fact c", Embedding: []float32{0.2, 1, 0}},
+	}
+}
+
+func TestApplyMMR(t *testing.T) {
+	query := []float32{1, 1, 0}
+	
+	t.Run("pure relevance", func(t *testing.T) {
+		selected := applyMMR(query, diversityTestRecords(), 1, 2, 0)
+		require.Len(t, selected, 2)
+		assert.Equal(t, "dup-b", selected[0].ID)
+		assert.Equal(t, "dup-a", selected[1].ID)
+	})
+	
+	t.Run("diversity pushes down near-duplicates", func(t *testing.T) {
+		selected := applyMMR(query, diversityTestRecords(), 0.5, 2, 0)
+		require.Len(t, selected, 2)
+		assert.Equal(t, "dup-b", selected[0].ID)
+		assert.Equal(t, "distinct", selected[1].ID)
+	})
+	
+	t.Run("importance counts towards relevance", func(t *testing.T) {
+		records := diversityTestRecords()
+		records[1].Metadata = map[string]interface{}{MetadataKeyImportance: 1.0}
+		records[2].Metadata = map[string]interface{}{MetadataKeyImportance: 10.0}
+		selected := applyMMR(query, records, 1, 1, 0.2)
+		require.Len(t, selected, 1)
+		assert.Equal(t, "distinct", selected[0].ID)
+	})
+	
+	t.Run("records without embeddings come last", func(t *testing.T) {
+		records := append([]ltm.MemoryRecord{{ID: "no-embedding"}}, diversityTestRecords()...)
+		selected := applyMMR(query, records, 0.5, 0, 0)
+		require.Len(t, selected, 4)
+		assert.Equal(t, "no-embedding", selected[3].ID)
+	})
+}
+
+func TestMMU_RetrieveFromLTM_Diversity(t *testing.T) {
+	mmu, ltmStore, scriptEngine, reasoningEngine, ctx := setupVectorTest(t, true)
+	
+	for _, record := range diversityTestRecords() {
+		_, err := ltmStore.Store(ctx, record)
+		require.NoError(t, err)
+	}
+	reasoningEngine.embeddingResults["dog"] = []float32{1, 1, 0}
+	
+	options := DefaultRetrievalOptions()
+	options.Strategy = "semantic"
+	options.MaxResults = 2
+	options.Diversity = 0.5
+	
+	results, err := mmu.RetrieveFromLTM(ctx, "dog", options)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "dup-b", results[0].ID)
+	assert.Equal(t, "distinct", results[1].ID)
+	
+	// MMR must run before the rank_semantic_results hook sees the results
+	last := scriptEngine.calls[len(scriptEngine.calls)-1]
+	assert.Equal(t, "rank_semantic_results", last.FunctionName)
+	ranked, ok := last.Args[0].([]ltm.MemoryRecord)
+	require.True(t, ok)
+	assert.Len(t, ranked, 2)
+}
@@ -0,0 +1,406 @@
+package mmu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/log"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+)
+
+const (
+	// MetadataKeyType classifies a record, e.g. as a conversation turn
+	MetadataKeyType = "type"
+	
+	// MetadataKeySessionID is the conversation session a turn belongs to
+	MetadataKeySessionID = "session_id"
+	
+	// MetadataKeyTurnIndex is the position of a turn in its session, starting at 0
+	MetadataKeyTurnIndex = "turn_index"
+	
+	// MetadataKeyRole is the speaker of a turn
+	MetadataKeyRole = "role"
+	
+	// MetadataKeyTimestamp is when a turn was spoken, in RFC 3339 format
+	MetadataKeyTimestamp = "timestamp"
+	
+	// RecordTypeTurn is the MetadataKeyType of conversation turns
+	RecordTypeTurn = "turn"
+)
+
+// Role identifies the speaker of a conversation turn.
+type Role string
+
+const (
+	// RoleUser is a turn spoken by the user
+	RoleUser Role = "user"
+	
+	// RoleAssistant is a turn spoken by the assistant
+	RoleAssistant Role = "assistant"
+)
+
+// maxSessionRecords bounds the turns read when scanning sessions, since
+// stores apply a small default limit to queries without one
+const maxSessionRecords = 10000
+
+// ErrMissingSessionID is returned when a session operation has no session ID.
+var ErrMissingSessionID = errors.New("session ID is required")
+
+// Turn is a single user or assistant message in a conversation session.
+type Turn struct {
+	// ID is the ID of the turn's memory record
+	ID string `json:"id,omitempty"`
+	
+	// SessionID is the session the turn belongs to
+	SessionID string `json:"session_id"`
+	
+	// Index is the position of the turn in its session, starting at 0
+	Index int `json:"turn_index"`
+	
+	// Role is the speaker of the turn
+	Role Role `json:"role"`
+	
+	// Content is what was said
+	Content string `json:"content"`
+	
+	// UserID is the user whose session the turn belongs to
+	UserID string `json:"user_id,omitempty"`
+	
+	// Timestamp is when the turn was spoken; zero means now when recording
+	Timestamp time.Time `json:"timestamp"`
+	
+	// Metadata is extra metadata stored with the turn
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// SessionSummary describes a conversation session.
+type SessionSummary struct {
+	// SessionID identifies the session
+	SessionID string `json:"session_id"`
+	
+	// UserID is the user the session belongs to
+	UserID string `json:"user_id,omitempty"`
+	
+	// TurnCount is the number of turns stored for the session
+	TurnCount int `json:"turn_count"`
+	
+	// StartedAt is the timestamp of the earliest turn
+	StartedAt time.Time `json:"started_at"`
+	
+	// LastActiveAt is the timestamp of the latest turn
+	LastActiveAt time.Time `json:"last_active_at"`
+}
+
+// EpisodicMemory is implemented by MMUs that store conversations as
+// sequences of turns grouped into sessions.
+type EpisodicMemory interface {
+	// RecordTurns stores turns at the end of a session, each as its own record
+	RecordTurns(ctx context.Context, sessionID string, turns ...Turn) ([]string, error)
+	
+	// SessionTranscript returns the turns of a session in order
+	SessionTranscript(ctx context.Context, sessionID string) ([]Turn, error)
+	
+	// ListSessions returns the sessions of the user in the context, most recently active first
+	ListSessions(ctx context.Context) ([]SessionSummary, error)
+	
+	// SearchSessions retrieves the turns most relevant to a query, within one
+	// session or, if sessionID is empty, across all sessions
+	SearchSessions(ctx context.Context, query string, sessionID string, options RetrievalOptions) ([]ltm.MemoryRecord, error)
+}
+
+// sessionLocks serialises turn numbering per session. A lock is dropped once
+// no caller holds or waits for it, so the map does not grow with sessions.
+type sessionLocks struct {
+	mutex sync.Mutex
+	locks map[string]*sessionLock
+}
+
+// sessionLock is a session's mutex with the number of callers holding or waiting for it
+type sessionLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock acquires the lock for key and returns the function that releases it.
+func (s *sessionLocks) lock(key string) func() {
+	s.mutex.Lock()
+	if s.locks == nil {
+		s.locks = make(map[string]*sessionLock)
+	}
+	l, ok := s.locks[key]
+	if !ok {
+		l = &sessionLock{}
+		s.locks[key] = l
+	}
+	l.refs++
+	s.mutex.Unlock()
+	
+	l.Lock()
+	return func() {
+		l.Unlock()
+		s.mutex.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, key)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// RecordTurns implements the EpisodicMemory interface. Turns are numbered on
+// from the last turn already stored for the session and are private to the
+// user in the context. Concurrent calls for the same session are serialised
+// within this MMU so turn indexes stay unique. Like EncodeBatchToLTM, it
+// returns the IDs of the turns stored before the first error, if any.
+func (m *MMUI) RecordTurns(ctx context.Context, sessionID string, turns ...Turn) ([]string, error) {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return nil, entity.ErrMissingEntityContext
+	}
+	if sessionID == "" {
+		return nil, ErrMissingSessionID
+	}
+	if len(turns) == 0 {
+		return nil, nil
+	}
+	
+	// Read the last index and store the new turns under one lock per session
+	unlock := m.sessionLocks.lock(string(entityCtx.EntityID) + "\x00" + entityCtx.UserID + "\x00" + sessionID)
+	defer unlock()
+	
+	existing, err := m.sessionTurns(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	next := 0
+	for _, record := range existing {
+		if index, ok := metadataInt(record, MetadataKeyTurnIndex); ok && index >= next {
+			next = index + 1
+		}
+	}
+	
+	items := make([]interface{}, len(turns))
+	for i, turn := range turns {
+		timestamp := turn.Timestamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+		}
+		
+		metadata := copyMetadata(turn.Metadata)
+		metadata[MetadataKeyType] = RecordTypeTurn
+		metadata[MetadataKeySessionID] = sessionID
+		metadata[MetadataKeyTurnIndex] = next + i
+		metadata[MetadataKeyRole] = string(turn.Role)
+		metadata[MetadataKeyTimestamp] = timestamp.UTC().Format(time.RFC3339Nano)
+		
+		items[i] = map[string]interface{}{
+			"content":      turn.Content,
+			"metadata":     metadata,
+			"access_level": int(entity.PrivateToUser),
+		}
+	}
+	
+	ids, err := m.EncodeBatchToLTM(ctx, items)
+	if err != nil {
+		return ids, fmt.Errorf("failed to store turn %d of session %s: %w", next+len(ids), sessionID, err)
+	}
+	
+	log.DebugContext(ctx, "Recorded conversation turns",
+		"session_id", sessionID,
+		"first_turn", next,
+		"turns", len(ids))
+	
+	return ids, nil
+}
+
+// SessionTranscript implements the EpisodicMemory interface.
+func (m *MMUI) SessionTranscript(ctx context.Context, sessionID string) ([]Turn, error) {
+	if sessionID == "" {
+		return nil, ErrMissingSessionID
+	}
+	
+	records, err := m.sessionTurns(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	
+	turns := make([]Turn, 0, len(records))
+	for _, record := range records {
+		turns = append(turns, turnFromRecord(record))
+	}
+	sort.SliceStable(turns, func(a, b int) bool {
+		return turns[a].Index < turns[b].Index
+	})
+	return turns, nil
+}
+
+// ListSessions implements the EpisodicMemory interface.
+func (m *MMUI) ListSessions(ctx context.Context) ([]SessionSummary, error) {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return nil, entity.ErrMissingEntityContext
+	}
+	
+	records, err := m.ltmStore.Retrieve(ctx, ltm.LTMQuery{
+		Filters: map[string]interface{}{MetadataKeyType: RecordTypeTurn},
+		Limit:   maxSessionRecords,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve conversation turns: %w", err)
+	}
+	
+	bySession := make(map[string]*SessionSummary)
+	for _, record := range records {
+		if record.UserID != entityCtx.UserID {
+			continue
+		}
+		turn := turnFromRecord(record)
+		if turn.SessionID == "" {
+			continue
+		}
+		
+		summary, ok := bySession[turn.SessionID]
+		if !ok {
+			summary = &SessionSummary{
+				SessionID:    turn.SessionID,
+				UserID:       record.UserID,
+				StartedAt:    turn.Timestamp,
+				LastActiveAt: turn.Timestamp,
+			}
+			bySession[turn.SessionID] = summary
+		}
+		summary.TurnCount++
+		if turn.Timestamp.Before(summary.StartedAt) {
+			summary.StartedAt = turn.Timestamp
+		}
+		if turn.Timestamp.After(summary.LastActiveAt) {
+			summary.LastActiveAt = turn.Timestamp
+		}
+	}
+	
+	sessions := make([]SessionSummary, 0, len(bySession))
+	for _, summary := range bySession {
+		sessions = append(sessions, *summary)
+	}
+	sort.Slice(sessions, func(a, b int) bool {
+		if !sessions[a].LastActiveAt.Equal(sessions[b].LastActiveAt) {
+			return sessions[a].LastActiveAt.After(sessions[b].LastActiveAt)
+		}
+		return sessions[a].SessionID < sessions[b].SessionID
+	})
+	return sessions, nil
+}
+
+// SearchSessions implements the EpisodicMemory interface. The query goes
+// through the normal retrieval pipeline, restricted to the user's turns.
+func (m *MMUI) SearchSessions(ctx context.Context, query string, sessionID string, options RetrievalOptions) ([]ltm.MemoryRecord, error) {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return nil, entity.ErrMissingEntityContext
+	}
+	
+	filters := map[string]interface{}{MetadataKeyType: RecordTypeTurn}
+	if sessionID != "" {
+		filters[MetadataKeySessionID] = sessionID
+	}
+	
+	records, err := m.RetrieveFromLTM(ctx, map[string]interface{}{
+		"text":    query,
+		"filters": filters,
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Not every store enforces access levels, and sessions of users may share an ID
+	results := make([]ltm.MemoryRecord, 0, len(records))
+	for _, record := range records {
+		if record.UserID == entityCtx.UserID {
+			results = append(results, record)
+		}
+	}
+	return results, nil
+}
+
+// sessionTurns returns the stored turns of the user's session in no
+// particular order.
+func (m *MMUI) sessionTurns(ctx context.Context, sessionID string) ([]ltm.MemoryRecord, error) {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return nil, entity.ErrMissingEntityContext
+	}
+	
+	records, err := m.ltmStore.Retrieve(ctx, ltm.LTMQuery{
+		Filters: map[string]interface{}{
+			MetadataKeyType:      RecordTypeTurn,
+			MetadataKeySessionID: sessionID,
+		},
+		Limit: maxSessionRecords,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve turns of session %s: %w", sessionID, err)
+	}
+	
+	turns := records[:0]
+	for _, record := range records {
+		if record.UserID == entityCtx.UserID {
+			turns = append(turns, record)
+		}
+	}
+	return turns, nil
+}
+
+// turnFromRecord converts a stored turn back into a Turn. The timestamp falls
+// back to the record's creation time if it is missing from the metadata.
+func turnFromRecord(record ltm.MemoryRecord) Turn {
+	turn := Turn{
+		ID:        record.ID,
+		Content:   record.Content,
+		UserID:    record.UserID,
+		Timestamp: record.CreatedAt,
+		Metadata:  make(map[string]interface{}),
+	}
+	turn.SessionID, _ = record.Metadata[MetadataKeySessionID].(string)
+	turn.Index, _ = metadataInt(record, MetadataKeyTurnIndex)
+	if role, ok := record.Metadata[MetadataKeyRole].(string); ok {
+		turn.Role = Role(role)
+	}
+	if value, ok := record.Metadata[MetadataKeyTimestamp].(string); ok {
+		if timestamp, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			turn.Timestamp = timestamp
+		}
+	}
+	
+	for key, value := range record.Metadata {
+		switch key {
+		case MetadataKeyType, MetadataKeySessionID, MetadataKeyTurnIndex, MetadataKeyRole, MetadataKeyTimestamp, "encoded_at":
+			continue
+		}
+		turn.Metadata[key] = value
+	}
+	return turn
+}
+
+// metadataInt returns an integer stored in a record's metadata.
+func metadataInt(record ltm.MemoryRecord, key string) (int, bool) {
+	switch v := record.Metadata[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case string:
+		// Some stores persist metadata values as strings
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
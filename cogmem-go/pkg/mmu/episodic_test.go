@@ -0,0 +1,163 @@
+package mmu
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm/adapters/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMMU_EpisodicMemory(t *testing.T) {
+	mmu, _, _, _, ctx := setupTest(t, false)
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	
+	ids, err := mmu.RecordTurns(ctx, "session-1",
+		Turn{Role: RoleUser, Content: "Where should we hold the offsite?", Timestamp: start},
+		Turn{Role: RoleAssistant, Content: "Lisbon was the favourite last year.", Timestamp: start.Add(time.Second)},
+	)
+	require.NoError(t, err)
+	require.Len(t, ids, 2)
+	
+	// Later turns continue the numbering of the session
+	_, err = mmu.RecordTurns(ctx, "session-1", Turn{
+		Role:      RoleUser,
+		Content:   "Book Lisbon then.",
+		Timestamp: start.Add(time.Minute),
+		Metadata:  map[string]interface{}{"channel": "chat"},
+	})
+	require.NoError(t, err)
+	
+	_, err = mmu.RecordTurns(ctx, "session-2", Turn{Role: RoleUser, Content: "What is the budget for Lisbon?", Timestamp: start.Add(time.Hour)})
+	require.NoError(t, err)
+	
+	otherUser := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "other-user"))
+	_, err = mmu.RecordTurns(otherUser, "session-3", Turn{Role: RoleUser, Content: "Lisbon weather?"})
+	require.NoError(t, err)
+	
+	t.Run("transcript", func(t *testing.T) {
+		turns, err := mmu.SessionTranscript(ctx, "session-1")
+		require.NoError(t, err)
+		require.Len(t, turns, 3)
+		for i, turn := range turns {
+			assert.Equal(t, i, turn.Index)
+			assert.Equal(t, "session-1", turn.SessionID)
+			assert.Equal(t, "test-user", turn.UserID)
+		}
+		assert.Equal(t, RoleAssistant, turns[1].Role)
+		assert.Equal(t, "Lisbon was the favourite last year.", turns[1].Content)
+		assert.True(t, start.Add(time.Minute).Equal(turns[2].Timestamp))
+		assert.Equal(t, map[string]interface{}{"channel": "chat"}, turns[2].Metadata)
+		
+		turns, err = mmu.SessionTranscript(otherUser, "session-1")
+		require.NoError(t, err)
+		assert.Empty(t, turns, "turns are private to their user")
+	})
+	
+	t.Run("list sessions", func(t *testing.T) {
+		sessions, err := mmu.ListSessions(ctx)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+		assert.Equal(t, "session-2", sessions[0].SessionID)
+		assert.Equal(t, "session-1", sessions[1].SessionID)
+		assert.Equal(t, 3, sessions[1].TurnCount)
+		assert.True(t, start.Equal(sessions[1].StartedAt))
+		assert.True(t, start.Add(time.Minute).Equal(sessions[1].LastActiveAt))
+	})
+	
+	t.Run("search", func(t *testing.T) {
+		results, err := mmu.SearchSessions(ctx, "Lisbon", "", DefaultRetrievalOptions())
+		require.NoError(t, err)
+		assert.Len(t, results, 3)
+		
+		results, err = mmu.SearchSessions(ctx, "Lisbon", "session-2", DefaultRetrievalOptions())
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "What is the budget for Lisbon?", results[0].Content)
+	})
+	
+	t.Run("session ID is required", func(t *testing.T) {
+		_, err := mmu.RecordTurns(ctx, "", Turn{Role: RoleUser, Content: "Hello"})
+		assert.ErrorIs(t, err, ErrMissingSessionID)
+		_, err = mmu.SessionTranscript(ctx, "")
+		assert.ErrorIs(t, err, ErrMissingSessionID)
+	})
+}
+
+func TestMMU_EpisodicMemory_VectorStore(t *testing.T) {
+	mmu, _, ctx := setupChromemTest(t)
+	otherUser := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "other-user"))
+	
+	// Both users hold a session with the same ID, which the vector store does not tell apart
+	_, err := mmu.RecordTurns(otherUser, "session-1",
+		Turn{Role: RoleUser, Content: "Private question about Lisbon"},
+		Turn{Role: RoleAssistant, Content: "Private answer about Lisbon"},
+	)
+	require.NoError(t, err)
+	_, err = mmu.RecordTurns(ctx, "session-1", Turn{Role: RoleUser, Content: "Lisbon budget?"})
+	require.NoError(t, err)
+	
+	turns, err := mmu.SessionTranscript(ctx, "session-1")
+	require.NoError(t, err)
+	require.Len(t, turns, 1)
+	assert.Equal(t, "Lisbon budget?", turns[0].Content)
+	assert.Equal(t, 0, turns[0].Index, "other users' turns do not shift the numbering")
+	
+	results, err := mmu.SearchSessions(ctx, "Lisbon", "", DefaultRetrievalOptions())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "test-user", results[0].UserID)
+}
+
+// slowRetrieveStore delays returning retrieved records so concurrent writers
+// read before any of them stores
+type slowRetrieveStore struct {
+	*mock.MockStore
+}
+
+func (s slowRetrieveStore) Retrieve(ctx context.Context, query ltm.LTMQuery) ([]ltm.MemoryRecord, error) {
+	records, err := s.MockStore.Retrieve(ctx, query)
+	time.Sleep(5 * time.Millisecond)
+	return records, err
+}
+
+func TestMMU_RecordTurns_ConcurrentSameSession(t *testing.T) {
+	mmu := NewMMU(slowRetrieveStore{mock.NewMockStore()}, newMockReasoningEngine(), newMockScriptEngine(), Config{})
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	const writers = 8
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := mmu.RecordTurns(ctx, "shared-session",
+				Turn{Role: RoleUser, Content: fmt.Sprintf("question %d", i)},
+				Turn{Role: RoleAssistant, Content: fmt.Sprintf("answer %d", i)},
+			)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	
+	turns, err := mmu.SessionTranscript(ctx, "shared-session")
+	require.NoError(t, err)
+	require.Len(t, turns, 2*writers)
+	for i, turn := range turns {
+		assert.Equal(t, i, turn.Index, "turn indexes are unique and contiguous")
+	}
+	
+	// Each call's turns stay adjacent
+	for i := 0; i < len(turns); i += 2 {
+		assert.Equal(t, RoleUser, turns[i].Role)
+		assert.Equal(t, strings.Replace(turns[i].Content, "question", "answer", 1), turns[i+1].Content)
+	}
+	assert.Empty(t, mmu.sessionLocks.locks, "session locks are released")
+}
@@ -0,0 +1,304 @@
+package mmu
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/log"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/reasoning"
+)
+
+const (
+	// StrategyMultiQuery retrieves with several paraphrases of the query and
+	// fuses the results with Reciprocal Rank Fusion
+	StrategyMultiQuery = "multi_query"
+	
+	// StrategyHyDE embeds a hypothetical answer to the query (Hypothetical
+	// Document Embeddings) instead of the query itself
+	StrategyHyDE = "hyde"
+	
+	// defaultQueryVariants is the number of paraphrases generated for multi_query
+	defaultQueryVariants = 3
+	
+	// rrfK dampens the influence of top ranks in Reciprocal Rank Fusion
+	rrfK = 60.0
+)
+
+// listMarkerPattern matches a leading list marker such as "1.", "2)", "-" or "*"
+var listMarkerPattern = regexp.MustCompile(`^\s*(\d+[.)]|[-*])\s+`)
+
+// isSemanticStrategy reports whether a retrieval strategy searches by embedding.
+func isSemanticStrategy(strategy string) bool {
+	switch strategy {
+	case "semantic", StrategyMultiQuery, StrategyHyDE:
+		return true
+	}
+	return false
+}
+
+// queryVariants returns the number of paraphrases to generate for multi_query.
+func queryVariants(options RetrievalOptions) int {
+	if options.QueryVariants < 1 {
+		return defaultQueryVariants
+	}
+	return options.QueryVariants
+}
+
+// generateHyDEEmbedding asks the reasoning engine for a short hypothetical
+// answer to the query and uses its embedding as the query embedding. Terse
+// questions embed poorly against long stored notes; a plausible answer sits
+// much closer to them. The embedding is cached per entity and query text.
+func (m *MMUI) generateHyDEEmbedding(ctx context.Context, query *ltm.LTMQuery) error {
+	key := m.expansionCacheKey(ctx, StrategyHyDE, query.Text)
+	if cached, ok := m.expansionCache.get(key); ok {
+		query.Embedding = cached[0]
+		log.DebugContext(ctx, "Using cached HyDE embedding", "text", truncateString(query.Text, 30))
+		return nil
+	}
+	
+	prompt := "Write a short passage, of the kind a person might have written in their notes, that directly answers the following question. " +
+		"Respond with only the passage.\n\nQuestion: " + query.Text
+	hypothetical, err := m.reasoningEngine.Process(ctx, prompt, reasoning.WithMaxTokens(200))
+	if err != nil {
+		return fmt.Errorf("failed to generate hypothetical document: %w", err)
+	}
+	hypothetical = strings.TrimSpace(hypothetical)
+	if hypothetical == "" {
+		return fmt.Errorf("empty hypothetical document")
+	}
+	
+	embeddings, err := m.reasoningEngine.GenerateEmbeddings(ctx, []string{hypothetical})
+	if err != nil {
+		return fmt.Errorf("failed to embed hypothetical document: %w", err)
+	}
+	if len(embeddings) == 0 || len(embeddings[0]) == 0 {
+		return fmt.Errorf("no embedding returned for hypothetical document")
+	}
+	
+	query.Embedding = embeddings[0]
+	m.expansionCache.put(key, embeddings[:1])
+	
+	log.DebugContext(ctx, "Generated HyDE query embedding",
+		"text", truncateString(query.Text, 30),
+		"hypothetical", truncateString(hypothetical, 60))
+	return nil
+}
+
+// generateQueryVariants asks the reasoning engine for paraphrases of the query
+// text and returns their embeddings. The embeddings are cached per entity,
+// query text and number of variants.
+func (m *MMUI) generateQueryVariants(ctx context.Context, text string, n int) ([][]float32, error) {
+	key := m.expansionCacheKey(ctx, fmt.Sprintf("%s:%d", StrategyMultiQuery, n), text)
+	if cached, ok := m.expansionCache.get(key); ok {
+		log.DebugContext(ctx, "Using cached query variants", "text", truncateString(text, 30), "variants", len(cached))
+		return cached, nil
+	}
+	
+	prompt := fmt.Sprintf("Rewrite the following search query in %d different ways, using different wording and "+
+		"expanding any abbreviations, so that together they find relevant notes. "+
+		"Respond with only a JSON array of %d strings.\n\nQuery: %s", n, n, text)
+	response, err := m.reasoningEngine.Process(ctx, prompt, reasoning.WithTemperature(0.7))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate query variants: %w", err)
+	}
+	
+	variants := parseQueryVariants(response, n)
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("no query variants found in response")
+	}
+	
+	embeddings, err := m.reasoningEngine.GenerateEmbeddings(ctx, variants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query variants: %w", err)
+	}
+	
+	m.expansionCache.put(key, embeddings)
+	
+	log.DebugContext(ctx, "Generated query variants",
+		"text", truncateString(text, 30),
+		"variants", len(variants))
+	return embeddings, nil
+}
+
+// parseQueryVariants extracts up to n paraphrases from a reasoning response,
+// accepting either a JSON array of strings or one paraphrase per line.
+func parseQueryVariants(response string, n int) []string {
+	response = strings.TrimSpace(response)
+	
+	var variants []string
+	if start, end := strings.Index(response, "["), strings.LastIndex(response, "]"); start >= 0 && end > start {
+		if err := json.Unmarshal([]byte(response[start:end+1]), &variants); err != nil {
+			variants = nil
+		}
+	}
+	if variants == nil {
+		for _, line := range strings.Split(response, "\n") {
+			// Strip list markers such as "1.", "-" or "*", keeping leading numbers like years
+			line = strings.TrimSpace(listMarkerPattern.ReplaceAllString(line, ""))
+			line = strings.Trim(line, `"`)
+			if line != "" {
+				variants = append(variants, line)
+			}
+		}
+	}
+	
+	result := make([]string, 0, n)
+	for _, variant := range variants {
+		if variant = strings.TrimSpace(variant); variant != "" {
+			result = append(result, variant)
+		}
+		if len(result) == n {
+			break
+		}
+	}
+	return result
+}
+
+// retrieveMultiQuery runs the query once with its own embedding and once per
+// variant embedding, then fuses the result lists with Reciprocal Rank Fusion.
+// The fused list is not truncated to the query limit. A variant whose
+// retrieval fails is skipped; the original query's error is returned.
+func (m *MMUI) retrieveMultiQuery(ctx context.Context, query ltm.LTMQuery, variants [][]float32) ([]ltm.MemoryRecord, error) {
+	results, err := m.ltmStore.Retrieve(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	lists := [][]ltm.MemoryRecord{results}
+	
+	for _, embedding := range variants {
+		variant := query
+		variant.Embedding = embedding
+		variantResults, err := m.ltmStore.Retrieve(ctx, variant)
+		if err != nil {
+			log.WarnContext(ctx, "Failed to retrieve for query variant", "error", err)
+			continue
+		}
+		calibrateScores(embedding, variantResults)
+		lists = append(lists, variantResults)
+	}
+	calibrateScores(query.Embedding, results)
+	
+	fused := fuseReciprocalRank(lists)
+	
+	log.DebugContext(ctx, "Fused multi-query results",
+		"queries", len(lists),
+		"fused", len(fused))
+	return fused, nil
+}
+
+// fuseReciprocalRank merges ranked result lists, scoring each record by the
+// sum of 1/(k + rank) over the lists it appears in. Duplicates are collapsed,
+// keeping the highest similarity Score seen for the record.
+func fuseReciprocalRank(lists [][]ltm.MemoryRecord) []ltm.MemoryRecord {
+	type fusedRecord struct {
+		record ltm.MemoryRecord
+		rrf    float64
+		first  int
+	}
+	
+	byID := make(map[string]*fusedRecord)
+	var order []*fusedRecord
+	for _, records := range lists {
+		for rank, record := range records {
+			entry, ok := byID[record.ID]
+			if !ok {
+				entry = &fusedRecord{record: record, first: len(order)}
+				byID[record.ID] = entry
+				order = append(order, entry)
+			} else if record.Score > entry.record.Score {
+				entry.record.Score = record.Score
+			}
+			entry.rrf += 1 / (rrfK + float64(rank+1))
+		}
+	}
+	
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].rrf > order[j].rrf
+	})
+	
+	fused := make([]ltm.MemoryRecord, len(order))
+	for i, entry := range order {
+		fused[i] = entry.record
+	}
+	return fused
+}
+
+// expansionCacheKey scopes cached query expansions to the entity in the context.
+func (m *MMUI) expansionCacheKey(ctx context.Context, strategy, text string) string {
+	var entityID entity.EntityID
+	if entityCtx, ok := entity.GetEntityContext(ctx); ok {
+		entityID = entityCtx.EntityID
+	}
+	return string(entityID) + "\x00" + strategy + "\x00" + text
+}
+
+// expansionCache is a bounded, least-recently-used cache of query expansion
+// embeddings, safe for concurrent use.
+type expansionCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+// expansionCacheEntry is a single cached expansion
+type expansionCacheEntry struct {
+	key        string
+	embeddings [][]float32
+}
+
+// newExpansionCache creates a cache holding up to capacity expansions.
+// A capacity below one disables caching.
+func newExpansionCache(capacity int) *expansionCache {
+	return &expansionCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the cached embeddings for key, if any.
+func (c *expansionCache) get(key string) ([][]float32, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*expansionCacheEntry).embeddings, true
+}
+
+// put caches embeddings for key, evicting the least recently used entry when full.
+func (c *expansionCache) put(key string, embeddings [][]float32) {
+	if c == nil || c.capacity < 1 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*expansionCacheEntry).embeddings = embeddings
+		c.order.MoveToFront(element)
+		return
+	}
+	
+	c.entries[key] = c.order.PushFront(&expansionCacheEntry{key: key, embeddings: embeddings})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*expansionCacheEntry).key)
+	}
+}
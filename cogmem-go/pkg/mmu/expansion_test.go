@@ -0,0 +1,136 @@
+package mmu
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQueryVariants(t *testing.T) {
+	t.Run("json array", func(t *testing.T) {
+		variants := parseQueryVariants(`Sure: ["cat food brands", "what do cats eat", "feline diet"]`, 2)
+		assert.Equal(t, []string{"cat food brands", "what do cats eat"}, variants)
+	})
+	
+	t.Run("numbered lines", func(t *testing.T) {
+		variants := parseQueryVariants("1. cat food brands\n2. \"what do cats eat\"\n\n- feline diet", 3)
+		assert.Equal(t, []string{"cat food brands", "what do cats eat", "feline diet"}, variants)
+	})
+	
+	t.Run("leading numbers are kept", func(t *testing.T) {
+		variants := parseQueryVariants("1. 2024 tax rules\n2) 401k limits\n3 tax brackets", 3)
+		assert.Equal(t, []string{"2024 tax rules", "401k limits", "3 tax brackets"}, variants)
+	})
+	
+	t.Run("empty response", func(t *testing.T) {
+		assert.Empty(t, parseQueryVariants("  ", 3))
+	})
+}
+
+func TestFuseReciprocalRank(t *testing.T) {
+	lists := [][]ltm.MemoryRecord{
+		{{ID: "a", Score: 0.9}, {ID: "b", Score: 0.5}},
+		{{ID: "b", Score: 0.8}, {ID: "c", Score: 0.7}},
+		{{ID: "b", Score: 0.6}, {ID: "a", Score: 0.4}},
+	}
+	
+	fused := fuseReciprocalRank(lists)
+	require.Len(t, fused, 3)
+	assert.Equal(t, "b", fused[0].ID, "ranked highly in every list")
+	assert.Equal(t, "a", fused[1].ID)
+	assert.Equal(t, "c", fused[2].ID)
+	assert.Equal(t, 0.8, fused[0].Score, "keeps the best similarity seen")
+}
+
+func TestExpansionCache(t *testing.T) {
+	cache := newExpansionCache(2)
+	cache.put("a", [][]float32{{1}})
+	cache.put("b", [][]float32{{2}})
+	
+	// Touch "a" so "b" is the least recently used
+	_, ok := cache.get("a")
+	require.True(t, ok)
+	cache.put("c", [][]float32{{3}})
+	
+	_, ok = cache.get("b")
+	assert.False(t, ok)
+	cached, ok := cache.get("a")
+	require.True(t, ok)
+	assert.Equal(t, [][]float32{{1}}, cached)
+	
+	// A disabled cache stores nothing
+	disabled := newExpansionCache(0)
+	disabled.put("a", [][]float32{{1}})
+	_, ok = disabled.get("a")
+	assert.False(t, ok)
+}
+
+// storeExpansionRecords stores a short note and a long note about cats
+func storeExpansionRecords(t *testing.T, ctx context.Context, ltmStore *mockVectorCapableLTMStore) {
+	records := []ltm.MemoryRecord{
+		{ID: "note", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "the cat eats salmon kibble every morning", Embedding: []float32{1, 0, 0}},
+		{ID: "other", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "the cat sleeps on the sofa", Embedding: []float32{0, 1, 0}},
+	}
+	for _, record := range records {
+		_, err := ltmStore.Store(ctx, record)
+		require.NoError(t, err)
+	}
+}
+
+func TestMMU_RetrieveFromLTM_HyDE(t *testing.T) {
+	mmu, ltmStore, _, reasoningEngine, ctx := setupVectorTest(t, true)
+	mmu.expansionCache = newExpansionCache(8)
+	storeExpansionRecords(t, ctx, ltmStore)
+	
+	hypothetical := "The cat eats salmon kibble for breakfast."
+	reasoningEngine.defaultProcessResult = hypothetical
+	reasoningEngine.embeddingResults[hypothetical] = []float32{1, 0.1, 0}
+	reasoningEngine.embeddingResults["cat"] = []float32{0, 1, 0}
+	
+	options := DefaultRetrievalOptions()
+	options.Strategy = StrategyHyDE
+	options.MinScore = 0.5
+	
+	results, err := mmu.RetrieveFromLTM(ctx, "cat", options)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "note", results[0].ID, "matched against the hypothetical answer, not the raw query")
+	
+	// Repeating the query reuses the cached embedding
+	_, err = mmu.RetrieveFromLTM(ctx, "cat", options)
+	require.NoError(t, err)
+	assert.Equal(t, 1, countCalls(reasoningEngine.calls, "Process"))
+	assert.Equal(t, 1, countCalls(reasoningEngine.calls, "GenerateEmbeddings"))
+}
+
+func TestMMU_RetrieveFromLTM_MultiQuery(t *testing.T) {
+	mmu, ltmStore, _, reasoningEngine, ctx := setupVectorTest(t, true)
+	mmu.expansionCache = newExpansionCache(8)
+	storeExpansionRecords(t, ctx, ltmStore)
+	
+	reasoningEngine.defaultProcessResult = `["what does the cat eat", "cat breakfast"]`
+	reasoningEngine.embeddingResults["cat"] = []float32{0, 1, 0}
+	reasoningEngine.embeddingResults["what does the cat eat"] = []float32{1, 0, 0}
+	reasoningEngine.embeddingResults["cat breakfast"] = []float32{1, 0.2, 0}
+	
+	options := DefaultRetrievalOptions()
+	options.Strategy = StrategyMultiQuery
+	options.QueryVariants = 2
+	
+	results, err := mmu.RetrieveFromLTM(ctx, "cat", options)
+	require.NoError(t, err)
+	require.Len(t, results, 2, "duplicates across variants are fused")
+	for _, result := range results {
+		assert.Greater(t, result.Score, 0.9, "best similarity across the variants")
+	}
+	
+	// The variants are generated once and embedded in a single call
+	_, err = mmu.RetrieveFromLTM(ctx, "cat", options)
+	require.NoError(t, err)
+	assert.Equal(t, 1, countCalls(reasoningEngine.calls, "Process"))
+	assert.Equal(t, 3, countCalls(reasoningEngine.calls, "GenerateEmbeddings"), "query twice, variants once")
+}
@@ -0,0 +1,295 @@
+package mmu
+
+import (
+	"reflect"
+
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+)
+
+// MetadataKeyExplain is the metadata key holding a result's *ResultExplanation
+// when RetrievalOptions.Explain is set
+const MetadataKeyExplain = "explain"
+
+// Reasons a candidate was filtered out of the results
+const (
+	// FilterReasonAfterRetrieveHook means the after_retrieve Lua hook removed the candidate
+	FilterReasonAfterRetrieveHook = "after_retrieve_hook"
+	
+	// FilterReasonMinScore means the candidate scored below RetrievalOptions.MinScore
+	FilterReasonMinScore = "min_score"
+	
+	// FilterReasonFusionLimit means the candidate ranked below the limit after multi-query fusion
+	FilterReasonFusionLimit = "fusion_limit"
+	
+	// FilterReasonDiversity means MMR selected other candidates instead
+	FilterReasonDiversity = "diversity"
+	
+	// FilterReasonRankHook means the rank_semantic_results Lua hook removed the candidate
+	FilterReasonRankHook = "rank_semantic_results_hook"
+)
+
+// Sources of the query embedding
+const (
+	// EmbeddingSourceProvided means the caller supplied the embedding
+	EmbeddingSourceProvided = "provided"
+	
+	// EmbeddingSourceQuery means the query text was embedded
+	EmbeddingSourceQuery = "query"
+	
+	// EmbeddingSourceHyDE means a hypothetical answer was embedded
+	EmbeddingSourceHyDE = "hyde"
+)
+
+// RetrievalExplanation describes how a retrieval was carried out. It is shared
+// by the ResultExplanation of every result of the retrieval.
+type RetrievalExplanation struct {
+	// Strategy is the requested retrieval strategy
+	Strategy string `json:"strategy"`
+	
+	// OriginalText is the query text as given by the caller
+	OriginalText string `json:"original_text"`
+	
+	// SentQuery is the query sent to the store, after the before_retrieve hook
+	// and candidate over-fetching; its embedding is omitted
+	SentQuery ltm.LTMQuery `json:"sent_query"`
+	
+	// RewrittenByHook reports whether the before_retrieve hook changed the query
+	RewrittenByHook bool `json:"rewritten_by_hook"`
+	
+	// EmbeddingGenerated reports whether an embedding was generated for the query
+	EmbeddingGenerated bool `json:"embedding_generated"`
+	
+	// EmbeddingSource is where the query embedding came from ("provided", "query", "hyde"),
+	// empty when the retrieval was not semantic
+	EmbeddingSource string `json:"embedding_source,omitempty"`
+	
+	// QueryVariants is the number of paraphrases fused by the multi_query strategy
+	QueryVariants int `json:"query_variants,omitempty"`
+	
+	// Candidates is the number of records returned by the store
+	Candidates int `json:"candidates"`
+	
+	// Filtered lists the candidates that did not make it into the results
+	Filtered []FilteredCandidate `json:"filtered"`
+}
+
+// FilteredCandidate is a candidate that was dropped during retrieval.
+type FilteredCandidate struct {
+	// ID is the record ID
+	ID string `json:"id"`
+	
+	// Reason is the stage that dropped the candidate (see the FilterReason constants)
+	Reason string `json:"reason"`
+	
+	// Score is the candidate's normalized similarity when it was dropped
+	Score float64 `json:"score"`
+}
+
+// ResultExplanation traces how a single result was scored and ranked.
+type ResultExplanation struct {
+	// Retrieval describes the retrieval as a whole
+	Retrieval *RetrievalExplanation `json:"retrieval"`
+	
+	// BackendRank is the 1-based position in the store's results
+	BackendRank int `json:"backend_rank"`
+	
+	// BackendScore is the normalized score reported by the store (0 if none)
+	BackendScore float64 `json:"backend_score"`
+	
+	// Score is the normalized similarity after calibration
+	Score float64 `json:"score"`
+	
+	// FusionRank is the 1-based position after multi-query fusion (0 if not fused)
+	FusionRank int `json:"fusion_rank,omitempty"`
+	
+	// ImportanceRank is the 1-based position after importance weighting (0 if not weighted)
+	ImportanceRank int `json:"importance_rank,omitempty"`
+	
+	// DiversityRank is the 1-based MMR selection order (0 if MMR was not applied)
+	DiversityRank int `json:"diversity_rank,omitempty"`
+	
+	// RerankRank is the 1-based position after the reranker (0 if not re-ranked)
+	RerankRank int `json:"rerank_rank,omitempty"`
+	
+	// RerankScore is the relevance score assigned by the reranker, if it reported one
+	RerankScore *float64 `json:"rerank_score,omitempty"`
+	
+	// LuaModified reports whether the rank_semantic_results hook moved this result
+	LuaModified bool `json:"lua_modified"`
+	
+	// FinalPosition is the 1-based position in the returned results
+	FinalPosition int `json:"final_position"`
+}
+
+// retrievalTrace collects the explanation of a retrieval. A nil trace
+// records nothing, so callers need not check whether explain mode is on.
+type retrievalTrace struct {
+	retrieval *RetrievalExplanation
+	results   map[string]*ResultExplanation
+}
+
+// newRetrievalTrace returns a trace when explain mode is on, nil otherwise.
+func newRetrievalTrace(options RetrievalOptions) *retrievalTrace {
+	if !options.Explain {
+		return nil
+	}
+	return &retrievalTrace{
+		retrieval: &RetrievalExplanation{
+			Strategy: options.Strategy,
+			Filtered: []FilteredCandidate{},
+		},
+		results: make(map[string]*ResultExplanation),
+	}
+}
+
+// query records the query text and embedding before the before_retrieve hook runs.
+func (t *retrievalTrace) query(text string, embeddingSource string) {
+	if t == nil {
+		return
+	}
+	t.retrieval.OriginalText = text
+	t.retrieval.EmbeddingSource = embeddingSource
+	t.retrieval.EmbeddingGenerated = embeddingSource == EmbeddingSourceQuery || embeddingSource == EmbeddingSourceHyDE
+}
+
+// sent records the query sent to the store and whether the hook rewrote it.
+func (t *retrievalTrace) sent(beforeHook, sent ltm.LTMQuery) {
+	if t == nil {
+		return
+	}
+	t.retrieval.RewrittenByHook = !reflect.DeepEqual(beforeHook, sent)
+	sent.Embedding = nil
+	t.retrieval.SentQuery = sent
+}
+
+// candidates records the store's results in backend order.
+func (t *retrievalTrace) candidates(records []ltm.MemoryRecord, fused bool, variants int) {
+	if t == nil {
+		return
+	}
+	t.retrieval.Candidates = len(records)
+	t.retrieval.QueryVariants = variants
+	for i, record := range records {
+		result := &ResultExplanation{
+			Retrieval:    t.retrieval,
+			BackendRank:  i + 1,
+			BackendScore: record.Score,
+			Score:        record.Score,
+		}
+		if fused {
+			result.FusionRank = i + 1
+		}
+		t.results[record.ID] = result
+	}
+}
+
+// scores records calibrated scores.
+func (t *retrievalTrace) scores(records []ltm.MemoryRecord) {
+	if t == nil {
+		return
+	}
+	for _, record := range records {
+		if result, ok := t.results[record.ID]; ok {
+			result.Score = record.Score
+		}
+	}
+}
+
+// dropped records every record in before that is missing from after as filtered for reason.
+func (t *retrievalTrace) dropped(before, after []ltm.MemoryRecord, reason string) {
+	if t == nil {
+		return
+	}
+	kept := make(map[string]bool, len(after))
+	for _, record := range after {
+		kept[record.ID] = true
+	}
+	for _, record := range before {
+		if !kept[record.ID] {
+			t.retrieval.Filtered = append(t.retrieval.Filtered, FilteredCandidate{
+				ID:     record.ID,
+				Reason: reason,
+				Score:  record.Score,
+			})
+		}
+	}
+}
+
+// weighted records the order after importance weighting.
+func (t *retrievalTrace) weighted(records []ltm.MemoryRecord) {
+	if t == nil {
+		return
+	}
+	for i, record := range records {
+		if result, ok := t.results[record.ID]; ok {
+			result.ImportanceRank = i + 1
+		}
+	}
+}
+
+// diversified records the MMR selection order.
+func (t *retrievalTrace) diversified(records []ltm.MemoryRecord) {
+	if t == nil {
+		return
+	}
+	for i, record := range records {
+		if result, ok := t.results[record.ID]; ok {
+			result.DiversityRank = i + 1
+		}
+	}
+}
+
+// reranked records the reranker's order and any score it reported.
+func (t *retrievalTrace) reranked(records []ltm.MemoryRecord) {
+	if t == nil {
+		return
+	}
+	for i, record := range records {
+		result, ok := t.results[record.ID]
+		if !ok {
+			continue
+		}
+		result.RerankRank = i + 1
+		if score, ok := record.Metadata[MetadataKeyRerankScore].(float64); ok {
+			result.RerankScore = &score
+		}
+	}
+}
+
+// luaRanked records which results the rank_semantic_results hook moved.
+func (t *retrievalTrace) luaRanked(before, after []ltm.MemoryRecord) {
+	if t == nil {
+		return
+	}
+	t.dropped(before, after, FilterReasonRankHook)
+	
+	position := make(map[string]int, len(before))
+	for i, record := range before {
+		position[record.ID] = i
+	}
+	for i, record := range after {
+		if result, ok := t.results[record.ID]; ok {
+			if previous, found := position[record.ID]; !found || previous != i {
+				result.LuaModified = true
+			}
+		}
+	}
+}
+
+// attach records final positions and attaches each result's explanation to its metadata.
+func (t *retrievalTrace) attach(records []ltm.MemoryRecord) {
+	if t == nil {
+		return
+	}
+	for i := range records {
+		result, ok := t.results[records[i].ID]
+		if !ok {
+			// Introduced by a hook rather than retrieved from the store
+			result = &ResultExplanation{Retrieval: t.retrieval, LuaModified: true, Score: records[i].Score}
+			t.results[records[i].ID] = result
+		}
+		result.FinalPosition = i + 1
+		records[i].Metadata = copyMetadata(records[i].Metadata)
+		records[i].Metadata[MetadataKeyExplain] = result
+	}
+}
@@ -0,0 +1,117 @@
+package mmu
+
+import (
+	"testing"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// explainOf returns the explanation attached to a result
+func explainOf(t *testing.T, record ltm.MemoryRecord) *ResultExplanation {
+	explanation, ok := record.Metadata[MetadataKeyExplain].(*ResultExplanation)
+	require.True(t, ok, "result %s has no explanation", record.ID)
+	return explanation
+}
+
+func TestMMU_ExplainRetrieval(t *testing.T) {
+	mmu, ltmStore, scriptEngine, reasoningEngine, ctx := setupVectorTest(t, true)
+	
+	records := []ltm.MemoryRecord{
+		{ID: "close", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "the cat eats salmon", Embedding: []float32{1, 0, 0}},
+		{ID: "near", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "the cat eats kibble", Embedding: []float32{1, 0.5, 0}},
+		{ID: "far", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "the cat has a passport", Embedding: []float32{0, 0, 1}},
+	}
+	for _, record := range records {
+		_, err := ltmStore.Store(ctx, record)
+		require.NoError(t, err)
+	}
+	reasoningEngine.embeddingResults["kitty"] = []float32{1, 0, 0}
+	
+	// The before_retrieve hook rewrites the text, the rank hook keeps only "near"
+	scriptEngine.functionResults["before_retrieve"] = map[string]interface{}{"text": "cat", "limit": float64(10)}
+	
+	options := DefaultRetrievalOptions()
+	options.Strategy = "semantic"
+	options.MinScore = 0.5
+	
+	t.Run("traces the query and filtered candidates", func(t *testing.T) {
+		results, explanation, err := mmu.ExplainRetrieval(ctx, "kitty", options)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		
+		assert.Equal(t, "kitty", explanation.OriginalText)
+		assert.Equal(t, "cat", explanation.SentQuery.Text)
+		assert.Nil(t, explanation.SentQuery.Embedding)
+		assert.True(t, explanation.RewrittenByHook)
+		assert.True(t, explanation.EmbeddingGenerated)
+		assert.Equal(t, EmbeddingSourceQuery, explanation.EmbeddingSource)
+		assert.Equal(t, 3, explanation.Candidates)
+		
+		require.Len(t, explanation.Filtered, 1)
+		assert.Equal(t, "far", explanation.Filtered[0].ID)
+		assert.Equal(t, FilterReasonMinScore, explanation.Filtered[0].Reason)
+		
+		for i, result := range results {
+			resultExplanation := explainOf(t, result)
+			assert.Same(t, explanation, resultExplanation.Retrieval)
+			assert.Equal(t, i+1, resultExplanation.FinalPosition)
+			assert.NotZero(t, resultExplanation.BackendRank)
+			assert.Equal(t, result.Score, resultExplanation.Score)
+			assert.False(t, resultExplanation.LuaModified)
+		}
+	})
+	
+	t.Run("traces Lua ranking", func(t *testing.T) {
+		near := records[1]
+		near.Score = 0.9
+		scriptEngine.functionResults["rank_semantic_results"] = []ltm.MemoryRecord{near}
+		defer delete(scriptEngine.functionResults, "rank_semantic_results")
+		
+		results, explanation, err := mmu.ExplainRetrieval(ctx, "kitty", options)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		
+		assert.Equal(t, 1, explainOf(t, results[0]).FinalPosition)
+		reasons := map[string]string{}
+		for _, filtered := range explanation.Filtered {
+			reasons[filtered.ID] = filtered.Reason
+		}
+		assert.Equal(t, map[string]string{"far": FilterReasonMinScore, "close": FilterReasonRankHook}, reasons)
+	})
+	
+	t.Run("explanation survives metadata removal", func(t *testing.T) {
+		explainOptions := options
+		explainOptions.Explain = true
+		explainOptions.IncludeMetadata = false
+		
+		results, err := mmu.RetrieveFromLTM(ctx, "kitty", explainOptions)
+		require.NoError(t, err)
+		require.NotEmpty(t, results)
+		assert.Len(t, results[0].Metadata, 1)
+		explainOf(t, results[0])
+	})
+	
+	t.Run("no explanation by default", func(t *testing.T) {
+		results, err := mmu.RetrieveFromLTM(ctx, "kitty", options)
+		require.NoError(t, err)
+		require.NotEmpty(t, results)
+		assert.NotContains(t, results[0].Metadata, MetadataKeyExplain)
+		assert.NotContains(t, ltmStore.GetRecord("close").Metadata, MetadataKeyExplain, "stored records are not mutated")
+	})
+}
+
+func TestRetrievalTrace_Nil(t *testing.T) {
+	var trace *retrievalTrace
+	records := []ltm.MemoryRecord{{ID: "a"}}
+	
+	// A nil trace must be safe to use at every stage
+	trace.query("text", EmbeddingSourceQuery)
+	trace.sent(ltm.LTMQuery{}, ltm.LTMQuery{})
+	trace.candidates(records, false, 0)
+	trace.dropped(records, nil, FilterReasonMinScore)
+	trace.attach(records)
+	assert.Nil(t, records[0].Metadata)
+}
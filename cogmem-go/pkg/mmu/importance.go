@@ -0,0 +1,210 @@
+package mmu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lexlapax/cogmem/pkg/log"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/reasoning"
+)
+
+const (
+	// MetadataKeyImportance is the metadata key holding a memory's importance score (1-10)
+	MetadataKeyImportance = "importance"
+
+	// MetadataKeyImportanceSource records who assigned the importance score ("llm" or "lua")
+	MetadataKeyImportanceSource = "importance_source"
+
+	// minImportance and maxImportance bound the importance scale
+	minImportance = 1.0
+	maxImportance = 10.0
+
+	// defaultImportance is assumed for records that were never scored
+	defaultImportance = 5.0
+)
+
+// numberPattern matches the first number in a free-text reasoning response
+var numberPattern = regexp.MustCompile(`-?\d+(\.\d+)?`)
+
+// scoreImportance rates the importance of the given records and writes the
+// score to their metadata. Records that already carry a score are left alone.
+// Failures are logged and leave the record unscored; they never block encoding.
+func (m *MMUI) scoreImportance(ctx context.Context, records []*ltm.MemoryRecord) {
+	var short, long []*ltm.MemoryRecord
+	
+	for _, record := range records {
+		if _, ok := record.Metadata[MetadataKeyImportance]; ok {
+			continue
+		}
+		
+		// Give the Lua hook a chance to score or skip the record cheaply
+		if m.hooksEnabled(ctx) {
+			result, err := m.scriptEngine.ExecuteFunction(ctx, scoreImportanceFuncName, record.Content)
+			if err == nil {
+				switch v := result.(type) {
+				case float64:
+					setImportance(record, v, "lua")
+					continue
+				case bool:
+					if !v {
+						log.DebugContext(ctx, "Importance scoring skipped by Lua hook", "record_id", record.ID)
+						continue
+					}
+				}
+			}
+		}
+		
+		if len(record.Content) < m.importanceShortInputChars() {
+			short = append(short, record)
+		} else {
+			long = append(long, record)
+		}
+	}
+	
+	if m.reasoningEngine == nil {
+		return
+	}
+	
+	// Short inputs are rated together, long ones individually
+	batchSize := m.importanceBatchSize()
+	for start := 0; start < len(short); start += batchSize {
+		end := start + batchSize
+		if end > len(short) {
+			end = len(short)
+		}
+		m.scoreImportanceBatch(ctx, short[start:end])
+	}
+	for _, record := range long {
+		m.scoreImportanceBatch(ctx, []*ltm.MemoryRecord{record})
+	}
+}
+
+// scoreImportanceBatch asks the reasoning engine to rate a batch of records in one call.
+func (m *MMUI) scoreImportanceBatch(ctx context.Context, batch []*ltm.MemoryRecord) {
+	if len(batch) == 0 {
+		return
+	}
+	
+	contents := make([]string, len(batch))
+	for i, record := range batch {
+		contents[i] = record.Content
+	}
+	
+	response, err := m.reasoningEngine.Process(ctx, buildImportancePrompt(contents),
+		reasoning.WithTemperature(0),
+		reasoning.WithMaxTokens(16+8*len(batch)),
+	)
+	if err != nil {
+		log.WarnContext(ctx, "Failed to score memory importance", "error", err, "batch_size", len(batch))
+		return
+	}
+	
+	scores, err := parseImportanceScores(response, len(batch))
+	if err != nil {
+		log.WarnContext(ctx, "Failed to parse importance scores",
+			"error", err,
+			"response", truncateString(response, 100))
+		return
+	}
+	
+	for i, record := range batch {
+		setImportance(record, scores[i], "llm")
+	}
+	
+	log.DebugContext(ctx, "Scored memory importance", "batch_size", len(batch))
+}
+
+// buildImportancePrompt creates the prompt used to rate one or more memories.
+func buildImportancePrompt(contents []string) string {
+	var sb strings.Builder
+	sb.WriteString("On a scale of 1 to 10, rate how important it is to remember each of the following memories long term. ")
+	sb.WriteString("1 is trivial small talk (e.g. \"I like dogs\"); 10 is critical information such as security events, commitments or deadlines (e.g. \"my API key rotated\").\n\n")
+	
+	for i, content := range contents {
+		sb.WriteString(fmt.Sprintf("Memory %d: %s\n", i+1, content))
+	}
+	
+	sb.WriteString(fmt.Sprintf("\nRespond with only a JSON array of %d numbers, one score per memory in order, e.g. [3, 8].", len(contents)))
+	return sb.String()
+}
+
+// parseImportanceScores extracts the expected number of scores from a reasoning response.
+func parseImportanceScores(response string, expected int) ([]float64, error) {
+	response = strings.TrimSpace(response)
+	
+	// Prefer a JSON array anywhere in the response
+	if start, end := strings.Index(response, "["), strings.LastIndex(response, "]"); start >= 0 && end > start {
+		var scores []float64
+		if err := json.Unmarshal([]byte(response[start:end+1]), &scores); err == nil {
+			if len(scores) != expected {
+				return nil, fmt.Errorf("expected %d scores, got %d", expected, len(scores))
+			}
+			return scores, nil
+		}
+	}
+	
+	// A single score may come back as a bare number
+	if expected == 1 {
+		if match := numberPattern.FindString(response); match != "" {
+			score, err := strconv.ParseFloat(match, 64)
+			if err == nil {
+				return []float64{score}, nil
+			}
+		}
+	}
+	
+	return nil, fmt.Errorf("no importance scores found in response")
+}
+
+// setImportance clamps a score to the importance scale and records it in metadata.
+func setImportance(record *ltm.MemoryRecord, score float64, source string) {
+	if score < minImportance {
+		score = minImportance
+	} else if score > maxImportance {
+		score = maxImportance
+	}
+	
+	if record.Metadata == nil {
+		record.Metadata = make(map[string]interface{})
+	}
+	record.Metadata[MetadataKeyImportance] = score
+	record.Metadata[MetadataKeyImportanceSource] = source
+}
+
+// importanceOf returns the importance score of a record, or the default when unscored.
+func importanceOf(record ltm.MemoryRecord) float64 {
+	switch v := record.Metadata[MetadataKeyImportance].(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case string:
+		if score, err := strconv.ParseFloat(v, 64); err == nil {
+			return score
+		}
+	}
+	return defaultImportance
+}
+
+// importanceBatchSize returns the configured batch size, defaulting when unset.
+func (m *MMUI) importanceBatchSize() int {
+	if m.config.ImportanceBatchSize <= 0 {
+		return DefaultConfig().ImportanceBatchSize
+	}
+	return m.config.ImportanceBatchSize
+}
+
+// importanceShortInputChars returns the configured short-input threshold, defaulting when unset.
+func (m *MMUI) importanceShortInputChars() int {
+	if m.config.ImportanceShortInputChars <= 0 {
+		return DefaultConfig().ImportanceShortInputChars
+	}
+	return m.config.ImportanceShortInputChars
+}
@@ -0,0 +1,142 @@
+package mmu
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countCalls returns how many recorded calls were made to the named function
+func countCalls(calls []mockCall, name string) int {
+	count := 0
+	for _, call := range calls {
+		if call.FunctionName == name {
+			count++
+		}
+	}
+	return count
+}
+
+func TestMMU_EncodeToLTM_ImportanceScoring(t *testing.T) {
+	mmu, ltmStore, _, reasoningEngine, ctx := setupTest(t, false)
+	mmu.config.EnableImportanceScoring = true
+	reasoningEngine.defaultProcessResult = "[8]"
+	
+	memoryID, err := mmu.EncodeToLTM(ctx, "my API key rotated")
+	require.NoError(t, err)
+	
+	record := ltmStore.GetRecord(memoryID)
+	assert.Equal(t, 8.0, record.Metadata[MetadataKeyImportance])
+	assert.Equal(t, "llm", record.Metadata[MetadataKeyImportanceSource])
+	assert.Equal(t, 1, countCalls(reasoningEngine.calls, "Process"))
+}
+
+func TestMMU_EncodeToLTM_ImportanceScoringDisabled(t *testing.T) {
+	mmu, ltmStore, _, reasoningEngine, ctx := setupTest(t, false)
+	
+	memoryID, err := mmu.EncodeToLTM(ctx, "I like dogs")
+	require.NoError(t, err)
+	
+	record := ltmStore.GetRecord(memoryID)
+	assert.NotContains(t, record.Metadata, MetadataKeyImportance)
+	assert.Equal(t, 0, countCalls(reasoningEngine.calls, "Process"))
+}
+
+func TestMMU_EncodeToLTM_ImportanceScoringOutOfRange(t *testing.T) {
+	mmu, ltmStore, _, reasoningEngine, ctx := setupTest(t, false)
+	mmu.config.EnableImportanceScoring = true
+	reasoningEngine.defaultProcessResult = "Importance: 42"
+	
+	memoryID, err := mmu.EncodeToLTM(ctx, "remember this")
+	require.NoError(t, err)
+	
+	record := ltmStore.GetRecord(memoryID)
+	assert.Equal(t, maxImportance, record.Metadata[MetadataKeyImportance])
+}
+
+func TestMMU_EncodeToLTM_ImportanceLuaHook(t *testing.T) {
+	t.Run("hook provides score", func(t *testing.T) {
+		mmu, ltmStore, scriptEngine, reasoningEngine, ctx := setupTest(t, true)
+		mmu.config.EnableImportanceScoring = true
+		scriptEngine.functionResults["score_importance"] = float64(2)
+		
+		memoryID, err := mmu.EncodeToLTM(ctx, "I like dogs")
+		require.NoError(t, err)
+		
+		record := ltmStore.GetRecord(memoryID)
+		assert.Equal(t, 2.0, record.Metadata[MetadataKeyImportance])
+		assert.Equal(t, "lua", record.Metadata[MetadataKeyImportanceSource])
+		assert.Equal(t, 0, countCalls(reasoningEngine.calls, "Process"))
+	})
+	
+	t.Run("hook skips scoring", func(t *testing.T) {
+		mmu, ltmStore, scriptEngine, reasoningEngine, ctx := setupTest(t, true)
+		mmu.config.EnableImportanceScoring = true
+		scriptEngine.functionResults["score_importance"] = false
+		
+		memoryID, err := mmu.EncodeToLTM(ctx, "I like dogs")
+		require.NoError(t, err)
+		
+		record := ltmStore.GetRecord(memoryID)
+		assert.NotContains(t, record.Metadata, MetadataKeyImportance)
+		assert.Equal(t, 0, countCalls(reasoningEngine.calls, "Process"))
+	})
+}
+
+func TestMMU_EncodeBatchToLTM_BatchesShortInputs(t *testing.T) {
+	mmu, ltmStore, _, reasoningEngine, ctx := setupTest(t, false)
+	mmu.config.EnableImportanceScoring = true
+	mmu.config.ImportanceBatchSize = 10
+	reasoningEngine.defaultProcessResult = "[2, 9, 5]"
+	
+	ids, err := mmu.EncodeBatchToLTM(ctx, []interface{}{
+		"I like dogs",
+		"my API key rotated",
+		"meeting moved to Tuesday",
+	})
+	require.NoError(t, err)
+	require.Len(t, ids, 3)
+	
+	// All three short inputs should be scored with a single reasoning call
+	assert.Equal(t, 1, countCalls(reasoningEngine.calls, "Process"))
+	assert.Equal(t, 2.0, ltmStore.GetRecord(ids[0]).Metadata[MetadataKeyImportance])
+	assert.Equal(t, 9.0, ltmStore.GetRecord(ids[1]).Metadata[MetadataKeyImportance])
+	assert.Equal(t, 5.0, ltmStore.GetRecord(ids[2]).Metadata[MetadataKeyImportance])
+}
+
+func TestMMU_EncodeBatchToLTM_MismatchedScoresLeaveRecordsUnscored(t *testing.T) {
+	mmu, ltmStore, _, reasoningEngine, ctx := setupTest(t, false)
+	mmu.config.EnableImportanceScoring = true
+	reasoningEngine.defaultProcessResult = "[4]"
+	
+	ids, err := mmu.EncodeBatchToLTM(ctx, []interface{}{"first", "second"})
+	require.NoError(t, err)
+	
+	for _, id := range ids {
+		assert.NotContains(t, ltmStore.GetRecord(id).Metadata, MetadataKeyImportance)
+	}
+}
+
+func TestMMU_WorkingMemoryOverflow_EvictsLeastImportant(t *testing.T) {
+	mmu, _, _, _, ctx := setupVectorTest(t, true)
+	
+	importance := []float64{9, 1, 7, 2, 8, 3}
+	for i, score := range importance {
+		mmu.workingMemory.add(ltm.MemoryRecord{
+			ID:       fmt.Sprintf("test-%d", i),
+			EntityID: "test-entity",
+			Metadata: map[string]interface{}{MetadataKeyImportance: score},
+		})
+	}
+	
+	mmu.ManageWorkingMemoryOverflow(ctx)
+	
+	records := mmu.workingMemory.snapshot("test-entity")
+	require.Len(t, records, 3)
+	assert.Equal(t, "test-0", records[0].ID)
+	assert.Equal(t, "test-2", records[1].ID)
+	assert.Equal(t, "test-4", records[2].ID)
+}
@@ -0,0 +1,450 @@
+package mmu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/ingest"
+	"github.com/lexlapax/cogmem/pkg/log"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/scripting"
+)
+
+const (
+	// MetadataKeyParentID links a chunk to the document it was split from
+	MetadataKeyParentID = "parent_id"
+	
+	// MetadataKeyDocumentID marks a stored document with its own ID so it can be found from its chunks
+	MetadataKeyDocumentID = "document_id"
+	
+	// MetadataKeyChunkIndex is the position of a chunk in its document, starting at 0
+	MetadataKeyChunkIndex = "chunk_index"
+	
+	// MetadataKeyChunkCount is the number of chunks a document was split into
+	MetadataKeyChunkCount = "chunk_count"
+	
+	// MetadataKeyChunkStart is the byte offset of a chunk in its document
+	MetadataKeyChunkStart = "chunk_start"
+	
+	// MetadataKeyChunkEnd is the byte offset just past the end of a chunk in its document
+	MetadataKeyChunkEnd = "chunk_end"
+	
+	// MetadataKeyChunkHeading is the Markdown heading of the section containing a chunk
+	MetadataKeyChunkHeading = "chunk_heading"
+	
+	// MetadataKeySkipEmbedding set to true stores a record without generating an embedding
+	MetadataKeySkipEmbedding = "skip_embedding"
+)
+
+// ErrEmptyDocument is returned when ingesting a document with no content.
+var ErrEmptyDocument = errors.New("document is empty")
+
+// removeBatchSize is the number of records fetched per round when removing by metadata
+const removeBatchSize = 100
+
+// IngestOptions configures how a document is split and stored.
+type IngestOptions struct {
+	// Chunking configures how the document is split into chunks
+	Chunking ingest.Config
+	
+	// Metadata is copied onto the document and each of its chunks
+	Metadata map[string]interface{}
+	
+	// AccessLevel is the access level of the document and its chunks
+	AccessLevel entity.AccessLevel
+	
+	// StoreParent stores the whole document as its own record, without an
+	// embedding, so it can be returned for any of its chunks
+	StoreParent bool
+	
+	// EmbeddingBatchSize is the maximum number of chunks embedded in a single
+	// reasoning engine call
+	EmbeddingBatchSize int
+}
+
+// DefaultIngestOptions returns the default options for document ingestion.
+// Chunks are counted with the reasoning engine's tokenizer when
+// Chunking.Tokenizer is left unset.
+func DefaultIngestOptions() IngestOptions {
+	chunking := ingest.DefaultConfig()
+	chunking.Tokenizer = nil
+	return IngestOptions{
+		Chunking:           chunking,
+		AccessLevel:        entity.SharedWithinEntity,
+		StoreParent:        true,
+		EmbeddingBatchSize: 16,
+	}
+}
+
+// IngestResult describes a stored document.
+type IngestResult struct {
+	// ParentID is the ID shared by the document's chunks, and the ID of the
+	// document record when StoreParent is set
+	ParentID string `json:"parent_id"`
+	
+	// ChunkIDs are the IDs of the stored chunks in document order
+	ChunkIDs []string `json:"chunk_ids"`
+}
+
+// DocumentIngester is implemented by MMUs that can split long documents into chunks.
+type DocumentIngester interface {
+	// IngestDocument splits a document into chunks and stores each as its own record
+	IngestDocument(ctx context.Context, document string, options IngestOptions) (*IngestResult, error)
+	
+	// ChunkWithNeighbours returns a chunk and up to window chunks either side of it, in document order
+	ChunkWithNeighbours(ctx context.Context, chunk ltm.MemoryRecord, window int) ([]ltm.MemoryRecord, error)
+	
+	// ParentDocument returns the document a chunk was split from
+	ParentDocument(ctx context.Context, chunk ltm.MemoryRecord) (*ltm.MemoryRecord, error)
+}
+
+// MemoryRemover is implemented by MMUs that can delete memories by metadata.
+type MemoryRemover interface {
+	// RemoveByMetadata deletes the entity's memories whose metadata matches every
+	// filter, such as the chunks and document record of a re-ingested file, and
+	// returns how many were deleted
+	RemoveByMetadata(ctx context.Context, filters map[string]interface{}) (int, error)
+}
+
+// IngestDocument implements the DocumentIngester interface. Each chunk is
+// stored with its parent ID, index and offsets in its metadata, and chunks are
+// embedded in batches. The chunk_document Lua hook may replace the built-in
+// chunking. It returns the IDs of the records stored before the first error, if any.
+func (m *MMUI) IngestDocument(ctx context.Context, document string, options IngestOptions) (*IngestResult, error) {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return nil, entity.ErrMissingEntityContext
+	}
+	if strings.TrimSpace(document) == "" {
+		return nil, ErrEmptyDocument
+	}
+	ctx = scripting.WithOperation(ctx, operationIngest)
+	
+	chunks, err := m.chunkDocument(ctx, document, options.Chunking)
+	if err != nil {
+		return nil, err
+	}
+	
+	result := &IngestResult{ParentID: uuid.New().String()}
+	encodedAt := time.Now().Format(time.RFC3339)
+	
+	if options.StoreParent {
+		metadata := copyMetadata(options.Metadata)
+		metadata[MetadataKeyDocumentID] = result.ParentID
+		metadata[MetadataKeyChunkCount] = len(chunks)
+		metadata[MetadataKeySkipEmbedding] = true
+		metadata["encoded_at"] = encodedAt
+		
+		parent := ltm.MemoryRecord{
+			ID:          result.ParentID,
+			EntityID:    entityCtx.EntityID,
+			UserID:      entityCtx.UserID,
+			AccessLevel: options.AccessLevel,
+			Content:     document,
+			Metadata:    metadata,
+		}
+		if _, err := m.storeRecord(ctx, parent); err != nil {
+			return result, fmt.Errorf("failed to store document: %w", err)
+		}
+	}
+	
+	records := make([]ltm.MemoryRecord, len(chunks))
+	for i, chunk := range chunks {
+		metadata := copyMetadata(options.Metadata)
+		metadata[MetadataKeyParentID] = result.ParentID
+		metadata[MetadataKeyChunkIndex] = i
+		metadata[MetadataKeyChunkCount] = len(chunks)
+		metadata[MetadataKeyChunkStart] = chunk.Start
+		metadata[MetadataKeyChunkEnd] = chunk.End
+		if chunk.Heading != "" {
+			metadata[MetadataKeyChunkHeading] = chunk.Heading
+		}
+		metadata["encoded_at"] = encodedAt
+		
+		records[i] = ltm.MemoryRecord{
+			ID:          uuid.New().String(),
+			EntityID:    entityCtx.EntityID,
+			UserID:      entityCtx.UserID,
+			AccessLevel: options.AccessLevel,
+			Content:     chunk.Content,
+			Metadata:    metadata,
+		}
+	}
+	
+	m.embedRecords(ctx, records, options.EmbeddingBatchSize)
+	
+	if m.config.EnableImportanceScoring {
+		pending := make([]*ltm.MemoryRecord, len(records))
+		for i := range records {
+			pending[i] = &records[i]
+		}
+		m.scoreImportance(ctx, pending)
+	}
+	
+	for _, record := range records {
+		id, err := m.storeRecord(ctx, record)
+		if err != nil {
+			return result, fmt.Errorf("failed to store chunk %d: %w", len(result.ChunkIDs), err)
+		}
+		result.ChunkIDs = append(result.ChunkIDs, id)
+	}
+	
+	log.DebugContext(ctx, "Ingested document",
+		"parent_id", result.ParentID,
+		"chunks", len(result.ChunkIDs),
+		"strategy", options.Chunking.Strategy,
+		"document_length", len(document))
+	
+	return result, nil
+}
+
+// chunkDocument splits a document with the chunk_document Lua hook if it
+// returns chunks, or with the configured chunking strategy otherwise.
+func (m *MMUI) chunkDocument(ctx context.Context, document string, config ingest.Config) ([]ingest.Chunk, error) {
+	if config.Tokenizer == nil {
+		config.Tokenizer = m.tokenizer
+	}
+	
+	if m.hooksEnabled(ctx) {
+		hookConfig := map[string]interface{}{
+			"strategy":   string(config.Strategy),
+			"chunk_size": config.ChunkSize,
+			"overlap":    config.Overlap,
+		}
+		result, err := m.scriptEngine.ExecuteFunction(ctx, chunkDocumentFuncName, document, hookConfig)
+		if err == nil && result != nil {
+			if chunks, ok := chunksFromHookResult(document, result); ok {
+				log.DebugContext(ctx, "Document chunked by Lua hook", "chunks", len(chunks))
+				return chunks, nil
+			}
+			log.WarnContext(ctx, "Ignoring invalid chunk_document hook result", "result_type", fmt.Sprintf("%T", result))
+		}
+	}
+	
+	chunker, err := ingest.New(config)
+	if err != nil {
+		return nil, err
+	}
+	chunks := chunker.Chunk(document)
+	if len(chunks) == 0 {
+		return nil, ErrEmptyDocument
+	}
+	return chunks, nil
+}
+
+// chunksFromHookResult converts the result of the chunk_document hook, a list
+// of strings or of tables with "content" and optional "start" and "end" byte
+// offsets. Offsets of string chunks are found by searching the document.
+func chunksFromHookResult(document string, result interface{}) ([]ingest.Chunk, bool) {
+	items, ok := result.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, false
+	}
+	
+	chunks := make([]ingest.Chunk, 0, len(items))
+	searchFrom := 0
+	for _, item := range items {
+		chunk := ingest.Chunk{Index: len(chunks), Start: -1, End: -1}
+		switch v := item.(type) {
+		case string:
+			chunk.Content = v
+		case map[string]interface{}:
+			content, ok := v["content"].(string)
+			if !ok {
+				return nil, false
+			}
+			chunk.Content = content
+			if start, ok := v["start"].(float64); ok {
+				chunk.Start = int(start)
+			}
+			if end, ok := v["end"].(float64); ok {
+				chunk.End = int(end)
+			}
+			if heading, ok := v["heading"].(string); ok {
+				chunk.Heading = heading
+			}
+		default:
+			return nil, false
+		}
+		if strings.TrimSpace(chunk.Content) == "" {
+			continue
+		}
+		
+		if chunk.Start < 0 || chunk.End < chunk.Start || chunk.End > len(document) {
+			chunk.Start, chunk.End = -1, -1
+			if idx := strings.Index(document[searchFrom:], chunk.Content); idx >= 0 {
+				chunk.Start = searchFrom + idx
+				chunk.End = chunk.Start + len(chunk.Content)
+				searchFrom = chunk.Start
+			}
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, len(chunks) > 0
+}
+
+// embedRecords generates embeddings for the records that need them, at most
+// batchSize per reasoning engine call. Failed batches are logged and left
+// without embeddings.
+func (m *MMUI) embedRecords(ctx context.Context, records []ltm.MemoryRecord, batchSize int) {
+	var pending []int
+	for i := range records {
+		if m.shouldGenerateEmbedding(records[i]) {
+			pending = append(pending, i)
+		}
+	}
+	if batchSize < 1 {
+		batchSize = len(pending)
+	}
+	
+	for start := 0; start < len(pending); start += batchSize {
+		end := start + batchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+		
+		texts := make([]string, len(batch))
+		for i, idx := range batch {
+			texts[i] = records[idx].Content
+		}
+		embeddings, err := m.reasoningEngine.GenerateEmbeddings(ctx, texts)
+		if err != nil || len(embeddings) != len(batch) {
+			log.WarnContext(ctx, "Failed to generate chunk embeddings",
+				"error", err,
+				"batch_size", len(batch),
+				"embeddings", len(embeddings))
+			continue
+		}
+		for i, idx := range batch {
+			records[idx].Embedding = embeddings[i]
+		}
+	}
+}
+
+// ChunkWithNeighbours implements the DocumentIngester interface. Records that
+// are not chunks are returned on their own.
+func (m *MMUI) ChunkWithNeighbours(ctx context.Context, chunk ltm.MemoryRecord, window int) ([]ltm.MemoryRecord, error) {
+	parentID, _ := chunk.Metadata[MetadataKeyParentID].(string)
+	index, ok := chunkIndexOf(chunk)
+	if parentID == "" || !ok {
+		return []ltm.MemoryRecord{chunk}, nil
+	}
+	
+	// Fetch every chunk of the document, as stores cap unlimited queries
+	count, _ := metadataInt(chunk, MetadataKeyChunkCount)
+	siblings, err := m.ltmStore.Retrieve(ctx, ltm.LTMQuery{
+		Filters: map[string]interface{}{MetadataKeyParentID: parentID},
+		Limit:   count,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve neighbouring chunks: %w", err)
+	}
+	
+	neighbours := make([]ltm.MemoryRecord, 0, 2*window+1)
+	found := false
+	for _, sibling := range siblings {
+		siblingIndex, ok := chunkIndexOf(sibling)
+		if !ok || siblingIndex < index-window || siblingIndex > index+window {
+			continue
+		}
+		if siblingIndex == index {
+			found = true
+		}
+		neighbours = append(neighbours, sibling)
+	}
+	if !found {
+		neighbours = append(neighbours, chunk)
+	}
+	
+	sort.SliceStable(neighbours, func(a, b int) bool {
+		ia, _ := chunkIndexOf(neighbours[a])
+		ib, _ := chunkIndexOf(neighbours[b])
+		return ia < ib
+	})
+	return neighbours, nil
+}
+
+// ParentDocument implements the DocumentIngester interface. It returns nil
+// if the record is not a chunk or its document was not stored.
+func (m *MMUI) ParentDocument(ctx context.Context, chunk ltm.MemoryRecord) (*ltm.MemoryRecord, error) {
+	parentID, _ := chunk.Metadata[MetadataKeyParentID].(string)
+	if parentID == "" {
+		return nil, nil
+	}
+	
+	records, err := m.ltmStore.Retrieve(ctx, ltm.LTMQuery{
+		Filters: map[string]interface{}{MetadataKeyDocumentID: parentID},
+		Limit:   1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve parent document: %w", err)
+	}
+	for _, record := range records {
+		if record.ID == parentID {
+			return &record, nil
+		}
+	}
+	return nil, nil
+}
+
+// RemoveByMetadata implements the MemoryRemover interface. Records of other
+// entities, and private records of other users, are never deleted. It keeps
+// querying until a query returns no records it may delete, widening each query
+// past the records it skipped.
+func (m *MMUI) RemoveByMetadata(ctx context.Context, filters map[string]interface{}) (int, error) {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return 0, entity.ErrMissingEntityContext
+	}
+	if len(filters) == 0 {
+		return 0, fmt.Errorf("filters must not be empty")
+	}
+	
+	removed := 0
+	skipped := make(map[string]bool)
+	for {
+		// Stores may add isolation filters to the query, so each round gets its own copy.
+		// Skipped records stay in the store, so the limit grows to see past them.
+		records, err := m.ltmStore.Retrieve(ctx, ltm.LTMQuery{
+			Filters: copyMetadata(filters),
+			Limit:   len(skipped) + removeBatchSize,
+		})
+		if err != nil {
+			return removed, fmt.Errorf("failed to find memories to remove: %w", err)
+		}
+		
+		deleted, newlySkipped := 0, 0
+		for _, record := range records {
+			if !visibleTo(entityCtx, record) {
+				if !skipped[record.ID] {
+					skipped[record.ID] = true
+					newlySkipped++
+				}
+				continue
+			}
+			if err := m.ltmStore.Delete(ctx, record.ID); err != nil {
+				return removed, fmt.Errorf("failed to remove memory %s: %w", record.ID, err)
+			}
+			deleted++
+		}
+		removed += deleted
+		if deleted == 0 && newlySkipped == 0 {
+			break
+		}
+	}
+	
+	log.DebugContext(ctx, "Removed memories by metadata", "filters", filters, "removed", removed)
+	return removed, nil
+}
+
+// chunkIndexOf returns the chunk index stored in a record's metadata.
+func chunkIndexOf(record ltm.MemoryRecord) (int, bool) {
+	return metadataInt(record, MetadataKeyChunkIndex)
+}
@@ -0,0 +1,256 @@
+package mmu
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/ingest"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm/adapters/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ingestTestDocument = "Alpha one. Alpha two. Beta three. Beta four. Gamma five. Gamma six."
+
+func ingestTestOptions() IngestOptions {
+	options := DefaultIngestOptions()
+	options.Chunking.Strategy = ingest.StrategySentence
+	options.Chunking.ChunkSize = 6
+	options.EmbeddingBatchSize = 2
+	options.Metadata = map[string]interface{}{"source": "test.txt"}
+	return options
+}
+
+func TestMMU_IngestDocument(t *testing.T) {
+	mmu, ltmStore, _, reasoningEngine, ctx := setupVectorTest(t, true)
+	
+	result, err := mmu.IngestDocument(ctx, ingestTestDocument, ingestTestOptions())
+	require.NoError(t, err)
+	require.Len(t, result.ChunkIDs, 3)
+	
+	parent := ltmStore.GetRecord(result.ParentID)
+	assert.Equal(t, ingestTestDocument, parent.Content)
+	assert.Empty(t, parent.Embedding, "the document itself is not embedded")
+	assert.Equal(t, 3, parent.Metadata[MetadataKeyChunkCount])
+	
+	for i, id := range result.ChunkIDs {
+		chunk := ltmStore.GetRecord(id)
+		assert.Equal(t, result.ParentID, chunk.Metadata[MetadataKeyParentID])
+		assert.Equal(t, i, chunk.Metadata[MetadataKeyChunkIndex])
+		assert.Equal(t, "test.txt", chunk.Metadata["source"])
+		assert.Equal(t, entity.SharedWithinEntity, chunk.AccessLevel)
+		assert.NotEmpty(t, chunk.Embedding)
+		
+		start := chunk.Metadata[MetadataKeyChunkStart].(int)
+		end := chunk.Metadata[MetadataKeyChunkEnd].(int)
+		assert.Equal(t, chunk.Content, ingestTestDocument[start:end])
+	}
+	assert.Equal(t, "Beta three. Beta four.", ltmStore.GetRecord(result.ChunkIDs[1]).Content)
+	
+	// Three chunks in batches of two
+	assert.Equal(t, 2, countCalls(reasoningEngine.calls, "GenerateEmbeddings"))
+}
+
+func TestMMU_IngestDocument_VectorAdapter(t *testing.T) {
+	mmu, ltmStore, ctx := setupChromemTest(t)
+	
+	sentences := make([]string, 24)
+	for i := range sentences {
+		sentences[i] = fmt.Sprintf("Sentence number %d.", i)
+	}
+	options := ingestTestOptions()
+	options.Chunking.ChunkSize = 8
+	
+	result, err := mmu.IngestDocument(ctx, strings.Join(sentences, " "), options)
+	require.NoError(t, err, "ingesting with default parent storage succeeds on a vector store")
+	require.Greater(t, len(result.ChunkIDs), 10, "more chunks than the store's default limit")
+	
+	records, err := ltmStore.Retrieve(ctx, ltm.LTMQuery{ExactMatch: map[string]interface{}{"id": result.ChunkIDs[0]}})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	first := records[0]
+	
+	t.Run("all neighbours are found", func(t *testing.T) {
+		neighbours, err := mmu.ChunkWithNeighbours(ctx, first, len(result.ChunkIDs))
+		require.NoError(t, err)
+		require.Len(t, neighbours, len(result.ChunkIDs))
+		for i, record := range neighbours {
+			assert.Equal(t, result.ChunkIDs[i], record.ID)
+		}
+	})
+	
+	t.Run("parent document is found", func(t *testing.T) {
+		parent, err := mmu.ParentDocument(ctx, first)
+		require.NoError(t, err)
+		require.NotNil(t, parent)
+		assert.Equal(t, result.ParentID, parent.ID)
+		assert.Equal(t, strings.Join(sentences, " "), parent.Content)
+	})
+}
+
+func TestMMU_IngestDocument_LuaHook(t *testing.T) {
+	mmu, ltmStore, scriptEngine, _, ctx := setupVectorTest(t, true)
+	scriptEngine.functionResults[chunkDocumentFuncName] = []interface{}{
+		"Alpha one. Alpha two.",
+		map[string]interface{}{"content": "Gamma five.", "start": float64(45), "end": float64(56)},
+	}
+	
+	result, err := mmu.IngestDocument(ctx, ingestTestDocument, ingestTestOptions())
+	require.NoError(t, err)
+	require.Len(t, result.ChunkIDs, 2)
+	
+	first := ltmStore.GetRecord(result.ChunkIDs[0])
+	assert.Equal(t, "Alpha one. Alpha two.", first.Content)
+	assert.Equal(t, 0, first.Metadata[MetadataKeyChunkStart])
+	second := ltmStore.GetRecord(result.ChunkIDs[1])
+	assert.Equal(t, "Gamma five.", second.Content)
+	assert.Equal(t, 45, second.Metadata[MetadataKeyChunkStart])
+}
+
+func TestMMU_IngestDocument_Empty(t *testing.T) {
+	mmu, _, _, _, ctx := setupTest(t, false)
+	_, err := mmu.IngestDocument(ctx, " \n ", DefaultIngestOptions())
+	assert.ErrorIs(t, err, ErrEmptyDocument)
+}
+
+func TestMMU_RemoveByMetadata(t *testing.T) {
+	mmu, ltmStore, _, _, ctx := setupTest(t, false)
+	
+	result, err := mmu.IngestDocument(ctx, ingestTestDocument, ingestTestOptions())
+	require.NoError(t, err)
+	keptID, err := mmu.EncodeToLTM(ctx, map[string]interface{}{
+		"content":  "Another file",
+		"metadata": map[string]interface{}{"source": "other.txt"},
+	})
+	require.NoError(t, err)
+	otherCtx := entity.ContextWithEntity(context.Background(), entity.NewContext("other-entity", "other-user"))
+	foreign, err := ltmStore.Store(otherCtx, ltm.MemoryRecord{
+		EntityID:    "other-entity",
+		AccessLevel: entity.SharedWithinEntity,
+		Content:     "Foreign copy",
+		Metadata:    map[string]interface{}{"source": "test.txt"},
+	})
+	require.NoError(t, err)
+	
+	removed, err := mmu.RemoveByMetadata(ctx, map[string]interface{}{"source": "test.txt"})
+	require.NoError(t, err)
+	assert.Equal(t, len(result.ChunkIDs)+1, removed, "the chunks and the document record")
+	
+	assert.Empty(t, ltmStore.GetRecord(result.ParentID).ID)
+	for _, id := range result.ChunkIDs {
+		assert.Empty(t, ltmStore.GetRecord(id).ID)
+	}
+	assert.Equal(t, keptID, ltmStore.GetRecord(keptID).ID)
+	assert.Equal(t, foreign, ltmStore.GetRecord(foreign).ID, "other entities' memories are kept")
+	
+	_, err = mmu.RemoveByMetadata(ctx, nil)
+	assert.Error(t, err)
+}
+
+// pagedStore returns the records still held by the mock store in the order
+// they were stored, regardless of their access level, at most pageSize at a time
+type pagedStore struct {
+	*mock.MockStore
+	order    []string
+	pageSize int
+}
+
+func (s *pagedStore) Retrieve(ctx context.Context, query ltm.LTMQuery) ([]ltm.MemoryRecord, error) {
+	var records []ltm.MemoryRecord
+	for _, id := range s.order {
+		if len(records) == query.Limit || (s.pageSize > 0 && len(records) == s.pageSize) {
+			break
+		}
+		if record := s.MockStore.GetRecord(id); record.ID != "" {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func TestMMU_RemoveByMetadata_Paging(t *testing.T) {
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	otherCtx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "other-user"))
+	
+	setup := func(t *testing.T, pageSize, private, own int) (*MMUI, *pagedStore) {
+		store := &pagedStore{MockStore: mock.NewMockStore(), pageSize: pageSize}
+		for i := 0; i < private+own; i++ {
+			storeCtx := ctx
+			if i < private {
+				storeCtx = otherCtx
+			}
+			id, err := store.Store(storeCtx, ltm.MemoryRecord{
+				Content:  fmt.Sprintf("record %d", i),
+				Metadata: map[string]interface{}{"source": "test.txt"},
+			})
+			require.NoError(t, err)
+			store.order = append(store.order, id)
+		}
+		return NewMMU(store, newMockReasoningEngine(), newMockScriptEngine(), Config{}), store
+	}
+	
+	t.Run("short pages", func(t *testing.T) {
+		mmu, store := setup(t, 2, 0, 5)
+		
+		removed, err := mmu.RemoveByMetadata(ctx, map[string]interface{}{"source": "test.txt"})
+		require.NoError(t, err)
+		assert.Equal(t, 5, removed)
+		for _, id := range store.order {
+			assert.Empty(t, store.GetRecord(id).ID)
+		}
+	})
+	
+	t.Run("pages of other users' private records", func(t *testing.T) {
+		mmu, store := setup(t, 0, removeBatchSize+10, 3)
+		
+		removed, err := mmu.RemoveByMetadata(ctx, map[string]interface{}{"source": "test.txt"})
+		require.NoError(t, err)
+		assert.Equal(t, 3, removed)
+		for i, id := range store.order {
+			if i < removeBatchSize+10 {
+				assert.Equal(t, id, store.GetRecord(id).ID, "other users' private records are kept")
+			} else {
+				assert.Empty(t, store.GetRecord(id).ID)
+			}
+		}
+	})
+}
+
+func TestMMU_ChunkExpansion(t *testing.T) {
+	mmu, ltmStore, _, _, ctx := setupTest(t, false)
+	
+	result, err := mmu.IngestDocument(ctx, ingestTestDocument, ingestTestOptions())
+	require.NoError(t, err)
+	require.Len(t, result.ChunkIDs, 3)
+	middle := ltmStore.GetRecord(result.ChunkIDs[1])
+	
+	t.Run("neighbours", func(t *testing.T) {
+		neighbours, err := mmu.ChunkWithNeighbours(ctx, middle, 1)
+		require.NoError(t, err)
+		require.Len(t, neighbours, 3)
+		for i, record := range neighbours {
+			assert.Equal(t, result.ChunkIDs[i], record.ID)
+		}
+		
+		alone, err := mmu.ChunkWithNeighbours(ctx, middle, 0)
+		require.NoError(t, err)
+		require.Len(t, alone, 1)
+		assert.Equal(t, middle.ID, alone[0].ID)
+	})
+	
+	t.Run("parent", func(t *testing.T) {
+		parent, err := mmu.ParentDocument(ctx, middle)
+		require.NoError(t, err)
+		require.NotNil(t, parent)
+		assert.Equal(t, result.ParentID, parent.ID)
+		assert.Equal(t, ingestTestDocument, parent.Content)
+		
+		parent, err = mmu.ParentDocument(ctx, *parent)
+		require.NoError(t, err)
+		assert.Nil(t, parent, "a document has no parent")
+	})
+}
@@ -0,0 +1,283 @@
+package mmu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/log"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/reasoning"
+)
+
+// Reasons an iterative retrieval stopped
+const (
+	// StopReasonSufficient means the reasoning engine judged the context sufficient
+	StopReasonSufficient = "sufficient"
+	
+	// StopReasonMaxRounds means the configured number of rounds was reached
+	StopReasonMaxRounds = "max_rounds"
+	
+	// StopReasonTokenBudget means the accumulated context reached the token budget
+	StopReasonTokenBudget = "token_budget"
+	
+	// StopReasonNoNewResults means a round retrieved nothing that was not already known
+	StopReasonNoNewResults = "no_new_results"
+	
+	// StopReasonNoFollowUp means the reasoning engine proposed no new follow-up query
+	StopReasonNoFollowUp = "no_follow_up"
+	
+	// StopReasonJudgeFailed means the sufficiency judgement could not be obtained
+	StopReasonJudgeFailed = "judge_failed"
+	
+	// StopReasonRetrievalFailed means a follow-up round's retrieval returned an error
+	StopReasonRetrievalFailed = "retrieval_failed"
+)
+
+// IterativeRetrievalOptions configures RetrieveIteratively.
+type IterativeRetrievalOptions struct {
+	// Retrieval configures each round's retrieval
+	Retrieval RetrievalOptions
+	
+	// MaxRounds is the maximum number of retrieval rounds, including the first
+	MaxRounds int
+	
+	// TokenBudget caps the estimated tokens of accumulated memory content;
+	// records that would exceed it are not added
+	TokenBudget int
+}
+
+// DefaultIterativeRetrievalOptions returns the default options for iterative retrieval.
+func DefaultIterativeRetrievalOptions() IterativeRetrievalOptions {
+	retrieval := DefaultRetrievalOptions()
+	retrieval.MaxResults = 5
+	retrieval.Strategy = "semantic"
+	
+	return IterativeRetrievalOptions{
+		Retrieval:   retrieval,
+		MaxRounds:   3,
+		TokenBudget: 2000,
+	}
+}
+
+// RetrievalRound records one round of an iterative retrieval.
+type RetrievalRound struct {
+	// Query is the sub-query retrieved in this round
+	Query string `json:"query"`
+	
+	// Retrieved is the number of records the retrieval returned
+	Retrieved int `json:"retrieved"`
+	
+	// Added is the number of new records kept after deduplication and budgeting
+	Added int `json:"added"`
+	
+	// Sufficient is the reasoning engine's judgement after this round
+	Sufficient bool `json:"sufficient"`
+	
+	// FollowUp is the follow-up query proposed after this round, if any
+	FollowUp string `json:"follow_up,omitempty"`
+	
+	// Error is the retrieval error that ended this round, if any
+	Error string `json:"error,omitempty"`
+}
+
+// IterativeRetrievalResult is the outcome of an iterative retrieval.
+type IterativeRetrievalResult struct {
+	// Records are the deduplicated memories gathered across all rounds, in retrieval order
+	Records []ltm.MemoryRecord `json:"records"`
+	
+	// Rounds is the trace of sub-queries, for debugging
+	Rounds []RetrievalRound `json:"rounds"`
+	
+	// EstimatedTokens is the estimated token count of the gathered memory content
+	EstimatedTokens int `json:"estimated_tokens"`
+	
+	// StopReason explains why the loop ended
+	StopReason string `json:"stop_reason"`
+	
+	// Err is the error that ended the loop when StopReason is StopReasonRetrievalFailed
+	Err error `json:"-"`
+}
+
+// IterativeRetriever is implemented by MMUs that support iterative retrieval.
+type IterativeRetriever interface {
+	// RetrieveIteratively retrieves memories for a question over several rounds,
+	// letting the reasoning engine propose follow-up queries until the context suffices
+	RetrieveIteratively(ctx context.Context, question string, options IterativeRetrievalOptions) (*IterativeRetrievalResult, error)
+}
+
+// sufficiencyJudgement is the reasoning engine's verdict on the gathered context
+type sufficiencyJudgement struct {
+	Sufficient    bool   `json:"sufficient"`
+	FollowUpQuery string `json:"follow_up_query"`
+}
+
+// RetrieveIteratively implements the IterativeRetriever interface. Each round
+// retrieves for the current sub-query, merges new records into the context,
+// and asks the reasoning engine whether the context answers the question or
+// which follow-up query would fill the gap. This lets multi-hop questions
+// ("what did the person I met in Paris recommend?") resolve intermediate
+// facts before searching for the answer.
+func (m *MMUI) RetrieveIteratively(ctx context.Context, question string, options IterativeRetrievalOptions) (*IterativeRetrievalResult, error) {
+	if _, ok := entity.GetEntityContext(ctx); !ok {
+		return nil, entity.ErrMissingEntityContext
+	}
+	if strings.TrimSpace(question) == "" {
+		return nil, fmt.Errorf("question must not be empty")
+	}
+	
+	maxRounds := options.MaxRounds
+	if maxRounds < 1 {
+		maxRounds = 1
+	}
+	
+	result := &IterativeRetrievalResult{Records: []ltm.MemoryRecord{}}
+	seen := make(map[string]bool)
+	asked := map[string]bool{normalizeSubQuery(question): true}
+	query := question
+	
+	for round := 1; ; round++ {
+		records, err := m.RetrieveFromLTM(ctx, query, options.Retrieval)
+		if err != nil {
+			if round == 1 {
+				return nil, err
+			}
+			log.WarnContext(ctx, "Iterative retrieval round failed", "round", round, "error", err)
+			result.Rounds = append(result.Rounds, RetrievalRound{Query: query, Error: err.Error()})
+			result.StopReason = StopReasonRetrievalFailed
+			result.Err = err
+			break
+		}
+		
+		trace := RetrievalRound{Query: query, Retrieved: len(records)}
+		budgetReached := false
+		for _, record := range records {
+			if seen[record.ID] {
+				continue
+			}
+			tokens := m.countTokens(record.Content)
+			if options.TokenBudget > 0 && result.EstimatedTokens+tokens > options.TokenBudget {
+				budgetReached = true
+				break
+			}
+			seen[record.ID] = true
+			result.Records = append(result.Records, record)
+			result.EstimatedTokens += tokens
+			trace.Added++
+		}
+		result.Rounds = append(result.Rounds, trace)
+		
+		log.DebugContext(ctx, "Iterative retrieval round complete",
+			"round", round,
+			"query", truncateString(query, 50),
+			"retrieved", trace.Retrieved,
+			"added", trace.Added)
+		
+		switch {
+		case budgetReached:
+			result.StopReason = StopReasonTokenBudget
+		case trace.Added == 0 && round > 1:
+			result.StopReason = StopReasonNoNewResults
+		case round >= maxRounds:
+			result.StopReason = StopReasonMaxRounds
+		}
+		if result.StopReason != "" {
+			break
+		}
+		
+		judgement, err := m.judgeSufficiency(ctx, question, result)
+		if err != nil {
+			log.WarnContext(ctx, "Failed to judge retrieved context", "error", err)
+			result.StopReason = StopReasonJudgeFailed
+			break
+		}
+		
+		last := &result.Rounds[len(result.Rounds)-1]
+		last.Sufficient = judgement.Sufficient
+		last.FollowUp = strings.TrimSpace(judgement.FollowUpQuery)
+		
+		if judgement.Sufficient {
+			result.StopReason = StopReasonSufficient
+			break
+		}
+		if last.FollowUp == "" || asked[normalizeSubQuery(last.FollowUp)] {
+			result.StopReason = StopReasonNoFollowUp
+			break
+		}
+		
+		asked[normalizeSubQuery(last.FollowUp)] = true
+		query = last.FollowUp
+	}
+	
+	log.DebugContext(ctx, "Iterative retrieval complete",
+		"rounds", len(result.Rounds),
+		"records", len(result.Records),
+		"estimated_tokens", result.EstimatedTokens,
+		"stop_reason", result.StopReason)
+	
+	return result, nil
+}
+
+// judgeSufficiency asks the reasoning engine whether the gathered memories
+// answer the question and, if not, for a follow-up search query.
+func (m *MMUI) judgeSufficiency(ctx context.Context, question string, result *IterativeRetrievalResult) (*sufficiencyJudgement, error) {
+	if m.reasoningEngine == nil {
+		return nil, fmt.Errorf("no reasoning engine available")
+	}
+	
+	response, err := m.reasoningEngine.Process(ctx, buildSufficiencyPrompt(question, result),
+		reasoning.WithTemperature(0),
+		reasoning.WithMaxTokens(100),
+	)
+	if err != nil {
+		return nil, err
+	}
+	
+	return parseSufficiencyJudgement(response)
+}
+
+// buildSufficiencyPrompt creates the prompt used to judge the gathered context.
+func buildSufficiencyPrompt(question string, result *IterativeRetrievalResult) string {
+	var sb strings.Builder
+	sb.WriteString("You are deciding whether the memories retrieved so far are enough to answer a question. ")
+	sb.WriteString("If they are not, propose one short search query that would find the missing information, ")
+	sb.WriteString("using facts from the memories where they help (for example, a name found in an earlier memory).\n\n")
+	sb.WriteString(fmt.Sprintf("Question: %s\n\n", question))
+	
+	sb.WriteString("Searches so far:\n")
+	for _, round := range result.Rounds {
+		sb.WriteString(fmt.Sprintf("- %s\n", round.Query))
+	}
+	
+	sb.WriteString("\nMemories:\n")
+	if len(result.Records) == 0 {
+		sb.WriteString("(none)\n")
+	}
+	for i, record := range result.Records {
+		sb.WriteString(fmt.Sprintf("Memory %d: %s\n", i+1, record.Content))
+	}
+	
+	sb.WriteString("\nRespond with only a JSON object, e.g. {\"sufficient\": false, \"follow_up_query\": \"...\"}.")
+	return sb.String()
+}
+
+// parseSufficiencyJudgement extracts the judgement object from a reasoning response.
+func parseSufficiencyJudgement(response string) (*sufficiencyJudgement, error) {
+	start, end := strings.Index(response, "{"), strings.LastIndex(response, "}")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("no judgement found in response")
+	}
+	
+	var judgement sufficiencyJudgement
+	if err := json.Unmarshal([]byte(response[start:end+1]), &judgement); err != nil {
+		return nil, fmt.Errorf("invalid judgement: %w", err)
+	}
+	return &judgement, nil
+}
+
+// normalizeSubQuery folds a sub-query for duplicate detection.
+func normalizeSubQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
@@ -0,0 +1,147 @@
+package mmu
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm/adapters/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storeMultiHopRecords stores two memories that only answer a question together
+func storeMultiHopRecords(t *testing.T, ctx context.Context, ltmStore *mock.MockStore) {
+	for _, content := range []string{
+		"In Paris I met Alice at the conference",
+		"Alice recommended the bistro on Rue Cler",
+	} {
+		_, err := ltmStore.Store(ctx, ltm.MemoryRecord{Content: content, AccessLevel: entity.SharedWithinEntity})
+		require.NoError(t, err)
+	}
+}
+
+var errStoreUnavailable = errors.New("store unavailable")
+
+// failingRetrieveStore fails every retrieval after the first succeed calls
+type failingRetrieveStore struct {
+	*mock.MockStore
+	succeed int
+	calls   int
+}
+
+func (s *failingRetrieveStore) Retrieve(ctx context.Context, query ltm.LTMQuery) ([]ltm.MemoryRecord, error) {
+	s.calls++
+	if s.calls > s.succeed {
+		return nil, errStoreUnavailable
+	}
+	return s.MockStore.Retrieve(ctx, query)
+}
+
+func TestMMU_RetrieveIteratively(t *testing.T) {
+	t.Run("follows up on multi-hop questions", func(t *testing.T) {
+		mmu, ltmStore, _, reasoningEngine, ctx := setupTest(t, false)
+		storeMultiHopRecords(t, ctx, ltmStore)
+		reasoningEngine.defaultProcessResult = `{"sufficient": false, "follow_up_query": "Alice"}`
+		
+		result, err := mmu.RetrieveIteratively(ctx, "Paris", DefaultIterativeRetrievalOptions())
+		require.NoError(t, err)
+		
+		require.Len(t, result.Rounds, 2)
+		assert.Equal(t, "Paris", result.Rounds[0].Query)
+		assert.Equal(t, "Alice", result.Rounds[0].FollowUp)
+		assert.Equal(t, "Alice", result.Rounds[1].Query)
+		assert.Equal(t, 2, result.Rounds[1].Retrieved)
+		assert.Equal(t, 1, result.Rounds[1].Added, "records from earlier rounds are deduplicated")
+		assert.Len(t, result.Records, 2)
+		assert.Equal(t, StopReasonNoFollowUp, result.StopReason, "a repeated follow-up ends the loop")
+	})
+	
+	t.Run("stops when the context suffices", func(t *testing.T) {
+		mmu, ltmStore, _, reasoningEngine, ctx := setupTest(t, false)
+		storeMultiHopRecords(t, ctx, ltmStore)
+		reasoningEngine.defaultProcessResult = `{"sufficient": true}`
+		
+		result, err := mmu.RetrieveIteratively(ctx, "Paris", DefaultIterativeRetrievalOptions())
+		require.NoError(t, err)
+		require.Len(t, result.Rounds, 1)
+		assert.True(t, result.Rounds[0].Sufficient)
+		assert.Equal(t, StopReasonSufficient, result.StopReason)
+	})
+	
+	t.Run("respects the round limit", func(t *testing.T) {
+		mmu, ltmStore, _, reasoningEngine, ctx := setupTest(t, false)
+		storeMultiHopRecords(t, ctx, ltmStore)
+		
+		options := DefaultIterativeRetrievalOptions()
+		options.MaxRounds = 1
+		result, err := mmu.RetrieveIteratively(ctx, "Paris", options)
+		require.NoError(t, err)
+		assert.Len(t, result.Rounds, 1)
+		assert.Equal(t, StopReasonMaxRounds, result.StopReason)
+		assert.Equal(t, 0, countCalls(reasoningEngine.calls, "Process"), "no judgement after the last round")
+	})
+	
+	t.Run("respects the token budget", func(t *testing.T) {
+		mmu, ltmStore, _, _, ctx := setupTest(t, false)
+		storeMultiHopRecords(t, ctx, ltmStore)
+		
+		options := DefaultIterativeRetrievalOptions()
+		options.TokenBudget = 12
+		result, err := mmu.RetrieveIteratively(ctx, "Alice", options)
+		require.NoError(t, err)
+		assert.Len(t, result.Records, 1)
+		assert.LessOrEqual(t, result.EstimatedTokens, 12)
+		assert.Equal(t, StopReasonTokenBudget, result.StopReason)
+	})
+	
+	t.Run("unparseable judgement ends the loop", func(t *testing.T) {
+		mmu, ltmStore, _, reasoningEngine, ctx := setupTest(t, false)
+		storeMultiHopRecords(t, ctx, ltmStore)
+		reasoningEngine.defaultProcessResult = "I am not sure"
+		
+		result, err := mmu.RetrieveIteratively(ctx, "Paris", DefaultIterativeRetrievalOptions())
+		require.NoError(t, err)
+		assert.Len(t, result.Records, 1)
+		assert.Equal(t, StopReasonJudgeFailed, result.StopReason)
+	})
+	
+	t.Run("failed follow-up retrieval is reported", func(t *testing.T) {
+		ltmStore := &failingRetrieveStore{MockStore: mock.NewMockStore(), succeed: 1}
+		reasoningEngine := newMockReasoningEngine()
+		reasoningEngine.defaultProcessResult = `{"sufficient": false, "follow_up_query": "Alice"}`
+		mmu := NewMMU(ltmStore, reasoningEngine, newMockScriptEngine(), Config{})
+		ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+		storeMultiHopRecords(t, ctx, ltmStore.MockStore)
+		
+		result, err := mmu.RetrieveIteratively(ctx, "Paris", DefaultIterativeRetrievalOptions())
+		require.NoError(t, err)
+		require.Len(t, result.Rounds, 2)
+		assert.Equal(t, "Alice", result.Rounds[1].Query)
+		assert.Equal(t, "store unavailable", result.Rounds[1].Error)
+		assert.Equal(t, StopReasonRetrievalFailed, result.StopReason)
+		assert.ErrorIs(t, result.Err, errStoreUnavailable)
+		assert.Len(t, result.Records, 1, "records from earlier rounds are kept")
+	})
+	
+	t.Run("requires entity context", func(t *testing.T) {
+		mmu, _, _, _, _ := setupTest(t, false)
+		_, err := mmu.RetrieveIteratively(context.Background(), "Paris", DefaultIterativeRetrievalOptions())
+		assert.ErrorIs(t, err, entity.ErrMissingEntityContext)
+	})
+}
+
+func TestBuildSufficiencyPrompt(t *testing.T) {
+	result := &IterativeRetrievalResult{
+		Records: []ltm.MemoryRecord{{Content: "In Paris I met Alice"}},
+		Rounds:  []RetrievalRound{{Query: "who did I meet in Paris"}},
+	}
+	
+	prompt := buildSufficiencyPrompt("what did the person I met in Paris recommend?", result)
+	assert.True(t, strings.Contains(prompt, "Question: what did the person I met in Paris recommend?"))
+	assert.True(t, strings.Contains(prompt, "- who did I meet in Paris"))
+	assert.True(t, strings.Contains(prompt, "Memory 1: In Paris I met Alice"))
+}
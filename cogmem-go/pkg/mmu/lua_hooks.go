@@ -2,8 +2,10 @@ package mmu
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/lexlapax/cogmem/pkg/entity"
 	"github.com/lexlapax/cogmem/pkg/log"
 	"github.com/lexlapax/cogmem/pkg/mem/ltm"
 	"github.com/lexlapax/cogmem/pkg/scripting"
@@ -27,8 +29,89 @@ const (
 
 	// rankSemanticResultsFuncName is the name of the Lua function to call to rank semantic search results
 	rankSemanticResultsFuncName = "rank_semantic_results"
+
+	// scoreImportanceFuncName is the name of the Lua function to call before rating a memory's importance.
+	// It may return a number to use as the score, false to skip scoring, or nil to ask the reasoning engine.
+	scoreImportanceFuncName = "score_importance"
+
+	// chunkDocumentFuncName is the name of the Lua function to call to split a document
+	// for ingestion. It may return a list of chunk strings or tables with "content" and
+	// optional "start", "end" and "heading" fields, or nil to use the configured strategy.
+	chunkDocumentFuncName = "chunk_document"
 )
 
+// Operations reported to hooks as ctx.operation
+const (
+	operationEncode   = "encode"
+	operationRetrieve = "retrieve"
+	operationIngest   = "ingest"
+)
+
+// ErrHookIsolationViolation is returned when a hook returns a memory record
+// that was not passed to it, or one private to another user.
+var ErrHookIsolationViolation = errors.New("hook result violates entity isolation")
+
+func init() {
+	// Hooks receive memory records and queries as tables, and may return them
+	scripting.RegisterStruct[ltm.MemoryRecord]()
+	scripting.RegisterStruct[ltm.LTMQuery]()
+	
+	// Hooks that transform a value pass it from handler to handler; hooks that
+	// make a decision stop at the first handler that makes one
+	scripting.DeclareHook(beforeRetrieveFuncName, scripting.HookSpec{Mode: scripting.ChainPipe})
+	scripting.DeclareHook(afterRetrieveFuncName, scripting.HookSpec{Mode: scripting.ChainPipe})
+	scripting.DeclareHook(rankSemanticResultsFuncName, scripting.HookSpec{Mode: scripting.ChainPipe})
+	scripting.DeclareHook(beforeEncodeFuncName, scripting.HookSpec{Mode: scripting.ChainPipe, Combine: combineBeforeEncode})
+	scripting.DeclareHook(afterEncodeFuncName, scripting.HookSpec{Mode: scripting.ChainNotify})
+	scripting.DeclareHook(beforeEmbeddingFuncName, scripting.HookSpec{Mode: scripting.ChainFirst})
+	scripting.DeclareHook(scoreImportanceFuncName, scripting.HookSpec{Mode: scripting.ChainFirst})
+	scripting.DeclareHook(chunkDocumentFuncName, scripting.HookSpec{Mode: scripting.ChainFirst})
+}
+
+// combineBeforeEncode merges the results of before_encode handlers. Each
+// handler receives the content as left by the previous ones, and the metadata
+// returned by all of them is merged, later handlers winning.
+func combineBeforeEncode(value, result interface{}) (interface{}, interface{}) {
+	update, ok := result.(map[string]interface{})
+	if !ok {
+		if previous, ok := value.(map[string]interface{}); ok {
+			if content, ok := result.(string); ok {
+				return map[string]interface{}{"content": content, "metadata": previous["metadata"]}, content
+			}
+		}
+		return result, result
+	}
+	
+	merged := map[string]interface{}{}
+	metadata := map[string]interface{}{}
+	switch previous := value.(type) {
+	case string:
+		merged["content"] = previous
+	case map[string]interface{}:
+		if content, ok := previous["content"].(string); ok {
+			merged["content"] = content
+		}
+		if previousMetadata, ok := previous["metadata"].(map[string]interface{}); ok {
+			for key, v := range previousMetadata {
+				metadata[key] = v
+			}
+		}
+	}
+	
+	var arg interface{}
+	if content, ok := update["content"].(string); ok {
+		merged["content"] = content
+		arg = content
+	}
+	if updateMetadata, ok := update["metadata"].(map[string]interface{}); ok {
+		for key, v := range updateMetadata {
+			metadata[key] = v
+		}
+	}
+	merged["metadata"] = metadata
+	return merged, arg
+}
+
 // callBeforeRetrieveHook calls the before_retrieve Lua hook if available
 func callBeforeRetrieveHook(
 	ctx context.Context,
@@ -39,22 +122,11 @@ func callBeforeRetrieveHook(
 		return query, nil
 	}
 
-	// Convert the query to a map for passing to Lua
-	queryMap := map[string]interface{}{
-		"text":   query.Text,
-		"limit":  query.Limit,
-		"filters": query.Filters,
-	}
-
-	if query.ExactMatch != nil {
-		queryMap["exact_match"] = query.ExactMatch
-	}
-
 	// Try to call the hook function
-	result, err := engine.ExecuteFunction(ctx, beforeRetrieveFuncName, queryMap)
+	result, err := engine.ExecuteFunction(ctx, beforeRetrieveFuncName, query)
 	if err != nil {
 		// If the function doesn't exist, that's ok - just continue
-		if err.Error() == fmt.Sprintf("%v: %s", scripting.ErrFunctionNotFound, beforeRetrieveFuncName) {
+		if errors.Is(err, scripting.ErrFunctionNotFound) {
 			return query, nil
 		}
 		// Log the error but don't fail the operation
@@ -64,33 +136,26 @@ func callBeforeRetrieveHook(
 		return query, nil
 	}
 
-	// If the function returned nil or not a map, just use the original query
-	resultMap, ok := result.(map[string]interface{})
-	if !ok {
+	// If the function returned nil, just use the original query
+	if result == nil {
 		return query, nil
 	}
-
-	// Update the query with the results from Lua
-	if text, ok := resultMap["text"].(string); ok {
-		query.Text = text
-	}
-
-	if limit, ok := resultMap["limit"].(float64); ok {
-		query.Limit = int(limit)
-	}
-
-	if filters, ok := resultMap["filters"].(map[string]interface{}); ok {
-		query.Filters = filters
-	}
-
-	if exactMatch, ok := resultMap["exact_match"].(map[string]interface{}); ok {
-		query.ExactMatch = exactMatch
+	
+	// Fields the hook left out keep their original values
+	updated := query
+	if err := scripting.Unmarshal(result, &updated); err != nil {
+		log.WarnContext(ctx, "Invalid result from Lua hook", 
+			"hook", beforeRetrieveFuncName, 
+			"error", err)
+		return query, nil
 	}
-
-	return query, nil
+	
+	return updated, nil
 }
 
-// callAfterRetrieveHook calls the after_retrieve Lua hook if available
+// callAfterRetrieveHook calls the after_retrieve Lua hook if available.
+// The hook receives the full records and may return a filtered, reordered or
+// annotated list, which replaces the results. Returning nil keeps them as they are.
 func callAfterRetrieveHook(
 	ctx context.Context,
 	engine scripting.Engine,
@@ -102,18 +167,10 @@ func callAfterRetrieveHook(
 		return results, nil
 	}
 
-	// For simplicity in Phase 1, just pass the number of results and a preview
-	// This is safer than trying to pass complex structures to Lua
-	summary := fmt.Sprintf("Found %d results", len(results))
-	if len(results) > 0 {
-		summary = fmt.Sprintf("Found %d results, first one: %s", len(results), results[0].Content)
-	}
-
-	// Try to call the hook function with a simple string instead of complex structures
-	result, err := engine.ExecuteFunction(ctx, afterRetrieveFuncName, summary)
+	result, err := engine.ExecuteFunction(ctx, afterRetrieveFuncName, results)
 	if err != nil {
 		// If the function doesn't exist, that's ok - just continue
-		if err.Error() == fmt.Sprintf("%v: %s", scripting.ErrFunctionNotFound, afterRetrieveFuncName) {
+		if errors.Is(err, scripting.ErrFunctionNotFound) {
 			return results, nil
 		}
 		// Log the error but don't fail the operation
@@ -123,13 +180,57 @@ func callAfterRetrieveHook(
 		return results, nil
 	}
 
-	// In Phase 1, we just acknowledge the script was called
-	// but we don't modify the results based on the return value
-	if resultStr, ok := result.(string); ok {
-		log.DebugContext(ctx, "Lua hook processed results", 
-			"hook", afterRetrieveFuncName,
-			"result", resultStr)
+	if result == nil {
+		return results, nil
+	}
+
+	var processed []ltm.MemoryRecord
+	if err := scripting.Unmarshal(result, &processed); err != nil {
+		return results, fmt.Errorf("invalid result from %s hook: %w", afterRetrieveFuncName, err)
 	}
 
-	return results, nil
-}
\ No newline at end of file
+	// The hook must not hand back records the caller could not have retrieved
+	processed, err = validateHookRecords(ctx, results, processed)
+	if err != nil {
+		return results, fmt.Errorf("rejected result from %s hook: %w", afterRetrieveFuncName, err)
+	}
+
+	log.DebugContext(ctx, "Lua hook processed results", 
+		"hook", afterRetrieveFuncName,
+		"before", len(results),
+		"after", len(processed))
+	return processed, nil
+}
+
+// validateHookRecords checks that every record returned by a hook was passed
+// to it and is visible to the user in ctx. The hook's copies keep the entity,
+// user and access level of the records passed in, whatever it set them to.
+func validateHookRecords(ctx context.Context, passed, returned []ltm.MemoryRecord) ([]ltm.MemoryRecord, error) {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return nil, entity.ErrMissingEntityContext
+	}
+
+	byID := make(map[string]ltm.MemoryRecord, len(passed))
+	for _, record := range passed {
+		byID[record.ID] = record
+	}
+	
+	validated := make([]ltm.MemoryRecord, len(returned))
+	for i, record := range returned {
+		original, ok := byID[record.ID]
+		if !ok {
+			return nil, fmt.Errorf("%w: record %q of entity %q was not passed to the hook",
+				ErrHookIsolationViolation, record.ID, record.EntityID)
+		}
+		record.EntityID = original.EntityID
+		record.UserID = original.UserID
+		record.AccessLevel = original.AccessLevel
+		if !visibleTo(entityCtx, record) {
+			return nil, fmt.Errorf("%w: record %q is private to another user",
+				ErrHookIsolationViolation, record.ID)
+		}
+		validated[i] = record
+	}
+	return validated, nil
+}
@@ -0,0 +1,620 @@
+package mmu
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm/adapters/mock"
+	"github.com/lexlapax/cogmem/pkg/scripting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHookTestEngine(t *testing.T, script string) *scripting.LuaEngine {
+	engine, err := scripting.NewLuaEngine(scripting.DefaultConfig())
+	require.NoError(t, err)
+	t.Cleanup(func() { engine.Close() })
+	
+	require.NoError(t, engine.LoadScript("hooks", []byte(script)))
+	return engine
+}
+
+func TestLuaHooks_TypedArguments(t *testing.T) {
+	engine := newHookTestEngine(t, `
+		function before_retrieve(query)
+			query.text = query.text .. " rewritten"
+			query.filters = {source = "lua"}
+			query.limit = query.limit * 2
+			return query
+		end
+		
+		function rank_semantic_results(results, query_text)
+			local ranked = {}
+			for i = #results, 1, -1 do
+				local record = results[i]
+				record.metadata.ranked_for = query_text
+				table.insert(ranked, record)
+			end
+			return ranked
+		end
+	`)
+	mmu := NewMMU(nil, nil, engine, Config{EnableLuaHooks: true})
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	t.Run("before_retrieve receives and returns an LTMQuery", func(t *testing.T) {
+		query := ltm.LTMQuery{
+			Text:      "cats",
+			Limit:     5,
+			Embedding: []float32{0.5, 0.25},
+		}
+		updated, err := callBeforeRetrieveHook(ctx, engine, query)
+		require.NoError(t, err)
+		
+		assert.Equal(t, "cats rewritten", updated.Text)
+		assert.Equal(t, 10, updated.Limit)
+		assert.Equal(t, map[string]interface{}{"source": "lua"}, updated.Filters)
+		assert.Equal(t, []float32{0.5, 0.25}, updated.Embedding)
+	})
+	
+	t.Run("rank_semantic_results receives and returns memory records", func(t *testing.T) {
+		createdAt := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+		records := []ltm.MemoryRecord{
+			{
+				ID:          "first",
+				EntityID:    "test-entity",
+				UserID:      "test-user",
+				AccessLevel: entity.SharedWithinEntity,
+				Content:     "first memory",
+				Metadata:    map[string]interface{}{"topic": "cats"},
+				Embedding:   []float32{1, 0},
+				CreatedAt:   createdAt,
+				UpdatedAt:   createdAt,
+				Score:       0.9,
+			},
+			{
+				ID:       "second",
+				EntityID: "test-entity",
+				UserID:   "test-user",
+				Content:  "second memory",
+				Metadata: map[string]interface{}{},
+				Score:    0.5,
+			},
+		}
+		
+		ranked, err := mmu.rankSemanticResults(ctx, records, ltm.LTMQuery{Text: "cats"})
+		require.NoError(t, err)
+		require.Len(t, ranked, 2)
+		
+		assert.Equal(t, "second", ranked[0].ID)
+		first := ranked[1]
+		assert.Equal(t, "first", first.ID)
+		assert.Equal(t, entity.EntityID("test-entity"), first.EntityID)
+		assert.Equal(t, "test-user", first.UserID)
+		assert.Equal(t, entity.SharedWithinEntity, first.AccessLevel)
+		assert.Equal(t, "first memory", first.Content)
+		assert.Equal(t, map[string]interface{}{"topic": "cats", "ranked_for": "cats"}, first.Metadata)
+		assert.Equal(t, []float32{1, 0}, first.Embedding)
+		assert.True(t, createdAt.Equal(first.CreatedAt))
+		assert.Equal(t, 0.9, first.Score)
+	})
+}
+
+func TestLuaHooks_InvalidResults(t *testing.T) {
+	engine := newHookTestEngine(t, `
+		function before_retrieve(query)
+			return {limit = "many"}
+		end
+		
+		function rank_semantic_results(results, query_text)
+			return "not a list"
+		end
+	`)
+	mmu := NewMMU(nil, nil, engine, Config{EnableLuaHooks: true})
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	query := ltm.LTMQuery{Text: "cats", Limit: 5}
+	updated, err := callBeforeRetrieveHook(ctx, engine, query)
+	require.NoError(t, err)
+	assert.Equal(t, query, updated)
+	
+	records := []ltm.MemoryRecord{{ID: "only", Content: "memory"}}
+	ranked, err := mmu.rankSemanticResults(ctx, records, query)
+	require.NoError(t, err)
+	assert.Equal(t, records, ranked)
+}
+
+func TestLuaHooks_AfterRetrieve(t *testing.T) {
+	engine := newHookTestEngine(t, `
+		function after_retrieve(results)
+			local mode = results[1].content
+			if mode == "keep" then
+				return nil
+			end
+			if mode == "inject" then
+				table.insert(results, {id = "foreign", entity_id = "other-entity", content = "stolen", access_level = 1})
+				return results
+			end
+			if mode == "private" then
+				table.insert(results, {id = "secret", entity_id = "test-entity", user_id = "other-user", content = "secret", access_level = 0})
+				return results
+			end
+			if mode == "invalid" then
+				return {{id = 42}}
+			end
+			if mode == "fabricate" then
+				table.insert(results, {id = "made-up", entity_id = "test-entity", content = "fabricated", access_level = 1})
+				return results
+			end
+			if mode == "relabel" then
+				for _, record in ipairs(results) do
+					record.entity_id = "other-entity"
+					record.user_id = "someone-else"
+					record.access_level = 1
+				end
+				return results
+			end
+			
+			-- Drop low scores, reverse the order and annotate
+			local processed = {}
+			for i = #results, 1, -1 do
+				local record = results[i]
+				if record.score >= 0.5 then
+					record.metadata.seen_by_hook = true
+					table.insert(processed, record)
+				end
+			end
+			return processed
+		end
+	`)
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	records := func(first string) []ltm.MemoryRecord {
+		return []ltm.MemoryRecord{
+			{ID: "a", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: first, Metadata: map[string]interface{}{"n": 1}, Score: 0.9},
+			{ID: "b", EntityID: "test-entity", UserID: "test-user", Content: "private to caller", Metadata: map[string]interface{}{}, Score: 0.7},
+			{ID: "c", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "weak", Metadata: map[string]interface{}{}, Score: 0.1},
+		}
+	}
+	
+	t.Run("filters, reorders and annotates", func(t *testing.T) {
+		processed, err := callAfterRetrieveHook(ctx, engine, records("filter"))
+		require.NoError(t, err)
+		require.Len(t, processed, 2)
+		
+		assert.Equal(t, "b", processed[0].ID)
+		assert.Equal(t, "a", processed[1].ID)
+		assert.Equal(t, 0.9, processed[1].Score)
+		assert.Equal(t, entity.EntityID("test-entity"), processed[1].EntityID)
+		assert.Equal(t, map[string]interface{}{"n": float64(1), "seen_by_hook": true}, processed[1].Metadata)
+	})
+	
+	t.Run("nil keeps the results", func(t *testing.T) {
+		original := records("keep")
+		processed, err := callAfterRetrieveHook(ctx, engine, original)
+		require.NoError(t, err)
+		assert.Equal(t, original, processed)
+	})
+	
+	t.Run("rejects records from another entity", func(t *testing.T) {
+		original := records("inject")
+		processed, err := callAfterRetrieveHook(ctx, engine, original)
+		assert.ErrorIs(t, err, ErrHookIsolationViolation)
+		assert.Contains(t, err.Error(), "other-entity")
+		assert.Equal(t, original, processed)
+	})
+	
+	t.Run("rejects records private to another user", func(t *testing.T) {
+		original := records("private")
+		processed, err := callAfterRetrieveHook(ctx, engine, original)
+		assert.ErrorIs(t, err, ErrHookIsolationViolation)
+		assert.Equal(t, original, processed)
+	})
+	
+	t.Run("rejects records that were not passed to it", func(t *testing.T) {
+		original := records("fabricate")
+		processed, err := callAfterRetrieveHook(ctx, engine, original)
+		assert.ErrorIs(t, err, ErrHookIsolationViolation)
+		assert.Contains(t, err.Error(), "made-up")
+		assert.Equal(t, original, processed)
+	})
+	
+	t.Run("keeps the stored ownership of records", func(t *testing.T) {
+		original := records("relabel")
+		processed, err := callAfterRetrieveHook(ctx, engine, original)
+		require.NoError(t, err)
+		require.Len(t, processed, len(original))
+		for i, record := range processed {
+			assert.Equal(t, original[i].EntityID, record.EntityID)
+			assert.Equal(t, original[i].UserID, record.UserID)
+			assert.Equal(t, original[i].AccessLevel, record.AccessLevel)
+		}
+	})
+	
+	t.Run("rejects malformed records", func(t *testing.T) {
+		original := records("invalid")
+		processed, err := callAfterRetrieveHook(ctx, engine, original)
+		assert.ErrorIs(t, err, scripting.ErrTypeMismatch)
+		assert.Equal(t, original, processed)
+	})
+}
+
+func TestLuaHooks_ShippedRetrievalFilter(t *testing.T) {
+	engine, err := scripting.NewLuaEngine(scripting.DefaultConfig())
+	require.NoError(t, err)
+	defer engine.Close()
+	require.NoError(t, engine.LoadScriptFile("../../scripts/mmu/retrieval_filter.lua"))
+	
+	ltmStore := mock.NewMockStore()
+	mmu := NewMMU(ltmStore, nil, engine, Config{EnableLuaHooks: true})
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	for _, record := range []ltm.MemoryRecord{
+		{ID: "shown", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "the visible note"},
+		{ID: "hidden", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "the hidden note", Metadata: map[string]interface{}{"hidden": true}},
+	} {
+		_, err := ltmStore.Store(ctx, record)
+		require.NoError(t, err)
+	}
+	
+	results, err := mmu.RetrieveFromLTM(ctx, "note", DefaultRetrievalOptions())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "shown", results[0].ID)
+}
+
+func TestLuaHooks_MemoryAPI(t *testing.T) {
+	engine := newHookTestEngine(t, `
+		function after_retrieve(results)
+			-- Attach the content of the related record, if the caller can see it
+			for _, record in ipairs(results) do
+				local related_id = record.metadata and record.metadata.related_id
+				if related_id then
+					local related = cogmem.memory.get(related_id)
+					record.metadata.related_content = related and related.content or "not found"
+				end
+			end
+			
+			-- Retrieval from a hook does not run the hooks again
+			local nested, err = cogmem.memory.retrieve({text = "note", limit = 10})
+			if err then
+				error(err)
+			end
+			for _, record in ipairs(results) do
+				record.metadata.nested_results = #nested
+			end
+			return results
+		end
+		
+		function before_encode(content)
+			if content == "remember this" then
+				local _, err = cogmem.memory.store("derived from " .. content, {derived = true})
+				if err then
+					error(err)
+				end
+			end
+			return content
+		end
+	`)
+	
+	ltmStore := mock.NewMockStore()
+	mmu := NewMMU(ltmStore, nil, engine, Config{EnableLuaHooks: true})
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	otherCtx := entity.ContextWithEntity(context.Background(), entity.NewContext("other-entity", "other-user"))
+	
+	_, err := ltmStore.Store(otherCtx, ltm.MemoryRecord{ID: "foreign", AccessLevel: entity.SharedWithinEntity, Content: "foreign note"})
+	require.NoError(t, err)
+	for _, record := range []ltm.MemoryRecord{
+		{ID: "related", AccessLevel: entity.SharedWithinEntity, Content: "related note"},
+		{ID: "linked", AccessLevel: entity.SharedWithinEntity, Content: "linked note", Metadata: map[string]interface{}{"related_id": "related"}},
+		{ID: "cross", AccessLevel: entity.SharedWithinEntity, Content: "cross note", Metadata: map[string]interface{}{"related_id": "foreign"}},
+	} {
+		_, err := ltmStore.Store(ctx, record)
+		require.NoError(t, err)
+	}
+	
+	t.Run("lookups stay within the caller's entity", func(t *testing.T) {
+		results, err := mmu.RetrieveFromLTM(ctx, "note", DefaultRetrievalOptions())
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		
+		byID := make(map[string]ltm.MemoryRecord)
+		for _, record := range results {
+			byID[record.ID] = record
+			assert.Equal(t, float64(3), record.Metadata["nested_results"])
+		}
+		assert.Equal(t, "related note", byID["linked"].Metadata["related_content"])
+		assert.Equal(t, "not found", byID["cross"].Metadata["related_content"])
+	})
+	
+	t.Run("stores within the caller's entity", func(t *testing.T) {
+		_, err := mmu.EncodeToLTM(ctx, "remember this")
+		require.NoError(t, err)
+		
+		derived, err := ltmStore.Retrieve(ctx, ltm.LTMQuery{Filters: map[string]interface{}{"derived": true}})
+		require.NoError(t, err)
+		require.Len(t, derived, 1)
+		assert.Equal(t, "derived from remember this", derived[0].Content)
+		assert.Equal(t, entity.EntityID("test-entity"), derived[0].EntityID)
+	})
+}
+
+func TestScriptMemory_VectorStore(t *testing.T) {
+	mmu, ltmStore, ctx := setupChromemTest(t)
+	memory := scriptMemory{mmu: mmu}
+	embedding := []float32{0.1, 0.2, 0.3, 0.4, 0.5}
+	
+	// More records than a default query returns, so only a real ID lookup finds the target
+	for i := 0; i < 15; i++ {
+		_, err := ltmStore.Store(ctx, ltm.MemoryRecord{
+			ID:          fmt.Sprintf("filler-%d", i),
+			EntityID:    "test-entity",
+			AccessLevel: entity.SharedWithinEntity,
+			Content:     "filler",
+			Embedding:   embedding,
+		})
+		require.NoError(t, err)
+	}
+	for _, record := range []ltm.MemoryRecord{
+		{ID: "target", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "target"},
+		{ID: "private", EntityID: "test-entity", UserID: "other-user", AccessLevel: entity.PrivateToUser, Content: "private"},
+		{ID: "foreign", EntityID: "other-entity", AccessLevel: entity.SharedWithinEntity, Content: "foreign"},
+	} {
+		record.Embedding = embedding
+		recordCtx := entity.ContextWithEntity(context.Background(), entity.NewContext(record.EntityID, record.UserID))
+		_, err := ltmStore.Store(recordCtx, record)
+		require.NoError(t, err)
+	}
+	
+	t.Run("get", func(t *testing.T) {
+		found, err := memory.Get(ctx, "target")
+		require.NoError(t, err)
+		require.NotNil(t, found)
+		assert.Equal(t, "target", found.(ltm.MemoryRecord).Content)
+		
+		for _, id := range []string{"private", "foreign", "missing"} {
+			found, err := memory.Get(ctx, id)
+			require.NoError(t, err)
+			assert.Nil(t, found, id)
+		}
+	})
+	
+	t.Run("retrieve", func(t *testing.T) {
+		found, err := memory.Retrieve(ctx, map[string]interface{}{"text": "private", "limit": 100})
+		require.NoError(t, err)
+		records := found.([]ltm.MemoryRecord)
+		require.NotEmpty(t, records)
+		for _, record := range records {
+			assert.NotEqual(t, "private", record.ID)
+			assert.NotEqual(t, "foreign", record.ID)
+		}
+	})
+}
+
+func TestLuaHooks_LLMAPI(t *testing.T) {
+	engine := newHookTestEngine(t, `
+		function before_encode(content)
+			local label, err = cogmem.llm.complete("Classify this memory: " .. content, {temperature = 0})
+			if err then
+				error(err)
+			end
+			return {metadata = {category = label}}
+		end
+	`)
+	
+	reasoningEngine := newMockReasoningEngine()
+	reasoningEngine.processResults["Classify this memory: I adopted a cat"] = "pets"
+	ltmStore := mock.NewMockStore()
+	mmu := NewMMU(ltmStore, reasoningEngine, engine, Config{EnableLuaHooks: true})
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	id, err := mmu.EncodeToLTM(ctx, "I adopted a cat")
+	require.NoError(t, err)
+	
+	records, err := ltmStore.Retrieve(ctx, ltm.LTMQuery{ExactMatch: map[string]interface{}{"ID": id}})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "I adopted a cat", records[0].Content)
+	assert.Equal(t, "pets", records[0].Metadata["category"])
+}
+
+func TestLuaHooks_VectorRanking(t *testing.T) {
+	engine := newHookTestEngine(t, `
+		function rank_semantic_results(results, query_text, query_embedding)
+			local ranked = {}
+			for _, match in ipairs(cogmem.vec.top_k(query_embedding, results)) do
+				local record = results[match.index]
+				record.metadata.embedding_is_vec = cogmem.vec.is_vec(record.embedding)
+				record.score = match.score
+				table.insert(ranked, record)
+			end
+			return ranked
+		end
+	`)
+	mmu := NewMMU(nil, nil, engine, Config{EnableLuaHooks: true})
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	results := []ltm.MemoryRecord{
+		{ID: "far", EntityID: "test-entity", UserID: "test-user", Metadata: map[string]interface{}{}, Embedding: []float32{0, 1}},
+		{ID: "near", EntityID: "test-entity", UserID: "test-user", Metadata: map[string]interface{}{}, Embedding: []float32{1, 0}},
+	}
+	ranked, err := mmu.rankSemanticResults(ctx, results, ltm.LTMQuery{Text: "query", Embedding: []float32{1, 0.1}})
+	require.NoError(t, err)
+	require.Len(t, ranked, 2)
+	
+	assert.Equal(t, "near", ranked[0].ID)
+	assert.Equal(t, "far", ranked[1].ID)
+	assert.Greater(t, ranked[0].Score, ranked[1].Score)
+	assert.Equal(t, true, ranked[0].Metadata["embedding_is_vec"])
+	assert.Equal(t, []float32{1, 0}, ranked[0].Embedding)
+}
+
+func TestLuaHooks_RankingIsolation(t *testing.T) {
+	engine := newHookTestEngine(t, `
+		function rank_semantic_results(results, query_text, query_embedding)
+			table.insert(results, {id = "leak", entity_id = "other-entity", access_level = 1, content = "secret"})
+			return results
+		end
+	`)
+	mmu := NewMMU(nil, nil, engine, Config{EnableLuaHooks: true})
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	results := []ltm.MemoryRecord{
+		{ID: "own", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "mine"},
+	}
+	ranked, err := mmu.rankSemanticResults(ctx, results, ltm.LTMQuery{Text: "query"})
+	require.NoError(t, err)
+	assert.Equal(t, results, ranked, "a foreign record falls back to the unranked results")
+}
+
+func TestLuaHooks_Context(t *testing.T) {
+	engine := newHookTestEngine(t, `
+		function before_retrieve(query)
+			query.filters = query.filters or {}
+			query.filters.seen_by = ctx.operation .. ":" .. ctx.entity_id .. ":" .. ctx.user_id
+			return query
+		end
+		
+		function before_encode(content)
+			return {metadata = {operation = ctx.operation, request_id = ctx.request_id}}
+		end
+	`)
+	ltmStore := mock.NewMockStore()
+	mmu := NewMMU(ltmStore, nil, engine, Config{EnableLuaHooks: true})
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	id, err := mmu.EncodeToLTM(scripting.WithRequestID(ctx, "request-1"), "a note")
+	require.NoError(t, err)
+	records, err := ltmStore.Retrieve(ctx, ltm.LTMQuery{ExactMatch: map[string]interface{}{"ID": id}})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, operationEncode, records[0].Metadata["operation"])
+	assert.Equal(t, "request-1", records[0].Metadata["request_id"])
+	
+	_, err = ltmStore.Store(ctx, ltm.MemoryRecord{
+		ID:          "seen",
+		AccessLevel: entity.SharedWithinEntity,
+		Content:     "seen note",
+		Metadata:    map[string]interface{}{"seen_by": "retrieve:test-entity:test-user"},
+	})
+	require.NoError(t, err)
+	results, err := mmu.RetrieveFromLTM(ctx, "note", DefaultRetrievalOptions())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "seen", results[0].ID)
+}
+
+func TestLuaHooks_EntityScripts(t *testing.T) {
+	engine := newHookTestEngine(t, `
+		function after_retrieve(results)
+			local kept = {}
+			for _, record in ipairs(results) do
+				if record.metadata.tier ~= "internal" then
+					table.insert(kept, record)
+				end
+			end
+			return kept
+		end
+	`)
+	require.NoError(t, engine.LoadEntityScript("tenant-a", "tenant-a", []byte(`
+		function after_retrieve(results)
+			local kept = {}
+			for _, record in ipairs(results) do
+				if record.metadata.tier == "gold" then
+					table.insert(kept, record)
+				end
+			end
+			return kept
+		end
+	`)))
+	
+	ltmStore := mock.NewMockStore()
+	mmu := NewMMU(ltmStore, nil, engine, Config{EnableLuaHooks: true})
+	
+	tiers := func(ctx context.Context) []string {
+		results, err := mmu.RetrieveFromLTM(ctx, "note", DefaultRetrievalOptions())
+		require.NoError(t, err)
+		var found []string
+		for _, record := range results {
+			found = append(found, record.Metadata["tier"].(string))
+		}
+		sort.Strings(found)
+		return found
+	}
+	
+	var ctxs []context.Context
+	for _, entityID := range []entity.EntityID{"tenant-a", "tenant-b"} {
+		ctx := entity.ContextWithEntity(context.Background(), entity.NewContext(entityID, "user"))
+		ctxs = append(ctxs, ctx)
+		for _, tier := range []string{"gold", "basic", "internal"} {
+			_, err := ltmStore.Store(ctx, ltm.MemoryRecord{
+				AccessLevel: entity.SharedWithinEntity,
+				Content:     tier + " note",
+				Metadata:    map[string]interface{}{"tier": tier},
+			})
+			require.NoError(t, err)
+		}
+	}
+	
+	assert.Equal(t, []string{"gold"}, tiers(ctxs[0]))
+	assert.Equal(t, []string{"basic", "gold"}, tiers(ctxs[1]))
+	
+	// Without its own scripts, the entity gets the global filter
+	require.True(t, engine.UnloadEntityScripts("tenant-a"))
+	assert.Equal(t, []string{"basic", "gold"}, tiers(ctxs[0]))
+}
+
+func TestLuaHooks_HandlerChains(t *testing.T) {
+	engine := newHookTestEngine(t, `
+		cogmem.hooks.register("before_encode", function(content)
+			return {content = string.upper(content), metadata = {shouted = true, source = "first"}}
+		end, {name = "shout", priority = 10})
+		
+		cogmem.hooks.register("before_encode", function(content)
+			return {content = content .. "!", metadata = {source = "second"}}
+		end, {name = "exclaim"})
+		
+		cogmem.hooks.register("score_importance", function(content)
+			return nil
+		end, {name = "undecided", priority = 1})
+		
+		cogmem.hooks.register("score_importance", function(content)
+			return 7
+		end, {name = "fixed"})
+	`)
+	ltmStore := mock.NewMockStore()
+	mmu := NewMMU(ltmStore, nil, engine, Config{EnableLuaHooks: true, EnableImportanceScoring: true})
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	// Go handlers run alongside Lua ones
+	require.NoError(t, engine.RegisterHookHandler(afterRetrieveFuncName, "drop_short", 0, func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		var kept []ltm.MemoryRecord
+		for _, record := range args[0].([]ltm.MemoryRecord) {
+			if len(record.Content) > 5 {
+				kept = append(kept, record)
+			}
+		}
+		return kept, nil
+	}))
+	
+	id, err := mmu.EncodeToLTM(ctx, "hello")
+	require.NoError(t, err)
+	records, err := ltmStore.Retrieve(ctx, ltm.LTMQuery{ExactMatch: map[string]interface{}{"ID": id}})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "HELLO!", records[0].Content)
+	assert.Equal(t, true, records[0].Metadata["shouted"])
+	assert.Equal(t, "second", records[0].Metadata["source"])
+	assert.Equal(t, float64(7), records[0].Metadata[MetadataKeyImportance])
+	
+	_, err = ltmStore.Store(ctx, ltm.MemoryRecord{ID: "short", AccessLevel: entity.SharedWithinEntity, Content: "HELLO"})
+	require.NoError(t, err)
+	results, err := mmu.RetrieveFromLTM(ctx, "HELLO", DefaultRetrievalOptions())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, id, results[0].ID)
+}
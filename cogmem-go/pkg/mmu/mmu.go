@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,6 +14,7 @@ import (
 	"github.com/lexlapax/cogmem/pkg/mem/ltm"
 	"github.com/lexlapax/cogmem/pkg/reasoning"
 	"github.com/lexlapax/cogmem/pkg/scripting"
+	"github.com/lexlapax/cogmem/pkg/tokenizer"
 )
 
 // RetrievalOptions configures the behavior of memory retrieval.
@@ -19,19 +22,49 @@ type RetrievalOptions struct {
 	// MaxResults limits the number of records returned
 	MaxResults int
 	
-	// Strategy determines the retrieval approach ("exact", "keyword", "semantic")
+	// Strategy determines the retrieval approach ("exact", "keyword", "semantic",
+	// "multi_query", "hyde")
 	Strategy string
 	
 	// IncludeMetadata determines whether to include metadata in the results
 	IncludeMetadata bool
+	
+	// Diversity enables Maximal Marginal Relevance re-ranking of semantic results.
+	// It is the MMR lambda in (0, 1]: 1 ranks purely by relevance, lower values
+	// favour results that differ from those already selected. 0 disables MMR.
+	Diversity float64
+	
+	// DiversityFetchFactor is how many times the requested number of results to
+	// over-retrieve as MMR candidates (defaults to 3 when Diversity is set)
+	DiversityFetchFactor int
+	
+	// MinScore drops semantic results whose normalized similarity score
+	// (ltm.MemoryRecord.Score, in [0, 1]) is below this threshold. 0 disables it.
+	MinScore float64
+	
+	// ImportanceWeight blends each result's importance (see
+	// MetadataKeyImportance) into its ranking, in [0, 1]: results are ordered by
+	// (1-w)*score + w*normalized importance, also when re-ranked for diversity.
+	// Results of non-semantic strategies have no score and are ordered by
+	// importance. 0 ranks by similarity alone.
+	ImportanceWeight float64
+	
+	// QueryVariants is the number of paraphrases generated by the "multi_query"
+	// strategy (defaults to 3)
+	QueryVariants int
+	
+	// Explain attaches a *ResultExplanation to each result's metadata under
+	// MetadataKeyExplain, tracing how it was scored and ranked
+	Explain bool
 }
 
 // DefaultRetrievalOptions returns the default options for memory retrieval.
 func DefaultRetrievalOptions() RetrievalOptions {
 	return RetrievalOptions{
-		MaxResults:     10,
-		Strategy:       "exact",
-		IncludeMetadata: true,
+		MaxResults:       10,
+		Strategy:         "exact",
+		IncludeMetadata:  true,
+		ImportanceWeight: 0.2,
 	}
 }
 
@@ -58,8 +91,28 @@ type Config struct {
 	EnableVectorOperations bool
 	
 	// WorkingMemoryLimit sets the maximum number of records in working memory
-	// before overflow triggers LTM encoding
+	// before overflow evicts the least important half (0 disables working memory)
 	WorkingMemoryLimit int
+	
+	// WorkingMemoryTokenLimit sets the maximum number of tokens of content in
+	// working memory before overflow evicts the least important half (0 disables it)
+	WorkingMemoryTokenLimit int
+	
+	// EnableImportanceScoring asks the reasoning engine to rate each new memory's
+	// importance on a 1-10 scale before it is stored
+	EnableImportanceScoring bool
+	
+	// ImportanceBatchSize is the maximum number of short inputs rated together
+	// in a single reasoning call
+	ImportanceBatchSize int
+	
+	// ImportanceShortInputChars is the content length below which an input is
+	// considered short and may be batched with others for scoring
+	ImportanceShortInputChars int
+	
+	// QueryExpansionCacheSize is the number of multi_query and hyde expansions
+	// kept in memory so repeated queries skip the reasoning engine (0 disables caching)
+	QueryExpansionCacheSize int
 }
 
 // DefaultConfig returns the default configuration for the MMU.
@@ -68,10 +121,15 @@ func DefaultConfig() Config {
 		EnableLuaHooks:        true,
 		EnableVectorOperations: true,
 		WorkingMemoryLimit:    100,
+		EnableImportanceScoring:   false,
+		ImportanceBatchSize:       10,
+		ImportanceShortInputChars: 280,
+		QueryExpansionCacheSize:   256,
 	}
 }
 
-// MMUI is the implementation of the MMU interface.
+// MMUI is the implementation of the MMU interface. It is safe for concurrent
+// use; working memory is kept per entity in independently locked shards.
 type MMUI struct {
 	// ltmStore is the long-term memory store
 	ltmStore ltm.LTMStore
@@ -85,9 +143,24 @@ type MMUI struct {
 	// config contains configuration options
 	config Config
 	
-	// workingMemory holds records not yet committed to LTM
+	// workingMemory holds records not yet committed to LTM, per entity
 	// This is a simple implementation for Phase 2
-	workingMemory []ltm.MemoryRecord
+	workingMemory *workingMemoryStore
+	
+	// expansionCache holds embeddings produced by the multi_query and hyde strategies
+	expansionCache *expansionCache
+	
+	// reranker optionally reorders semantic results before the rank_semantic_results hook
+	reranker Reranker
+	
+	// rerankerMutex guards reranker, which may be replaced while retrievals run
+	rerankerMutex sync.RWMutex
+	
+	// tokenizer counts tokens for budget decisions, matching the reasoning engine's model
+	tokenizer tokenizer.Tokenizer
+	
+	// sessionLocks serialises RecordTurns calls per session
+	sessionLocks sessionLocks
 }
 
 // NewMMU creates a new MMU with the specified dependencies.
@@ -102,7 +175,17 @@ func NewMMU(
 		reasoningEngine: reasoningEngine,
 		scriptEngine:    scriptEngine,
 		config:          config,
-		workingMemory:   make([]ltm.MemoryRecord, 0, config.WorkingMemoryLimit),
+		workingMemory:   newWorkingMemoryStore(),
+		expansionCache:  newExpansionCache(config.QueryExpansionCacheSize),
+		tokenizer:       reasoning.TokenizerFor(reasoningEngine),
+	}
+	
+	// Give scripts access to memory within the entity context of their caller
+	if binder, ok := scriptEngine.(scripting.MemoryAPIBinder); ok {
+		binder.SetMemoryAPI(scriptMemory{mmu: mmu})
+	}
+	if binder, ok := scriptEngine.(scripting.ReasoningBinder); ok && reasoningEngine != nil {
+		binder.SetReasoningEngine(reasoningEngine)
 	}
 	
 	// Determine if the LTM store supports vector operations
@@ -117,6 +200,7 @@ func NewMMU(
 		"lua_hooks_enabled", config.EnableLuaHooks,
 		"vector_operations", supportsVectors,
 		"ltm_store_type", fmt.Sprintf("%T", ltmStore),
+		"tokenizer", mmu.tokenizer.Name(),
 	)
 	
 	return mmu
@@ -124,10 +208,69 @@ func NewMMU(
 
 // EncodeToLTM implements the MMU interface.
 func (m *MMUI) EncodeToLTM(ctx context.Context, dataToStore interface{}) (string, error) {
+	ctx = scripting.WithOperation(ctx, operationEncode)
+	record, err := m.prepareRecord(ctx, dataToStore)
+	if err != nil {
+		return "", err
+	}
+	
+	// Rate the importance of the memory before it is stored
+	if m.config.EnableImportanceScoring {
+		m.scoreImportance(ctx, []*ltm.MemoryRecord{&record})
+	}
+	
+	id, err := m.storeRecord(ctx, record)
+	if err == nil {
+		record.ID = id
+		m.remember(ctx, record)
+	}
+	return id, err
+}
+
+// EncodeBatchToLTM stores several items in long-term memory. It behaves like
+// calling EncodeToLTM for each item, except that importance scoring for short
+// inputs is batched into as few reasoning calls as possible.
+// It returns the IDs of the records stored before the first error, if any.
+func (m *MMUI) EncodeBatchToLTM(ctx context.Context, items []interface{}) ([]string, error) {
+	ctx = scripting.WithOperation(ctx, operationEncode)
+	records := make([]ltm.MemoryRecord, 0, len(items))
+	for _, item := range items {
+		record, err := m.prepareRecord(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	
+	if m.config.EnableImportanceScoring {
+		pending := make([]*ltm.MemoryRecord, len(records))
+		for i := range records {
+			pending[i] = &records[i]
+		}
+		m.scoreImportance(ctx, pending)
+	}
+	
+	ids := make([]string, 0, len(records))
+	for _, record := range records {
+		id, err := m.storeRecord(ctx, record)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+		record.ID = id
+		m.remember(ctx, record)
+	}
+	
+	return ids, nil
+}
+
+// prepareRecord builds a memory record from the data to store, generating its
+// embedding and applying the encode-time Lua hooks.
+func (m *MMUI) prepareRecord(ctx context.Context, dataToStore interface{}) (ltm.MemoryRecord, error) {
 	// Verify entity context
 	entityCtx, ok := entity.GetEntityContext(ctx)
 	if !ok {
-		return "", entity.ErrMissingEntityContext
+		return ltm.MemoryRecord{}, entity.ErrMissingEntityContext
 	}
 
 	// Prepare record to store
@@ -150,7 +293,7 @@ func (m *MMUI) EncodeToLTM(ctx context.Context, dataToStore interface{}) (string
 			// Otherwise, convert the entire map to JSON and store it
 			jsonBytes, err := json.Marshal(data)
 			if err != nil {
-				return "", fmt.Errorf("failed to marshal data: %w", err)
+				return ltm.MemoryRecord{}, fmt.Errorf("failed to marshal data: %w", err)
 			}
 			record.Content = string(jsonBytes)
 		}
@@ -173,7 +316,7 @@ func (m *MMUI) EncodeToLTM(ctx context.Context, dataToStore interface{}) (string
 		// For any other type, try to marshal to JSON
 		jsonBytes, err := json.Marshal(dataToStore)
 		if err != nil {
-			return "", fmt.Errorf("failed to marshal data: %w", err)
+			return ltm.MemoryRecord{}, fmt.Errorf("failed to marshal data: %w", err)
 		}
 		record.Content = string(jsonBytes)
 	}
@@ -193,7 +336,7 @@ func (m *MMUI) EncodeToLTM(ctx context.Context, dataToStore interface{}) (string
 	needsEmbedding := m.shouldGenerateEmbedding(record)
 	
 	// Apply before_embedding Lua hook if enabled
-	if needsEmbedding && m.config.EnableLuaHooks && m.scriptEngine != nil {
+	if needsEmbedding && m.hooksEnabled(ctx) {
 		result, err := m.scriptEngine.ExecuteFunction(ctx, beforeEmbeddingFuncName, record.Content)
 		if err == nil {
 			// If the hook returns false, skip embedding generation
@@ -221,31 +364,43 @@ func (m *MMUI) EncodeToLTM(ctx context.Context, dataToStore interface{}) (string
 	}
 	
 	// Apply before_encode Lua hook if enabled
-	if m.config.EnableLuaHooks && m.scriptEngine != nil {
+	if m.hooksEnabled(ctx) {
 		// Call the hook and potentially modify the content
 		result, err := m.scriptEngine.ExecuteFunction(ctx, beforeEncodeFuncName, record.Content)
 		if err == nil && result != nil {
-			// If the hook returns a string, use it as the modified content
-			if modifiedContent, ok := result.(string); ok {
-				record.Content = modifiedContent
+			switch modified := result.(type) {
+			case string:
+				// If the hook returns a string, use it as the modified content
+				record.Content = modified
 				log.Debug("Content modified by before_encode Lua hook")
+			case map[string]interface{}:
+				// A table may replace the content and add metadata, e.g. tags
+				if content, ok := modified["content"].(string); ok {
+					record.Content = content
+				}
+				if metadata, ok := modified["metadata"].(map[string]interface{}); ok {
+					for key, value := range metadata {
+						record.Metadata[key] = value
+					}
+				}
+				log.Debug("Record modified by before_encode Lua hook")
 			}
 		}
 	}
 
+	return record, nil
+}
+
+// storeRecord persists a prepared record and runs the post-encode steps.
+func (m *MMUI) storeRecord(ctx context.Context, record ltm.MemoryRecord) (string, error) {
 	// Store the record in LTM
 	memoryID, err := m.ltmStore.Store(ctx, record)
 	
 	// Apply after_encode hook if enabled
-	if err == nil && m.config.EnableLuaHooks && m.scriptEngine != nil {
+	if err == nil && m.hooksEnabled(ctx) {
 		m.scriptEngine.ExecuteFunction(ctx, afterEncodeFuncName, memoryID)
 	}
 	
-	// Check if we need to manage working memory overflow
-	if err == nil {
-		m.ManageWorkingMemoryOverflow(ctx)
-	}
-	
 	return memoryID, err
 }
 
@@ -266,6 +421,11 @@ func (m *MMUI) shouldGenerateEmbedding(record ltm.MemoryRecord) bool {
 		return false
 	}
 	
+	// Skip if the record asks not to be embedded
+	if skip, ok := record.Metadata[MetadataKeySkipEmbedding].(bool); ok && skip {
+		return false
+	}
+	
 	// Check if the LTM store supports vector operations
 	vectorStore, ok := m.ltmStore.(ltm.VectorCapableLTMStore)
 	if !ok || !vectorStore.SupportsVectorSearch() {
@@ -288,37 +448,180 @@ func truncateString(s string, maxLen int) string {
 	return s[:maxLen] + "..."
 }
 
-// ManageWorkingMemoryOverflow handles eviction of items from working memory to LTM
-// when the working memory reaches its capacity limit.
+// ManageWorkingMemoryOverflow handles eviction of items from the working memory
+// of the entity in the context when it reaches its capacity limit.
 // Exported for testing purposes.
 func (m *MMUI) ManageWorkingMemoryOverflow(ctx context.Context) {
 	// For Phase 2, this is a simple placeholder implementation
 	// In future phases, this would implement more sophisticated overflow management
 	
-	// Skip handling if not initialized or below limit
-	if m.workingMemory == nil || len(m.workingMemory) < m.config.WorkingMemoryLimit {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok || m.workingMemory == nil {
 		return
 	}
 	
-	log.Debug("Managing working memory overflow",
-		"current_size", len(m.workingMemory),
-		"limit", m.config.WorkingMemoryLimit)
+	m.workingMemory.update(entityCtx.EntityID, func(records []ltm.MemoryRecord) []ltm.MemoryRecord {
+		// Skip handling if below both limits
+		tokens := m.workingMemoryTokens(records)
+		overTokenLimit := m.config.WorkingMemoryTokenLimit > 0 && tokens > m.config.WorkingMemoryTokenLimit
+		if len(records) < m.config.WorkingMemoryLimit && !overTokenLimit {
+			return records
+		}
+		
+		log.Debug("Managing working memory overflow",
+			"entity_id", entityCtx.EntityID,
+			"current_size", len(records),
+			"limit", m.config.WorkingMemoryLimit,
+			"current_tokens", tokens,
+			"token_limit", m.config.WorkingMemoryTokenLimit)
+		
+		// Evict half of the records, least important first and oldest first among equals
+		evictionCount := len(records) / 2
+		if evictionCount < 1 && len(records) > 0 {
+			evictionCount = 1
+		}
+		
+		// Ensure we don't have an out-of-bounds error
+		if evictionCount == 0 || evictionCount > len(records) {
+			return records
+		}
+		order := make([]int, len(records))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return importanceOf(records[order[a]]) < importanceOf(records[order[b]])
+		})
+		
+		evicted := make(map[int]bool, evictionCount)
+		for _, idx := range order[:evictionCount] {
+			evicted[idx] = true
+		}
+		
+		// Records to keep, in their original order
+		kept := make([]ltm.MemoryRecord, 0, len(records)-evictionCount)
+		for i, record := range records {
+			if !evicted[i] {
+				kept = append(kept, record)
+			}
+		}
+		return kept
+	})
+}
+
+// remember adds records that were just encoded or retrieved to the working
+// memory of the entity in the context, then evicts if it overflows. Records
+// are copied without their embeddings, which working memory does not need.
+func (m *MMUI) remember(ctx context.Context, records ...ltm.MemoryRecord) {
+	if m.config.WorkingMemoryLimit <= 0 || len(records) == 0 {
+		return
+	}
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return
+	}
 	
-	// Simple LRU implementation - evict the oldest half of the records
-	evictionCount := len(m.workingMemory) / 2
-	if evictionCount < 1 && len(m.workingMemory) > 0 {
-		evictionCount = 1
+	held := make([]ltm.MemoryRecord, 0, len(records))
+	for _, record := range records {
+		if record.EntityID != entityCtx.EntityID {
+			continue
+		}
+		record.Embedding = nil
+		if record.Metadata != nil {
+			record.Metadata = copyMetadata(record.Metadata)
+		}
+		held = append(held, record)
+	}
+	m.workingMemory.add(held...)
+	m.ManageWorkingMemoryOverflow(ctx)
+}
+
+// workingMemoryTokens returns the number of tokens of content in working memory records.
+func (m *MMUI) workingMemoryTokens(records []ltm.MemoryRecord) int {
+	total := 0
+	for _, record := range records {
+		total += m.countTokens(record.Content)
+	}
+	return total
+}
+
+// countTokens counts the tokens in text with the tokenizer of the reasoning engine's model.
+func (m *MMUI) countTokens(text string) int {
+	if m.tokenizer == nil {
+		return tokenizer.NewHeuristic().CountTokens(text)
+	}
+	return m.tokenizer.CountTokens(text)
+}
+
+// WorkingMemoryProvider is implemented by MMUs that expose their working memory.
+type WorkingMemoryProvider interface {
+	// WorkingMemory returns the working memory records of the entity in the context,
+	// oldest first
+	WorkingMemory(ctx context.Context) []ltm.MemoryRecord
+}
+
+// WorkingMemory implements the WorkingMemoryProvider interface.
+func (m *MMUI) WorkingMemory(ctx context.Context) []ltm.MemoryRecord {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return nil
 	}
 	
-	// Ensure we don't have an out-of-bounds error
-	if evictionCount > 0 && evictionCount <= len(m.workingMemory) {
-		// Records to keep
-		m.workingMemory = m.workingMemory[evictionCount:]
+	var records []ltm.MemoryRecord
+	for _, record := range m.workingMemory.snapshot(entityCtx.EntityID) {
+		if visibleTo(entityCtx, record) {
+			records = append(records, record)
+		}
 	}
+	return records
+}
+
+// visibleTo reports whether a record belongs to the caller's entity and, if
+// it is private, to the caller. Not every store enforces access levels.
+func visibleTo(entityCtx entity.Context, record ltm.MemoryRecord) bool {
+	if record.EntityID != entityCtx.EntityID {
+		return false
+	}
+	return record.AccessLevel != entity.PrivateToUser || record.UserID == entityCtx.UserID
+}
+
+// SetReranker installs a Reranker that reorders semantic retrieval results
+// before the rank_semantic_results Lua hook runs. Pass nil to disable re-ranking.
+func (m *MMUI) SetReranker(reranker Reranker) {
+	m.rerankerMutex.Lock()
+	defer m.rerankerMutex.Unlock()
+	m.reranker = reranker
+}
+
+// currentReranker returns the installed Reranker, if any.
+func (m *MMUI) currentReranker() Reranker {
+	m.rerankerMutex.RLock()
+	defer m.rerankerMutex.RUnlock()
+	return m.reranker
 }
 
 // RetrieveFromLTM implements the MMU interface.
 func (m *MMUI) RetrieveFromLTM(ctx context.Context, queryInput interface{}, options RetrievalOptions) ([]ltm.MemoryRecord, error) {
+	return m.retrieve(ctx, queryInput, options, newRetrievalTrace(options))
+}
+
+// ExplainRetrieval performs a retrieval in explain mode and also returns the
+// retrieval-level explanation, which lists the candidates that were filtered out.
+func (m *MMUI) ExplainRetrieval(ctx context.Context, queryInput interface{}, options RetrievalOptions) ([]ltm.MemoryRecord, *RetrievalExplanation, error) {
+	options.Explain = true
+	trace := newRetrievalTrace(options)
+	
+	results, err := m.retrieve(ctx, queryInput, options, trace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return results, trace.retrieval, nil
+}
+
+// retrieve carries out a retrieval, recording each stage in trace when it is non-nil.
+func (m *MMUI) retrieve(ctx context.Context, queryInput interface{}, options RetrievalOptions, trace *retrievalTrace) ([]ltm.MemoryRecord, error) {
+	ctx = scripting.WithOperation(ctx, operationRetrieve)
+	
 	// Verify entity context
 	_, ok := entity.GetEntityContext(ctx)
 	if !ok {
@@ -362,17 +665,36 @@ func (m *MMUI) RetrieveFromLTM(ctx context.Context, queryInput interface{}, opti
 	}
 
 	// Check if we need to generate embeddings for semantic search
+	var embeddingSource string
+	if query.Embedding != nil {
+		embeddingSource = EmbeddingSourceProvided
+	}
 	if m.shouldUseSemanticSearch(options.Strategy) && query.Embedding == nil && query.Text != "" {
+		// HyDE embeds a hypothetical answer instead of the question itself
+		if options.Strategy == StrategyHyDE {
+			if err := m.generateHyDEEmbedding(ctx, &query); err != nil {
+				log.WarnContext(ctx, "Failed to generate HyDE embedding, falling back to query embedding", "error", err)
+			} else {
+				embeddingSource = EmbeddingSourceHyDE
+			}
+		}
+		
 		// Generate an embedding for the query text
-		if err := m.generateQueryEmbedding(ctx, &query); err != nil {
-			// Log error but continue with non-semantic search
-			log.WarnContext(ctx, "Failed to generate query embedding", "error", err)
+		if query.Embedding == nil {
+			if err := m.generateQueryEmbedding(ctx, &query); err != nil {
+				// Log error but continue with non-semantic search
+				log.WarnContext(ctx, "Failed to generate query embedding", "error", err)
+			} else if query.Embedding != nil {
+				embeddingSource = EmbeddingSourceQuery
+			}
 		}
 	}
+	trace.query(query.Text, embeddingSource)
+	beforeHook := query
 
 	// Apply Lua hooks if enabled
 	var err error
-	if m.config.EnableLuaHooks && m.scriptEngine != nil {
+	if m.hooksEnabled(ctx) {
 		query, err = callBeforeRetrieveHook(ctx, m.scriptEngine, query)
 		if err != nil {
 			// Log the error but continue
@@ -380,6 +702,17 @@ func (m *MMUI) RetrieveFromLTM(ctx context.Context, queryInput interface{}, opti
 		}
 	}
 
+	// Over-retrieve candidates when diversity re-ranking will trim the results
+	resultLimit := query.Limit
+	useMMR := options.Diversity > 0 && len(query.Embedding) > 0
+	if useMMR {
+		if resultLimit <= 0 {
+			resultLimit = DefaultRetrievalOptions().MaxResults
+		}
+		query.Limit = resultLimit * diversityFetchFactor(options)
+	}
+	trace.sent(beforeHook, query)
+
 	// Perform the retrieval
 	log.Debug("Retrieving from LTM", 
 		"strategy", options.Strategy,
@@ -387,36 +720,99 @@ func (m *MMUI) RetrieveFromLTM(ctx context.Context, queryInput interface{}, opti
 		"text", query.Text,
 		"limit", query.Limit)
 		
-	results, err := m.ltmStore.Retrieve(ctx, query)
+	var results []ltm.MemoryRecord
+	variants := m.expandMultiQuery(ctx, query, options)
+	if len(variants) > 0 {
+		results, err = m.retrieveMultiQuery(ctx, query, variants)
+	} else {
+		results, err = m.ltmStore.Retrieve(ctx, query)
+	}
 	if err != nil {
 		return nil, err
 	}
+	trace.candidates(results, len(variants) > 0, len(variants))
+	
+	// Fused results may exceed the limit, as every variant contributes candidates
+	if len(variants) > 0 && query.Limit > 0 && len(results) > query.Limit {
+		trace.dropped(results, results[:query.Limit], FilterReasonFusionLimit)
+		results = results[:query.Limit]
+	}
 
 	// Apply after_retrieve hook if enabled
-	if m.config.EnableLuaHooks && m.scriptEngine != nil {
+	if m.hooksEnabled(ctx) {
+		before := results
 		results, err = callAfterRetrieveHook(ctx, m.scriptEngine, results)
 		if err != nil {
 			// Log the error but continue
 			log.WarnContext(ctx, "Error in after_retrieve hook", "error", err)
 		}
+		trace.dropped(before, results, FilterReasonAfterRetrieveHook)
+	}
+	
+	// Ensure every semantic result carries a normalized score, then drop weak matches
+	if len(query.Embedding) > 0 && len(results) > 0 {
+		calibrateScores(query.Embedding, results)
+		trace.scores(results)
+		if options.MinScore > 0 {
+			before := append([]ltm.MemoryRecord(nil), results...)
+			results = filterByMinScore(results, options.MinScore)
+			trace.dropped(before, results, FilterReasonMinScore)
+			log.DebugContext(ctx, "Applied minimum score threshold",
+				"min_score", options.MinScore,
+				"dropped", len(before)-len(results),
+				"remaining", len(results))
+		}
+	}
+	if options.ImportanceWeight > 0 && len(results) > 1 {
+		weightByImportance(results, options.ImportanceWeight)
+		trace.weighted(results)
+	}
+	
+	// Re-rank for diversity before any custom ranking
+	if useMMR && len(results) > 0 {
+		before := results
+		results = applyMMR(query.Embedding, results, options.Diversity, resultLimit, options.ImportanceWeight)
+		trace.dropped(before, results, FilterReasonDiversity)
+		trace.diversified(results)
+		log.DebugContext(ctx, "Applied MMR diversity re-ranking",
+			"lambda", options.Diversity,
+			"selected", len(results))
+	}
+	
+	// Re-rank semantic results with the configured reranker, keeping the order on failure
+	if reranker := m.currentReranker(); reranker != nil && len(query.Embedding) > 0 && query.Text != "" && len(results) > 1 {
+		reranked, err := reranker.Rerank(ctx, query.Text, results)
+		if err != nil {
+			log.WarnContext(ctx, "Re-ranking failed, keeping retrieval order", "error", err)
+		} else {
+			results = reranked
+			trace.reranked(results)
+		}
 	}
 	
 	// If semantic search requested, sort by semantic relevance using rank_semantic_results Lua hook
-	if len(query.Embedding) > 0 && len(results) > 0 && 
-		m.config.EnableLuaHooks && m.scriptEngine != nil {
+	if len(query.Embedding) > 0 && len(results) > 0 && m.hooksEnabled(ctx) {
+		before := results
 		results, err = m.rankSemanticResults(ctx, results, query)
 		if err != nil {
 			// Log the error but continue
 			log.WarnContext(ctx, "Error in rank_semantic_results hook", "error", err)
 		}
+		trace.luaRanked(before, results)
 	}
 
+	// Hold what was retrieved in working memory for the rest of the conversation
+	m.remember(ctx, results...)
+	
 	// Remove metadata if not requested
 	if !options.IncludeMetadata {
 		for i := range results {
 			results[i].Metadata = nil
 		}
 	}
+	
+	// Attach the explanation last so it survives metadata removal
+	trace.attach(results)
 
 	log.Debug("Retrieved results from LTM", 
 		"count", len(results),
@@ -425,6 +821,12 @@ func (m *MMUI) RetrieveFromLTM(ctx context.Context, queryInput interface{}, opti
 	return results, nil
 }
 
+// isVectorStore reports whether the LTM store is a vector store.
+func (m *MMUI) isVectorStore() bool {
+	vectorStore, ok := m.ltmStore.(ltm.VectorCapableLTMStore)
+	return ok && vectorStore.SupportsVectorSearch()
+}
+
 // shouldUseSemanticSearch determines if semantic search should be used.
 func (m *MMUI) shouldUseSemanticSearch(strategy string) bool {
 	// Skip if vector operations are disabled
@@ -444,7 +846,22 @@ func (m *MMUI) shouldUseSemanticSearch(strategy string) bool {
 	}
 	
 	// Check if strategy explicitly requests semantic search
-	return strategy == "semantic"
+	return isSemanticStrategy(strategy)
+}
+
+// expandMultiQuery returns the paraphrase embeddings for a multi_query
+// retrieval, or nil when the strategy does not apply or expansion fails.
+func (m *MMUI) expandMultiQuery(ctx context.Context, query ltm.LTMQuery, options RetrievalOptions) [][]float32 {
+	if options.Strategy != StrategyMultiQuery || len(query.Embedding) == 0 || query.Text == "" {
+		return nil
+	}
+	
+	variants, err := m.generateQueryVariants(ctx, query.Text, queryVariants(options))
+	if err != nil {
+		log.WarnContext(ctx, "Failed to expand query, falling back to single query", "error", err)
+		return nil
+	}
+	return variants
 }
 
 // generateQueryEmbedding generates an embedding for a text query.
@@ -474,21 +891,32 @@ func (m *MMUI) rankSemanticResults(ctx context.Context, results []ltm.MemoryReco
 		return results, nil
 	}
 	
-	// Call Lua hook with results and query
-	ranked, err := m.scriptEngine.ExecuteFunction(ctx, rankSemanticResultsFuncName, results, query.Text)
+	// Call Lua hook with results, query text and query embedding
+	ranked, err := m.scriptEngine.ExecuteFunction(ctx, rankSemanticResultsFuncName, results, query.Text, query.Embedding)
 	if err != nil {
 		// Log the error but continue
 		log.DebugContext(ctx, "Error calling rank_semantic_results hook", "error", err)
 		return results, nil
 	}
 	
-	// Try to convert the result back to []ltm.MemoryRecord
-	if rankedRecords, ok := ranked.([]ltm.MemoryRecord); ok {
-		return rankedRecords, nil
+	// A hook that returns nothing keeps the original ranking
+	if ranked == nil {
+		return results, nil
 	}
 	
-	// If we couldn't convert, just return the original results
-	return results, nil
+	var rankedRecords []ltm.MemoryRecord
+	if err := scripting.Unmarshal(ranked, &rankedRecords); err != nil {
+		log.WarnContext(ctx, "Invalid result from rank_semantic_results hook", "error", err)
+		return results, nil
+	}
+	
+	// Ranking may reorder or drop results but never add ones the caller cannot see
+	rankedRecords, err = validateHookRecords(ctx, results, rankedRecords)
+	if err != nil {
+		log.WarnContext(ctx, "Rejected result from rank_semantic_results hook", "error", err)
+		return results, nil
+	}
+	return rankedRecords, nil
 }
 
 // ConsolidateLTM implements the MMU interface.
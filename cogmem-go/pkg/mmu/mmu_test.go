@@ -9,6 +9,7 @@ import (
 	"github.com/lexlapax/cogmem/pkg/entity"
 	"github.com/lexlapax/cogmem/pkg/mem/ltm"
 	"github.com/lexlapax/cogmem/pkg/mem/ltm/adapters/mock"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm/adapters/vector/chromem_go"
 	"github.com/lexlapax/cogmem/pkg/reasoning"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -55,6 +56,8 @@ type mockReasoningEngine struct {
 	// Map of expected function calls to results
 	embeddingResults map[string][]float32
 	processResults   map[string]string
+	// Response returned for prompts without a predefined result
+	defaultProcessResult string
 	// Record of function calls
 	calls []mockCall
 }
@@ -101,6 +104,9 @@ func (m *mockReasoningEngine) Process(ctx context.Context, prompt string, opts .
 	}
 	
 	// Return a default mock response
+	if m.defaultProcessResult != "" {
+		return m.defaultProcessResult, nil
+	}
 	return "Mock response to: " + prompt, nil
 }
 
@@ -177,6 +183,21 @@ func setupVectorTest(t *testing.T, supportsVectors bool) (*MMUI, *mockVectorCapa
 	return mmu, ltmStore, scriptEngine, reasoningEngine, ctx
 }
 
+// Helper function to set up a test environment with an in-memory chromem-go vector store
+func setupChromemTest(t *testing.T) (*MMUI, *chromem_go.ChromemGoAdapter, context.Context) {
+	ltmStore, err := chromem_go.NewChromemGoAdapterWithConfig(&chromem_go.ChromemGoConfig{Collection: "mmu-test"})
+	require.NoError(t, err)
+	
+	mmu := NewMMU(ltmStore, newMockReasoningEngine(), newMockScriptEngine(), Config{
+		EnableVectorOperations: true,
+	})
+	
+	entityCtx := entity.NewContext("test-entity", "test-user")
+	ctx := entity.ContextWithEntity(context.Background(), entityCtx)
+	
+	return mmu, ltmStore, ctx
+}
+
 func TestMMU_EncodeToLTM_String(t *testing.T) {
 	// Setup
 	mmu, ltmStore, _, _, ctx := setupTest(t, false)
@@ -565,7 +586,7 @@ func TestMMU_WorkingMemoryOverflow(t *testing.T) {
 	mmu, _, _, _, ctx := setupVectorTest(t, true)
 	
 	// Initially, working memory should be empty
-	assert.Empty(t, mmu.workingMemory)
+	assert.Empty(t, mmu.workingMemory.snapshot("test-entity"))
 	
 	// Add records to working memory directly to test overflow
 	for i := 0; i < 6; i++ {
@@ -574,13 +595,114 @@ func TestMMU_WorkingMemoryOverflow(t *testing.T) {
 			EntityID: "test-entity",
 			Content:  fmt.Sprintf("Working memory record %d", i),
 		}
-		mmu.workingMemory = append(mmu.workingMemory, record)
+		mmu.workingMemory.add(record)
 	}
+	mmu.workingMemory.add(ltm.MemoryRecord{ID: "other", EntityID: "other-entity"})
 	
 	// Now trigger the overflow management
 	mmu.ManageWorkingMemoryOverflow(ctx)
 	
 	// Verify overflow was managed (records were evicted)
-	assert.Less(t, len(mmu.workingMemory), 6, "Working memory should have evicted some records")
-	assert.Equal(t, 3, len(mmu.workingMemory), "Working memory should have half the records after LRU eviction")
-}
\ No newline at end of file
+	assert.Less(t, len(mmu.workingMemory.snapshot("test-entity")), 6, "Working memory should have evicted some records")
+	assert.Equal(t, 3, len(mmu.workingMemory.snapshot("test-entity")), "Working memory should have half the records after LRU eviction")
+	assert.Len(t, mmu.workingMemory.snapshot("other-entity"), 1, "Other entities' working memory is untouched")
+}
+
+func TestMMU_WorkingMemoryOverflow_TokenLimit(t *testing.T) {
+	mmu, _, _, _, ctx := setupTest(t, false)
+	mmu.config.WorkingMemoryLimit = 100
+	mmu.config.WorkingMemoryTokenLimit = 20
+	
+	// Each record is 24 characters, 6 heuristic tokens
+	for i := 0; i < 3; i++ {
+		mmu.workingMemory.add(ltm.MemoryRecord{
+			ID:       fmt.Sprintf("test-%d", i),
+			EntityID: "test-entity",
+			Content:  fmt.Sprintf("Working memory record %d", i),
+		})
+	}
+	mmu.ManageWorkingMemoryOverflow(ctx)
+	assert.Len(t, mmu.workingMemory.snapshot("test-entity"), 3, "18 tokens is within the limit")
+	
+	mmu.workingMemory.add(ltm.MemoryRecord{ID: "test-3", EntityID: "test-entity", Content: "Working memory record 3"})
+	mmu.ManageWorkingMemoryOverflow(ctx)
+	assert.Len(t, mmu.workingMemory.snapshot("test-entity"), 2, "24 tokens exceeds the limit")
+}
+
+func TestWorkingMemoryStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	store := newWorkingMemoryStore()
+	
+	// Find three entities sharing a shard, and let the shard hold two of them
+	var entityIDs []entity.EntityID
+	for i := 0; len(entityIDs) < 3; i++ {
+		entityID := entity.EntityID(fmt.Sprintf("entity-%d", i))
+		if entityID.Shard(workingMemoryShardCount) == 0 {
+			entityIDs = append(entityIDs, entityID)
+		}
+	}
+	store.shards[0].maxEntities = 2
+	
+	store.add(ltm.MemoryRecord{ID: "first", EntityID: entityIDs[0]})
+	store.add(ltm.MemoryRecord{ID: "second", EntityID: entityIDs[1]})
+	store.snapshot(entityIDs[0])
+	store.add(ltm.MemoryRecord{ID: "third", EntityID: entityIDs[2]})
+	
+	assert.Len(t, store.shards[0].entries, 2)
+	assert.Len(t, store.snapshot(entityIDs[0]), 1, "recently used entities are kept")
+	assert.Empty(t, store.snapshot(entityIDs[1]), "the least recently used entity is evicted")
+	assert.Len(t, store.snapshot(entityIDs[2]), 1)
+}
+
+func TestMMU_WorkingMemory_FilledByEncodeAndRetrieve(t *testing.T) {
+	mmu, ltmStore, _, _, ctx := setupTest(t, false)
+	mmu.config.WorkingMemoryLimit = 10
+	
+	storedID, err := mmu.EncodeToLTM(ctx, "The offsite is in Lisbon")
+	require.NoError(t, err)
+	olderID, err := ltmStore.Store(ctx, ltm.MemoryRecord{Content: "Lisbon flights are booked", AccessLevel: entity.SharedWithinEntity})
+	require.NoError(t, err)
+	
+	records := mmu.WorkingMemory(ctx)
+	require.Len(t, records, 1, "encoded memories enter working memory")
+	assert.Equal(t, storedID, records[0].ID)
+	
+	options := DefaultRetrievalOptions()
+	options.Strategy = "keyword"
+	options.IncludeMetadata = false
+	for i := 0; i < 2; i++ {
+		_, err = mmu.RetrieveFromLTM(ctx, "Lisbon", options)
+		require.NoError(t, err)
+	}
+	
+	records = mmu.WorkingMemory(ctx)
+	require.Len(t, records, 2, "retrieved memories enter working memory once")
+	ids := []string{records[0].ID, records[1].ID}
+	assert.ElementsMatch(t, []string{storedID, olderID}, ids)
+	for _, record := range records {
+		assert.NotNil(t, record.Metadata, "working memory keeps metadata stripped from results")
+	}
+	
+	t.Run("disabled without a limit", func(t *testing.T) {
+		mmu, _, _, _, ctx := setupTest(t, false)
+		_, err := mmu.EncodeToLTM(ctx, "The offsite is in Lisbon")
+		require.NoError(t, err)
+		assert.Empty(t, mmu.WorkingMemory(ctx))
+	})
+}
+
+func TestMMU_WorkingMemory(t *testing.T) {
+	mmu, _, _, _, ctx := setupTest(t, false)
+	mmu.workingMemory.add(
+		ltm.MemoryRecord{ID: "shared", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity},
+		ltm.MemoryRecord{ID: "mine", EntityID: "test-entity", UserID: "test-user", AccessLevel: entity.PrivateToUser},
+		ltm.MemoryRecord{ID: "theirs", EntityID: "test-entity", UserID: "other-user", AccessLevel: entity.PrivateToUser},
+		ltm.MemoryRecord{ID: "other-entity", EntityID: "other-entity", AccessLevel: entity.SharedWithinEntity},
+	)
+	
+	records := mmu.WorkingMemory(ctx)
+	require.Len(t, records, 2)
+	assert.Equal(t, "shared", records[0].ID)
+	assert.Equal(t, "mine", records[1].ID)
+	
+	assert.Nil(t, mmu.WorkingMemory(context.Background()))
+}
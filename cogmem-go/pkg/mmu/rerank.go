@@ -0,0 +1,184 @@
+package mmu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lexlapax/cogmem/pkg/log"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/reasoning"
+)
+
+// MetadataKeyRerankScore is the metadata key holding a record's re-ranker relevance score
+const MetadataKeyRerankScore = "rerank_score"
+
+// Reranker reorders first-stage retrieval results by relevance to the query.
+// Implementations may use an LLM, a cross-encoder or any other model.
+type Reranker interface {
+	// Rerank returns the candidates reordered by relevance to the query.
+	// On error the MMU keeps the original order.
+	Rerank(ctx context.Context, query string, candidates []ltm.MemoryRecord) ([]ltm.MemoryRecord, error)
+}
+
+// LLMRerankerConfig configures an LLMReranker.
+type LLMRerankerConfig struct {
+	// TopN is the number of leading candidates re-ranked; the rest keep their order after them
+	TopN int
+	
+	// BatchSize is the number of candidates scored per reasoning call
+	BatchSize int
+	
+	// Timeout bounds the whole re-ranking stage
+	Timeout time.Duration
+}
+
+// DefaultLLMRerankerConfig returns the default configuration for an LLMReranker.
+func DefaultLLMRerankerConfig() LLMRerankerConfig {
+	return LLMRerankerConfig{
+		TopN:      20,
+		BatchSize: 10,
+		Timeout:   10 * time.Second,
+	}
+}
+
+// LLMReranker scores candidates with the reasoning engine, asking for a 0-10
+// relevance score per candidate as a JSON array.
+type LLMReranker struct {
+	// reasoningEngine scores the candidates
+	reasoningEngine reasoning.Engine
+	
+	// config contains configuration options
+	config LLMRerankerConfig
+}
+
+// NewLLMReranker creates a new LLM-based re-ranker.
+func NewLLMReranker(reasoningEngine reasoning.Engine, config LLMRerankerConfig) *LLMReranker {
+	defaults := DefaultLLMRerankerConfig()
+	if config.TopN <= 0 {
+		config.TopN = defaults.TopN
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	
+	return &LLMReranker{
+		reasoningEngine: reasoningEngine,
+		config:          config,
+	}
+}
+
+// Rerank implements the Reranker interface. Any failure, including a timeout
+// in any batch, returns the candidates in their original order with the error.
+func (r *LLMReranker) Rerank(ctx context.Context, query string, candidates []ltm.MemoryRecord) ([]ltm.MemoryRecord, error) {
+	if len(candidates) < 2 {
+		return candidates, nil
+	}
+	
+	if r.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.Timeout)
+		defer cancel()
+	}
+	
+	topN := r.config.TopN
+	if topN > len(candidates) {
+		topN = len(candidates)
+	}
+	
+	scores := make([]float64, 0, topN)
+	for start := 0; start < topN; start += r.config.BatchSize {
+		end := start + r.config.BatchSize
+		if end > topN {
+			end = topN
+		}
+		
+		batchScores, err := r.scoreBatch(ctx, query, candidates[start:end])
+		if err != nil {
+			return candidates, fmt.Errorf("failed to re-rank candidates %d-%d: %w", start+1, end, err)
+		}
+		scores = append(scores, batchScores...)
+	}
+	
+	// Reorder the scored candidates; ties keep their first-stage order
+	order := make([]int, topN)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+	
+	reranked := make([]ltm.MemoryRecord, 0, len(candidates))
+	for _, idx := range order {
+		record := candidates[idx]
+		record.Metadata = copyMetadata(record.Metadata)
+		record.Metadata[MetadataKeyRerankScore] = scores[idx]
+		reranked = append(reranked, record)
+	}
+	reranked = append(reranked, candidates[topN:]...)
+	
+	log.DebugContext(ctx, "Re-ranked retrieval results",
+		"candidates", len(candidates),
+		"scored", topN)
+	return reranked, nil
+}
+
+// scoreBatch asks the reasoning engine for one relevance score per candidate.
+func (r *LLMReranker) scoreBatch(ctx context.Context, query string, batch []ltm.MemoryRecord) ([]float64, error) {
+	response, err := r.reasoningEngine.Process(ctx, buildRerankPrompt(query, batch),
+		reasoning.WithTemperature(0),
+		reasoning.WithMaxTokens(16+8*len(batch)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	
+	return parseRerankScores(response, len(batch))
+}
+
+// buildRerankPrompt creates the prompt used to score a batch of candidates.
+func buildRerankPrompt(query string, batch []ltm.MemoryRecord) string {
+	var sb strings.Builder
+	sb.WriteString("Rate how relevant each of the following memories is to the query, on a scale of 0 (unrelated) to 10 (directly answers it).\n\n")
+	sb.WriteString(fmt.Sprintf("Query: %s\n\n", query))
+	
+	for i, record := range batch {
+		sb.WriteString(fmt.Sprintf("Memory %d: %s\n", i+1, record.Content))
+	}
+	
+	sb.WriteString(fmt.Sprintf("\nRespond with only a JSON array of %d numbers, one score per memory in order, e.g. [7, 2].", len(batch)))
+	return sb.String()
+}
+
+// parseRerankScores extracts the expected number of relevance scores from a reasoning response.
+func parseRerankScores(response string, expected int) ([]float64, error) {
+	start, end := strings.Index(response, "["), strings.LastIndex(response, "]")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("no relevance scores found in response")
+	}
+	
+	var scores []float64
+	if err := json.Unmarshal([]byte(response[start:end+1]), &scores); err != nil {
+		return nil, fmt.Errorf("invalid relevance scores: %w", err)
+	}
+	if len(scores) != expected {
+		return nil, fmt.Errorf("expected %d relevance scores, got %d", expected, len(scores))
+	}
+	return scores, nil
+}
+
+// copyMetadata returns a shallow copy of metadata so callers' maps are not mutated.
+func copyMetadata(metadata map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(metadata)+1)
+	for k, v := range metadata {
+		copied[k] = v
+	}
+	return copied
+}
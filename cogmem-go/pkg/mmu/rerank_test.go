@@ -0,0 +1,136 @@
+package mmu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/reasoning"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingReasoningEngine never answers before the context is done
+type blockingReasoningEngine struct{}
+
+func (blockingReasoningEngine) Process(ctx context.Context, prompt string, opts ...reasoning.Option) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func (blockingReasoningEngine) GenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, errors.New("not supported")
+}
+
+// reverseReranker reverses the candidates, or fails when err is set
+type reverseReranker struct {
+	err   error
+	input []ltm.MemoryRecord
+}
+
+func (r *reverseReranker) Rerank(ctx context.Context, query string, candidates []ltm.MemoryRecord) ([]ltm.MemoryRecord, error) {
+	r.input = append([]ltm.MemoryRecord(nil), candidates...)
+	if r.err != nil {
+		return candidates, r.err
+	}
+	reversed := make([]ltm.MemoryRecord, len(candidates))
+	for i, record := range candidates {
+		reversed[len(candidates)-1-i] = record
+	}
+	return reversed, nil
+}
+
+func rerankCandidates() []ltm.MemoryRecord {
+	return []ltm.MemoryRecord{
+		{ID: "a", Content: "the cat sleeps"},
+		{ID: "b", Content: "the cat eats salmon"},
+		{ID: "c", Content: "cat food brands"},
+		{ID: "d", Content: "the dog barks"},
+	}
+}
+
+func TestLLMReranker_Rerank(t *testing.T) {
+	candidates := rerankCandidates()
+	
+	t.Run("reorders the top candidates in batches", func(t *testing.T) {
+		reasoningEngine := newMockReasoningEngine()
+		reasoningEngine.processResults[buildRerankPrompt("what does the cat eat", candidates[0:2])] = "[2, 9]"
+		reasoningEngine.processResults[buildRerankPrompt("what does the cat eat", candidates[2:3])] = "[6]"
+		
+		reranker := NewLLMReranker(reasoningEngine, LLMRerankerConfig{TopN: 3, BatchSize: 2})
+		reranked, err := reranker.Rerank(context.Background(), "what does the cat eat", candidates)
+		require.NoError(t, err)
+		
+		ids := make([]string, len(reranked))
+		for i, record := range reranked {
+			ids[i] = record.ID
+		}
+		assert.Equal(t, []string{"b", "c", "a", "d"}, ids, "candidates beyond TopN keep their place at the end")
+		assert.Equal(t, 9.0, reranked[0].Metadata[MetadataKeyRerankScore])
+		assert.Nil(t, candidates[1].Metadata, "input records are not mutated")
+		assert.Equal(t, 2, countCalls(reasoningEngine.calls, "Process"))
+	})
+	
+	t.Run("keeps the original order on unparseable scores", func(t *testing.T) {
+		reasoningEngine := newMockReasoningEngine()
+		reasoningEngine.defaultProcessResult = "they are all relevant"
+		
+		reranker := NewLLMReranker(reasoningEngine, DefaultLLMRerankerConfig())
+		reranked, err := reranker.Rerank(context.Background(), "cat", candidates)
+		assert.Error(t, err)
+		assert.Equal(t, candidates, reranked)
+	})
+	
+	t.Run("times out", func(t *testing.T) {
+		reranker := NewLLMReranker(blockingReasoningEngine{}, LLMRerankerConfig{Timeout: 10 * time.Millisecond})
+		reranked, err := reranker.Rerank(context.Background(), "cat", candidates)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, candidates, reranked)
+	})
+}
+
+func TestMMU_RetrieveFromLTM_Reranker(t *testing.T) {
+	setup := func(t *testing.T) (*MMUI, *mockScriptEngine, context.Context) {
+		mmu, ltmStore, scriptEngine, reasoningEngine, ctx := setupVectorTest(t, true)
+		for _, record := range rerankCandidates()[:3] {
+			record.AccessLevel = entity.SharedWithinEntity
+			record.Embedding = []float32{1, 0, 0}
+			_, err := ltmStore.Store(ctx, record)
+			require.NoError(t, err)
+		}
+		reasoningEngine.embeddingResults["cat"] = []float32{1, 0, 0}
+		return mmu, scriptEngine, ctx
+	}
+	
+	options := DefaultRetrievalOptions()
+	options.Strategy = "semantic"
+	
+	t.Run("reranker runs before the Lua ranking hook", func(t *testing.T) {
+		mmu, scriptEngine, ctx := setup(t)
+		reranker := &reverseReranker{}
+		mmu.SetReranker(reranker)
+		
+		results, err := mmu.RetrieveFromLTM(ctx, "cat", options)
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		require.Len(t, reranker.input, 3)
+		assert.Equal(t, reranker.input[0].ID, results[2].ID)
+		assert.Equal(t, reranker.input[2].ID, results[0].ID)
+		
+		last := scriptEngine.calls[len(scriptEngine.calls)-1]
+		assert.Equal(t, "rank_semantic_results", last.FunctionName)
+		assert.Equal(t, results, last.Args[0])
+	})
+	
+	t.Run("failed re-ranking keeps the retrieval order", func(t *testing.T) {
+		mmu, _, ctx := setup(t)
+		reranker := &reverseReranker{err: errors.New("model unavailable")}
+		mmu.SetReranker(reranker)
+		results, err := mmu.RetrieveFromLTM(ctx, "cat", options)
+		require.NoError(t, err)
+		assert.Equal(t, reranker.input, results)
+	})
+}
@@ -0,0 +1,56 @@
+package mmu
+
+import (
+	"sort"
+
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+)
+
+// calibrateScores fills in the Score of semantic results that the store left
+// unset (such as stores without native similarity reporting) from the cosine
+// similarity between the query and the record embedding. Scores reported by
+// vector adapters are kept as is.
+func calibrateScores(queryEmbedding []float32, results []ltm.MemoryRecord) {
+	for i := range results {
+		if results[i].Score > 0 || len(results[i].Embedding) == 0 {
+			continue
+		}
+		results[i].Score = ltm.SimilarityScore(ltm.CosineSimilarity(queryEmbedding, results[i].Embedding))
+	}
+}
+
+// filterByMinScore returns the results whose score is at least minScore,
+// preserving their order.
+func filterByMinScore(results []ltm.MemoryRecord, minScore float64) []ltm.MemoryRecord {
+	filtered := results[:0]
+	for _, record := range results {
+		if record.Score >= minScore {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+// blendedScore returns a similarity score blended with the record's
+// importance, normalized to [0, 1].
+func blendedScore(record ltm.MemoryRecord, similarity, weight float64) float64 {
+	if weight > 1 {
+		weight = 1
+	}
+	importance := (importanceOf(record) - minImportance) / (maxImportance - minImportance)
+	return (1-weight)*similarity + weight*importance
+}
+
+// weightByImportance reorders results by their similarity score blended with
+// their importance. Scores themselves are left untouched so thresholds keep
+// applying to similarity alone. Results without a score are ordered by
+// importance.
+func weightByImportance(results []ltm.MemoryRecord, weight float64) {
+	blended := make(map[string]float64, len(results))
+	for _, record := range results {
+		blended[record.ID] = blendedScore(record, record.Score, weight)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return blended[results[i].ID] > blended[results[j].ID]
+	})
+}
@@ -0,0 +1,128 @@
+package mmu
+
+import (
+	"testing"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalibrateScores(t *testing.T) {
+	results := []ltm.MemoryRecord{
+		{ID: "unscored", Embedding: []float32{1, 0}},
+		{ID: "scored", Embedding: []float32{1, 0}, Score: 0.42},
+		{ID: "opposite", Embedding: []float32{-1, 0}},
+		{ID: "no-embedding"},
+	}
+	
+	calibrateScores([]float32{1, 0}, results)
+	
+	assert.InDelta(t, 1.0, results[0].Score, 1e-6)
+	assert.Equal(t, 0.42, results[1].Score, "adapter scores are kept")
+	assert.Equal(t, 0.0, results[2].Score)
+	assert.Equal(t, 0.0, results[3].Score)
+}
+
+func TestMMU_RetrieveFromLTM_MinScore(t *testing.T) {
+	mmu, ltmStore, _, reasoningEngine, ctx := setupVectorTest(t, true)
+	
+	records := []ltm.MemoryRecord{
+		{ID: "close", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "cat on the mat", Embedding: []float32{1, 0.1, 0}},
+		{ID: "far", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "cat tax forms", Embedding: []float32{0, 0.1, 1}},
+	}
+	for _, record := range records {
+		_, err := ltmStore.Store(ctx, record)
+		require.NoError(t, err)
+	}
+	reasoningEngine.embeddingResults["cat"] = []float32{1, 0, 0}
+	
+	options := DefaultRetrievalOptions()
+	options.Strategy = "semantic"
+	
+	t.Run("scores are populated", func(t *testing.T) {
+		results, err := mmu.RetrieveFromLTM(ctx, "cat", options)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		for _, result := range results {
+			assert.GreaterOrEqual(t, result.Score, 0.0)
+			assert.LessOrEqual(t, result.Score, 1.0)
+		}
+	})
+	
+	t.Run("weak matches are dropped", func(t *testing.T) {
+		options.MinScore = 0.5
+		results, err := mmu.RetrieveFromLTM(ctx, "cat", options)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, "close", results[0].ID)
+		assert.Greater(t, results[0].Score, 0.9)
+	})
+}
+
+func TestWeightByImportance(t *testing.T) {
+	results := []ltm.MemoryRecord{
+		{ID: "trivial", Score: 0.8, Metadata: map[string]interface{}{MetadataKeyImportance: 1.0}},
+		{ID: "unscored", Score: 0.75},
+		{ID: "critical", Score: 0.7, Metadata: map[string]interface{}{MetadataKeyImportance: 10.0}},
+	}
+	
+	weightByImportance(results, 0.5)
+	
+	assert.Equal(t, "critical", results[0].ID)
+	assert.Equal(t, "unscored", results[1].ID)
+	assert.Equal(t, "trivial", results[2].ID)
+	assert.Equal(t, 0.7, results[0].Score, "scores are not rewritten")
+}
+
+func TestMMU_RetrieveFromLTM_ImportanceWeight(t *testing.T) {
+	mmu, ltmStore, _, reasoningEngine, ctx := setupVectorTest(t, true)
+	
+	records := []ltm.MemoryRecord{
+		{ID: "dogs", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "note: I like dogs", Embedding: []float32{1, 0.1, 0}, Metadata: map[string]interface{}{MetadataKeyImportance: 2.0}},
+		{ID: "api-key", EntityID: "test-entity", AccessLevel: entity.SharedWithinEntity, Content: "note: my API key rotated", Embedding: []float32{1, 0.3, 0}, Metadata: map[string]interface{}{MetadataKeyImportance: 9.0}},
+	}
+	for _, record := range records {
+		_, err := ltmStore.Store(ctx, record)
+		require.NoError(t, err)
+	}
+	reasoningEngine.embeddingResults["note"] = []float32{1, 0, 0}
+	
+	options := DefaultRetrievalOptions()
+	options.Strategy = "semantic"
+	
+	t.Run("similarity alone favours the trivial memory", func(t *testing.T) {
+		options.ImportanceWeight = 0
+		results, err := mmu.RetrieveFromLTM(ctx, "note", options)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		scores := map[string]float64{results[0].ID: results[0].Score, results[1].ID: results[1].Score}
+		assert.Greater(t, scores["dogs"], scores["api-key"])
+	})
+	
+	t.Run("importance lifts the critical memory", func(t *testing.T) {
+		options.ImportanceWeight = 0.5
+		results, err := mmu.RetrieveFromLTM(ctx, "note", options)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, "api-key", results[0].ID)
+	})
+	
+	t.Run("diversity re-ranking keeps the importance", func(t *testing.T) {
+		options.ImportanceWeight = 0.2
+		options.Diversity = 0.7
+		results, err := mmu.RetrieveFromLTM(ctx, "note", options)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, "api-key", results[0].ID)
+	})
+	
+	t.Run("exact results are ordered by importance", func(t *testing.T) {
+		exact := DefaultRetrievalOptions()
+		results, err := mmu.RetrieveFromLTM(ctx, "note", exact)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, "api-key", results[0].ID)
+	})
+}
@@ -0,0 +1,84 @@
+package mmu
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+	"github.com/lexlapax/cogmem/pkg/scripting"
+)
+
+// scriptMemory gives Lua scripts access to the MMU as cogmem.memory. Every
+// operation runs in the entity context of the hook that performs it, and
+// hooks are not run for it.
+type scriptMemory struct {
+	mmu *MMUI
+}
+
+// Retrieve implements the scripting.MemoryAPI interface. A query table may
+// carry a strategy, which otherwise defaults to the default retrieval options.
+// Private records of other users are not returned.
+func (s scriptMemory) Retrieve(ctx context.Context, query interface{}) (interface{}, error) {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return nil, entity.ErrMissingEntityContext
+	}
+	
+	options := DefaultRetrievalOptions()
+	if q, ok := query.(map[string]interface{}); ok {
+		if strategy, ok := q["strategy"].(string); ok {
+			options.Strategy = strategy
+		}
+	}
+	
+	records, err := s.mmu.RetrieveFromLTM(ctx, query, options)
+	if err != nil {
+		return nil, err
+	}
+	
+	visible := make([]ltm.MemoryRecord, 0, len(records))
+	for _, record := range records {
+		if visibleTo(entityCtx, record) {
+			visible = append(visible, record)
+		}
+	}
+	return visible, nil
+}
+
+// Store implements the scripting.MemoryAPI interface.
+func (s scriptMemory) Store(ctx context.Context, content string, metadata map[string]interface{}) (string, error) {
+	data := map[string]interface{}{"content": content}
+	if metadata != nil {
+		data["metadata"] = metadata
+	}
+	return s.mmu.EncodeToLTM(ctx, data)
+}
+
+// Get implements the scripting.MemoryAPI interface. Records of other entities
+// and private records of other users are not found.
+func (s scriptMemory) Get(ctx context.Context, id string) (interface{}, error) {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return nil, entity.ErrMissingEntityContext
+	}
+	
+	records, err := s.mmu.ltmStore.Retrieve(ctx, ltm.LTMQuery{
+		ExactMatch: map[string]interface{}{"ID": id},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve memory %s: %w", id, err)
+	}
+	for _, record := range records {
+		if record.ID == id && visibleTo(entityCtx, record) {
+			return record, nil
+		}
+	}
+	return nil, nil
+}
+
+// hooksEnabled reports whether Lua hooks should run for an operation. They
+// do not run for memory operations performed by scripts, which would recurse.
+func (m *MMUI) hooksEnabled(ctx context.Context) bool {
+	return m.config.EnableLuaHooks && m.scriptEngine != nil && !scripting.InScript(ctx)
+}
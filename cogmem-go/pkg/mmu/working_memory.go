@@ -0,0 +1,145 @@
+package mmu
+
+import (
+	"sync"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/mem/ltm"
+)
+
+const (
+	// workingMemoryShardCount is the number of independently locked shards
+	// working memory is split into
+	workingMemoryShardCount = 32
+	
+	// maxWorkingMemoryEntitiesPerShard bounds the entities whose working memory
+	// a shard keeps; the least recently used entity is evicted to make room for a new one
+	maxWorkingMemoryEntitiesPerShard = 128
+)
+
+// workingMemoryEntry holds the working memory of one entity.
+type workingMemoryEntry struct {
+	records  []ltm.MemoryRecord
+	lastUsed uint64
+}
+
+// workingMemoryShard holds the working memory of the entities that hash to it.
+type workingMemoryShard struct {
+	mutex       sync.Mutex
+	entries     map[entity.EntityID]*workingMemoryEntry
+	maxEntities int
+	
+	// tick orders entity accesses for least recently used eviction
+	tick uint64
+}
+
+// workingMemoryStore holds the working memory of every entity, sharded by
+// entity so that concurrent operations on different entities rarely contend
+// for a lock. Each shard keeps only its most recently used entities, so an
+// idle entity's working memory is eventually dropped. It is safe for concurrent use.
+type workingMemoryStore struct {
+	shards [workingMemoryShardCount]workingMemoryShard
+}
+
+// newWorkingMemoryStore creates an empty working memory store.
+func newWorkingMemoryStore() *workingMemoryStore {
+	store := &workingMemoryStore{}
+	for i := range store.shards {
+		store.shards[i].entries = make(map[entity.EntityID]*workingMemoryEntry)
+		store.shards[i].maxEntities = maxWorkingMemoryEntitiesPerShard
+	}
+	return store
+}
+
+// shardFor returns the shard holding the working memory of entityID.
+func (w *workingMemoryStore) shardFor(entityID entity.EntityID) *workingMemoryShard {
+	return &w.shards[entityID.Shard(workingMemoryShardCount)]
+}
+
+// touch marks the entry as most recently used. The caller must hold the shard's mutex.
+func (s *workingMemoryShard) touch(entry *workingMemoryEntry) {
+	s.tick++
+	entry.lastUsed = s.tick
+}
+
+// entryFor returns the entry of entityID, creating it if needed and evicting the
+// least recently used entity when the shard is full. The caller must hold the shard's mutex.
+func (s *workingMemoryShard) entryFor(entityID entity.EntityID) *workingMemoryEntry {
+	entry, ok := s.entries[entityID]
+	if !ok {
+		if s.maxEntities > 0 && len(s.entries) >= s.maxEntities {
+			s.evictOldest()
+		}
+		entry = &workingMemoryEntry{}
+		s.entries[entityID] = entry
+	}
+	s.touch(entry)
+	return entry
+}
+
+// evictOldest removes the least recently used entity. The caller must hold the shard's mutex.
+func (s *workingMemoryShard) evictOldest() {
+	var oldestID entity.EntityID
+	var oldest *workingMemoryEntry
+	for entityID, entry := range s.entries {
+		if oldest == nil || entry.lastUsed < oldest.lastUsed {
+			oldestID, oldest = entityID, entry
+		}
+	}
+	if oldest != nil {
+		delete(s.entries, oldestID)
+	}
+}
+
+// add appends records to the working memory of the entities they belong to.
+// A record already held under the same ID is replaced and becomes the newest.
+func (w *workingMemoryStore) add(records ...ltm.MemoryRecord) {
+	for _, record := range records {
+		shard := w.shardFor(record.EntityID)
+		shard.mutex.Lock()
+		entry := shard.entryFor(record.EntityID)
+		held := entry.records
+		if record.ID != "" {
+			for i := range held {
+				if held[i].ID == record.ID {
+					held = append(held[:i], held[i+1:]...)
+					break
+				}
+			}
+		}
+		entry.records = append(held, record)
+		shard.mutex.Unlock()
+	}
+}
+
+// snapshot returns a copy of the working memory of entityID, oldest first.
+func (w *workingMemoryStore) snapshot(entityID entity.EntityID) []ltm.MemoryRecord {
+	shard := w.shardFor(entityID)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	entry, ok := shard.entries[entityID]
+	if !ok {
+		return nil
+	}
+	shard.touch(entry)
+	return append([]ltm.MemoryRecord(nil), entry.records...)
+}
+
+// update replaces the working memory of entityID with the result of fn,
+// holding the shard's lock while fn runs.
+func (w *workingMemoryStore) update(entityID entity.EntityID, fn func([]ltm.MemoryRecord) []ltm.MemoryRecord) {
+	shard := w.shardFor(entityID)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	
+	var held []ltm.MemoryRecord
+	if entry, ok := shard.entries[entityID]; ok {
+		held = entry.records
+	}
+	records := fn(held)
+	if len(records) == 0 {
+		delete(shard.entries, entityID)
+		return
+	}
+	shard.entryFor(entityID).records = records
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/lexlapax/cogmem/pkg/log"
 	"github.com/lexlapax/cogmem/pkg/reasoning"
+	"github.com/lexlapax/cogmem/pkg/tokenizer"
 )
 
 // Call represents a recorded method call on the mock engine.
@@ -248,6 +249,11 @@ func (m *MockEngine) SetShouldError(shouldErr bool) {
 	log.Debug("Set should error mode", "should_error", shouldErr)
 }
 
+// Tokenizer implements the reasoning.TokenizerProvider interface.
+func (m *MockEngine) Tokenizer() tokenizer.Tokenizer {
+	return tokenizer.NewHeuristic()
+}
+
 // GetCallHistory returns a copy of the call history.
 func (m *MockEngine) GetCallHistory() []Call {
 	m.mutex.RLock()
@@ -7,6 +7,7 @@ import (
 
 	"github.com/lexlapax/cogmem/pkg/log"
 	"github.com/lexlapax/cogmem/pkg/reasoning"
+	"github.com/lexlapax/cogmem/pkg/tokenizer"
 	"github.com/sashabaranov/go-openai"
 )
 
@@ -101,6 +102,12 @@ func (a *OpenAIAdapter) GenerateEmbeddings(ctx context.Context, texts []string)
 	return embeddings, nil
 }
 
+// Tokenizer implements the reasoning.TokenizerProvider interface, returning
+// the BPE tokenizer of the configured chat model.
+func (a *OpenAIAdapter) Tokenizer() tokenizer.Tokenizer {
+	return tokenizer.ForModel(a.chatModel)
+}
+
 // ProcessMessages generates a response to the given messages using the OpenAI API.
 func (a *OpenAIAdapter) ProcessMessages(ctx context.Context, messages []map[string]string, opts ...reasoning.Option) (string, error) {
 	// Apply options
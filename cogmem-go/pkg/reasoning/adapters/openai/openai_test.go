@@ -218,4 +218,14 @@ func TestInitialization(t *testing.T) {
 	adapter, err = openai.NewOpenAIAdapter(invalidConfig)
 	assert.Error(t, err)
 	assert.Nil(t, adapter)
-}
\ No newline at end of file
+}
+// TestTokenizer tests that the adapter advertises its chat model's encoding.
+func TestTokenizer(t *testing.T) {
+	adapter, err := openai.NewOpenAIAdapter(openai.Config{APIKey: "test-key", ChatModel: "gpt-4o-mini"})
+	require.NoError(t, err)
+	assert.Equal(t, "o200k_base", adapter.Tokenizer().Name())
+	
+	adapter, err = openai.NewOpenAIAdapter(openai.Config{APIKey: "test-key", ChatModel: "gpt-4"})
+	require.NoError(t, err)
+	assert.Equal(t, "cl100k_base", adapter.Tokenizer().Name())
+}
@@ -2,6 +2,8 @@ package reasoning
 
 import (
 	"context"
+
+	"github.com/lexlapax/cogmem/pkg/tokenizer"
 )
 
 // Option is a function that configures a reasoning process.
@@ -57,3 +59,21 @@ type Engine interface {
 	// GenerateEmbeddings creates vector embeddings for the provided texts.
 	GenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error)
 }
+
+// TokenizerProvider is implemented by reasoning engines that know which
+// tokenizer their model uses.
+type TokenizerProvider interface {
+	// Tokenizer returns the tokenizer of the engine's chat model
+	Tokenizer() tokenizer.Tokenizer
+}
+
+// TokenizerFor returns the tokenizer advertised by an engine, or the
+// heuristic tokenizer when the engine does not advertise one.
+func TokenizerFor(engine Engine) tokenizer.Tokenizer {
+	if provider, ok := engine.(TokenizerProvider); ok {
+		if tok := provider.Tokenizer(); tok != nil {
+			return tok
+		}
+	}
+	return tokenizer.NewHeuristic()
+}
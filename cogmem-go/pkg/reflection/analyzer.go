@@ -110,7 +110,33 @@ func (m *Module) retrieveMemoriesForAnalysis(ctx context.Context) ([]ltm.MemoryR
 		IncludeMetadata: true,       // Include metadata for analysis
 	}
 	
-	return m.mmu.RetrieveFromLTM(ctx, query, options)
+	memories, err := m.mmu.RetrieveFromLTM(ctx, query, options)
+	if err != nil {
+		return nil, err
+	}
+	
+	return m.limitAnalysisTokens(memories), nil
+}
+
+// limitAnalysisTokens keeps the leading memories whose combined content fits
+// within MaxAnalysisTokens.
+func (m *Module) limitAnalysisTokens(memories []ltm.MemoryRecord) []ltm.MemoryRecord {
+	if m.config.MaxAnalysisTokens <= 0 || m.tokenizer == nil {
+		return memories
+	}
+	
+	total := 0
+	for i, memory := range memories {
+		total += m.tokenizer.CountTokens(memory.Content)
+		if total > m.config.MaxAnalysisTokens {
+			log.Debug("Truncated memories for reflection analysis to token budget",
+				"kept", i,
+				"retrieved", len(memories),
+				"max_tokens", m.config.MaxAnalysisTokens)
+			return memories[:i]
+		}
+	}
+	return memories
 }
 
 // formatMemoriesForAnalysis prepares memories for input to the reasoning engine
@@ -7,30 +7,36 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/lexlapax/cogmem/pkg/log"
+	"github.com/lexlapax/cogmem/pkg/scripting"
 )
 
+func init() {
+	// Reflection hooks receive insights as tables, and may return them
+	scripting.RegisterStruct[Insight]()
+}
+
 // Insight represents a single insight generated during reflection
 type Insight struct {
 	// ID is a unique identifier for this insight
-	ID string `json:"id"`
+	ID string `json:"id" lua:"id"`
 	
 	// Type categorizes the insight (e.g., pattern, connection, gap, anomaly)
-	Type string `json:"type"`
+	Type string `json:"type" lua:"type"`
 	
 	// Description is a human-readable explanation of the insight
-	Description string `json:"description"`
+	Description string `json:"description" lua:"description"`
 	
 	// Confidence is a numerical measure of certainty (0.0-1.0)
-	Confidence float64 `json:"confidence"`
+	Confidence float64 `json:"confidence" lua:"confidence"`
 	
 	// RelatedMemoryIDs lists memory records related to this insight
-	RelatedMemoryIDs []string `json:"related_memory_ids"`
+	RelatedMemoryIDs []string `json:"related_memory_ids" lua:"related_memory_ids"`
 	
 	// Metadata contains additional structured data about the insight
-	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty" lua:"metadata"`
 	
 	// CreatedAt is when this insight was generated
-	CreatedAt time.Time `json:"created_at"`
+	CreatedAt time.Time `json:"created_at" lua:"created_at"`
 }
 
 // NewInsight creates a new insight with a unique ID and current timestamp
@@ -1,5 +1,16 @@
 package reflection
 
+import "github.com/lexlapax/cogmem/pkg/scripting"
+
+// operationReflection is reported to hooks as ctx.operation
+const operationReflection = "reflection"
+
+func init() {
+	scripting.DeclareHook(beforeReflectionAnalysisFuncName, scripting.HookSpec{Mode: scripting.ChainFirst})
+	scripting.DeclareHook(afterInsightGenerationFuncName, scripting.HookSpec{Mode: scripting.ChainNotify})
+	scripting.DeclareHook(beforeConsolidationFuncName, scripting.HookSpec{Mode: scripting.ChainPipe})
+}
+
 // Lua hook function names for reflection operations
 const (
 	// Called before performing reflection analysis
@@ -9,6 +9,7 @@ import (
 	"github.com/lexlapax/cogmem/pkg/mmu"
 	"github.com/lexlapax/cogmem/pkg/reasoning"
 	"github.com/lexlapax/cogmem/pkg/scripting"
+	"github.com/lexlapax/cogmem/pkg/tokenizer"
 )
 
 // ReflectionModule defines the interface for self-reflection functionality
@@ -26,6 +27,10 @@ type Config struct {
 	// MaxMemoriesToAnalyze sets the maximum number of memories to include in analysis
 	MaxMemoriesToAnalyze int
 	
+	// MaxAnalysisTokens caps the tokens of memory content included in analysis,
+	// counted with the reasoning engine's tokenizer (0 disables the cap)
+	MaxAnalysisTokens int
+	
 	// AnalysisTemperature sets the temperature for reasoning during analysis
 	AnalysisTemperature float64
 	
@@ -60,6 +65,9 @@ type Module struct {
 	
 	// config contains configuration options
 	config Config
+	
+	// tokenizer counts memory tokens against MaxAnalysisTokens
+	tokenizer tokenizer.Tokenizer
 }
 
 // NewReflectionModule creates a new reflection module with the specified dependencies
@@ -74,11 +82,13 @@ func NewReflectionModule(
 		reasoningEngine: reasoningEngine,
 		scriptEngine:    scriptEngine,
 		config:          config,
+		tokenizer:       reasoning.TokenizerFor(reasoningEngine),
 	}
 	
 	log.Debug("Reflection Module initialized",
 		"lua_hooks_enabled", config.EnableLuaHooks,
 		"max_memories", config.MaxMemoriesToAnalyze,
+		"max_analysis_tokens", config.MaxAnalysisTokens,
 		"analysis_temperature", config.AnalysisTemperature)
 	
 	return module
@@ -91,6 +101,7 @@ func (m *Module) TriggerReflection(ctx context.Context) ([]*Insight, error) {
 	if !ok {
 		return nil, entity.ErrMissingEntityContext
 	}
+	ctx = scripting.WithOperation(ctx, operationReflection)
 	
 	log.Info("Triggering reflection process",
 		"entity_id", entityCtx.EntityID,
@@ -117,10 +128,15 @@ func (m *Module) TriggerReflection(ctx context.Context) ([]*Insight, error) {
 		result, err := m.scriptEngine.ExecuteFunction(ctx, beforeConsolidationFuncName, insights)
 		if err != nil {
 			log.WarnContext(ctx, "Error in before_consolidation hook", "error", err)
-		} else if modifiedInsights, ok := result.([]*Insight); ok {
-			insights = modifiedInsights
-			log.Debug("Insights modified by before_consolidation hook",
-				"count", len(insights))
+		} else if result != nil {
+			var modifiedInsights []*Insight
+			if err := scripting.Unmarshal(result, &modifiedInsights); err != nil {
+				log.WarnContext(ctx, "Invalid result from before_consolidation hook", "error", err)
+			} else {
+				insights = modifiedInsights
+				log.Debug("Insights modified by before_consolidation hook",
+					"count", len(insights))
+			}
 		}
 	}
 	
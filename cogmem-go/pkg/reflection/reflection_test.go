@@ -10,8 +10,10 @@ import (
 	"github.com/lexlapax/cogmem/pkg/mem/ltm"
 	"github.com/lexlapax/cogmem/pkg/mmu"
 	"github.com/lexlapax/cogmem/pkg/reasoning"
+	"github.com/lexlapax/cogmem/pkg/scripting"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockMMU mocks the MMU interface for testing
@@ -79,6 +81,16 @@ func (m *MockScriptEngine) Close() error {
 	return args.Error(0)
 }
 
+// reflectionCtx matches the context a reflection pass passes on: ctx with
+// the operation reported to hooks added.
+func reflectionCtx(ctx context.Context) interface{} {
+	entityCtx, _ := entity.GetEntityContext(ctx)
+	return mock.MatchedBy(func(c context.Context) bool {
+		got, ok := entity.GetEntityContext(c)
+		return ok && got == entityCtx && scripting.Operation(c) == operationReflection
+	})
+}
+
 func init() {
 	// Set up test logger
 	log.Setup(log.Config{
@@ -137,10 +149,10 @@ func TestTriggerReflection(t *testing.T) {
 	}
 	
 	// Mock the before hook call (if enabled) - return false to NOT skip analysis
-	mockScripting.On("ExecuteFunction", ctx, "before_reflection_analysis", mock.Anything).Return(false, nil)
+	mockScripting.On("ExecuteFunction", reflectionCtx(ctx), "before_reflection_analysis", mock.Anything).Return(false, nil)
 	
 	// Mock the retrieval call
-	mockMmu.On("RetrieveFromLTM", ctx, mock.Anything, mock.Anything).Return(records, nil)
+	mockMmu.On("RetrieveFromLTM", reflectionCtx(ctx), mock.Anything, mock.Anything).Return(records, nil)
 	
 	// Sample LLM response with insights
 	llmResponse := `
@@ -162,16 +174,16 @@ func TestTriggerReflection(t *testing.T) {
 	}`
 	
 	// Mock the reasoning engine call
-	mockReasoning.On("Process", ctx, mock.Anything, mock.Anything).Return(llmResponse, nil)
+	mockReasoning.On("Process", reflectionCtx(ctx), mock.Anything, mock.Anything).Return(llmResponse, nil)
 	
 	// Mock the after hook call (if enabled)
-	mockScripting.On("ExecuteFunction", ctx, "after_insight_generation", mock.Anything).Return(nil, nil)
+	mockScripting.On("ExecuteFunction", reflectionCtx(ctx), "after_insight_generation", mock.Anything).Return(nil, nil)
 	
 	// Mock the before_consolidation hook
-	mockScripting.On("ExecuteFunction", ctx, "before_consolidation", mock.Anything).Return(mock.Anything, nil)
+	mockScripting.On("ExecuteFunction", reflectionCtx(ctx), "before_consolidation", mock.Anything).Return(mock.Anything, nil)
 	
 	// Mock the consolidation call
-	mockMmu.On("ConsolidateLTM", ctx, mock.Anything).Return(nil)
+	mockMmu.On("ConsolidateLTM", reflectionCtx(ctx), mock.Anything).Return(nil)
 	
 	// Create the module
 	config := DefaultConfig()
@@ -222,7 +234,7 @@ func TestTriggerReflectionWithoutLuaHooks(t *testing.T) {
 	}
 	
 	// Mock the retrieval call
-	mockMmu.On("RetrieveFromLTM", ctx, mock.Anything, mock.Anything).Return(records, nil)
+	mockMmu.On("RetrieveFromLTM", reflectionCtx(ctx), mock.Anything, mock.Anything).Return(records, nil)
 	
 	// Sample LLM response with insights
 	llmResponse := `
@@ -238,10 +250,10 @@ func TestTriggerReflectionWithoutLuaHooks(t *testing.T) {
 	}`
 	
 	// Mock the reasoning engine call
-	mockReasoning.On("Process", ctx, mock.Anything, mock.Anything).Return(llmResponse, nil)
+	mockReasoning.On("Process", reflectionCtx(ctx), mock.Anything, mock.Anything).Return(llmResponse, nil)
 	
 	// Mock the consolidation call
-	mockMmu.On("ConsolidateLTM", ctx, mock.Anything).Return(nil)
+	mockMmu.On("ConsolidateLTM", reflectionCtx(ctx), mock.Anything).Return(nil)
 	
 	// Create the module with hooks disabled
 	config := DefaultConfig()
@@ -262,6 +274,58 @@ func TestTriggerReflectionWithoutLuaHooks(t *testing.T) {
 	mockScripting.AssertNotCalled(t, "ExecuteFunction", mock.Anything, mock.Anything)
 }
 
+func TestTriggerReflectionWithLuaScripts(t *testing.T) {
+	mockMmu := new(MockMMU)
+	mockReasoning := new(MockReasoningEngine)
+	
+	// Use the shipped reflection hooks with the real engine
+	engine, err := scripting.NewLuaEngine(scripting.DefaultConfig())
+	require.NoError(t, err)
+	defer engine.Close()
+	require.NoError(t, engine.LoadScriptFile("../../scripts/reflection/analysis.lua"))
+	
+	ctx := entity.ContextWithEntity(context.Background(), entity.Context{
+		EntityID: "test-entity",
+		UserID:   "test-user",
+	})
+	
+	// before_reflection_analysis skips analysis of fewer than 3 memories
+	records := []ltm.MemoryRecord{
+		{ID: "record1", EntityID: "test-entity", Content: "Memory content 1", CreatedAt: time.Now().Add(-time.Hour)},
+		{ID: "record2", EntityID: "test-entity", Content: "Memory content 2", Embedding: []float32{0.1, 0.2}},
+		{ID: "record3", EntityID: "test-entity", Content: "Memory content 3", Metadata: map[string]interface{}{"topic": "x"}},
+	}
+	mockMmu.On("RetrieveFromLTM", reflectionCtx(ctx), mock.Anything, mock.Anything).Return(records, nil)
+	
+	llmResponse := `
+	{
+		"insights": [
+			{"type": "pattern", "description": "Confident insight", "confidence": 0.85, "related_memory_ids": ["record1"]},
+			{"type": "gap", "description": "Doubtful insight", "confidence": 0.4, "related_memory_ids": ["record2"]}
+		]
+	}`
+	mockReasoning.On("Process", reflectionCtx(ctx), mock.Anything, mock.Anything).Return(llmResponse, nil)
+	mockMmu.On("ConsolidateLTM", reflectionCtx(ctx), mock.Anything).Return(nil)
+	
+	config := DefaultConfig()
+	config.EnableLuaHooks = true
+	module := NewReflectionModule(mockMmu, mockReasoning, engine, config)
+	
+	insights, err := module.TriggerReflection(ctx)
+	require.NoError(t, err)
+	
+	// before_consolidation drops low confidence insights and annotates the rest
+	require.Len(t, insights, 1)
+	assert.Equal(t, "Confident insight", insights[0].Description)
+	assert.Equal(t, []string{"record1"}, insights[0].RelatedMemoryIDs)
+	assert.NotEmpty(t, insights[0].ID)
+	assert.False(t, insights[0].CreatedAt.IsZero())
+	assert.Equal(t, true, insights[0].Metadata["processed_by_lua"])
+	assert.NotNil(t, insights[0].Metadata["processing_timestamp"])
+	
+	mockMmu.AssertExpectations(t)
+}
+
 func TestTriggerReflectionErrorHandling(t *testing.T) {
 	// Create mocks
 	mockMmu := new(MockMMU)
@@ -277,7 +341,7 @@ func TestTriggerReflectionErrorHandling(t *testing.T) {
 	})
 	
 	// Mock the retrieval call with an error
-	mockMmu.On("RetrieveFromLTM", ctx, mock.Anything, mock.Anything).Return([]ltm.MemoryRecord{}, assert.AnError)
+	mockMmu.On("RetrieveFromLTM", reflectionCtx(ctx), mock.Anything, mock.Anything).Return([]ltm.MemoryRecord{}, assert.AnError)
 	
 	// Create the module
 	module := NewReflectionModule(mockMmu, mockReasoning, mockScripting, DefaultConfig())
@@ -295,12 +359,12 @@ func TestTriggerReflectionErrorHandling(t *testing.T) {
 	mockReasoning2 := new(MockReasoningEngine)
 	
 	// Mock successful retrieval
-	mockMmu2.On("RetrieveFromLTM", ctx, mock.Anything, mock.Anything).Return([]ltm.MemoryRecord{
+	mockMmu2.On("RetrieveFromLTM", reflectionCtx(ctx), mock.Anything, mock.Anything).Return([]ltm.MemoryRecord{
 		{ID: "record1", Content: "test"},
 	}, nil)
 	
 	// Mock reasoning error
-	mockReasoning2.On("Process", ctx, mock.Anything, mock.Anything).Return("", assert.AnError)
+	mockReasoning2.On("Process", reflectionCtx(ctx), mock.Anything, mock.Anything).Return("", assert.AnError)
 	
 	// Create module with new mocks
 	module2 := NewReflectionModule(mockMmu2, mockReasoning2, nil, DefaultConfig())
@@ -312,4 +376,22 @@ func TestTriggerReflectionErrorHandling(t *testing.T) {
 	assert.Error(t, err2)
 	assert.Nil(t, insights2)
 	assert.ErrorIs(t, err2, assert.AnError)
-}
\ No newline at end of file
+}
+
+func TestLimitAnalysisTokens(t *testing.T) {
+	memories := []ltm.MemoryRecord{
+		{ID: "a", Content: "twelve chars"},
+		{ID: "b", Content: "twelve chars"},
+		{ID: "c", Content: "twelve chars"},
+	}
+	
+	config := DefaultConfig()
+	module := NewReflectionModule(new(MockMMU), new(MockReasoningEngine), nil, config)
+	assert.Len(t, module.limitAnalysisTokens(memories), 3, "no cap by default")
+	
+	config.MaxAnalysisTokens = 7
+	module = NewReflectionModule(new(MockMMU), new(MockReasoningEngine), nil, config)
+	limited := module.limitAnalysisTokens(memories)
+	assert.Len(t, limited, 2)
+	assert.Equal(t, "b", limited[1].ID)
+}
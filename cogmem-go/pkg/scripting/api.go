@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/lexlapax/cogmem/pkg/log"
 	lua "github.com/yuin/gopher-lua"
 )
@@ -26,8 +27,14 @@ func registerAPIFunctions(L *lua.LState) {
 	L.SetField(cogmem, "uuid", L.NewFunction(apiUUID))
 	
 	// JSON encoding/decoding
+	null := newJSONNull(L)
+	L.SetField(cogmem, "null", null)
 	L.SetField(cogmem, "json_encode", L.NewFunction(apiJSONEncode))
-	L.SetField(cogmem, "json_decode", L.NewFunction(apiJSONDecode))
+	L.SetField(cogmem, "json_decode", L.NewClosure(apiJSONDecode, null))
+	L.SetField(cogmem, "json_array", L.NewFunction(apiJSONArray))
+	
+	// Vector math on embeddings
+	L.SetField(cogmem, "vec", newVecModule(L))
 	
 	// Register the cogmem table in the global namespace
 	L.SetGlobal("cogmem", cogmem)
@@ -73,41 +80,70 @@ func apiFormatTime(L *lua.LState) int {
 	return 1
 }
 
-// apiUUID generates a UUID string
+// apiUUID generates an RFC 4122 UUID string. The optional argument selects
+// the version: 4 (random, the default) or 7 (time-ordered).
+// Returns nil and an error message on failure.
 func apiUUID(L *lua.LState) int {
-	// This is a placeholder implementation
-	// In a real implementation, you'd use a proper UUID package
-	// such as github.com/google/uuid
+	version := L.OptString(1, "4")
+	
+	var id uuid.UUID
+	var err error
+	switch version {
+	case "4", "v4":
+		id, err = uuid.NewRandom()
+	case "7", "v7":
+		id, err = uuid.NewV7()
+	default:
+		err = fmt.Errorf("unsupported uuid version %q", version)
+	}
 	
-	// Use more randomness to ensure UUIDs are unique even when called in rapid succession
-	uuid := fmt.Sprintf("uuid-%d-%d", time.Now().UnixNano(), time.Now().Add(time.Nanosecond).UnixNano())
-	L.Push(lua.LString(uuid))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LString(id.String()))
 	return 1
 }
 
-// apiJSONEncode encodes a Lua table to a JSON string
+// apiJSONEncode encodes a Lua value to a JSON string.
+// Returns nil and an error message if the value cannot be encoded.
 func apiJSONEncode(L *lua.LState) int {
 	value := L.CheckAny(1)
 	
-	// Convert Lua value to Go
-	goValue := convertLuaToGo(value)
+	encoded, err := encodeJSON(value)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
 	
-	// For now, just return a placeholder
-	// In a real implementation, you'd use encoding/json
-	L.Push(lua.LString(fmt.Sprintf("%v", goValue)))
+	L.Push(lua.LString(encoded))
 	return 1
 }
 
-// apiJSONDecode decodes a JSON string to a Lua table
+// apiJSONDecode decodes a JSON string to a Lua value, with null decoded as cogmem.null.
+// Returns nil and an error message if the string is not valid JSON.
 func apiJSONDecode(L *lua.LState) int {
 	jsonStr := L.CheckString(1)
 	
-	// For now, just create an empty table
-	// In a real implementation, you'd use encoding/json
-	table := L.NewTable()
-	table.RawSetString("original", lua.LString(jsonStr))
+	value, err := decodeJSON(L, []byte(jsonStr), L.Get(lua.UpvalueIndex(1)))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(fmt.Sprintf("invalid JSON: %v", err)))
+		return 2
+	}
 	
-	L.Push(table)
+	L.Push(value)
+	return 1
+}
+
+// apiJSONArray marks a table as a JSON array, so it encodes as [] even when empty.
+// Creates a new table if none is given, and returns the table.
+func apiJSONArray(L *lua.LState) int {
+	tbl := L.OptTable(1, L.NewTable())
+	tbl.Metatable = arrayMetatable(L)
+	L.Push(tbl)
 	return 1
 }
 
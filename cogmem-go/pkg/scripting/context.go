@@ -0,0 +1,112 @@
+package scripting
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lexlapax/cogmem/pkg/entity"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ctxMetatableName is the registry name of the metatable of the ctx userdata
+const ctxMetatableName = "cogmem.ctx"
+
+type (
+	// requestIDKey holds the ID of the request a function call belongs to
+	requestIDKey struct{}
+	
+	// operationKey holds the operation that calls a function, e.g. "retrieve"
+	operationKey struct{}
+)
+
+// WithRequestID returns a context that reports id to scripts as ctx.request_id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of a context, or "" if it has none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithOperation returns a context that reports operation to scripts as
+// ctx.operation. It also gives the context a request ID if it has none, so
+// that every hook called for the operation sees the same one.
+func WithOperation(ctx context.Context, operation string) context.Context {
+	if RequestID(ctx) == "" {
+		ctx = WithRequestID(ctx, uuid.NewString())
+	}
+	return context.WithValue(ctx, operationKey{}, operation)
+}
+
+// Operation returns the operation of a context, or "" if it has none.
+func Operation(ctx context.Context) string {
+	operation, _ := ctx.Value(operationKey{}).(string)
+	return operation
+}
+
+// pushContext sets the ctx global to a read-only view of the caller's context:
+// entity_id, user_id and session_id from its entity context, operation,
+// request_id, and deadline as a Unix timestamp. Fields that are not known
+// are nil. A function called without a request ID gets a fresh one.
+func pushContext(L *lua.LState, ctx context.Context) {
+	fields := L.NewTable()
+	
+	if deadline, ok := ctx.Deadline(); ok {
+		fields.RawSetString("deadline", lua.LNumber(deadline.Unix()))
+	}
+	if entityCtx, ok := entity.GetEntityContext(ctx); ok {
+		setContextField(fields, "entity_id", string(entityCtx.EntityID))
+		setContextField(fields, "user_id", entityCtx.UserID)
+		setContextField(fields, "session_id", entityCtx.SessionID)
+	}
+	setContextField(fields, "operation", Operation(ctx))
+	
+	requestID := RequestID(ctx)
+	if requestID == "" {
+		requestID = uuid.NewString()
+	}
+	setContextField(fields, "request_id", requestID)
+	
+	view := L.NewUserData()
+	view.Value = fields
+	view.Metatable = ctxMetatable(L)
+	L.SetGlobal("ctx", view)
+}
+
+// setContextField sets a ctx field, leaving it nil if the value is empty.
+func setContextField(fields *lua.LTable, name, value string) {
+	if value != "" {
+		fields.RawSetString(name, lua.LString(value))
+	}
+}
+
+// ctxMetatable returns the metatable of the ctx userdata, which exposes the
+// fields for reading and rejects assignments. Being userdata, ctx cannot be
+// changed with rawset either.
+func ctxMetatable(L *lua.LState) *lua.LTable {
+	if mt, ok := L.GetTypeMetatable(ctxMetatableName).(*lua.LTable); ok {
+		return mt
+	}
+	mt := L.NewTypeMetatable(ctxMetatableName)
+	L.SetField(mt, "__index", L.NewFunction(ctxIndex))
+	L.SetField(mt, "__newindex", L.NewFunction(ctxNewIndex))
+	L.SetField(mt, "__metatable", lua.LString("read-only"))
+	return mt
+}
+
+func ctxIndex(L *lua.LState) int {
+	fields, _ := L.CheckUserData(1).Value.(*lua.LTable)
+	if fields == nil {
+		L.Push(lua.LNil)
+		return 1
+	}
+	L.Push(fields.RawGet(L.Get(2)))
+	return 1
+}
+
+func ctxNewIndex(L *lua.LState) int {
+	L.RaiseError("ctx is read-only")
+	return 0
+}
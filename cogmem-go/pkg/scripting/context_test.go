@@ -0,0 +1,101 @@
+package scripting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLuaEngine_ContextFields(t *testing.T) {
+	engine, err := NewLuaEngine(DefaultConfig())
+	require.NoError(t, err)
+	defer engine.Close()
+	
+	err = engine.LoadScript("ctx", []byte(`
+		function describe()
+			return {
+				entity_id = ctx.entity_id,
+				user_id = ctx.user_id,
+				session_id = ctx.session_id,
+				operation = ctx.operation,
+				request_id = ctx.request_id,
+				has_deadline = ctx.deadline ~= nil,
+			}
+		end
+		
+		function assign()
+			ctx.entity_id = "other-entity"
+		end
+		
+		function raw_assign()
+			rawset(ctx, "entity_id", "other-entity")
+		end
+		
+		function replace_metatable()
+			setmetatable(ctx, {})
+		end
+	`))
+	require.NoError(t, err)
+	
+	entityCtx := entity.NewContext("test-entity", "test-user")
+	entityCtx.SessionID = "test-session"
+	ctx := entity.ContextWithEntity(context.Background(), entityCtx)
+	
+	t.Run("Fields come from the caller's context", func(t *testing.T) {
+		opCtx := WithOperation(WithRequestID(ctx, "request-1"), "retrieve")
+		opCtx, cancel := context.WithTimeout(opCtx, 5*time.Second)
+		defer cancel()
+		
+		result, err := engine.ExecuteFunction(opCtx, "describe")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"entity_id":    "test-entity",
+			"user_id":      "test-user",
+			"session_id":   "test-session",
+			"operation":    "retrieve",
+			"request_id":   "request-1",
+			"has_deadline": true,
+		}, result)
+	})
+	
+	t.Run("Unknown fields are nil", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(context.Background(), "describe")
+		require.NoError(t, err)
+		fields := result.(map[string]interface{})
+		assert.NotContains(t, fields, "entity_id")
+		assert.NotContains(t, fields, "operation")
+		
+		// A request ID is generated when the caller has none
+		assert.NotEmpty(t, fields["request_id"])
+	})
+	
+	t.Run("An operation shares its request ID with every hook", func(t *testing.T) {
+		opCtx := WithOperation(ctx, "encode")
+		require.NotEmpty(t, RequestID(opCtx))
+		
+		first, err := engine.ExecuteFunction(opCtx, "describe")
+		require.NoError(t, err)
+		second, err := engine.ExecuteFunction(opCtx, "describe")
+		require.NoError(t, err)
+		assert.Equal(t, RequestID(opCtx), first.(map[string]interface{})["request_id"])
+		assert.Equal(t, RequestID(opCtx), second.(map[string]interface{})["request_id"])
+		
+		// A nested operation keeps the request ID of the outer one
+		assert.Equal(t, RequestID(opCtx), RequestID(WithOperation(opCtx, "retrieve")))
+	})
+	
+	t.Run("ctx is read-only", func(t *testing.T) {
+		for _, funcName := range []string{"assign", "raw_assign", "replace_metatable"} {
+			_, err := engine.ExecuteFunction(ctx, funcName)
+			assert.Error(t, err, funcName)
+		}
+		
+		result, err := engine.ExecuteFunction(ctx, "describe")
+		require.NoError(t, err)
+		assert.Equal(t, "test-entity", result.(map[string]interface{})["entity_id"])
+	})
+}
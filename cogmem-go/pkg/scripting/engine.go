@@ -1,17 +1,24 @@
 package scripting
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/lexlapax/cogmem/pkg/entity"
 	"github.com/lexlapax/cogmem/pkg/log"
 	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
 )
 
 // Engine is the interface for the Lua scripting engine.
@@ -25,7 +32,8 @@ type Engine interface {
 	// LoadScriptDir loads all Lua scripts from a directory.
 	LoadScriptDir(dir string) error
 	
-	// ExecuteFunction calls a Lua function with the given arguments.
+	// ExecuteFunction calls a Lua function with the given arguments, or runs
+	// the chain of handlers registered for a hook of that name.
 	// The function should be previously loaded via LoadScript or LoadScriptFile.
 	ExecuteFunction(ctx context.Context, funcName string, args ...interface{}) (interface{}, error)
 	
@@ -43,6 +51,32 @@ type Config struct {
 	
 	// MaxMemoryMB sets a maximum memory limit for the Lua state in megabytes
 	MaxMemoryMB int
+	
+	// MaxInstructions sets a maximum number of Lua instructions per function call
+	MaxInstructions int64
+	
+	// MaxMemoryOps sets a maximum number of cogmem.memory operations per function call
+	MaxMemoryOps int
+	
+	// MaxLLMCalls sets a maximum number of cogmem.llm calls per function call
+	MaxLLMCalls int
+	
+	// MaxLLMTokens sets a maximum number of tokens sent to and generated by
+	// cogmem.llm calls per function call
+	MaxLLMTokens int
+	
+	// CallStackSize caps the depth of Lua calls; 0 uses the gopher-lua default
+	CallStackSize int
+	
+	// RegistrySize caps the number of values on the Lua stack; 0 uses the gopher-lua default
+	RegistrySize int
+	
+	// HookLimits overrides the limits for individual functions, keyed by function name
+	HookLimits map[string]Limits
+	
+	// PoolSize is the number of Lua states kept ready to run functions, and so
+	// the number of functions that can run in parallel
+	PoolSize int
 }
 
 // DefaultConfig returns the default configuration for the scripting engine.
@@ -51,6 +85,11 @@ func DefaultConfig() Config {
 		EnableSandboxing: true,
 		ScriptTimeoutMs:  1000,  // 1 second
 		MaxMemoryMB:      100,   // 100 MB
+		MaxInstructions:  10000000,
+		MaxMemoryOps:     100,
+		MaxLLMCalls:      5,
+		MaxLLMTokens:     4096,
+		PoolSize:         runtime.GOMAXPROCS(0),
 	}
 }
 
@@ -66,73 +105,304 @@ var (
 	ErrExecutionTimeout = errors.New("script execution timed out")
 	ErrInvalidArgument  = errors.New("invalid argument for lua function")
 	ErrMemoryLimit      = errors.New("lua memory limit exceeded")
+	ErrEngineClosed     = errors.New("lua engine is closed")
 )
 
-// LuaEngine implements the Engine interface using gopher-lua.
+// compiledScript is a loaded script, compiled once and run in every Lua state.
+type compiledScript struct {
+	name  string
+	proto *lua.FunctionProto
+}
+
+// pooledState is a Lua state together with the number of the engine's
+// scripts that have been run in it, the hook handlers they registered, and
+// the environments of the entities whose scripts it has run.
+type pooledState struct {
+	L        *lua.LState
+	scripts  int
+	hooks    *luaHooks
+	entities map[entity.EntityID]*entityEnv
+	unloads  uint64
+}
+
+// LuaEngine implements the Engine interface using gopher-lua. It keeps a pool
+// of sandboxed Lua states that all have the same scripts loaded, so functions
+// can run in parallel. A state whose function is cancelled or times out is
+// discarded and replaced, since it may have been stopped mid-update.
+// Scripts loaded for an entity override the global ones in calls made for
+// that entity; see EntityScriptLoader.
 type LuaEngine struct {
-	state       *lua.LState
 	config      Config
+	
+	// pool holds the idle states
+	pool        chan *pooledState
+	
+	// closed is closed by Close to wake callers waiting for a state
+	closed      chan struct{}
+	
+	// mutex guards scripts, loadedFiles, entities, unloads, handlers and isClosed
+	mutex       sync.RWMutex
+	scripts     []compiledScript
 	loadedFiles map[string]bool
-	mutex       sync.Mutex
+	isClosed    bool
+	
+	// entities holds the scripts loaded for individual entities, and unloads
+	// counts the times an entity's scripts were unloaded
+	entities    map[entity.EntityID]*entityScripts
+	unloads     uint64
+	
+	// handlers holds the Go handlers registered for each hook
+	handlers    map[string][]*goHandler
+	
+	// memory is the memory API offered to scripts, if one has been bound
+	memory      atomic.Pointer[boundMemory]
+	
+	// reasoning is the reasoning engine offered to scripts, if one has been bound
+	reasoning   atomic.Pointer[boundReasoning]
 }
 
 // NewLuaEngine creates a new LuaEngine with the given configuration.
 func NewLuaEngine(config Config) (*LuaEngine, error) {
-	// Create a new Lua state
-	opts := lua.Options{
-		SkipOpenLibs: config.EnableSandboxing,
+	if config.PoolSize < 1 {
+		config.PoolSize = 1
 	}
 	
-	L := lua.NewState(opts)
-	
 	// Initialize the engine
 	engine := &LuaEngine{
-		state:       L,
 		config:      config,
+		pool:        make(chan *pooledState, config.PoolSize),
+		closed:      make(chan struct{}),
 		loadedFiles: make(map[string]bool),
+		entities:    make(map[entity.EntityID]*entityScripts),
+		handlers:    make(map[string][]*goHandler),
+	}
+	
+	// Pre-warm the pool
+	for i := 0; i < config.PoolSize; i++ {
+		engine.pool <- engine.newState()
 	}
 	
-	// Setup the sandbox if enabled
 	if config.EnableSandboxing {
-		setupSandbox(L)
 		log.Debug("Lua engine initialized with sandbox enabled", 
 			"timeout_ms", config.ScriptTimeoutMs,
-			"max_memory_mb", config.MaxMemoryMB)
+			"max_memory_mb", config.MaxMemoryMB,
+			"pool_size", config.PoolSize)
 	} else {
-		L.OpenLibs()
 		log.Debug("Lua engine initialized with sandbox disabled", 
 			"timeout_ms", config.ScriptTimeoutMs,
 			"max_memory_mb", config.MaxMemoryMB,
+			"pool_size", config.PoolSize,
 			"warning", "full Lua libraries available")
 	}
 	
+	return engine, nil
+}
+
+// newState creates a Lua state with the sandbox and API functions set up, but
+// no scripts loaded.
+func (e *LuaEngine) newState() *pooledState {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:  e.config.EnableSandboxing,
+		CallStackSize: e.config.CallStackSize,
+		RegistrySize:  e.config.RegistrySize,
+	})
+	
+	// Setup the sandbox if enabled
+	if e.config.EnableSandboxing {
+		setupSandbox(L)
+	} else {
+		L.OpenLibs()
+	}
+	
 	// Register API functions
 	registerAPIFunctions(L)
+	e.registerMemoryFunctions(L)
+	e.registerLLMFunctions(L)
+	registerHookFunctions(L)
+	installLimitGuards(L)
+	
+	return &pooledState{
+		L:        L,
+		hooks:    newLuaHooks(""),
+		entities: make(map[entity.EntityID]*entityEnv),
+	}
+}
+
+// acquire takes an idle state from the pool, waiting for one if all are in
+// use, and brings it up to date with the loaded scripts.
+func (e *LuaEngine) acquire(ctx context.Context) (*pooledState, error) {
+	var state *pooledState
+	select {
+	case state = <-e.pool:
+	case <-e.closed:
+		return nil, ErrEngineClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 	
-	return engine, nil
+	if err := e.syncScripts(state); err != nil {
+		e.replace(state)
+		return nil, err
+	}
+	return state, nil
 }
 
-// LoadScript loads a Lua script with the given name and content.
-func (e *LuaEngine) LoadScript(name string, content []byte) error {
+// syncScripts runs the global scripts loaded since the state was last used,
+// and drops the environments of entities whose scripts were unloaded since.
+// Entities' own scripts are run when a function is called for them.
+func (e *LuaEngine) syncScripts(state *pooledState) error {
+	e.mutex.RLock()
+	scripts := e.scripts
+	if state.unloads != e.unloads {
+		for entityID, env := range state.entities {
+			if e.entities[entityID] != env.source {
+				delete(state.entities, entityID)
+			}
+		}
+		state.unloads = e.unloads
+	}
+	e.mutex.RUnlock()
+	
+	return e.runPending(state, scripts)
+}
+
+// runPending runs the scripts the state has not run yet.
+func (e *LuaEngine) runPending(state *pooledState, scripts []compiledScript) error {
+	for _, script := range scripts[state.scripts:] {
+		if err := e.runScript(state.L, nil, state.hooks, script); err != nil {
+			log.Error("Failed to load Lua script into pooled state", "name", script.name, "error", err)
+			return fmt.Errorf("failed to load script %s: %w", script.name, err)
+		}
+		state.scripts++
+	}
+	return nil
+}
+
+// release returns a state to the pool, or closes it if the engine is closed.
+func (e *LuaEngine) release(state *pooledState) {
+	state.L.SetTop(0)
+	
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if e.isClosed {
+		state.L.Close()
+		return
+	}
+	e.pool <- state
+}
+
+// replace closes a state that may be inconsistent and adds a fresh one to the pool.
+func (e *LuaEngine) replace(state *pooledState) {
+	state.L.Close()
+	e.release(e.newState())
+}
+
+// runScript runs a compiled script in a Lua state under the engine-wide
+// limits. The script defines its functions in env, or in the global
+// environment if env is nil, and registers its hook handlers in hooks.
+func (e *LuaEngine) runScript(L *lua.LState, env *lua.LTable, hooks *luaHooks, script compiledScript) error {
+	limitCtx, done := newLimitContext(context.Background(), L, e.config.limitsFor(""))
+	defer done()
+	limitCtx.load = &scriptLoad{script: script.name, hooks: hooks}
+	
+	fn := L.NewFunctionFromProto(script.proto)
+	if env != nil {
+		fn.Env = env
+	}
+	L.SetContext(limitCtx)
+	L.Push(fn)
+	err := L.PCall(0, lua.MultRet, nil)
+	L.RemoveContext()
+	L.SetTop(0)
+	
+	if limitErr := limitCtx.limitErr(); limitErr != nil {
+		return limitErr
+	}
+	if limitCtx.Err() != nil {
+		return ErrExecutionTimeout
+	}
+	if isOverflowError(err) {
+		return fmt.Errorf("%w: %v", ErrMemoryLimit, err)
+	}
+	return err
+}
+
+// compileScript parses and compiles a Lua script.
+func compileScript(name string, content []byte) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(bytes.NewReader(content), name)
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, name)
+}
+
+// addScript compiles a script, checks that it runs, and adds it to the
+// scripts run in every state: the global scripts if entityID is empty, or
+// else the entity's.
+func (e *LuaEngine) addScript(entityID entity.EntityID, name string, content []byte) error {
+	proto, err := compileScript(name, content)
+	if err != nil {
+		return err
+	}
+	
+	state, err := e.acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	
+	// Loading is serialised so that every state runs the scripts in the same order
 	e.mutex.Lock()
-	defer e.mutex.Unlock()
+	err = e.runPending(state, e.scripts)
+	if err == nil {
+		if entityID == "" {
+			err = e.addGlobalScript(state, name, proto)
+		} else {
+			err = e.addEntityScript(state, entityID, name, proto)
+		}
+	}
+	e.mutex.Unlock()
+	
+	if err != nil {
+		// The script may have partly run, so the state is no longer like the others
+		e.replace(state)
+		return err
+	}
+	e.release(state)
+	return nil
+}
+
+// addGlobalScript runs a script in the global environment of a state that is
+// up to date and adds it to the global scripts. The caller holds e.mutex.
+func (e *LuaEngine) addGlobalScript(state *pooledState, name string, proto *lua.FunctionProto) error {
+	script := compiledScript{name: name, proto: proto}
+	globals := state.L.G.Global
+	defined := definedFunctions(globals)
+	if err := e.runScript(state.L, nil, state.hooks, script); err != nil {
+		return err
+	}
+	warnRedefined("", name, defined, globals)
 	
-	log.Debug("Loading Lua script from string", "name", name, "size_bytes", len(content))
+	e.scripts = append(e.scripts, script)
+	state.scripts = len(e.scripts)
+	return nil
+}
+
+// loadScript loads a script for an entity, or a global script if entityID is empty.
+func (e *LuaEngine) loadScript(entityID entity.EntityID, name string, content []byte) error {
+	log.Debug("Loading Lua script from string", withEntity(entityID, "name", name, "size_bytes", len(content))...)
 	
-	if err := e.state.DoString(string(content)); err != nil {
-		log.Error("Failed to load Lua script", "name", name, "error", err)
+	if err := e.addScript(entityID, name, content); err != nil {
+		log.Error("Failed to load Lua script", withEntity(entityID, "name", name, "error", err)...)
 		return fmt.Errorf("failed to load script %s: %w", name, err)
 	}
 	
-	e.loadedFiles[name] = true
+	e.markLoaded(entityID, name)
 	return nil
 }
 
-// LoadScriptFile loads a Lua script from a file path.
-func (e *LuaEngine) LoadScriptFile(path string) error {
-	e.mutex.Lock()
-	defer e.mutex.Unlock()
-	
+// loadScriptFile loads a script file for an entity, or a global script file
+// if entityID is empty. Files already loaded are skipped.
+func (e *LuaEngine) loadScriptFile(entityID entity.EntityID, path string) error {
 	// Check if the file has already been loaded
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -140,26 +410,31 @@ func (e *LuaEngine) LoadScriptFile(path string) error {
 		return fmt.Errorf("failed to get absolute path for %s: %w", path, err)
 	}
 	
-	if e.loadedFiles[absPath] {
-		log.Debug("Lua script file already loaded, skipping", "path", absPath)
+	if e.isLoaded(entityID, absPath) {
+		log.Debug("Lua script file already loaded, skipping", withEntity(entityID, "path", absPath)...)
 		return nil // Already loaded
 	}
 	
-	log.Debug("Loading Lua script from file", "path", absPath)
+	log.Debug("Loading Lua script from file", withEntity(entityID, "path", absPath)...)
 	
 	// Load the file
-	if err := e.state.DoFile(path); err != nil {
-		log.Error("Failed to load Lua script file", "path", absPath, "error", err)
+	content, err := os.ReadFile(path)
+	if err == nil {
+		err = e.addScript(entityID, path, content)
+	}
+	if err != nil {
+		log.Error("Failed to load Lua script file", withEntity(entityID, "path", absPath, "error", err)...)
 		return fmt.Errorf("failed to load script file %s: %w", path, err)
 	}
 	
-	e.loadedFiles[absPath] = true
+	e.markLoaded(entityID, absPath)
 	return nil
 }
 
-// LoadScriptDir loads all Lua scripts from a directory.
-func (e *LuaEngine) LoadScriptDir(dir string) error {
-	log.Debug("Loading Lua scripts from directory", "dir", dir)
+// loadScriptDir loads all Lua scripts in a directory for an entity, or as
+// global scripts if entityID is empty.
+func (e *LuaEngine) loadScriptDir(entityID entity.EntityID, dir string) error {
+	log.Debug("Loading Lua scripts from directory", withEntity(entityID, "dir", dir)...)
 	
 	fileCount := 0
 	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
@@ -179,179 +454,306 @@ func (e *LuaEngine) LoadScriptDir(dir string) error {
 		}
 		
 		fileCount++
-		return e.LoadScriptFile(path)
+		return e.loadScriptFile(entityID, path)
 	})
 	
 	if err != nil {
-		log.Error("Failed to load Lua scripts from directory", "dir", dir, "error", err)
+		log.Error("Failed to load Lua scripts from directory", withEntity(entityID, "dir", dir, "error", err)...)
 		return err
 	}
 	
-	log.Debug("Successfully loaded Lua scripts from directory", "dir", dir, "file_count", fileCount)
+	log.Debug("Successfully loaded Lua scripts from directory", withEntity(entityID, "dir", dir, "file_count", fileCount)...)
 	return nil
 }
 
-// ExecuteFunction calls a Lua function with the given arguments.
-func (e *LuaEngine) ExecuteFunction(ctx context.Context, funcName string, args ...interface{}) (interface{}, error) {
-	// Lock the mutex before accessing the Lua state
+// isLoaded reports whether a script name or file has been loaded, globally
+// if entityID is empty or else for the entity.
+func (e *LuaEngine) isLoaded(entityID entity.EntityID, key string) bool {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if entityID == "" {
+		return e.loadedFiles[key]
+	}
+	source := e.entities[entityID]
+	return source != nil && source.loadedFiles[key]
+}
+
+// markLoaded records that a script name or file has been loaded.
+func (e *LuaEngine) markLoaded(entityID entity.EntityID, key string) {
 	e.mutex.Lock()
-	
+	defer e.mutex.Unlock()
+	if entityID == "" {
+		e.loadedFiles[key] = true
+	} else if source := e.entities[entityID]; source != nil {
+		source.loadedFiles[key] = true
+	}
+}
+
+// LoadScript loads a Lua script with the given name and content.
+func (e *LuaEngine) LoadScript(name string, content []byte) error {
+	return e.loadScript("", name, content)
+}
+
+// LoadScriptFile loads a Lua script from a file path.
+func (e *LuaEngine) LoadScriptFile(path string) error {
+	return e.loadScriptFile("", path)
+}
+
+// LoadScriptDir loads all Lua scripts from a directory.
+func (e *LuaEngine) LoadScriptDir(dir string) error {
+	return e.loadScriptDir("", dir)
+}
+
+// ExecuteFunction runs the chain of handlers registered for a hook, funcName,
+// with the given arguments; see HookRegistry. A Lua function named funcName
+// is part of the chain, so functions that are not hooks are simply called.
+// Lua handlers run in one of the pooled states. Execution stops when ctx is
+// done, the timeout elapses or a handler exceeds one of its limits; the state
+// is then replaced. A failing handler is skipped, and its error is returned
+// only if every handler that ran failed. Functions cannot be called from
+// memory operations started by a running function.
+func (e *LuaEngine) ExecuteFunction(ctx context.Context, funcName string, args ...interface{}) (interface{}, error) {
 	log.DebugContext(ctx, "Executing Lua function", 
 		"function", funcName, 
 		"arg_count", len(args),
 	)
 	
-	// Get the function from global environment
-	fn := e.state.GetGlobal(funcName)
-	if fn.Type() != lua.LTFunction {
-		// Unlock before returning
-		e.mutex.Unlock()
+	// A function called from a memory operation would wait for a state held by its caller
+	if InScript(ctx) {
+		log.WarnContext(ctx, "Refusing to call Lua function from within a Lua function", "function", funcName)
+		return nil, fmt.Errorf("%w: %s", ErrReentrantCall, funcName)
+	}
+	
+	state, chain, err := e.acquireChain(ctx, funcName)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		e.release(state)
 		log.WarnContext(ctx, "Lua function not found", "function", funcName)
 		return nil, fmt.Errorf("%w: %s", ErrFunctionNotFound, funcName)
 	}
 	
-	// Convert arguments to Lua values before starting the goroutine
-	luaArgs, err := convertArgsToLua(e.state, args...)
+	spec := hookSpecFor(funcName)
+	startTime := time.Now()
+	args = append([]interface{}(nil), args...)
+	
+	var value interface{}
+	var errs []error
+	ran := 0
+	for i := 0; i < len(chain); i++ {
+		handler := chain[i]
+		var result interface{}
+		var stop bool
+		if handler.goFn != nil {
+			// Go handlers may use the MMU, which may need a state
+			if state != nil {
+				e.release(state)
+				state = nil
+			}
+			result, err = handler.goFn(ctx, args...)
+			if errors.Is(err, ErrStopChain) {
+				stop, err = true, nil
+			}
+		} else {
+			if state == nil {
+				// Every state has the same handlers, so the chain is looked up again in the new one
+				var current []chainHandler
+				if state, current, err = e.acquireChain(ctx, funcName); err != nil {
+					return nil, err
+				}
+				var ok bool
+				if handler, ok = findHandler(current, handler.info); !ok {
+					continue
+				}
+			}
+			var kept bool
+			result, stop, kept, err = e.callHandler(ctx, state, funcName, handler, args)
+			if !kept {
+				state = nil
+			}
+		}
+		ran++
+		
+		if err != nil {
+			if ctx.Err() != nil {
+				if state != nil {
+					e.release(state)
+				}
+				return nil, ctx.Err()
+			}
+			if len(chain) > 1 {
+				log.WarnContext(ctx, "Hook handler failed, skipping it", 
+					"hook", funcName, 
+					"handler", handler.info.Name, 
+					"error", err,
+				)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		
+		switch spec.Mode {
+		case ChainPipe:
+			if result != nil {
+				var arg interface{}
+				value, arg = spec.combine(value, result)
+				if arg != nil && len(args) > 0 {
+					args[0] = arg
+				}
+			}
+		case ChainFirst:
+			if result != nil {
+				value, stop = result, true
+			}
+		}
+		if stop {
+			break
+		}
+	}
+	if state != nil {
+		e.release(state)
+	}
+	
+	if ran > 0 && len(errs) == ran {
+		if len(errs) == 1 {
+			return nil, errs[0]
+		}
+		return nil, errors.Join(errs...)
+	}
+	
+	log.DebugContext(ctx, "Lua function executed successfully", 
+		"function", funcName, 
+		"handlers", ran,
+		"execution_time_ms", time.Since(startTime).Milliseconds(),
+	)
+	return value, nil
+}
+
+// acquireChain takes a state from the pool and builds the chain of handlers
+// for a hook in it.
+func (e *LuaEngine) acquireChain(ctx context.Context, hook string) (*pooledState, []chainHandler, error) {
+	state, err := e.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain, err := e.buildChain(ctx, state, hook)
+	if err != nil {
+		e.replace(state)
+		log.ErrorContext(ctx, "Failed to load entity scripts", "function", hook, "error", err)
+		return nil, nil, err
+	}
+	return state, chain, nil
+}
+
+// callHandler calls a Lua handler of a hook in a state. It reports whether
+// the state was kept; a state whose handler was interrupted or exceeded its
+// limits is replaced, since it may have been stopped mid-update. A handler
+// ends the chain by returning cogmem.hooks.stop(value).
+func (e *LuaEngine) callHandler(ctx context.Context, state *pooledState, funcName string, handler chainHandler, args []interface{}) (result interface{}, stop bool, kept bool, err error) {
+	L := state.L
+	
+	// Convert arguments to Lua values
+	luaArgs, err := convertArgsToLua(L, args...)
 	if err != nil {
-		// Unlock before returning
-		e.mutex.Unlock()
 		log.ErrorContext(ctx, "Error converting arguments to Lua", 
 			"function", funcName, 
 			"error", err,
 		)
-		return nil, err
+		return nil, false, true, err
 	}
 	
-	// Create a channel to handle timeout
-	done := make(chan struct{})
-	resultCh := make(chan lua.LValue, 1)
-	errCh := make(chan error, 1)
-	
-	startTime := time.Now()
+	limits := e.config.limitsFor(funcName)
 	
 	// Push context to Lua state
-	pushContext(e.state, ctx)
-	
-	// Create a new mutex that we'll use just for this execution
-	// to avoid blocking other operations if this one times out
-	execMutex := &sync.Mutex{}
-	execMutex.Lock()
-	
-	// Execute the function in a goroutine
-	go func() {
-		defer close(done)
-		defer e.mutex.Unlock() // Always unlock the main mutex
-		defer execMutex.Unlock() // Signal that execution is complete
-		
-		// Call the function
-		err := e.state.CallByParam(lua.P{
-			Fn:      fn,
-			NRet:    1,
-			Protect: true,
-		}, luaArgs...)
-		
-		if err != nil {
-			log.ErrorContext(ctx, "Error executing Lua function", 
-				"function", funcName, 
-				"error", err,
-			)
-			errCh <- err
-			return
-		}
-		
-		// Get the result
-		var result lua.LValue
-		if e.state.GetTop() > 0 {
-			result = e.state.Get(-1)
-			e.state.Pop(1)
+	pushContext(L, ctx)
+	
+	// Call the function; the VM checks the limits between instructions
+	limitCtx, done := newLimitContext(ctx, L, limits)
+	defer done()
+	L.SetContext(limitCtx)
+	err = L.CallByParam(lua.P{
+		Fn:      handler.luaFn,
+		NRet:    1,
+		Protect: true,
+	}, luaArgs...)
+	L.RemoveContext()
+	
+	if limitErr := limitCtx.limitErr(); limitErr != nil || isOverflowError(err) {
+		// The state may hold what the function allocated, so it is not reused
+		e.replace(state)
+		if limitErr == nil {
+			limitErr = ErrMemoryLimit
 		}
-		resultCh <- result
-	}()
+		log.ErrorContext(ctx, "Lua function exceeded its resource limits", 
+			"function", funcName, 
+			"handler", handler.info.Name,
+			"max_memory_mb", limits.MaxMemoryMB,
+			"max_instructions", limits.MaxInstructions,
+			"max_memory_ops", limits.MaxMemoryOps,
+			"max_llm_calls", limits.MaxLLMCalls,
+			"max_llm_tokens", limits.MaxLLMTokens,
+			"error", err,
+		)
+		return nil, false, false, fmt.Errorf("%w: %s", limitErr, funcName)
+	}
 	
-	// Wait for execution to complete or timeout
-	select {
-	case <-done:
-		// Wait for execution mutex to be unlocked (should already be unlocked)
-		execMutex.Lock()
-		execMutex.Unlock()
-		
-		// Check for errors
-		select {
-		case err := <-errCh:
-			return nil, err
-		case result := <-resultCh:
-			executionTime := time.Since(startTime)
-			log.DebugContext(ctx, "Lua function executed successfully", 
+	if limitCtx.Err() != nil {
+		// The function was interrupted and may have left the state half-updated
+		e.replace(state)
+		if ctx.Err() != nil {
+			log.WarnContext(ctx, "Lua function execution canceled by context", 
 				"function", funcName, 
-				"execution_time_ms", executionTime.Milliseconds(),
+				"error", ctx.Err(),
 			)
-			return convertLuaToGo(result), nil
-		default:
-			return nil, errors.New("lua function execution completed without result or error")
+			return nil, false, false, ctx.Err()
 		}
-	case <-time.After(time.Duration(e.config.ScriptTimeoutMs) * time.Millisecond):
-		// Force unlock the execution mutex to indicate timeout
-		execMutex.Unlock()
-		
-		// For testing purposes, let's create a new goroutine to handle the cleanup
-		// after the timeout. This avoids deadlocks when the main goroutine is blocked.
-		// In production code, you'd want a more robust mechanism.
-		go func() {
-			// Wait a bit to let the execution goroutine reach a safe point
-			time.Sleep(100 * time.Millisecond)
-			
-			// Try to cancel the operation or clean up state
-			// This is a simplified approach - in production, consider 
-			// using a separate Lua state for each function execution
-			
-			// The main mutex might still be locked - we'll try to unlock it
-			// but ignore errors if it's already been unlocked
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Error("Recovered from panic while unlocking mutex after timeout", "error", r)
-					}
-				}()
-				e.mutex.Unlock()
-			}()
-		}()
-		
 		log.ErrorContext(ctx, "Lua function execution timed out", 
 			"function", funcName, 
-			"timeout_ms", e.config.ScriptTimeoutMs,
+			"handler", handler.info.Name,
+			"timeout_ms", limits.ScriptTimeoutMs,
 		)
-		return nil, ErrExecutionTimeout
-	case <-ctx.Done():
-		// Similar approach for context cancellation
-		execMutex.Unlock()
-		
-		go func() {
-			time.Sleep(100 * time.Millisecond)
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Error("Recovered from panic while unlocking mutex after context cancellation", "error", r)
-					}
-				}()
-				e.mutex.Unlock()
-			}()
-		}()
-		
-		log.WarnContext(ctx, "Lua function execution canceled by context", 
+		return nil, false, false, ErrExecutionTimeout
+	}
+	
+	if err != nil {
+		log.ErrorContext(ctx, "Error executing Lua function", 
 			"function", funcName, 
-			"error", ctx.Err(),
+			"handler", handler.info.Name,
+			"error", err,
 		)
-		return nil, ctx.Err()
+		return nil, false, true, err
+	}
+	
+	// Get the result
+	value := L.Get(-1)
+	L.Pop(1)
+	if stopped, ok := toHookStop(value); ok {
+		value, stop = stopped, true
 	}
+	return convertLuaToGo(value), stop, true, nil
 }
 
-// Close releases resources associated with the engine.
+// Close releases resources associated with the engine. States in use are
+// closed when their functions return.
 func (e *LuaEngine) Close() error {
 	e.mutex.Lock()
-	defer e.mutex.Unlock()
+	if e.isClosed {
+		e.mutex.Unlock()
+		return nil
+	}
+	e.isClosed = true
+	close(e.closed)
+	e.mutex.Unlock()
 	
-	e.state.Close()
-	return nil
+	for {
+		select {
+		case state := <-e.pool:
+			state.L.Close()
+		default:
+			return nil
+		}
+	}
 }
 
 // Helper function to convert Go values to Lua values
@@ -386,6 +788,9 @@ func convertToLua(L *lua.LState, val interface{}) (lua.LValue, error) {
 		return lua.LNumber(v), nil
 	case bool:
 		return lua.LBool(v), nil
+	case []float32:
+		// Vectors stay in Go, wrapped in userdata
+		return newVec(L, append([]float32(nil), v...)), nil
 	case []interface{}:
 		tbl := L.NewTable()
 		for i, item := range v {
@@ -395,6 +800,8 @@ func convertToLua(L *lua.LState, val interface{}) (lua.LValue, error) {
 			}
 			tbl.RawSetInt(i+1, lv)
 		}
+		// Mark the table so that it stays an array when empty
+		tbl.Metatable = arrayMetatable(L)
 		return tbl, nil
 	case map[string]interface{}:
 		tbl := L.NewTable()
@@ -407,7 +814,12 @@ func convertToLua(L *lua.LState, val interface{}) (lua.LValue, error) {
 		}
 		return tbl, nil
 	default:
-		return nil, fmt.Errorf("%w: unsupported type %T", ErrInvalidArgument, val)
+		// Other types go through the registered marshalers and reflection
+		plain, err := toLua(reflect.ValueOf(val))
+		if err != nil {
+			return nil, err
+		}
+		return convertToLua(L, plain)
 	}
 }
 
@@ -425,7 +837,7 @@ func convertLuaToGo(lv lua.LValue) interface{} {
 	case *lua.LTable:
 		// Check if it's an array-like table
 		maxn := v.MaxN()
-		if maxn > 0 {
+		if maxn > 0 || isMarkedArray(v) {
 			slice := make([]interface{}, 0, maxn)
 			for i := 1; i <= maxn; i++ {
 				item := v.RawGetInt(i)
@@ -444,22 +856,15 @@ func convertLuaToGo(lv lua.LValue) interface{} {
 			}
 		})
 		return result
+	case *lua.LUserData:
+		if v.Value == jsonNull {
+			return nil
+		}
+		if vec, ok := toVec(v); ok {
+			return append([]float32(nil), vec...)
+		}
+		return fmt.Sprintf("unsupported Lua type: %s", lv.Type().String())
 	default:
 		return fmt.Sprintf("unsupported Lua type: %s", lv.Type().String())
 	}
 }
-
-// Helper function to push context to Lua state
-func pushContext(L *lua.LState, ctx context.Context) {
-	// Create a context table
-	ctxTable := L.NewTable()
-	
-	// You can add context values here if needed
-	// For example, adding a deadline
-	if deadline, ok := ctx.Deadline(); ok {
-		L.SetField(ctxTable, "deadline", lua.LNumber(deadline.Unix()))
-	}
-	
-	// Set the context in global environment
-	L.SetGlobal("ctx", ctxTable)
-}
\ No newline at end of file
@@ -2,9 +2,12 @@ package scripting
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -123,14 +126,127 @@ func TestLuaEngine_ExecuteFunction(t *testing.T) {
 		assert.ErrorIs(t, err, ErrFunctionNotFound)
 	})
 
-	// Skip timeout test for now
+	// Test a function that runs past the script timeout
 	t.Run("timeout", func(t *testing.T) {
-		t.Skip("Skipping timeout test due to unreliable execution timing")
+		config := DefaultConfig()
+		config.ScriptTimeoutMs = 50
+		config.PoolSize = 1
+		engine, err := NewLuaEngine(config)
+		require.NoError(t, err)
+		defer engine.Close()
+
+		err = engine.LoadScript("loop", []byte(`
+			counter = 0
+			function spin()
+				while true do
+					counter = counter + 1
+				end
+			end
+			function get_counter()
+				return counter
+			end
+		`))
+		require.NoError(t, err)
+
+		start := time.Now()
+		_, err = engine.ExecuteFunction(context.Background(), "spin")
+		assert.ErrorIs(t, err, ErrExecutionTimeout)
+		assert.Less(t, time.Since(start), time.Second)
+
+		// The interrupted state is replaced by a fresh one with the scripts loaded
+		result, err := engine.ExecuteFunction(context.Background(), "get_counter")
+		assert.NoError(t, err)
+		assert.Equal(t, float64(0), result)
 	})
 
-	// Skip context cancellation test for now
+	// Test a function whose context is cancelled while it runs
 	t.Run("context cancellation", func(t *testing.T) {
-		t.Skip("Skipping context cancellation test due to unreliable execution timing")
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}()
+
+		_, err := engine.ExecuteFunction(ctx, "sleep", 1000000)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		result, err := engine.ExecuteFunction(context.Background(), "hello")
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello, World!", result)
+	})
+}
+
+func TestLuaEngine_Pool(t *testing.T) {
+	config := DefaultConfig()
+	config.PoolSize = 4
+	engine, err := NewLuaEngine(config)
+	require.NoError(t, err)
+
+	err = engine.LoadScript("first", []byte(`
+		function double(n)
+			return n * 2
+		end
+	`))
+	require.NoError(t, err)
+
+	// Test that functions run in parallel across the pooled states
+	t.Run("parallel execution", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 50)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				result, err := engine.ExecuteFunction(context.Background(), "double", n)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if result != float64(n*2) {
+					errs <- fmt.Errorf("double(%d) returned %v", n, result)
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Error(err)
+		}
+	})
+
+	// Test that scripts loaded later reach every state
+	t.Run("late script load", func(t *testing.T) {
+		err := engine.LoadScript("second", []byte(`
+			function triple(n)
+				return n * 3
+			end
+		`))
+		require.NoError(t, err)
+
+		for i := 0; i < config.PoolSize*2; i++ {
+			result, err := engine.ExecuteFunction(context.Background(), "triple", i)
+			require.NoError(t, err)
+			assert.Equal(t, float64(i*3), result)
+		}
+	})
+
+	// Test that a failing script is not loaded into the pool
+	t.Run("failing script", func(t *testing.T) {
+		err := engine.LoadScript("broken", []byte(`
+			function never() return 1 end
+			error("boom")
+		`))
+		assert.Error(t, err)
+
+		_, err = engine.ExecuteFunction(context.Background(), "never")
+		assert.ErrorIs(t, err, ErrFunctionNotFound)
+	})
+
+	// Test that a closed engine refuses calls
+	t.Run("closed engine", func(t *testing.T) {
+		require.NoError(t, engine.Close())
+		_, err := engine.ExecuteFunction(context.Background(), "double", 1)
+		assert.ErrorIs(t, err, ErrEngineClosed)
 	})
 }
 
@@ -0,0 +1,446 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/log"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Errors returned by the hook registry
+var (
+	// ErrStopChain is returned by a Go handler, with its result, to end the
+	// chain of a hook after it
+	ErrStopChain = errors.New("stop hook chain")
+	
+	ErrHandlerExists = errors.New("hook handler already registered")
+)
+
+// ChainMode says how the results of a hook's handlers are combined.
+type ChainMode int
+
+const (
+	// ChainPipe passes each handler's result on to the next handler as its
+	// first argument. A nil result leaves the value unchanged. The hook's
+	// result is the last value, or nil if no handler changed it.
+	ChainPipe ChainMode = iota
+	
+	// ChainFirst ends the chain at the first handler that returns a value
+	// other than nil, which is the hook's result.
+	ChainFirst
+	
+	// ChainNotify calls every handler with the same arguments and ignores
+	// their results.
+	ChainNotify
+)
+
+// HookSpec describes how the handlers of a hook are chained.
+type HookSpec struct {
+	// Mode says how the results of the handlers are combined
+	Mode ChainMode
+	
+	// Combine merges a handler's result into the value passed along a
+	// ChainPipe chain, which is nil before the first result. It returns the
+	// new value and the first argument for the next handler, or nil to keep
+	// the current one. By default a result replaces both.
+	Combine func(value, result interface{}) (next interface{}, arg interface{})
+}
+
+// combine merges a handler's result into the chain's value.
+func (s HookSpec) combine(value, result interface{}) (interface{}, interface{}) {
+	if s.Combine == nil {
+		return result, result
+	}
+	return s.Combine(value, result)
+}
+
+var (
+	hookSpecsMutex sync.RWMutex
+	hookSpecs      = map[string]HookSpec{}
+)
+
+// DeclareHook declares how the handlers of a hook are chained. Hooks that are
+// not declared use ChainPipe. Packages that call hooks declare them in init.
+func DeclareHook(name string, spec HookSpec) {
+	hookSpecsMutex.Lock()
+	defer hookSpecsMutex.Unlock()
+	hookSpecs[name] = spec
+}
+
+func hookSpecFor(name string) HookSpec {
+	hookSpecsMutex.RLock()
+	defer hookSpecsMutex.RUnlock()
+	return hookSpecs[name]
+}
+
+func declaredHooks() []string {
+	hookSpecsMutex.RLock()
+	defer hookSpecsMutex.RUnlock()
+	names := make([]string, 0, len(hookSpecs))
+	for name := range hookSpecs {
+		names = append(names, name)
+	}
+	return names
+}
+
+// HookHandler is a Go function registered for a hook. It receives the hook's
+// arguments, the first of which is the result of the previous handler in a
+// ChainPipe chain that changed it. Results from Lua handlers are plain values
+// (see Unmarshal). A handler returns nil to leave the value unchanged, and
+// ErrStopChain to end the chain.
+type HookHandler func(ctx context.Context, args ...interface{}) (interface{}, error)
+
+// HookHandlerInfo describes a handler registered for a hook.
+type HookHandlerInfo struct {
+	// Hook is the name of the hook
+	Hook string
+	
+	// Name identifies the handler among the hook's handlers
+	Name string
+	
+	// Priority orders the chain; handlers with higher priorities run first
+	Priority int
+	
+	// Lua is true for handlers defined by scripts and false for Go handlers
+	Lua bool
+	
+	// Script is the script that registered a Lua handler, if known
+	Script string
+	
+	// EntityID is set for handlers from an entity's scripts
+	EntityID entity.EntityID
+}
+
+// HookRegistry is implemented by engines that run hooks as chains of
+// handlers. A hook's handlers are the Go handlers registered for it, the Lua
+// handlers scripts registered with cogmem.hooks.register, and a Lua function
+// named after the hook, which has priority 0. Handlers with equal priority
+// run in that order, Lua handlers from the global scripts before those of the
+// caller's entity. A handler from an entity's scripts replaces a global one
+// of the same name. How results pass along the chain depends on the hook's
+// HookSpec. A failing handler is logged and skipped.
+type HookRegistry interface {
+	// RegisterHookHandler adds a Go handler to a hook
+	RegisterHookHandler(hook, name string, priority int, handler HookHandler) error
+	
+	// UnregisterHookHandler removes a Go handler, reporting whether it was registered
+	UnregisterHookHandler(hook, name string) bool
+	
+	// HookHandlers lists the handlers of a hook for the caller's entity, in call order
+	HookHandlers(ctx context.Context, hook string) ([]HookHandlerInfo, error)
+	
+	// ListHooks lists the handlers of every hook that has any for the caller's entity
+	ListHooks(ctx context.Context) (map[string][]HookHandlerInfo, error)
+}
+
+// goHandler is a Go function registered for a hook.
+type goHandler struct {
+	info HookHandlerInfo
+	fn   HookHandler
+}
+
+// luaHandler is a Lua function a script registered for a hook in one state.
+type luaHandler struct {
+	info HookHandlerInfo
+	fn   *lua.LFunction
+}
+
+// luaHooks holds the Lua handlers registered in a state by one layer of
+// scripts: the global scripts, or an entity's.
+type luaHooks struct {
+	entityID entity.EntityID
+	handlers map[string][]*luaHandler
+	count    int
+}
+
+func newLuaHooks(entityID entity.EntityID) *luaHooks {
+	return &luaHooks{entityID: entityID, handlers: make(map[string][]*luaHandler)}
+}
+
+// scriptLoad is the script a state is running while it loads.
+type scriptLoad struct {
+	script string
+	hooks  *luaHooks
+}
+
+// chainHandler is one handler in the chain of a hook call.
+type chainHandler struct {
+	info  HookHandlerInfo
+	goFn  HookHandler
+	luaFn *lua.LFunction
+}
+
+// RegisterHookHandler implements the HookRegistry interface.
+func (e *LuaEngine) RegisterHookHandler(hook, name string, priority int, handler HookHandler) error {
+	if hook == "" || name == "" || handler == nil {
+		return fmt.Errorf("%w: hook handler needs a hook, a name and a function", ErrInvalidArgument)
+	}
+	
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, registered := range e.handlers[hook] {
+		if registered.info.Name == name {
+			return fmt.Errorf("%w: %s for %s", ErrHandlerExists, name, hook)
+		}
+	}
+	e.handlers[hook] = append(e.handlers[hook], &goHandler{
+		info: HookHandlerInfo{Hook: hook, Name: name, Priority: priority},
+		fn:   handler,
+	})
+	
+	log.Debug("Registered Go hook handler", "hook", hook, "handler", name, "priority", priority)
+	return nil
+}
+
+// UnregisterHookHandler implements the HookRegistry interface.
+func (e *LuaEngine) UnregisterHookHandler(hook, name string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	
+	handlers := e.handlers[hook]
+	for i, registered := range handlers {
+		if registered.info.Name == name {
+			// Chains being built keep their copy of the list
+			remaining := append(append([]*goHandler(nil), handlers[:i]...), handlers[i+1:]...)
+			if len(remaining) == 0 {
+				delete(e.handlers, hook)
+			} else {
+				e.handlers[hook] = remaining
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// HookHandlers implements the HookRegistry interface.
+func (e *LuaEngine) HookHandlers(ctx context.Context, hook string) ([]HookHandlerInfo, error) {
+	hooks, err := e.inspectHooks(ctx, []string{hook})
+	if err != nil {
+		return nil, err
+	}
+	return hooks[hook], nil
+}
+
+// ListHooks implements the HookRegistry interface.
+func (e *LuaEngine) ListHooks(ctx context.Context) (map[string][]HookHandlerInfo, error) {
+	return e.inspectHooks(ctx, nil)
+}
+
+// inspectHooks describes the chains of the given hooks, or of all hooks with
+// handlers if names is nil, as the caller would run them.
+func (e *LuaEngine) inspectHooks(ctx context.Context, names []string) (map[string][]HookHandlerInfo, error) {
+	state, err := e.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	env, err := e.callerEnv(ctx, state)
+	if err != nil {
+		e.replace(state)
+		return nil, err
+	}
+	
+	if names == nil {
+		seen := make(map[string]bool)
+		add := func(name string) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		// Declared hooks may be handled by functions named after them
+		for _, name := range declaredHooks() {
+			add(name)
+		}
+		e.mutex.RLock()
+		for name := range e.handlers {
+			add(name)
+		}
+		e.mutex.RUnlock()
+		for name := range state.hooks.handlers {
+			add(name)
+		}
+		if env != nil {
+			for name := range env.hooks.handlers {
+				add(name)
+			}
+		}
+	}
+	
+	hooks := make(map[string][]HookHandlerInfo)
+	for _, name := range names {
+		chain := e.chainIn(state, env, name)
+		if len(chain) == 0 {
+			continue
+		}
+		infos := make([]HookHandlerInfo, len(chain))
+		for i, handler := range chain {
+			infos[i] = handler.info
+		}
+		hooks[name] = infos
+	}
+	e.release(state)
+	return hooks, nil
+}
+
+// buildChain returns the handlers to run for a hook called with ctx, in order.
+func (e *LuaEngine) buildChain(ctx context.Context, state *pooledState, hook string) ([]chainHandler, error) {
+	env, err := e.callerEnv(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	return e.chainIn(state, env, hook), nil
+}
+
+// chainIn returns the handlers of a hook in a state, for a caller whose
+// entity's scripts have env, which is nil for callers without any.
+func (e *LuaEngine) chainIn(state *pooledState, env *entityEnv, hook string) []chainHandler {
+	var chain []chainHandler
+	
+	e.mutex.RLock()
+	for _, handler := range e.handlers[hook] {
+		chain = append(chain, chainHandler{info: handler.info, goFn: handler.fn})
+	}
+	e.mutex.RUnlock()
+	
+	// The function named after the hook, the entity's own if it defines one
+	named := HookHandlerInfo{Hook: hook, Name: hook, Lua: true}
+	var fn lua.LValue = lua.LNil
+	if env != nil {
+		fn = env.table.RawGetString(hook)
+		named.EntityID = env.hooks.entityID
+	}
+	if fn.Type() != lua.LTFunction {
+		fn = state.L.GetGlobal(hook)
+		named.EntityID = ""
+	}
+	if fn, ok := fn.(*lua.LFunction); ok {
+		chain = append(chain, chainHandler{info: named, luaFn: fn})
+	}
+	
+	var overrides map[string]bool
+	if env != nil {
+		overrides = make(map[string]bool)
+		for _, handler := range env.hooks.handlers[hook] {
+			overrides[handler.info.Name] = true
+		}
+	}
+	for _, handler := range state.hooks.handlers[hook] {
+		if !overrides[handler.info.Name] {
+			chain = append(chain, chainHandler{info: handler.info, luaFn: handler.fn})
+		}
+	}
+	if env != nil {
+		for _, handler := range env.hooks.handlers[hook] {
+			chain = append(chain, chainHandler{info: handler.info, luaFn: handler.fn})
+		}
+	}
+	
+	sort.SliceStable(chain, func(i, j int) bool {
+		return chain[i].info.Priority > chain[j].info.Priority
+	})
+	return chain
+}
+
+// findHandler finds a handler in a chain by its description.
+func findHandler(chain []chainHandler, info HookHandlerInfo) (chainHandler, bool) {
+	for _, handler := range chain {
+		if handler.info == info {
+			return handler, true
+		}
+	}
+	return chainHandler{}, false
+}
+
+// hookStop is the value of the userdata cogmem.hooks.stop returns.
+type hookStop struct {
+	value lua.LValue
+}
+
+// toHookStop unwraps the result of cogmem.hooks.stop.
+func toHookStop(lv lua.LValue) (lua.LValue, bool) {
+	ud, ok := lv.(*lua.LUserData)
+	if !ok {
+		return nil, false
+	}
+	stop, ok := ud.Value.(hookStop)
+	return stop.value, ok
+}
+
+// registerHookFunctions adds the cogmem.hooks table to a Lua state.
+func registerHookFunctions(L *lua.LState) {
+	cogmem, ok := L.GetGlobal("cogmem").(*lua.LTable)
+	if !ok {
+		return
+	}
+	
+	hooks := L.NewTable()
+	L.SetField(hooks, "register", L.NewFunction(apiHooksRegister))
+	L.SetField(hooks, "stop", L.NewFunction(apiHooksStop))
+	L.SetField(cogmem, "hooks", hooks)
+}
+
+// apiHooksRegister registers a function as a handler of a hook. The optional
+// table may set priority (default 0) and name, which defaults to the script's
+// name and the number of the registration. Handlers can only be registered
+// while a script loads. Returns the handler's name.
+func apiHooksRegister(L *lua.LState) int {
+	hook := L.CheckString(1)
+	fn := L.CheckFunction(2)
+	opts := L.OptTable(3, nil)
+	
+	limitCtx, ok := L.Context().(*limitContext)
+	if !ok || limitCtx.load == nil {
+		L.RaiseError("hook handlers can only be registered while a script loads")
+		return 0
+	}
+	load := limitCtx.load
+	load.hooks.count++
+	
+	info := HookHandlerInfo{
+		Hook:     hook,
+		Name:     fmt.Sprintf("%s#%d", load.script, load.hooks.count),
+		Lua:      true,
+		Script:   load.script,
+		EntityID: load.hooks.entityID,
+	}
+	if opts != nil {
+		if v, ok := opts.RawGetString("priority").(lua.LNumber); ok {
+			info.Priority = int(v)
+		}
+		if v, ok := opts.RawGetString("name").(lua.LString); ok && v != "" {
+			info.Name = string(v)
+		}
+	}
+	
+	handler := &luaHandler{info: info, fn: fn}
+	handlers := load.hooks.handlers[hook]
+	replaced := false
+	for i, registered := range handlers {
+		if registered.info.Name == info.Name {
+			log.Warn("Lua script replaces a hook handler registered earlier", 
+				withEntity(info.EntityID, "hook", hook, "handler", info.Name, "name", load.script)...)
+			handlers[i] = handler
+			replaced = true
+		}
+	}
+	if !replaced {
+		load.hooks.handlers[hook] = append(handlers, handler)
+	}
+	
+	L.Push(lua.LString(info.Name))
+	return 1
+}
+
+// apiHooksStop wraps a handler's result to end the chain after the handler.
+func apiHooksStop(L *lua.LState) int {
+	ud := L.NewUserData()
+	ud.Value = hookStop{value: L.Get(1)}
+	L.Push(ud)
+	return 1
+}
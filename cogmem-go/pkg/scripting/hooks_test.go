@@ -0,0 +1,269 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	DeclareHook("test_first", HookSpec{Mode: ChainFirst})
+	DeclareHook("test_notify", HookSpec{Mode: ChainNotify})
+}
+
+const hookChainScript = `
+	notified = {}
+	
+	-- The function named after the hook has priority 0
+	function test_pipe(value)
+		return value .. " named"
+	end
+	
+	cogmem.hooks.register("test_pipe", function(value)
+		return value .. " high"
+	end, {priority = 10, name = "high"})
+	
+	cogmem.hooks.register("test_pipe", function(value)
+		return nil
+	end, {priority = 5, name = "unchanged"})
+	
+	cogmem.hooks.register("test_pipe", function(value)
+		return value .. " low"
+	end, {priority = -10})
+	
+	cogmem.hooks.register("test_stop", function(value)
+		return cogmem.hooks.stop(value .. " stopped")
+	end, {priority = 1, name = "stopper"})
+	
+	cogmem.hooks.register("test_stop", function(value)
+		return value .. " never"
+	end, {name = "after_stop"})
+	
+	cogmem.hooks.register("test_first", function(value)
+		return nil
+	end, {priority = 2, name = "undecided"})
+	
+	cogmem.hooks.register("test_first", function(value)
+		return "decided"
+	end, {priority = 1, name = "decider"})
+	
+	cogmem.hooks.register("test_first", function(value)
+		return "too late"
+	end, {name = "late"})
+	
+	cogmem.hooks.register("test_errors", function(value)
+		error("broken handler")
+	end, {priority = 1, name = "broken"})
+	
+	cogmem.hooks.register("test_errors", function(value)
+		return value .. " survived"
+	end, {name = "survivor"})
+	
+	cogmem.hooks.register("test_all_fail", function(value)
+		error("first failure")
+	end, {name = "first"})
+	
+	cogmem.hooks.register("test_all_fail", function(value)
+		error("second failure")
+	end, {name = "second"})
+	
+	cogmem.hooks.register("test_runaway", function(value)
+		while true do end
+	end, {priority = 1, name = "runaway"})
+	
+	cogmem.hooks.register("test_runaway", function(value)
+		return value .. " recovered"
+	end, {name = "after_runaway"})
+	
+	function register_late()
+		cogmem.hooks.register("test_pipe", function(value) return value end)
+	end
+`
+
+func TestLuaEngine_HookChains(t *testing.T) {
+	config := DefaultConfig()
+	config.PoolSize = 2
+	config.MaxInstructions = 100000
+	engine, err := NewLuaEngine(config)
+	require.NoError(t, err)
+	defer engine.Close()
+	require.NoError(t, engine.LoadScript("chains", []byte(hookChainScript)))
+	
+	ctx := context.Background()
+	
+	t.Run("Handlers pipe their results in priority order", func(t *testing.T) {
+		for i := 0; i < config.PoolSize*2; i++ {
+			result, err := engine.ExecuteFunction(ctx, "test_pipe", "start")
+			require.NoError(t, err)
+			assert.Equal(t, "start high named low", result)
+		}
+		
+		// Handlers registered without a name are named after their script
+		handlers, err := engine.HookHandlers(ctx, "test_pipe")
+		require.NoError(t, err)
+		var names []string
+		for _, handler := range handlers {
+			names = append(names, handler.Name)
+		}
+		assert.Equal(t, []string{"high", "unchanged", "test_pipe", "chains#3"}, names)
+	})
+	
+	t.Run("Go handlers join the chain", func(t *testing.T) {
+		var received interface{}
+		require.NoError(t, engine.RegisterHookHandler("test_pipe", "go", 7, func(ctx context.Context, args ...interface{}) (interface{}, error) {
+			received = args[0]
+			return args[0].(string) + " go", nil
+		}))
+		defer engine.UnregisterHookHandler("test_pipe", "go")
+		
+		result, err := engine.ExecuteFunction(ctx, "test_pipe", "start")
+		require.NoError(t, err)
+		assert.Equal(t, "start high", received)
+		assert.Equal(t, "start high go named low", result)
+		
+		err = engine.RegisterHookHandler("test_pipe", "go", 0, func(ctx context.Context, args ...interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		assert.ErrorIs(t, err, ErrHandlerExists)
+	})
+	
+	t.Run("Handlers can stop the chain", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "test_stop", "start")
+		require.NoError(t, err)
+		assert.Equal(t, "start stopped", result)
+		
+		require.NoError(t, engine.RegisterHookHandler("test_stop", "go_stopper", 2, func(ctx context.Context, args ...interface{}) (interface{}, error) {
+			return "go stopped", ErrStopChain
+		}))
+		defer engine.UnregisterHookHandler("test_stop", "go_stopper")
+		result, err = engine.ExecuteFunction(ctx, "test_stop", "start")
+		require.NoError(t, err)
+		assert.Equal(t, "go stopped", result)
+	})
+	
+	t.Run("First result mode", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "test_first", "start")
+		require.NoError(t, err)
+		assert.Equal(t, "decided", result)
+	})
+	
+	t.Run("Notify mode ignores results", func(t *testing.T) {
+		calls := 0
+		for _, name := range []string{"one", "two"} {
+			require.NoError(t, engine.RegisterHookHandler("test_notify", name, 0, func(ctx context.Context, args ...interface{}) (interface{}, error) {
+				calls++
+				assert.Equal(t, "event", args[0])
+				return "ignored", nil
+			}))
+		}
+		
+		result, err := engine.ExecuteFunction(ctx, "test_notify", "event")
+		require.NoError(t, err)
+		assert.Nil(t, result)
+		assert.Equal(t, 2, calls)
+	})
+	
+	t.Run("Failing handlers are skipped", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "test_errors", "start")
+		require.NoError(t, err)
+		assert.Equal(t, "start survived", result)
+		
+		result, err = engine.ExecuteFunction(ctx, "test_runaway", "start")
+		require.NoError(t, err)
+		assert.Equal(t, "start recovered", result)
+	})
+	
+	t.Run("The error is returned when every handler fails", func(t *testing.T) {
+		_, err := engine.ExecuteFunction(ctx, "test_all_fail", "start")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "first failure")
+		assert.Contains(t, err.Error(), "second failure")
+		
+		require.NoError(t, engine.RegisterHookHandler("test_go_fail", "go", 0, func(ctx context.Context, args ...interface{}) (interface{}, error) {
+			return nil, errors.New("go failure")
+		}))
+		_, err = engine.ExecuteFunction(ctx, "test_go_fail")
+		assert.EqualError(t, err, "go failure")
+	})
+	
+	t.Run("Handlers can only be registered while loading", func(t *testing.T) {
+		_, err := engine.ExecuteFunction(ctx, "register_late")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "only be registered while a script loads")
+	})
+	
+	t.Run("Unknown hooks are not found", func(t *testing.T) {
+		_, err := engine.ExecuteFunction(ctx, "test_missing")
+		assert.ErrorIs(t, err, ErrFunctionNotFound)
+	})
+}
+
+func TestLuaEngine_HookHandlers(t *testing.T) {
+	engine, err := NewLuaEngine(DefaultConfig())
+	require.NoError(t, err)
+	defer engine.Close()
+	
+	require.NoError(t, engine.LoadScript("global", []byte(`
+		function test_pipe(value)
+			return value .. " global"
+		end
+		
+		cogmem.hooks.register("test_pipe", function(value)
+			return value .. " global filter"
+		end, {name = "filter", priority = 1})
+	`)))
+	require.NoError(t, engine.LoadEntityScript("tenant-a", "tenant", []byte(`
+		cogmem.hooks.register("test_pipe", function(value)
+			return value .. " tenant filter"
+		end, {name = "filter", priority = 1})
+		
+		cogmem.hooks.register("test_pipe", function(value)
+			return value .. " tenant extra"
+		end, {name = "extra", priority = -1})
+	`)))
+	require.NoError(t, engine.RegisterHookHandler("test_pipe", "audit", 5, func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		return nil, nil
+	}))
+	
+	tenantCtx := entity.ContextWithEntity(context.Background(), entity.NewContext("tenant-a", "user"))
+	
+	t.Run("Entity handlers replace global ones of the same name", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(tenantCtx, "test_pipe", "start")
+		require.NoError(t, err)
+		assert.Equal(t, "start tenant filter global tenant extra", result)
+		
+		result, err = engine.ExecuteFunction(context.Background(), "test_pipe", "start")
+		require.NoError(t, err)
+		assert.Equal(t, "start global filter global", result)
+	})
+	
+	t.Run("Handlers are listed in call order", func(t *testing.T) {
+		handlers, err := engine.HookHandlers(tenantCtx, "test_pipe")
+		require.NoError(t, err)
+		assert.Equal(t, []HookHandlerInfo{
+			{Hook: "test_pipe", Name: "audit", Priority: 5},
+			{Hook: "test_pipe", Name: "filter", Priority: 1, Lua: true, Script: "tenant", EntityID: "tenant-a"},
+			{Hook: "test_pipe", Name: "test_pipe", Lua: true},
+			{Hook: "test_pipe", Name: "extra", Priority: -1, Lua: true, Script: "tenant", EntityID: "tenant-a"},
+		}, handlers)
+		
+		hooks, err := engine.ListHooks(context.Background())
+		require.NoError(t, err)
+		require.Contains(t, hooks, "test_pipe")
+		assert.Len(t, hooks["test_pipe"], 3)
+		assert.Equal(t, "global", hooks["test_pipe"][1].Script)
+	})
+	
+	t.Run("Unregistered Go handlers leave the chain", func(t *testing.T) {
+		assert.True(t, engine.UnregisterHookHandler("test_pipe", "audit"))
+		assert.False(t, engine.UnregisterHookHandler("test_pipe", "audit"))
+		
+		handlers, err := engine.HookHandlers(context.Background(), "test_pipe")
+		require.NoError(t, err)
+		assert.Len(t, handlers, 2)
+	})
+}
@@ -0,0 +1,291 @@
+package scripting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// arrayMetatableName is the registry name of the metatable that marks a
+	// table as a JSON array, so that empty arrays keep their type
+	arrayMetatableName = "cogmem.json_array"
+	
+	// jsonTypeField is the metatable field holding the JSON type of a table
+	jsonTypeField = "__jsontype"
+	
+	// maxJSONDepth bounds the nesting of encoded and decoded values
+	maxJSONDepth = 1000
+	
+	// maxArrayGap is the number of missing elements an array may have beyond
+	// the number of elements it holds
+	maxArrayGap = 16
+)
+
+// jsonNullValue is the value of the cogmem.null userdata that stands for
+// JSON null, since a nil table field is indistinguishable from a missing one.
+type jsonNullValue struct{}
+
+var jsonNull = &jsonNullValue{}
+
+// JSON errors
+var (
+	ErrJSONCycle       = errors.New("cannot encode a table that contains itself")
+	ErrJSONUnsupported = errors.New("value cannot be encoded as JSON")
+	ErrJSONDepth       = errors.New("JSON nesting is too deep")
+)
+
+// newJSONNull creates the userdata for JSON null in a Lua state.
+func newJSONNull(L *lua.LState) *lua.LUserData {
+	null := L.NewUserData()
+	null.Value = jsonNull
+	return null
+}
+
+// isJSONNull reports whether a Lua value is cogmem.null.
+func isJSONNull(lv lua.LValue) bool {
+	ud, ok := lv.(*lua.LUserData)
+	return ok && ud.Value == jsonNull
+}
+
+// arrayMetatable returns the metatable that marks tables as JSON arrays.
+func arrayMetatable(L *lua.LState) *lua.LTable {
+	if mt, ok := L.GetTypeMetatable(arrayMetatableName).(*lua.LTable); ok {
+		return mt
+	}
+	mt := L.NewTypeMetatable(arrayMetatableName)
+	mt.RawSetString(jsonTypeField, lua.LString("array"))
+	return mt
+}
+
+// isMarkedArray reports whether a table carries the JSON array metatable.
+func isMarkedArray(tbl *lua.LTable) bool {
+	mt, ok := tbl.Metatable.(*lua.LTable)
+	return ok && mt.RawGetString(jsonTypeField) == lua.LString("array")
+}
+
+// arrayLength returns the length of a table that encodes as a JSON array:
+// one whose keys are 1..n, or, if it carries the array metatable, positive
+// integers with missing elements encoded as null.
+func arrayLength(tbl *lua.LTable) (int, bool) {
+	count, maxKey := 0, 0
+	integerKeys := true
+	tbl.ForEach(func(key, _ lua.LValue) {
+		count++
+		n, ok := key.(lua.LNumber)
+		if !ok || float64(n) != math.Trunc(float64(n)) || n < 1 || n > math.MaxInt32 {
+			integerKeys = false
+			return
+		}
+		if int(n) > maxKey {
+			maxKey = int(n)
+		}
+	})
+	
+	if !integerKeys {
+		return 0, false
+	}
+	if isMarkedArray(tbl) {
+		// Refuse to pad very sparse arrays with nulls
+		return maxKey, maxKey <= 2*count+maxArrayGap
+	}
+	return maxKey, count > 0 && count == maxKey
+}
+
+// encodeJSON encodes a Lua value as JSON. Tables whose keys are 1..n, or that
+// carry the array metatable, become arrays; other tables become objects with
+// string or number keys. cogmem.null becomes null.
+func encodeJSON(lv lua.LValue) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, lv, make(map[*lua.LTable]bool), 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeJSON(buf *bytes.Buffer, lv lua.LValue, active map[*lua.LTable]bool, depth int) error {
+	if depth > maxJSONDepth {
+		return ErrJSONDepth
+	}
+	
+	switch v := lv.(type) {
+	case *lua.LNilType:
+		buf.WriteString("null")
+	case lua.LBool:
+		buf.WriteString(strconv.FormatBool(bool(v)))
+	case lua.LNumber:
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Errorf("%w: %v", ErrJSONUnsupported, f)
+		}
+		encoded, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		buf.Write(encoded)
+	case lua.LString:
+		encoded, err := json.Marshal(string(v))
+		if err != nil {
+			return err
+		}
+		buf.Write(encoded)
+	case *lua.LTable:
+		if active[v] {
+			return ErrJSONCycle
+		}
+		active[v] = true
+		defer delete(active, v)
+		
+		if n, ok := arrayLength(v); ok {
+			return writeJSONArray(buf, v, n, active, depth)
+		}
+		return writeJSONObject(buf, v, active, depth)
+	case *lua.LUserData:
+		if v.Value == jsonNull {
+			buf.WriteString("null")
+			return nil
+		}
+		if vec, ok := toVec(v); ok {
+			buf.WriteByte('[')
+			for i, x := range vec {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				if err := writeJSON(buf, lua.LNumber(x), active, depth+1); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+			return nil
+		}
+		return fmt.Errorf("%w: userdata", ErrJSONUnsupported)
+	default:
+		return fmt.Errorf("%w: %s", ErrJSONUnsupported, lv.Type().String())
+	}
+	return nil
+}
+
+func writeJSONArray(buf *bytes.Buffer, tbl *lua.LTable, n int, active map[*lua.LTable]bool, depth int) error {
+	buf.WriteByte('[')
+	for i := 1; i <= n; i++ {
+		if i > 1 {
+			buf.WriteByte(',')
+		}
+		if err := writeJSON(buf, tbl.RawGet(lua.LNumber(i)), active, depth+1); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func writeJSONObject(buf *bytes.Buffer, tbl *lua.LTable, active map[*lua.LTable]bool, depth int) error {
+	// Keys are sorted so that the output is deterministic
+	fields := make(map[string]lua.LValue)
+	var keyErr error
+	tbl.ForEach(func(key, value lua.LValue) {
+		switch k := key.(type) {
+		case lua.LString:
+			fields[string(k)] = value
+		case lua.LNumber:
+			fields[k.String()] = value
+		default:
+			keyErr = fmt.Errorf("%w: %s key", ErrJSONUnsupported, key.Type().String())
+		}
+	})
+	if keyErr != nil {
+		return keyErr
+	}
+	
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		if err := writeJSON(buf, fields[key], active, depth+1); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// decodeJSON decodes a JSON document into a Lua value. Arrays carry the array
+// metatable and null becomes cogmem.null, so the value encodes back to the
+// same JSON.
+func decodeJSON(L *lua.LState, data []byte, null lua.LValue) (lua.LValue, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return jsonToLua(L, value, null, 0)
+}
+
+func jsonToLua(L *lua.LState, value interface{}, null lua.LValue, depth int) (lua.LValue, error) {
+	if depth > maxJSONDepth {
+		return nil, ErrJSONDepth
+	}
+	
+	switch v := value.(type) {
+	case nil:
+		return null, nil
+	case bool:
+		return lua.LBool(v), nil
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s: %w", v, err)
+		}
+		return lua.LNumber(f), nil
+	case string:
+		return lua.LString(v), nil
+	case []interface{}:
+		tbl := L.CreateTable(len(v), 0)
+		for i, item := range v {
+			lv, err := jsonToLua(L, item, null, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			tbl.RawSetInt(i+1, lv)
+		}
+		tbl.Metatable = arrayMetatable(L)
+		return tbl, nil
+	case map[string]interface{}:
+		tbl := L.CreateTable(0, len(v))
+		for key, item := range v {
+			lv, err := jsonToLua(L, item, null, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			tbl.RawSetString(key, lv)
+		}
+		return tbl, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrJSONUnsupported, value)
+	}
+}
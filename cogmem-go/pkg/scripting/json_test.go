@@ -0,0 +1,90 @@
+package scripting
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestJSON_ConvertRoundTrip(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	null := newJSONNull(L)
+	
+	documents := []string{
+		`{"name":"test","count":3,"tags":["a","b"],"nested":{"empty":[],"object":{}}}`,
+		`[1,2.5,-3,"four",true,false]`,
+		`{"list":[{"id":1},{"id":2}],"ratio":0.333}`,
+		`[]`,
+	}
+	
+	for _, document := range documents {
+		t.Run(document, func(t *testing.T) {
+			var expected interface{}
+			require.NoError(t, json.Unmarshal([]byte(document), &expected))
+			
+			// JSON decoded in Lua converts to the same Go value as encoding/json produces
+			decoded, err := decodeJSON(L, []byte(document), null)
+			require.NoError(t, err)
+			assert.Equal(t, expected, convertLuaToGo(decoded))
+			
+			// Go values passed to Lua encode to the same JSON as encoding/json produces
+			lv, err := convertToLua(L, expected)
+			require.NoError(t, err)
+			encoded, err := encodeJSON(lv)
+			require.NoError(t, err)
+			assert.JSONEq(t, document, string(encoded))
+		})
+	}
+}
+
+func TestJSON_Null(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	null := newJSONNull(L)
+	
+	decoded, err := decodeJSON(L, []byte(`{"a":null,"b":[null,1]}`), null)
+	require.NoError(t, err)
+	
+	// null survives in Lua as cogmem.null and becomes nil in Go
+	tbl := decoded.(*lua.LTable)
+	assert.True(t, isJSONNull(tbl.RawGetString("a")))
+	assert.Equal(t, map[string]interface{}{
+		"a": nil,
+		"b": []interface{}{nil, float64(1)},
+	}, convertLuaToGo(decoded))
+	
+	encoded, err := encodeJSON(decoded)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":null,"b":[null,1]}`, string(encoded))
+}
+
+func TestJSON_Errors(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	null := newJSONNull(L)
+	
+	_, err := decodeJSON(L, []byte(`{"a":1} {"b":2}`), null)
+	assert.Error(t, err)
+	
+	_, err = decodeJSON(L, []byte(`{"a":`), null)
+	assert.Error(t, err)
+	
+	cyclic := L.NewTable()
+	cyclic.RawSetString("self", cyclic)
+	_, err = encodeJSON(cyclic)
+	assert.ErrorIs(t, err, ErrJSONCycle)
+	
+	withFunction := L.NewTable()
+	withFunction.RawSetString("f", L.NewFunction(func(*lua.LState) int { return 0 }))
+	_, err = encodeJSON(withFunction)
+	assert.ErrorIs(t, err, ErrJSONUnsupported)
+	
+	withTableKey := L.NewTable()
+	withTableKey.RawSet(L.NewTable(), lua.LTrue)
+	_, err = encodeJSON(withTableKey)
+	assert.ErrorIs(t, err, ErrJSONUnsupported)
+}
@@ -0,0 +1,389 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ErrInstructionLimit is returned when a function runs more Lua instructions than allowed.
+var ErrInstructionLimit = errors.New("lua instruction limit exceeded")
+
+const (
+	// memoryCheckInterval is the number of instructions between allocation checks
+	memoryCheckInterval = 1000
+	
+	// minMemoryCheckBytes is the least process-wide allocation between two
+	// measurements of a state's memory
+	minMemoryCheckBytes = 256 * 1024
+	
+	// heapAllocsMetric is the cumulative number of bytes allocated by the process
+	heapAllocsMetric = "/gc/heap/allocs:bytes"
+)
+
+// Limits bounds the resources one function call may use. Zero values mean no limit.
+type Limits struct {
+	// ScriptTimeoutMs is the maximum execution time in milliseconds
+	ScriptTimeoutMs int
+	
+	// MaxMemoryMB is the maximum memory held by the Lua state in megabytes
+	MaxMemoryMB int
+	
+	// MaxInstructions is the maximum number of Lua VM instructions executed
+	MaxInstructions int64
+	
+	// MaxMemoryOps is the maximum number of cogmem.memory operations performed
+	MaxMemoryOps int
+	
+	// MaxLLMCalls is the maximum number of cogmem.llm calls made
+	MaxLLMCalls int
+	
+	// MaxLLMTokens is the maximum number of tokens sent to and generated by cogmem.llm calls
+	MaxLLMTokens int
+}
+
+// limitsFor returns the limits for a function: its entry in HookLimits, with
+// unset fields taken from the engine-wide settings.
+func (c Config) limitsFor(funcName string) Limits {
+	limits := Limits{
+		ScriptTimeoutMs: c.ScriptTimeoutMs,
+		MaxMemoryMB:     c.MaxMemoryMB,
+		MaxInstructions: c.MaxInstructions,
+		MaxMemoryOps:    c.MaxMemoryOps,
+		MaxLLMCalls:     c.MaxLLMCalls,
+		MaxLLMTokens:    c.MaxLLMTokens,
+	}
+	
+	hook, ok := c.HookLimits[funcName]
+	if !ok {
+		return limits
+	}
+	if hook.ScriptTimeoutMs > 0 {
+		limits.ScriptTimeoutMs = hook.ScriptTimeoutMs
+	}
+	if hook.MaxMemoryMB > 0 {
+		limits.MaxMemoryMB = hook.MaxMemoryMB
+	}
+	if hook.MaxInstructions > 0 {
+		limits.MaxInstructions = hook.MaxInstructions
+	}
+	if hook.MaxMemoryOps > 0 {
+		limits.MaxMemoryOps = hook.MaxMemoryOps
+	}
+	if hook.MaxLLMCalls > 0 {
+		limits.MaxLLMCalls = hook.MaxLLMCalls
+	}
+	if hook.MaxLLMTokens > 0 {
+		limits.MaxLLMTokens = hook.MaxLLMTokens
+	}
+	return limits
+}
+
+// limitContext is the context a Lua state runs under while executing a
+// function. The VM calls Done before every instruction, which is where
+// instructions are counted and memory is periodically measured.
+type limitContext struct {
+	context.Context
+	
+	L               *lua.LState
+	maxInstructions int64
+	maxMemory       int64
+	instructions    atomic.Int64
+	maxMemoryOps    int64
+	memoryOps       atomic.Int64
+	maxLLMCalls     int64
+	llmCalls        atomic.Int64
+	maxLLMTokens    int64
+	llmTokens       atomic.Int64
+	
+	// checkMutex serialises memory checks; allocs and checkBytes belong to it
+	checkMutex sync.Mutex
+	allocs     []metrics.Sample
+	lastAllocs uint64
+	checkBytes uint64
+	
+	done     chan struct{}
+	stopOnce sync.Once
+	err      atomic.Value
+	cancel   context.CancelFunc
+	release  func() bool
+	
+	// load is set while a script loads, and receives the hook handlers it registers
+	load *scriptLoad
+}
+
+// newLimitContext creates the context for running a function in L under the
+// given limits. The returned function releases its resources.
+func newLimitContext(parent context.Context, L *lua.LState, limits Limits) (*limitContext, func()) {
+	c := &limitContext{
+		L:               L,
+		maxInstructions: limits.MaxInstructions,
+		maxMemory:       int64(limits.MaxMemoryMB) * 1024 * 1024,
+		maxMemoryOps:    int64(limits.MaxMemoryOps),
+		maxLLMCalls:     int64(limits.MaxLLMCalls),
+		maxLLMTokens:    int64(limits.MaxLLMTokens),
+		done:            make(chan struct{}),
+	}
+	
+	if limits.ScriptTimeoutMs > 0 {
+		c.Context, c.cancel = context.WithTimeout(parent, time.Duration(limits.ScriptTimeoutMs)*time.Millisecond)
+	} else {
+		c.Context, c.cancel = context.WithCancel(parent)
+	}
+	c.release = context.AfterFunc(c.Context, func() {
+		c.stop(c.Context.Err())
+	})
+	
+	if c.maxMemory > 0 {
+		c.allocs = []metrics.Sample{{Name: heapAllocsMetric}}
+		c.lastAllocs = c.readAllocs()
+		c.checkBytes = uint64(c.maxMemory / 16)
+		if c.checkBytes < minMemoryCheckBytes {
+			c.checkBytes = minMemoryCheckBytes
+		}
+	}
+	
+	return c, func() {
+		c.release()
+		c.cancel()
+	}
+}
+
+// Done counts an instruction and reports whether execution must stop.
+func (c *limitContext) Done() <-chan struct{} {
+	n := c.instructions.Add(1)
+	if c.maxInstructions > 0 && n > c.maxInstructions {
+		c.stop(ErrInstructionLimit)
+	} else if c.maxMemory > 0 && n%memoryCheckInterval == 0 {
+		c.checkMemory()
+	}
+	return c.done
+}
+
+// Err returns the reason execution stopped.
+func (c *limitContext) Err() error {
+	if err, ok := c.err.Load().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// stop ends execution with the given reason; the first reason wins.
+func (c *limitContext) stop(err error) {
+	c.stopOnce.Do(func() {
+		c.err.Store(err)
+		close(c.done)
+	})
+}
+
+// limitErrors are the reasons execution stops when a function exceeds a limit
+var limitErrors = []error{ErrInstructionLimit, ErrMemoryLimit, ErrMemoryOpLimit, ErrLLMCallLimit, ErrLLMTokenLimit}
+
+// limitErr returns the limit that stopped execution, or nil if none did.
+func (c *limitContext) limitErr() error {
+	err := c.Err()
+	for _, limitErr := range limitErrors {
+		if errors.Is(err, limitErr) {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMemory measures the state's memory once enough has been allocated
+// since the last measurement, and stops execution if it is over the limit.
+func (c *limitContext) checkMemory() {
+	if !c.checkMutex.TryLock() {
+		return
+	}
+	defer c.checkMutex.Unlock()
+	
+	// Allocation is only known process-wide, so it just decides when to measure
+	allocs := c.readAllocs()
+	if allocs-c.lastAllocs < c.checkBytes {
+		return
+	}
+	c.lastAllocs = allocs
+	
+	if stateMemory(c.L) > c.maxMemory {
+		c.stop(ErrMemoryLimit)
+	}
+}
+
+// checkAllocation stops execution if allocating size more bytes would take
+// the state over its memory limit. Go functions that can allocate a lot in
+// a single call use it.
+func (c *limitContext) checkAllocation(size int64) bool {
+	if c.maxMemory <= 0 {
+		return true
+	}
+	if size > c.maxMemory || stateMemory(c.L)+size > c.maxMemory {
+		c.stop(ErrMemoryLimit)
+		return false
+	}
+	return true
+}
+
+// useMemoryOp counts a memory operation, and stops execution if the function
+// has used up its budget.
+func (c *limitContext) useMemoryOp() bool {
+	if c.maxMemoryOps > 0 && c.memoryOps.Add(1) > c.maxMemoryOps {
+		c.stop(ErrMemoryOpLimit)
+		return false
+	}
+	return true
+}
+
+// useLLMCall counts a reasoning engine call, and stops execution if the
+// function has used up its call budget.
+func (c *limitContext) useLLMCall() bool {
+	if c.maxLLMCalls > 0 && c.llmCalls.Add(1) > c.maxLLMCalls {
+		c.stop(ErrLLMCallLimit)
+		return false
+	}
+	return true
+}
+
+// useLLMTokens counts tokens sent to or generated by the reasoning engine,
+// and stops execution if the function has gone over its token budget.
+func (c *limitContext) useLLMTokens(n int) bool {
+	if c.maxLLMTokens > 0 && c.llmTokens.Add(int64(n)) > c.maxLLMTokens {
+		c.stop(ErrLLMTokenLimit)
+		return false
+	}
+	return true
+}
+
+// llmTokensLeft returns the tokens left in the function's budget, or -1 if it has none.
+func (c *limitContext) llmTokensLeft() int64 {
+	if c.maxLLMTokens <= 0 {
+		return -1
+	}
+	return max(c.maxLLMTokens-c.llmTokens.Load(), 0)
+}
+
+func (c *limitContext) readAllocs() uint64 {
+	metrics.Read(c.allocs)
+	if c.allocs[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return c.allocs[0].Value.Uint64()
+}
+
+// isOverflowError reports whether err is the VM running out of call stack or registry space.
+func isOverflowError(err error) bool {
+	var apiErr *lua.ApiError
+	if !errors.As(err, &apiErr) || apiErr.Object == nil {
+		return false
+	}
+	message := apiErr.Object.String()
+	return strings.Contains(message, "stack overflow") || strings.Contains(message, "registry overflow")
+}
+
+// Approximate sizes of Lua values in bytes
+const (
+	valueSize      = 16
+	tableSize      = 64
+	tableEntrySize = 40
+	functionSize   = 64
+)
+
+// stateMemory estimates the memory held by a Lua state by walking the values
+// reachable from its globals, registry and the locals of running functions.
+func stateMemory(L *lua.LState) int64 {
+	seen := make(map[lua.LValue]bool)
+	size := valueMemory(L, L.G.Global, seen) + valueMemory(L, L.G.Registry, seen)
+	
+	for level := 0; ; level++ {
+		dbg, ok := L.GetStack(level)
+		if !ok {
+			break
+		}
+		for n := 1; ; n++ {
+			name, value := L.GetLocal(dbg, n)
+			if name == "" {
+				break
+			}
+			size += valueMemory(L, value, seen)
+		}
+	}
+	return size
+}
+
+// valueMemory estimates the memory held by a value and the values it references.
+func valueMemory(L *lua.LState, value lua.LValue, seen map[lua.LValue]bool) int64 {
+	switch v := value.(type) {
+	case lua.LString:
+		return valueSize + int64(len(v))
+	case *lua.LTable:
+		if seen[v] {
+			return 0
+		}
+		seen[v] = true
+		size := int64(tableSize)
+		v.ForEach(func(key, val lua.LValue) {
+			size += tableEntrySize + valueMemory(L, key, seen) + valueMemory(L, val, seen)
+		})
+		return size + valueMemory(L, v.Metatable, seen)
+	case *lua.LFunction:
+		if seen[v] {
+			return 0
+		}
+		seen[v] = true
+		size := int64(functionSize)
+		for _, upvalue := range v.Upvalues {
+			if upvalue != nil {
+				size += valueSize + valueMemory(L, upvalue.Value(), seen)
+			}
+		}
+		return size + valueMemory(L, v.Env, seen)
+	case *lua.LUserData:
+		if seen[v] {
+			return 0
+		}
+		seen[v] = true
+		size := int64(functionSize)
+		if vec, ok := toVec(v); ok {
+			size += 4 * int64(len(vec))
+		}
+		return size + valueMemory(L, v.Metatable, seen)
+	default:
+		return valueSize
+	}
+}
+
+// limitedStringRep replaces string.rep, which can allocate any amount of
+// memory in one instruction, with a version that checks the memory limit first.
+func limitedStringRep(L *lua.LState) int {
+	str := L.CheckString(1)
+	n := L.CheckInt(2)
+	if n <= 0 || len(str) == 0 {
+		L.Push(lua.LString(""))
+		return 1
+	}
+	
+	size := int64(len(str)) * int64(n)
+	if c, ok := L.Context().(*limitContext); ok && !c.checkAllocation(size) {
+		L.RaiseError("%s", ErrMemoryLimit.Error())
+		return 0
+	}
+	
+	L.Push(lua.LString(strings.Repeat(str, n)))
+	return 1
+}
+
+// installLimitGuards replaces library functions that could bypass the limits.
+func installLimitGuards(L *lua.LState) {
+	if str, ok := L.GetGlobal("string").(*lua.LTable); ok {
+		str.RawSetString("rep", L.NewFunction(limitedStringRep))
+	}
+	
+	// Coroutines run under their own context, out of reach of the limits
+	L.SetGlobal("coroutine", lua.LNil)
+}
@@ -0,0 +1,146 @@
+package scripting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const limitsTestScript = `
+	function spin()
+		local counter = 0
+		while true do
+			counter = counter + 1
+		end
+	end
+	
+	function hoard()
+		local items = {}
+		for i = 1, 100000000 do
+			items[i] = string.format("item-%d-with-some-padding", i)
+		end
+		return #items
+	end
+	
+	function repeat_string(n)
+		return #string.rep("x", n)
+	end
+	
+	function recurse(n)
+		return recurse(n + 1) + 1
+	end
+	
+	function count_to(n)
+		local counter = 0
+		for i = 1, n do
+			counter = counter + 1
+		end
+		return counter
+	end
+	
+	function has_coroutines()
+		return coroutine ~= nil
+	end
+`
+
+func newLimitsTestEngine(t *testing.T, config Config) *LuaEngine {
+	engine, err := NewLuaEngine(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { engine.Close() })
+	
+	require.NoError(t, engine.LoadScript("limits", []byte(limitsTestScript)))
+	return engine
+}
+
+func TestLuaEngine_Limits(t *testing.T) {
+	config := DefaultConfig()
+	config.PoolSize = 1
+	config.ScriptTimeoutMs = 10000
+	config.MaxMemoryMB = 4
+	config.MaxInstructions = 1000000
+	engine := newLimitsTestEngine(t, config)
+	
+	t.Run("instruction limit", func(t *testing.T) {
+		_, err := engine.ExecuteFunction(context.Background(), "spin")
+		assert.ErrorIs(t, err, ErrInstructionLimit)
+		
+		// The state is replaced and the engine keeps working
+		result, err := engine.ExecuteFunction(context.Background(), "count_to", 10)
+		require.NoError(t, err)
+		assert.Equal(t, float64(10), result)
+	})
+	
+	t.Run("memory limit", func(t *testing.T) {
+		unlimited := config
+		unlimited.MaxInstructions = 0
+		engine := newLimitsTestEngine(t, unlimited)
+		
+		_, err := engine.ExecuteFunction(context.Background(), "hoard")
+		assert.ErrorIs(t, err, ErrMemoryLimit)
+		
+		result, err := engine.ExecuteFunction(context.Background(), "count_to", 10)
+		require.NoError(t, err)
+		assert.Equal(t, float64(10), result)
+	})
+	
+	t.Run("string.rep", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(context.Background(), "repeat_string", 1000)
+		require.NoError(t, err)
+		assert.Equal(t, float64(1000), result)
+		
+		_, err = engine.ExecuteFunction(context.Background(), "repeat_string", 1024*1024*1024)
+		assert.ErrorIs(t, err, ErrMemoryLimit)
+	})
+	
+	t.Run("call stack overflow", func(t *testing.T) {
+		_, err := engine.ExecuteFunction(context.Background(), "recurse", 1)
+		assert.ErrorIs(t, err, ErrMemoryLimit)
+	})
+	
+	t.Run("coroutines disabled", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(context.Background(), "has_coroutines")
+		require.NoError(t, err)
+		assert.Equal(t, false, result)
+	})
+	
+	t.Run("script load", func(t *testing.T) {
+		err := engine.LoadScript("endless", []byte(`while true do end`))
+		assert.ErrorIs(t, err, ErrInstructionLimit)
+	})
+}
+
+func TestLuaEngine_HookLimits(t *testing.T) {
+	config := DefaultConfig()
+	config.PoolSize = 1
+	config.MaxInstructions = 1000000
+	config.HookLimits = map[string]Limits{
+		"count_to": {MaxInstructions: 1000},
+	}
+	engine := newLimitsTestEngine(t, config)
+	
+	t.Run("tighter limit for hook", func(t *testing.T) {
+		_, err := engine.ExecuteFunction(context.Background(), "count_to", 10000)
+		assert.ErrorIs(t, err, ErrInstructionLimit)
+		
+		result, err := engine.ExecuteFunction(context.Background(), "count_to", 10)
+		require.NoError(t, err)
+		assert.Equal(t, float64(10), result)
+	})
+	
+	t.Run("defaults for other functions", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(context.Background(), "repeat_string", 10000)
+		require.NoError(t, err)
+		assert.Equal(t, float64(10000), result)
+	})
+	
+	t.Run("limits resolution", func(t *testing.T) {
+		limits := config.limitsFor("count_to")
+		assert.Equal(t, int64(1000), limits.MaxInstructions)
+		assert.Equal(t, config.MaxMemoryMB, limits.MaxMemoryMB)
+		assert.Equal(t, config.ScriptTimeoutMs, limits.ScriptTimeoutMs)
+		
+		assert.Equal(t, config.MaxInstructions, config.limitsFor("other").MaxInstructions)
+	})
+}
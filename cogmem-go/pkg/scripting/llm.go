@@ -0,0 +1,188 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lexlapax/cogmem/pkg/reasoning"
+	"github.com/lexlapax/cogmem/pkg/tokenizer"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Errors returned by the reasoning engine API
+var (
+	ErrReasoningUnavailable = errors.New("reasoning engine is not available")
+	ErrLLMCallLimit         = errors.New("lua llm call limit exceeded")
+	ErrLLMTokenLimit        = errors.New("lua llm token limit exceeded")
+)
+
+// ReasoningBinder is implemented by engines that can give scripts access to
+// a reasoning engine.
+type ReasoningBinder interface {
+	// SetReasoningEngine makes engine available to scripts as cogmem.llm
+	SetReasoningEngine(engine reasoning.Engine)
+}
+
+// boundReasoning holds the reasoning engine bound to an engine, with the
+// tokenizer used to count its tokens against the budgets.
+type boundReasoning struct {
+	engine    reasoning.Engine
+	tokenizer tokenizer.Tokenizer
+}
+
+// SetReasoningEngine implements the ReasoningBinder interface.
+func (e *LuaEngine) SetReasoningEngine(engine reasoning.Engine) {
+	if engine == nil {
+		e.reasoning.Store(nil)
+		return
+	}
+	e.reasoning.Store(&boundReasoning{
+		engine:    engine,
+		tokenizer: reasoning.TokenizerFor(engine),
+	})
+}
+
+// registerLLMFunctions adds the cogmem.llm table to a Lua state.
+func (e *LuaEngine) registerLLMFunctions(L *lua.LState) {
+	cogmem, ok := L.GetGlobal("cogmem").(*lua.LTable)
+	if !ok {
+		return
+	}
+	
+	llm := L.NewTable()
+	L.SetField(llm, "complete", L.NewFunction(e.apiLLMComplete))
+	L.SetField(llm, "embed", L.NewFunction(e.apiLLMEmbed))
+	L.SetField(cogmem, "llm", llm)
+}
+
+// llmCall returns the reasoning engine and the limits of the running
+// function, counting the call against its call budget. It raises a Lua error
+// once the budget is spent.
+func (e *LuaEngine) llmCall(L *lua.LState) (*boundReasoning, *limitContext, error) {
+	bound := e.reasoning.Load()
+	limitCtx, ok := L.Context().(*limitContext)
+	if bound == nil || !ok {
+		return nil, nil, ErrReasoningUnavailable
+	}
+	
+	if !limitCtx.useLLMCall() {
+		L.RaiseError("%s", ErrLLMCallLimit.Error())
+		return nil, nil, ErrLLMCallLimit
+	}
+	return bound, limitCtx, nil
+}
+
+// useLLMTokens counts tokens against the running function's budget, raising
+// a Lua error if it is exceeded.
+func useLLMTokens(L *lua.LState, limitCtx *limitContext, n int) {
+	if !limitCtx.useLLMTokens(n) {
+		L.RaiseError("%s", ErrLLMTokenLimit.Error())
+	}
+}
+
+// apiLLMComplete sends a prompt to the reasoning engine. The optional table
+// may set temperature, max_tokens, model and timeout_ms. max_tokens is capped
+// at what is left of the token budget once the prompt is counted.
+// Returns the response, or nil and an error message on failure.
+func (e *LuaEngine) apiLLMComplete(L *lua.LState) int {
+	prompt := L.CheckString(1)
+	optsTable := L.OptTable(2, nil)
+	
+	maxTokens := reasoning.DefaultOptions().MaxTokens
+	var opts []reasoning.Option
+	var timeout time.Duration
+	if optsTable != nil {
+		if v, ok := optsTable.RawGetString("temperature").(lua.LNumber); ok {
+			opts = append(opts, reasoning.WithTemperature(float64(v)))
+		}
+		if v, ok := optsTable.RawGetString("max_tokens").(lua.LNumber); ok && v > 0 {
+			maxTokens = int(v)
+		}
+		if v, ok := optsTable.RawGetString("model").(lua.LString); ok {
+			opts = append(opts, reasoning.WithModel(string(v)))
+		}
+		if v, ok := optsTable.RawGetString("timeout_ms").(lua.LNumber); ok && v > 0 {
+			timeout = time.Duration(v) * time.Millisecond
+		}
+	}
+	
+	bound, limitCtx, err := e.llmCall(L)
+	if err != nil {
+		return pushAPIError(L, err)
+	}
+	
+	useLLMTokens(L, limitCtx, bound.tokenizer.CountTokens(prompt))
+	if left := limitCtx.llmTokensLeft(); left >= 0 {
+		if left == 0 {
+			limitCtx.stop(ErrLLMTokenLimit)
+			L.RaiseError("%s", ErrLLMTokenLimit.Error())
+		}
+		maxTokens = min(maxTokens, int(left))
+	}
+	opts = append(opts, reasoning.WithMaxTokens(maxTokens))
+	
+	// The hook's deadline applies, and timeout_ms can only shorten it
+	ctx := limitCtx.callContext()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	
+	response, err := bound.engine.Process(ctx, prompt, opts...)
+	if err != nil {
+		return pushAPIError(L, err)
+	}
+	useLLMTokens(L, limitCtx, bound.tokenizer.CountTokens(response))
+	
+	L.Push(lua.LString(response))
+	return 1
+}
+
+// apiLLMEmbed generates embeddings with the reasoning engine. Given a string
+// it returns one vector; given a list of strings, a list of vectors.
+// Returns nil and an error message on failure.
+func (e *LuaEngine) apiLLMEmbed(L *lua.LState) int {
+	input := L.CheckAny(1)
+	
+	var texts []string
+	switch v := input.(type) {
+	case lua.LString:
+		texts = []string{string(v)}
+	case *lua.LTable:
+		for i := 1; i <= v.Len(); i++ {
+			text, ok := v.RawGetInt(i).(lua.LString)
+			if !ok {
+				L.ArgError(1, "list of strings expected")
+				return 0
+			}
+			texts = append(texts, string(text))
+		}
+	default:
+		L.ArgError(1, "string or list of strings expected")
+		return 0
+	}
+	
+	bound, limitCtx, err := e.llmCall(L)
+	if err != nil {
+		return pushAPIError(L, err)
+	}
+	tokens := 0
+	for _, text := range texts {
+		tokens += bound.tokenizer.CountTokens(text)
+	}
+	useLLMTokens(L, limitCtx, tokens)
+	
+	embeddings, err := bound.engine.GenerateEmbeddings(limitCtx.callContext(), texts)
+	if err != nil {
+		return pushAPIError(L, err)
+	}
+	if _, single := input.(lua.LString); single {
+		if len(embeddings) == 0 {
+			return pushAPIError(L, errors.New("reasoning engine returned no embedding"))
+		}
+		return pushAPIResult(L, embeddings[0])
+	}
+	return pushAPIResult(L, embeddings)
+}
@@ -0,0 +1,128 @@
+package scripting
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lexlapax/cogmem/pkg/reasoning"
+	reasoningMock "github.com/lexlapax/cogmem/pkg/reasoning/adapters/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const llmTestScript = `
+	function classify(text, opts)
+		local label, err = cogmem.llm.complete("Classify: " .. text, opts)
+		if err then
+			return "error: " .. err
+		end
+		return label
+	end
+	
+	function classify_twice(text)
+		cogmem.llm.complete("Classify: " .. text)
+		return cogmem.llm.complete("Classify again: " .. text)
+	end
+	
+	function embed(texts)
+		return cogmem.llm.embed(texts)
+	end
+`
+
+func TestLuaEngine_LLMAPI(t *testing.T) {
+	config := DefaultConfig()
+	config.PoolSize = 1
+	config.MaxLLMCalls = 1
+	config.MaxLLMTokens = 50
+	config.ScriptTimeoutMs = 5000
+	engine, err := NewLuaEngine(config)
+	require.NoError(t, err)
+	defer engine.Close()
+	require.NoError(t, engine.LoadScript("llm", []byte(llmTestScript)))
+	
+	ctx := context.Background()
+	
+	t.Run("Unavailable until bound", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "classify", "a cat")
+		require.NoError(t, err)
+		assert.Equal(t, "error: "+ErrReasoningUnavailable.Error(), result)
+	})
+	
+	llm := reasoningMock.NewMockEngine(reasoningMock.WithDefaultEmbedding([]float32{0.5, 0.25}))
+	llm.AddResponse("Classify: a cat", "animal")
+	engine.SetReasoningEngine(llm)
+	
+	lastOptions := func() (context.Context, reasoning.Options) {
+		history := llm.GetCallHistory()
+		require.NotEmpty(t, history)
+		call := history[len(history)-1]
+		options := reasoning.DefaultOptions()
+		for _, opt := range call.Args[2].([]reasoning.Option) {
+			opt(&options)
+		}
+		return call.Args[0].(context.Context), options
+	}
+	
+	t.Run("Complete", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "classify", "a cat", map[string]interface{}{
+			"temperature": 0.1,
+			"model":       "small",
+			"timeout_ms":  100,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "animal", result)
+		
+		callCtx, options := lastOptions()
+		assert.Equal(t, 0.1, options.Temperature)
+		assert.Equal(t, "small", options.Model)
+		assert.True(t, InScript(callCtx))
+		
+		// max_tokens is capped at what is left of the token budget after the prompt
+		assert.Less(t, options.MaxTokens, 50)
+		assert.Positive(t, options.MaxTokens)
+		
+		// timeout_ms shortens the hook's deadline
+		deadline, ok := callCtx.Deadline()
+		require.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(100*time.Millisecond), deadline, 100*time.Millisecond)
+	})
+	
+	t.Run("Embed", func(t *testing.T) {
+		single, err := engine.ExecuteFunction(ctx, "embed", "a cat")
+		require.NoError(t, err)
+		assert.Equal(t, []float32{0.5, 0.25}, single)
+		
+		list, err := engine.ExecuteFunction(ctx, "embed", []interface{}{"a cat", "a dog"})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{
+			[]float32{0.5, 0.25},
+			[]float32{0.5, 0.25},
+		}, list)
+	})
+	
+	t.Run("Call budget", func(t *testing.T) {
+		_, err := engine.ExecuteFunction(ctx, "classify_twice", "a cat")
+		assert.ErrorIs(t, err, ErrLLMCallLimit)
+	})
+	
+	t.Run("Token budget", func(t *testing.T) {
+		_, err := engine.ExecuteFunction(ctx, "classify", strings.Repeat("long text ", 50))
+		assert.ErrorIs(t, err, ErrLLMTokenLimit)
+		
+		// The budget is per call
+		result, err := engine.ExecuteFunction(ctx, "classify", "a cat")
+		require.NoError(t, err)
+		assert.Equal(t, "animal", result)
+	})
+	
+	t.Run("Engine errors are returned to the script", func(t *testing.T) {
+		llm.SetShouldError(true)
+		defer llm.SetShouldError(false)
+		
+		result, err := engine.ExecuteFunction(ctx, "classify", "a cat")
+		require.NoError(t, err)
+		assert.Equal(t, "error: mock reasoning engine error", result)
+	})
+}
@@ -0,0 +1,438 @@
+package scripting
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ErrTypeMismatch is returned when a value returned by a script does not have
+// the type of the Go value it is unmarshaled into.
+var ErrTypeMismatch = errors.New("lua value has the wrong type")
+
+// luaTag is the struct tag naming the field of a Lua table a struct field maps to.
+// A tag of "-" leaves the field out; untagged exported fields use their snake_case name.
+const luaTag = "lua"
+
+// Marshaler converts values of a Go type to the plain values scripts see
+// (nil, bool, float64, string, []interface{} and map[string]interface{}),
+// and converts values returned by scripts back.
+type Marshaler struct {
+	// ToLua converts a value of the type to plain values
+	ToLua func(value interface{}) (interface{}, error)
+	
+	// FromLua converts a plain value returned by a script to a value of the type
+	FromLua func(value interface{}) (interface{}, error)
+}
+
+var (
+	marshalersMutex sync.RWMutex
+	marshalers      = map[reflect.Type]Marshaler{
+		reflect.TypeOf(time.Time{}): {ToLua: timeToLua, FromLua: timeFromLua},
+	}
+	structs = map[reflect.Type][]structField{}
+)
+
+// RegisterMarshaler registers the conversion of values of type T to and from Lua.
+func RegisterMarshaler[T any](toLua func(T) (interface{}, error), fromLua func(interface{}) (T, error)) {
+	registerMarshaler(reflect.TypeOf((*T)(nil)).Elem(), Marshaler{
+		ToLua: func(value interface{}) (interface{}, error) {
+			return toLua(value.(T))
+		},
+		FromLua: func(value interface{}) (interface{}, error) {
+			return fromLua(value)
+		},
+	})
+}
+
+// RegisterStruct registers the struct type T to be converted to and from Lua
+// tables field by field, with field names taken from lua struct tags.
+// Unmarshaling sets only the fields present in the table.
+func RegisterStruct[T any]() {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("scripting: RegisterStruct called with non-struct type %s", t))
+	}
+	
+	marshalersMutex.Lock()
+	defer marshalersMutex.Unlock()
+	structs[t] = structFields(t)
+}
+
+func registerMarshaler(t reflect.Type, m Marshaler) {
+	marshalersMutex.Lock()
+	defer marshalersMutex.Unlock()
+	marshalers[t] = m
+}
+
+func marshalerFor(t reflect.Type) (Marshaler, bool) {
+	marshalersMutex.RLock()
+	defer marshalersMutex.RUnlock()
+	m, ok := marshalers[t]
+	return m, ok
+}
+
+func structFieldsFor(t reflect.Type) ([]structField, bool) {
+	marshalersMutex.RLock()
+	defer marshalersMutex.RUnlock()
+	fields, ok := structs[t]
+	return fields, ok
+}
+
+// Unmarshal converts a value returned by ExecuteFunction into target, which
+// must be a non-nil pointer. Registered types, slices, maps, pointers and
+// basic types are converted recursively; a value of the wrong type gives an
+// error wrapping ErrTypeMismatch that names where in the value it was found.
+func Unmarshal(value interface{}, target interface{}) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Pointer || ptr.IsNil() {
+		return fmt.Errorf("%w: unmarshal target must be a non-nil pointer, got %T", ErrInvalidArgument, target)
+	}
+	return fromLua(value, ptr.Elem(), "value")
+}
+
+// toLua converts a Go value to plain values, using the registered marshalers.
+func toLua(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if m, ok := marshalerFor(v.Type()); ok {
+		plain, err := m.ToLua(v.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s for Lua: %w", v.Type(), err)
+		}
+		return plain, nil
+	}
+	if fields, ok := structFieldsFor(v.Type()); ok {
+		return structToLua(v, fields)
+	}
+	
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toLua(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Float32 {
+			// Vectors such as embeddings become cogmem.vec userdata
+			vec := make([]float32, v.Len())
+			for i := range vec {
+				vec[i] = float32(v.Index(i).Float())
+			}
+			return vec, nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			item, err := toLua(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("%w: unsupported map key type %s", ErrInvalidArgument, v.Type().Key())
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		fields := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			item, err := toLua(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			fields[iter.Key().String()] = item
+		}
+		return fields, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %s", ErrInvalidArgument, v.Type())
+	}
+}
+
+// fromLua sets target from a plain value returned by a script. path names
+// the value's position for error messages.
+func fromLua(value interface{}, target reflect.Value, path string) error {
+	if value == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	
+	// Values that already have the target type, such as those of mock engines, are used as they are
+	if v := reflect.ValueOf(value); v.Type().AssignableTo(target.Type()) {
+		target.Set(v)
+		return nil
+	}
+	
+	if m, ok := marshalerFor(target.Type()); ok {
+		converted, err := m.FromLua(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		target.Set(reflect.ValueOf(converted))
+		return nil
+	}
+	if fields, ok := structFieldsFor(target.Type()); ok {
+		return structFromLua(value, target, fields, path)
+	}
+	
+	switch target.Kind() {
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return typeMismatch(path, "boolean", value)
+		}
+		target.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) || target.OverflowInt(int64(f)) {
+			return typeMismatch(path, "integer", value)
+		}
+		target.SetInt(int64(f))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) || f < 0 || target.OverflowUint(uint64(f)) {
+			return typeMismatch(path, "non-negative integer", value)
+		}
+		target.SetUint(uint64(f))
+	case reflect.Float32, reflect.Float64:
+		f, ok := value.(float64)
+		if !ok {
+			return typeMismatch(path, "number", value)
+		}
+		target.SetFloat(f)
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return typeMismatch(path, "string", value)
+		}
+		target.SetString(s)
+	case reflect.Pointer:
+		elem := reflect.New(target.Type().Elem())
+		if err := fromLua(value, elem.Elem(), path); err != nil {
+			return err
+		}
+		target.Set(elem)
+	case reflect.Interface:
+		v := reflect.ValueOf(value)
+		if !v.Type().Implements(target.Type()) {
+			return typeMismatch(path, target.Type().String(), value)
+		}
+		target.Set(v)
+	case reflect.Slice:
+		items, ok := asList(value)
+		if !ok {
+			return typeMismatch(path, "list", value)
+		}
+		slice := reflect.MakeSlice(target.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := fromLua(item, slice.Index(i), fmt.Sprintf("%s[%d]", path, i+1)); err != nil {
+				return err
+			}
+		}
+		target.Set(slice)
+	case reflect.Map:
+		fields, ok := asTable(value)
+		if !ok || target.Type().Key().Kind() != reflect.String {
+			return typeMismatch(path, "table", value)
+		}
+		m := reflect.MakeMapWithSize(target.Type(), len(fields))
+		for key, item := range fields {
+			elem := reflect.New(target.Type().Elem()).Elem()
+			if err := fromLua(item, elem, path+"."+key); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(target.Type().Key()), elem)
+		}
+		target.Set(m)
+	default:
+		return fmt.Errorf("%w: %s: unsupported type %s", ErrTypeMismatch, path, target.Type())
+	}
+	return nil
+}
+
+func typeMismatch(path, expected string, value interface{}) error {
+	return fmt.Errorf("%w: %s: expected %s, got %s", ErrTypeMismatch, path, expected, luaTypeName(value))
+}
+
+// luaTypeName names the Lua type a plain value came from.
+func luaTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}, map[string]interface{}:
+		return "table"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// asList returns the items of a list; an empty table counts as an empty list.
+func asList(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case []float32:
+		items := make([]interface{}, len(v))
+		for i, x := range v {
+			items[i] = float64(x)
+		}
+		return items, true
+	case map[string]interface{}:
+		return []interface{}{}, len(v) == 0
+	}
+	return nil, false
+}
+
+// asTable returns the fields of a table; an empty list counts as an empty table.
+func asTable(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case []interface{}:
+		return map[string]interface{}{}, len(v) == 0
+	}
+	return nil, false
+}
+
+// structField is a struct field that maps to a Lua table field.
+type structField struct {
+	index     int
+	name      string
+	omitEmpty bool
+}
+
+// structFields lists the fields of a struct type that map to Lua table fields.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		
+		name, options, _ := strings.Cut(field.Tag.Get(luaTag), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = snakeCase(field.Name)
+		}
+		fields = append(fields, structField{
+			index:     i,
+			name:      name,
+			omitEmpty: options == "omitempty",
+		})
+	}
+	return fields
+}
+
+func structToLua(v reflect.Value, fields []structField) (interface{}, error) {
+	table := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		fieldValue := v.Field(field.index)
+		if field.omitEmpty && fieldValue.IsZero() {
+			continue
+		}
+		item, err := toLua(fieldValue)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.name, err)
+		}
+		if item != nil {
+			table[field.name] = item
+		}
+	}
+	return table, nil
+}
+
+// structFromLua sets the fields of target present in a Lua table; other
+// fields keep their values.
+func structFromLua(value interface{}, target reflect.Value, fields []structField, path string) error {
+	table, ok := asTable(value)
+	if !ok {
+		return typeMismatch(path, "table", value)
+	}
+	for _, field := range fields {
+		item, ok := table[field.name]
+		if !ok {
+			continue
+		}
+		if err := fromLua(item, target.Field(field.index), path+"."+field.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snakeCase converts a Go field name such as EntityID to entity_id.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a new word at a lower-to-upper change, or before the last
+			// capital of an acronym followed by a lower case letter
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// timeToLua converts a time to an RFC 3339 string with nanoseconds, which
+// keeps it exact; the zero time becomes nil.
+func timeToLua(value interface{}) (interface{}, error) {
+	t := value.(time.Time)
+	if t.IsZero() {
+		return nil, nil
+	}
+	return t.Format(time.RFC3339Nano), nil
+}
+
+// timeFromLua accepts an RFC 3339 string or a Unix timestamp in seconds, as
+// returned by cogmem.now.
+func timeFromLua(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid time %q: %v", ErrTypeMismatch, v, err)
+		}
+		return t, nil
+	case float64:
+		seconds, fraction := math.Modf(v)
+		return time.Unix(int64(seconds), int64(fraction*1e9)).UTC(), nil
+	default:
+		return nil, fmt.Errorf("%w: expected time string or number, got %s", ErrTypeMismatch, luaTypeName(value))
+	}
+}
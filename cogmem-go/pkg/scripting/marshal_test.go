@@ -0,0 +1,220 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLevel int
+
+type testOwner string
+
+type testNote struct {
+	ID        string                 `lua:"id"`
+	Owner     testOwner              `lua:"owner"`
+	Level     testLevel              `lua:"level"`
+	Text      string                 `lua:"text"`
+	Tags      []string               `lua:"tags"`
+	Vector    []float32              `lua:"vector"`
+	Extra     map[string]interface{} `lua:"extra"`
+	CreatedAt time.Time              `lua:"created_at"`
+	Parent    *testNote              `lua:"parent"`
+	Secret    string                 `lua:"-"`
+	WordCount int
+}
+
+type testPoint struct {
+	X, Y float64
+}
+
+func init() {
+	RegisterStruct[testNote]()
+	RegisterMarshaler(
+		func(p testPoint) (interface{}, error) {
+			return []interface{}{p.X, p.Y}, nil
+		},
+		func(value interface{}) (testPoint, error) {
+			items, ok := value.([]interface{})
+			if !ok || len(items) != 2 {
+				return testPoint{}, errors.New("point must be a list of two numbers")
+			}
+			x, xok := items[0].(float64)
+			y, yok := items[1].(float64)
+			if !xok || !yok {
+				return testPoint{}, errors.New("point must be a list of two numbers")
+			}
+			return testPoint{X: x, Y: y}, nil
+		},
+	)
+}
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	engine, err := NewLuaEngine(DefaultConfig())
+	require.NoError(t, err)
+	defer engine.Close()
+	
+	err = engine.LoadScript("marshal_test", []byte(`
+		function edit_notes(notes)
+			for i, note in ipairs(notes) do
+				note.text = note.text .. " (edited)"
+				note.extra.seen = true
+				table.insert(note.tags, "edited")
+			end
+			-- Reverse the order
+			return {notes[2], notes[1]}
+		end
+		
+		function describe(note)
+			return {
+				owner = note.owner,
+				level = note.level,
+				created_at = note.created_at,
+				vector_length = #note.vector,
+				parent_id = note.parent.id,
+				has_secret = note.secret ~= nil,
+				word_count = note.word_count,
+			}
+		end
+		
+		function identity(value)
+			return value
+		end
+	`))
+	require.NoError(t, err)
+	
+	createdAt := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	notes := []testNote{
+		{
+			ID:        "first",
+			Owner:     "entity-a",
+			Level:     2,
+			Text:      "hello",
+			Tags:      []string{"a"},
+			Vector:    []float32{0.25, -1.5, 3},
+			Extra:     map[string]interface{}{"source": "test", "count": 3},
+			CreatedAt: createdAt,
+			Secret:    "hidden",
+			WordCount: 1,
+		},
+		{ID: "second", Text: "world", Tags: []string{}, Extra: map[string]interface{}{}},
+	}
+	
+	t.Run("fields are visible to Lua", func(t *testing.T) {
+		note := notes[0]
+		note.Parent = &testNote{ID: "root"}
+		result, err := engine.ExecuteFunction(context.Background(), "describe", note)
+		require.NoError(t, err)
+		
+		assert.Equal(t, map[string]interface{}{
+			"owner":         "entity-a",
+			"level":         float64(2),
+			"created_at":    "2024-05-06T07:08:09.123456789Z",
+			"vector_length": float64(3),
+			"parent_id":     "root",
+			"has_secret":    false,
+			"word_count":    float64(1),
+		}, result)
+	})
+	
+	t.Run("modified values unmarshal back", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(context.Background(), "edit_notes", notes)
+		require.NoError(t, err)
+		
+		var edited []testNote
+		require.NoError(t, Unmarshal(result, &edited))
+		require.Len(t, edited, 2)
+		
+		assert.Equal(t, "second", edited[0].ID)
+		assert.Equal(t, "world (edited)", edited[0].Text)
+		assert.Equal(t, []string{"edited"}, edited[0].Tags)
+		
+		first := edited[1]
+		assert.Equal(t, "first", first.ID)
+		assert.Equal(t, testOwner("entity-a"), first.Owner)
+		assert.Equal(t, testLevel(2), first.Level)
+		assert.Equal(t, "hello (edited)", first.Text)
+		assert.Equal(t, []string{"a", "edited"}, first.Tags)
+		assert.Equal(t, []float32{0.25, -1.5, 3}, first.Vector)
+		assert.Equal(t, map[string]interface{}{"source": "test", "count": float64(3), "seen": true}, first.Extra)
+		assert.True(t, createdAt.Equal(first.CreatedAt))
+		assert.Empty(t, first.Secret)
+		assert.Equal(t, 1, first.WordCount)
+	})
+	
+	t.Run("pointers and explicit marshalers", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(context.Background(), "identity", []*testNote{{ID: "p", Text: "pointer"}})
+		require.NoError(t, err)
+		var pointers []*testNote
+		require.NoError(t, Unmarshal(result, &pointers))
+		require.Len(t, pointers, 1)
+		assert.Equal(t, "pointer", pointers[0].Text)
+		
+		result, err = engine.ExecuteFunction(context.Background(), "identity", testPoint{X: 1, Y: 2})
+		require.NoError(t, err)
+		var point testPoint
+		require.NoError(t, Unmarshal(result, &point))
+		assert.Equal(t, testPoint{X: 1, Y: 2}, point)
+	})
+}
+
+func TestMarshal_Unmarshal(t *testing.T) {
+	t.Run("fields absent from the table keep their values", func(t *testing.T) {
+		note := testNote{ID: "kept", Text: "old"}
+		require.NoError(t, Unmarshal(map[string]interface{}{"text": "new"}, &note))
+		assert.Equal(t, "kept", note.ID)
+		assert.Equal(t, "new", note.Text)
+	})
+	
+	t.Run("timestamps from numbers", func(t *testing.T) {
+		var note testNote
+		require.NoError(t, Unmarshal(map[string]interface{}{"created_at": float64(1700000000)}, &note))
+		assert.Equal(t, int64(1700000000), note.CreatedAt.Unix())
+	})
+	
+	t.Run("type errors name the field", func(t *testing.T) {
+		cases := []struct {
+			value    interface{}
+			contains string
+		}{
+			{[]interface{}{map[string]interface{}{"text": 5.0}}, "value[1].text: expected string, got number"},
+			{[]interface{}{map[string]interface{}{"level": 1.5}}, "value[1].level: expected integer, got number"},
+			{[]interface{}{map[string]interface{}{"tags": "a"}}, "value[1].tags: expected list, got string"},
+			{[]interface{}{map[string]interface{}{"created_at": "yesterday"}}, "value[1].created_at"},
+			{[]interface{}{"not a note"}, "value[1]: expected table, got string"},
+			{"not a list", "value: expected list, got string"},
+		}
+		for _, c := range cases {
+			var notes []testNote
+			err := Unmarshal(c.value, &notes)
+			assert.ErrorIs(t, err, ErrTypeMismatch)
+			assert.True(t, strings.Contains(err.Error(), c.contains), err.Error())
+		}
+		
+		var point testPoint
+		assert.Error(t, Unmarshal([]interface{}{1.0}, &point))
+	})
+	
+	t.Run("invalid target", func(t *testing.T) {
+		var notes []testNote
+		assert.ErrorIs(t, Unmarshal(nil, notes), ErrInvalidArgument)
+	})
+	
+	t.Run("unsupported types are reported", func(t *testing.T) {
+		_, err := toLua(reflect.ValueOf(make(chan int)))
+		assert.ErrorIs(t, err, ErrInvalidArgument)
+	})
+}
+
+func TestMarshal_SnakeCase(t *testing.T) {
+	assert.Equal(t, "word_count", snakeCase("WordCount"))
+	assert.Equal(t, "entity_id", snakeCase("EntityID"))
+	assert.Equal(t, "http_server", snakeCase("HTTPServer"))
+	assert.Equal(t, "id", snakeCase("ID"))
+}
@@ -0,0 +1,174 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Errors returned by the memory API
+var (
+	ErrMemoryAPIUnavailable = errors.New("memory API is not available")
+	ErrMemoryOpLimit        = errors.New("lua memory operation limit exceeded")
+	ErrReentrantCall        = errors.New("lua function called from within a lua function")
+)
+
+// MemoryAPI is the memory access offered to scripts as cogmem.memory. Each
+// call receives the context of the function call running the script, so it
+// acts within the caller's entity context. Results are converted to Lua
+// values like function arguments are.
+type MemoryAPI interface {
+	// Retrieve returns the records matching a query, which is a string or a
+	// table with text, filters, exact_match, limit and strategy fields
+	Retrieve(ctx context.Context, query interface{}) (interface{}, error)
+	
+	// Store stores content with the given metadata and returns the record ID
+	Store(ctx context.Context, content string, metadata map[string]interface{}) (string, error)
+	
+	// Get returns the record with the given ID, or nil if there is none
+	Get(ctx context.Context, id string) (interface{}, error)
+}
+
+// MemoryAPIBinder is implemented by engines that can give scripts memory access.
+type MemoryAPIBinder interface {
+	// SetMemoryAPI makes api available to scripts as cogmem.memory
+	SetMemoryAPI(api MemoryAPI)
+}
+
+// inScriptKey marks contexts passed to the memory API from a running script.
+type inScriptKey struct{}
+
+// InScript reports whether ctx belongs to a memory operation started by a
+// script. Hooks must not run for such operations, since they would recurse.
+func InScript(ctx context.Context) bool {
+	inScript, _ := ctx.Value(inScriptKey{}).(bool)
+	return inScript
+}
+
+// callContext returns the context for calls into Go made by the running
+// function. It carries the caller's values and deadline, and is marked so
+// that the calls do not run hooks.
+func (c *limitContext) callContext() context.Context {
+	return context.WithValue(c.Context, inScriptKey{}, true)
+}
+
+// boundMemory holds the memory API bound to an engine.
+type boundMemory struct {
+	api MemoryAPI
+}
+
+// SetMemoryAPI implements the MemoryAPIBinder interface.
+func (e *LuaEngine) SetMemoryAPI(api MemoryAPI) {
+	e.memory.Store(&boundMemory{api: api})
+}
+
+// registerMemoryFunctions adds the cogmem.memory table to a Lua state.
+func (e *LuaEngine) registerMemoryFunctions(L *lua.LState) {
+	cogmem, ok := L.GetGlobal("cogmem").(*lua.LTable)
+	if !ok {
+		return
+	}
+	
+	memory := L.NewTable()
+	L.SetField(memory, "retrieve", L.NewFunction(e.apiMemoryRetrieve))
+	L.SetField(memory, "store", L.NewFunction(e.apiMemoryStore))
+	L.SetField(memory, "get", L.NewFunction(e.apiMemoryGet))
+	L.SetField(cogmem, "memory", memory)
+}
+
+// memoryCall returns the memory API and the context to call it with, counting
+// the call against the function's operation budget. It raises a Lua error
+// once the budget is spent.
+func (e *LuaEngine) memoryCall(L *lua.LState) (MemoryAPI, context.Context, error) {
+	bound := e.memory.Load()
+	limitCtx, ok := L.Context().(*limitContext)
+	if bound == nil || bound.api == nil || !ok {
+		return nil, nil, ErrMemoryAPIUnavailable
+	}
+	
+	if !limitCtx.useMemoryOp() {
+		L.RaiseError("%s", ErrMemoryOpLimit.Error())
+		return nil, nil, ErrMemoryOpLimit
+	}
+	return bound.api, limitCtx.callContext(), nil
+}
+
+// apiMemoryRetrieve retrieves records from memory.
+// Returns a list of records, or nil and an error message on failure.
+func (e *LuaEngine) apiMemoryRetrieve(L *lua.LState) int {
+	query := L.CheckAny(1)
+	if query.Type() != lua.LTString && query.Type() != lua.LTTable {
+		L.ArgError(1, "string or table expected")
+		return 0
+	}
+	
+	api, ctx, err := e.memoryCall(L)
+	if err != nil {
+		return pushAPIError(L, err)
+	}
+	records, err := api.Retrieve(ctx, convertLuaToGo(query))
+	if err != nil {
+		return pushAPIError(L, err)
+	}
+	return pushAPIResult(L, records)
+}
+
+// apiMemoryStore stores content with optional metadata in memory.
+// Returns the record ID, or nil and an error message on failure.
+func (e *LuaEngine) apiMemoryStore(L *lua.LState) int {
+	content := L.CheckString(1)
+	var metadata map[string]interface{}
+	if tbl := L.OptTable(2, nil); tbl != nil {
+		var ok bool
+		if metadata, ok = convertLuaToGo(tbl).(map[string]interface{}); !ok {
+			L.ArgError(2, "metadata must be a table with string keys")
+			return 0
+		}
+	}
+	
+	api, ctx, err := e.memoryCall(L)
+	if err != nil {
+		return pushAPIError(L, err)
+	}
+	id, err := api.Store(ctx, content, metadata)
+	if err != nil {
+		return pushAPIError(L, err)
+	}
+	L.Push(lua.LString(id))
+	return 1
+}
+
+// apiMemoryGet fetches a record from memory by ID.
+// Returns the record, nil if there is none, or nil and an error message on failure.
+func (e *LuaEngine) apiMemoryGet(L *lua.LState) int {
+	id := L.CheckString(1)
+	
+	api, ctx, err := e.memoryCall(L)
+	if err != nil {
+		return pushAPIError(L, err)
+	}
+	record, err := api.Get(ctx, id)
+	if err != nil {
+		return pushAPIError(L, err)
+	}
+	return pushAPIResult(L, record)
+}
+
+// pushAPIResult converts an API result to a Lua value and pushes it.
+func pushAPIResult(L *lua.LState, result interface{}) int {
+	value, err := convertToLua(L, result)
+	if err != nil {
+		return pushAPIError(L, fmt.Errorf("failed to convert result: %w", err))
+	}
+	L.Push(value)
+	return 1
+}
+
+// pushAPIError pushes nil and an error message.
+func pushAPIError(L *lua.LState, err error) int {
+	L.Push(lua.LNil)
+	L.Push(lua.LString(err.Error()))
+	return 2
+}
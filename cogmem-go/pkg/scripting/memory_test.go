@@ -0,0 +1,154 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const memoryTestScript = `
+	function lookup(query)
+		return cogmem.memory.retrieve(query)
+	end
+	
+	function remember(content, metadata)
+		return cogmem.memory.store(content, metadata)
+	end
+	
+	function fetch(id)
+		local record, err = cogmem.memory.get(id)
+		if err then
+			return "error: " .. err
+		end
+		return record
+	end
+	
+	function fetch_many(n)
+		for i = 1, n do
+			cogmem.memory.get("id-" .. i)
+		end
+		return n
+	end
+	
+	function reenter()
+		local _, err = cogmem.memory.retrieve("reenter")
+		return err
+	end
+`
+
+// fakeMemoryAPI records the entity of each call and answers from a fixed set of records.
+type fakeMemoryAPI struct {
+	engine   *LuaEngine
+	entities []string
+	records  map[string]map[string]interface{}
+}
+
+func (f *fakeMemoryAPI) record(ctx context.Context) {
+	if entityCtx, ok := entity.GetEntityContext(ctx); ok {
+		f.entities = append(f.entities, string(entityCtx.EntityID))
+	}
+}
+
+func (f *fakeMemoryAPI) Retrieve(ctx context.Context, query interface{}) (interface{}, error) {
+	f.record(ctx)
+	if query == "reenter" {
+		return f.engine.ExecuteFunction(ctx, "lookup", "inner")
+	}
+	return []interface{}{map[string]interface{}{"content": "found", "query": query}}, nil
+}
+
+func (f *fakeMemoryAPI) Store(ctx context.Context, content string, metadata map[string]interface{}) (string, error) {
+	f.record(ctx)
+	if content == "" {
+		return "", errors.New("empty content")
+	}
+	f.records["new-id"] = map[string]interface{}{"content": content, "metadata": metadata}
+	return "new-id", nil
+}
+
+func (f *fakeMemoryAPI) Get(ctx context.Context, id string) (interface{}, error) {
+	f.record(ctx)
+	if record, ok := f.records[id]; ok {
+		return record, nil
+	}
+	return nil, nil
+}
+
+func TestLuaEngine_MemoryAPI(t *testing.T) {
+	config := DefaultConfig()
+	config.PoolSize = 1
+	config.MaxMemoryOps = 3
+	engine, err := NewLuaEngine(config)
+	require.NoError(t, err)
+	defer engine.Close()
+	require.NoError(t, engine.LoadScript("memory", []byte(memoryTestScript)))
+	
+	ctx := entity.ContextWithEntity(context.Background(), entity.NewContext("test-entity", "test-user"))
+	
+	t.Run("Unavailable until bound", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "fetch", "any")
+		require.NoError(t, err)
+		assert.Equal(t, "error: "+ErrMemoryAPIUnavailable.Error(), result)
+	})
+	
+	api := &fakeMemoryAPI{engine: engine, records: make(map[string]map[string]interface{})}
+	engine.SetMemoryAPI(api)
+	
+	t.Run("Operations run in the caller's entity context", func(t *testing.T) {
+		api.entities = nil
+		
+		result, err := engine.ExecuteFunction(ctx, "lookup", map[string]interface{}{"text": "cats", "limit": 2})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{map[string]interface{}{
+			"content": "found",
+			"query":   map[string]interface{}{"text": "cats", "limit": float64(2)},
+		}}, result)
+		
+		id, err := engine.ExecuteFunction(ctx, "remember", "a note", map[string]interface{}{"source": "lua"})
+		require.NoError(t, err)
+		assert.Equal(t, "new-id", id)
+		
+		record, err := engine.ExecuteFunction(ctx, "fetch", "new-id")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"content":  "a note",
+			"metadata": map[string]interface{}{"source": "lua"},
+		}, record)
+		
+		missing, err := engine.ExecuteFunction(ctx, "fetch", "unknown")
+		require.NoError(t, err)
+		assert.Nil(t, missing)
+		
+		assert.Equal(t, []string{"test-entity", "test-entity", "test-entity", "test-entity"}, api.entities)
+	})
+	
+	t.Run("Errors are returned to the script", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "remember", "")
+		require.NoError(t, err)
+		assert.Nil(t, result)
+	})
+	
+	t.Run("Operation budget", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "fetch_many", 3)
+		require.NoError(t, err)
+		assert.Equal(t, float64(3), result)
+		
+		_, err = engine.ExecuteFunction(ctx, "fetch_many", 4)
+		assert.ErrorIs(t, err, ErrMemoryOpLimit)
+		
+		// The budget is per call
+		result, err = engine.ExecuteFunction(ctx, "fetch_many", 3)
+		require.NoError(t, err)
+		assert.Equal(t, float64(3), result)
+	})
+	
+	t.Run("Re-entrant calls are refused", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "reenter")
+		require.NoError(t, err)
+		assert.Contains(t, result, ErrReentrantCall.Error())
+	})
+}
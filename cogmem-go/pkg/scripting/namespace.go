@@ -0,0 +1,204 @@
+package scripting
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/lexlapax/cogmem/pkg/log"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// EntityScriptLoader is implemented by engines that can load scripts for
+// individual entities, at start-up or while running. An entity's scripts are
+// layered over the global ones: a function called for the entity uses the
+// entity's definition if it has one, and the global one otherwise.
+// Namespaces keep hooks apart; they are not a security boundary between
+// scripts.
+type EntityScriptLoader interface {
+	// LoadEntityScript loads a Lua script for an entity
+	LoadEntityScript(entityID entity.EntityID, name string, content []byte) error
+	
+	// LoadEntityScriptFile loads a Lua script file for an entity
+	LoadEntityScriptFile(entityID entity.EntityID, path string) error
+	
+	// LoadEntityScriptDir loads all Lua scripts in a directory for an entity
+	LoadEntityScriptDir(entityID entity.EntityID, dir string) error
+	
+	// UnloadEntityScripts removes an entity's scripts, so that its calls use
+	// the global scripts again. It reports whether the entity had any.
+	UnloadEntityScripts(entityID entity.EntityID) bool
+}
+
+// entityScripts holds the scripts loaded for an entity. Unloading an entity
+// drops its entityScripts, so a state can tell an environment built by an
+// earlier load from a current one by comparing pointers.
+type entityScripts struct {
+	scripts     []compiledScript
+	loadedFiles map[string]bool
+}
+
+// entityEnv is the environment of an entity's scripts in one Lua state, with
+// the number of the entity's scripts run in it and the hook handlers they
+// registered. Names the entity's scripts do not define are looked up in the
+// global environment.
+type entityEnv struct {
+	source  *entityScripts
+	table   *lua.LTable
+	scripts int
+	hooks   *luaHooks
+}
+
+// LoadEntityScript implements the EntityScriptLoader interface.
+func (e *LuaEngine) LoadEntityScript(entityID entity.EntityID, name string, content []byte) error {
+	if entityID == "" {
+		return entity.ErrInvalidEntityID
+	}
+	return e.loadScript(entityID, name, content)
+}
+
+// LoadEntityScriptFile implements the EntityScriptLoader interface.
+func (e *LuaEngine) LoadEntityScriptFile(entityID entity.EntityID, path string) error {
+	if entityID == "" {
+		return entity.ErrInvalidEntityID
+	}
+	return e.loadScriptFile(entityID, path)
+}
+
+// LoadEntityScriptDir implements the EntityScriptLoader interface.
+func (e *LuaEngine) LoadEntityScriptDir(entityID entity.EntityID, dir string) error {
+	if entityID == "" {
+		return entity.ErrInvalidEntityID
+	}
+	return e.loadScriptDir(entityID, dir)
+}
+
+// UnloadEntityScripts implements the EntityScriptLoader interface. Calls
+// already running keep the scripts they started with.
+func (e *LuaEngine) UnloadEntityScripts(entityID entity.EntityID) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	
+	if _, ok := e.entities[entityID]; !ok {
+		return false
+	}
+	delete(e.entities, entityID)
+	e.unloads++
+	
+	log.Debug("Unloaded Lua scripts", "entity_id", entityID)
+	return true
+}
+
+// addEntityScript runs a script in an entity's environment of a state whose
+// global scripts are up to date, and adds it to the entity's scripts. The
+// caller holds e.mutex.
+func (e *LuaEngine) addEntityScript(state *pooledState, entityID entity.EntityID, name string, proto *lua.FunctionProto) error {
+	source := e.entities[entityID]
+	if source == nil {
+		source = &entityScripts{loadedFiles: make(map[string]bool)}
+	}
+	env := state.envFor(entityID, source)
+	if err := e.runEntityPending(state, env, source.scripts); err != nil {
+		return err
+	}
+	
+	script := compiledScript{name: name, proto: proto}
+	defined := definedFunctions(env.table)
+	if err := e.runScript(state.L, env.table, env.hooks, script); err != nil {
+		return err
+	}
+	warnRedefined(entityID, name, defined, env.table)
+	
+	source.scripts = append(source.scripts, script)
+	env.scripts = len(source.scripts)
+	e.entities[entityID] = source
+	return nil
+}
+
+// callerEnv returns the state's environment for the scripts of the caller's
+// entity, with all of them run, or nil if the entity has no scripts.
+func (e *LuaEngine) callerEnv(ctx context.Context, state *pooledState) (*entityEnv, error) {
+	entityCtx, ok := entity.GetEntityContext(ctx)
+	if !ok {
+		return nil, nil
+	}
+	
+	e.mutex.RLock()
+	source := e.entities[entityCtx.EntityID]
+	var scripts []compiledScript
+	if source != nil {
+		scripts = source.scripts
+	}
+	e.mutex.RUnlock()
+	if source == nil {
+		return nil, nil
+	}
+	
+	env := state.envFor(entityCtx.EntityID, source)
+	if err := e.runEntityPending(state, env, scripts); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// runEntityPending runs the entity's scripts the environment has not run yet.
+func (e *LuaEngine) runEntityPending(state *pooledState, env *entityEnv, scripts []compiledScript) error {
+	for _, script := range scripts[env.scripts:] {
+		if err := e.runScript(state.L, env.table, env.hooks, script); err != nil {
+			log.Error("Failed to load entity Lua script into pooled state", "name", script.name, "error", err)
+			return fmt.Errorf("failed to load script %s: %w", script.name, err)
+		}
+		env.scripts++
+	}
+	return nil
+}
+
+// envFor returns the state's environment for an entity's scripts, replacing
+// one built from scripts that have since been unloaded.
+func (state *pooledState) envFor(entityID entity.EntityID, source *entityScripts) *entityEnv {
+	if env := state.entities[entityID]; env != nil && env.source == source {
+		return env
+	}
+	
+	L := state.L
+	table := L.NewTable()
+	fallback := L.NewTable()
+	fallback.RawSetString("__index", L.G.Global)
+	table.Metatable = fallback
+	
+	// _G names the entity's environment, so assignments through it stay there too
+	table.RawSetString("_G", table)
+	
+	env := &entityEnv{source: source, table: table, hooks: newLuaHooks(entityID)}
+	state.entities[entityID] = env
+	return env
+}
+
+// definedFunctions returns the functions defined in an environment.
+func definedFunctions(env *lua.LTable) map[string]lua.LValue {
+	defined := make(map[string]lua.LValue)
+	env.ForEach(func(key, value lua.LValue) {
+		if name, ok := key.(lua.LString); ok && value.Type() == lua.LTFunction {
+			defined[string(name)] = value
+		}
+	})
+	return defined
+}
+
+// warnRedefined logs the functions a script replaced in its environment,
+// since the last definition loaded is the one that is called.
+func warnRedefined(entityID entity.EntityID, name string, defined map[string]lua.LValue, env *lua.LTable) {
+	for funcName, fn := range defined {
+		if redefined := env.RawGetString(funcName); redefined != fn && redefined.Type() == lua.LTFunction {
+			log.Warn("Lua script redefines a function loaded earlier", withEntity(entityID, "name", name, "function", funcName)...)
+		}
+	}
+}
+
+// withEntity adds the entity ID to log arguments about an entity's scripts.
+func withEntity(entityID entity.EntityID, args ...interface{}) []interface{} {
+	if entityID != "" {
+		args = append(args, "entity_id", entityID)
+	}
+	return args
+}
@@ -0,0 +1,161 @@
+package scripting
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lexlapax/cogmem/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLuaEngine_EntityScripts(t *testing.T) {
+	config := DefaultConfig()
+	config.PoolSize = 2
+	engine, err := NewLuaEngine(config)
+	require.NoError(t, err)
+	defer engine.Close()
+	
+	require.NoError(t, engine.LoadScript("global", []byte(`
+		function filter()
+			return "global filter"
+		end
+		
+		function shared_helper()
+			return "global helper"
+		end
+		
+		function describe()
+			return filter() .. " / " .. shared_helper()
+		end
+		
+		function read_globals()
+			return {counter = counter or 0, via_g = via_g == true}
+		end
+	`)))
+	require.NoError(t, engine.LoadEntityScript("tenant-a", "tenant", []byte(`
+		function filter()
+			return "tenant-a filter"
+		end
+		
+		function tenant_only()
+			return "tenant-a only, using " .. shared_helper()
+		end
+		
+		function count()
+			counter = (counter or 0) + 1
+			_G.via_g = true
+			return counter
+		end
+	`)))
+	
+	ctxFor := func(entityID entity.EntityID) context.Context {
+		return entity.ContextWithEntity(context.Background(), entity.NewContext(entityID, "user"))
+	}
+	tenantCtx := ctxFor("tenant-a")
+	
+	t.Run("Entity scripts override global functions", func(t *testing.T) {
+		// Run on every state in the pool
+		for i := 0; i < config.PoolSize*2; i++ {
+			result, err := engine.ExecuteFunction(tenantCtx, "filter")
+			require.NoError(t, err)
+			assert.Equal(t, "tenant-a filter", result)
+		}
+		
+		result, err := engine.ExecuteFunction(tenantCtx, "tenant_only")
+		require.NoError(t, err)
+		assert.Equal(t, "tenant-a only, using global helper", result)
+	})
+	
+	t.Run("Other callers use the global scripts", func(t *testing.T) {
+		for _, ctx := range []context.Context{ctxFor("tenant-b"), context.Background()} {
+			result, err := engine.ExecuteFunction(ctx, "filter")
+			require.NoError(t, err)
+			assert.Equal(t, "global filter", result)
+			
+			_, err = engine.ExecuteFunction(ctx, "tenant_only")
+			assert.ErrorIs(t, err, ErrFunctionNotFound)
+		}
+	})
+	
+	t.Run("Global functions do not see entity definitions", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(tenantCtx, "describe")
+		require.NoError(t, err)
+		assert.Equal(t, "global filter / global helper", result)
+	})
+	
+	t.Run("Globals set by entity scripts stay in the entity's namespace", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(tenantCtx, "count")
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), result)
+		
+		result, err = engine.ExecuteFunction(tenantCtx, "read_globals")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"counter": float64(0), "via_g": false}, result)
+	})
+	
+	t.Run("Unloading restores the global scripts", func(t *testing.T) {
+		assert.True(t, engine.UnloadEntityScripts("tenant-a"))
+		assert.False(t, engine.UnloadEntityScripts("tenant-a"))
+		
+		for i := 0; i < config.PoolSize*2; i++ {
+			result, err := engine.ExecuteFunction(tenantCtx, "filter")
+			require.NoError(t, err)
+			assert.Equal(t, "global filter", result)
+		}
+		
+		// Loading again starts from an empty namespace
+		require.NoError(t, engine.LoadEntityScript("tenant-a", "tenant", []byte(`
+			function count()
+				counter = (counter or 0) + 1
+				return counter
+			end
+		`)))
+		result, err := engine.ExecuteFunction(tenantCtx, "count")
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), result)
+		
+		_, err = engine.ExecuteFunction(tenantCtx, "tenant_only")
+		assert.ErrorIs(t, err, ErrFunctionNotFound)
+	})
+	
+	t.Run("Scripts that fail to load are not added", func(t *testing.T) {
+		err := engine.LoadEntityScript("tenant-c", "broken", []byte(`error("broken")`))
+		require.Error(t, err)
+		assert.False(t, engine.UnloadEntityScripts("tenant-c"))
+		
+		err = engine.LoadEntityScript("", "global", []byte(`function filter() end`))
+		assert.ErrorIs(t, err, entity.ErrInvalidEntityID)
+	})
+}
+
+func TestLuaEngine_LoadEntityScriptDir(t *testing.T) {
+	engine, err := NewLuaEngine(DefaultConfig())
+	require.NoError(t, err)
+	defer engine.Close()
+	
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "filter.lua"), []byte(`
+		function filter()
+			return "from directory"
+		end
+	`), 0600))
+	
+	require.NoError(t, engine.LoadEntityScriptDir("tenant-a", tmpDir))
+	
+	// Files are loaded once per entity
+	require.NoError(t, engine.LoadEntityScriptDir("tenant-a", tmpDir))
+	require.NoError(t, engine.LoadEntityScriptDir("tenant-b", tmpDir))
+	
+	for _, entityID := range []entity.EntityID{"tenant-a", "tenant-b"} {
+		ctx := entity.ContextWithEntity(context.Background(), entity.NewContext(entityID, "user"))
+		result, err := engine.ExecuteFunction(ctx, "filter")
+		require.NoError(t, err)
+		assert.Equal(t, "from directory", result)
+	}
+	
+	_, err = engine.ExecuteFunction(context.Background(), "filter")
+	assert.ErrorIs(t, err, ErrFunctionNotFound)
+}
@@ -0,0 +1,286 @@
+package scripting
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// vecMetatableName is the registry name of the metatable of vector userdata
+const vecMetatableName = "cogmem.vec"
+
+// newVecModule creates the cogmem.vec table and the metatable of vectors,
+// which are []float32 values wrapped in userdata so that embeddings do not
+// have to be converted to and from Lua tables.
+func newVecModule(L *lua.LState) *lua.LTable {
+	vec := L.NewTable()
+	L.SetField(vec, "new", L.NewFunction(vecNew))
+	L.SetField(vec, "is_vec", L.NewFunction(vecIsVec))
+	L.SetField(vec, "to_table", L.NewFunction(vecToTable))
+	L.SetField(vec, "dot", L.NewFunction(vecDot))
+	L.SetField(vec, "cosine", L.NewFunction(vecCosine))
+	L.SetField(vec, "norm", L.NewFunction(vecNorm))
+	L.SetField(vec, "add", L.NewFunction(vecAdd))
+	L.SetField(vec, "scale", L.NewFunction(vecScale))
+	L.SetField(vec, "mean", L.NewFunction(vecMean))
+	L.SetField(vec, "top_k", L.NewFunction(vecTopK))
+	
+	// Vectors index like lists and have the module functions as methods
+	mt := L.NewTypeMetatable(vecMetatableName)
+	L.SetField(mt, "__index", L.NewClosure(vecIndex, vec))
+	L.SetField(mt, "__len", L.NewFunction(vecLen))
+	L.SetField(mt, "__tostring", L.NewFunction(vecString))
+	return vec
+}
+
+// newVec wraps a vector in userdata. The vector must not be modified afterwards.
+func newVec(L *lua.LState, v []float32) *lua.LUserData {
+	ud := L.NewUserData()
+	ud.Value = v
+	ud.Metatable = L.GetTypeMetatable(vecMetatableName)
+	return ud
+}
+
+// toVec returns the vector wrapped in a userdata value.
+func toVec(lv lua.LValue) ([]float32, bool) {
+	ud, ok := lv.(*lua.LUserData)
+	if !ok {
+		return nil, false
+	}
+	v, ok := ud.Value.([]float32)
+	return v, ok
+}
+
+// checkVec returns argument n as a vector. Lists of numbers are accepted too.
+func checkVec(L *lua.LState, n int) []float32 {
+	lv := L.CheckAny(n)
+	if v, ok := toVec(lv); ok {
+		return v
+	}
+	if tbl, ok := lv.(*lua.LTable); ok {
+		v := make([]float32, tbl.Len())
+		for i := range v {
+			x, ok := tbl.RawGetInt(i + 1).(lua.LNumber)
+			if !ok {
+				L.ArgError(n, "vector or list of numbers expected")
+				return nil
+			}
+			v[i] = float32(x)
+		}
+		return v
+	}
+	L.ArgError(n, "vector expected")
+	return nil
+}
+
+// checkSameLength raises an error unless two vectors have the same dimensions.
+func checkSameLength(L *lua.LState, a, b []float32) {
+	if len(a) != len(b) {
+		L.RaiseError("vector dimensions do not match: %d and %d", len(a), len(b))
+	}
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func norm(a []float32) float64 {
+	return math.Sqrt(dot(a, a))
+}
+
+// cosine returns the cosine similarity of two vectors, or 0 if either is zero.
+func cosine(a, b []float32) float64 {
+	na, nb := norm(a), norm(b)
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot(a, b) / (na * nb)
+}
+
+// vecIndex returns an element for an index, or a module function for a name.
+func vecIndex(L *lua.LState) int {
+	v, _ := toVec(L.CheckUserData(1))
+	switch key := L.Get(2).(type) {
+	case lua.LNumber:
+		i := int(key)
+		if float64(key) == float64(i) && i >= 1 && i <= len(v) {
+			L.Push(lua.LNumber(v[i-1]))
+			return 1
+		}
+	case lua.LString:
+		L.Push(L.GetField(L.Get(lua.UpvalueIndex(1)), string(key)))
+		return 1
+	}
+	L.Push(lua.LNil)
+	return 1
+}
+
+func vecLen(L *lua.LState) int {
+	v, _ := toVec(L.CheckUserData(1))
+	L.Push(lua.LNumber(len(v)))
+	return 1
+}
+
+func vecString(L *lua.LState) int {
+	v, _ := toVec(L.CheckUserData(1))
+	parts := make([]string, len(v))
+	for i, x := range v {
+		parts[i] = fmt.Sprint(x)
+	}
+	L.Push(lua.LString("vec(" + strings.Join(parts, ", ") + ")"))
+	return 1
+}
+
+// vecNew creates a vector from a list of numbers, or copies a vector.
+func vecNew(L *lua.LState) int {
+	v := checkVec(L, 1)
+	L.Push(newVec(L, append([]float32(nil), v...)))
+	return 1
+}
+
+// vecIsVec reports whether a value is a vector.
+func vecIsVec(L *lua.LState) int {
+	_, ok := toVec(L.Get(1))
+	L.Push(lua.LBool(ok))
+	return 1
+}
+
+// vecToTable converts a vector to a list of numbers.
+func vecToTable(L *lua.LState) int {
+	v := checkVec(L, 1)
+	tbl := L.CreateTable(len(v), 0)
+	for i, x := range v {
+		tbl.RawSetInt(i+1, lua.LNumber(x))
+	}
+	tbl.Metatable = arrayMetatable(L)
+	L.Push(tbl)
+	return 1
+}
+
+func vecDot(L *lua.LState) int {
+	a, b := checkVec(L, 1), checkVec(L, 2)
+	checkSameLength(L, a, b)
+	L.Push(lua.LNumber(dot(a, b)))
+	return 1
+}
+
+func vecCosine(L *lua.LState) int {
+	a, b := checkVec(L, 1), checkVec(L, 2)
+	checkSameLength(L, a, b)
+	L.Push(lua.LNumber(cosine(a, b)))
+	return 1
+}
+
+func vecNorm(L *lua.LState) int {
+	L.Push(lua.LNumber(norm(checkVec(L, 1))))
+	return 1
+}
+
+func vecAdd(L *lua.LState) int {
+	a, b := checkVec(L, 1), checkVec(L, 2)
+	checkSameLength(L, a, b)
+	sum := make([]float32, len(a))
+	for i := range a {
+		sum[i] = a[i] + b[i]
+	}
+	L.Push(newVec(L, sum))
+	return 1
+}
+
+func vecScale(L *lua.LState) int {
+	a := checkVec(L, 1)
+	factor := float32(L.CheckNumber(2))
+	scaled := make([]float32, len(a))
+	for i := range a {
+		scaled[i] = a[i] * factor
+	}
+	L.Push(newVec(L, scaled))
+	return 1
+}
+
+// vecMean returns the element-wise mean of a list of vectors.
+func vecMean(L *lua.LState) int {
+	list := L.CheckTable(1)
+	n := list.Len()
+	if n == 0 {
+		L.ArgError(1, "list of vectors must not be empty")
+		return 0
+	}
+	
+	var sum []float64
+	for i := 1; i <= n; i++ {
+		v, ok := toVec(list.RawGetInt(i))
+		if !ok {
+			L.ArgError(1, "list of vectors expected")
+			return 0
+		}
+		if sum == nil {
+			sum = make([]float64, len(v))
+		} else if len(v) != len(sum) {
+			L.RaiseError("vector dimensions do not match: %d and %d", len(sum), len(v))
+		}
+		for j, x := range v {
+			sum[j] += float64(x)
+		}
+	}
+	
+	mean := make([]float32, len(sum))
+	for j := range sum {
+		mean[j] = float32(sum[j] / float64(n))
+	}
+	L.Push(newVec(L, mean))
+	return 1
+}
+
+// vecTopK ranks candidates by cosine similarity to a query vector and returns
+// the best k as a list of {index = ..., score = ...}, most similar first.
+// Candidates are vectors or tables with an embedding field, such as memory
+// records; those without an embedding of the query's dimensions are skipped.
+func vecTopK(L *lua.LState) int {
+	query := checkVec(L, 1)
+	candidates := L.CheckTable(2)
+	k := L.OptInt(3, candidates.Len())
+	
+	type scored struct {
+		index int
+		score float64
+	}
+	var ranked []scored
+	for i := 1; i <= candidates.Len(); i++ {
+		candidate := candidates.RawGetInt(i)
+		if tbl, ok := candidate.(*lua.LTable); ok {
+			candidate = tbl.RawGetString("embedding")
+		}
+		v, ok := toVec(candidate)
+		if !ok || len(v) != len(query) {
+			continue
+		}
+		ranked = append(ranked, scored{index: i, score: cosine(query, v)})
+	}
+	
+	// Ties keep the candidates' order
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return ranked[a].score > ranked[b].score
+	})
+	if k >= 0 && k < len(ranked) {
+		ranked = ranked[:k]
+	}
+	
+	result := L.CreateTable(len(ranked), 0)
+	for i, r := range ranked {
+		entry := L.CreateTable(0, 2)
+		entry.RawSetString("index", lua.LNumber(r.index))
+		entry.RawSetString("score", lua.LNumber(r.score))
+		result.RawSetInt(i+1, entry)
+	}
+	result.Metatable = arrayMetatable(L)
+	L.Push(result)
+	return 1
+}
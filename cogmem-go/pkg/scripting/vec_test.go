@@ -0,0 +1,119 @@
+package scripting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLuaEngine_Vec(t *testing.T) {
+	engine, err := NewLuaEngine(DefaultConfig())
+	require.NoError(t, err)
+	defer engine.Close()
+	
+	err = engine.LoadScript("vec", []byte(`
+		function describe(v)
+			return {
+				is_vec = cogmem.vec.is_vec(v),
+				length = #v,
+				first = v[1],
+				missing = v[10],
+				text = tostring(v),
+				norm = v:norm(),
+			}
+		end
+		
+		function arithmetic(a, b)
+			return {
+				dot = cogmem.vec.dot(a, b),
+				cosine = a:cosine(b),
+				sum = cogmem.vec.to_table(cogmem.vec.add(a, b)),
+				scaled = cogmem.vec.to_table(a:scale(2)),
+				mean = cogmem.vec.to_table(cogmem.vec.mean({a, b})),
+				from_table = cogmem.vec.dot({1, 1}, a),
+			}
+		end
+		
+		function passthrough(v)
+			return cogmem.vec.new(v)
+		end
+		
+		function mismatch(a, b)
+			return cogmem.vec.dot(a, b)
+		end
+		
+		function rank(query, records, k)
+			return cogmem.vec.top_k(query, records, k)
+		end
+		
+		function encode(v)
+			return cogmem.json_encode({embedding = v})
+		end
+	`))
+	require.NoError(t, err)
+	ctx := context.Background()
+	
+	t.Run("Indexing and methods", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "describe", []float32{3, 4})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"is_vec": true,
+			"length": float64(2),
+			"first":  float64(3),
+			"text":   "vec(3, 4)",
+			"norm":   float64(5),
+		}, result)
+	})
+	
+	t.Run("Arithmetic", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "arithmetic", []float32{1, 0}, []float32{1, 2})
+		require.NoError(t, err)
+		values := result.(map[string]interface{})
+		assert.Equal(t, float64(1), values["dot"])
+		assert.InDelta(t, 0.4472, values["cosine"], 0.0001)
+		assert.Equal(t, []interface{}{float64(2), float64(2)}, values["sum"])
+		assert.Equal(t, []interface{}{float64(2), float64(0)}, values["scaled"])
+		assert.Equal(t, []interface{}{float64(1), float64(1)}, values["mean"])
+		assert.Equal(t, float64(1), values["from_table"])
+	})
+	
+	t.Run("Vectors convert back to Go", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "passthrough", []float32{0.25, -1})
+		require.NoError(t, err)
+		assert.Equal(t, []float32{0.25, -1}, result)
+		
+		result, err = engine.ExecuteFunction(ctx, "passthrough", []interface{}{0.5, 2})
+		require.NoError(t, err)
+		assert.Equal(t, []float32{0.5, 2}, result)
+	})
+	
+	t.Run("Mismatched dimensions raise an error", func(t *testing.T) {
+		_, err := engine.ExecuteFunction(ctx, "mismatch", []float32{1, 2}, []float32{1, 2, 3})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "vector dimensions do not match")
+	})
+	
+	t.Run("Top k over records", func(t *testing.T) {
+		records := []interface{}{
+			map[string]interface{}{"id": "far", "embedding": []float32{0, 1}},
+			map[string]interface{}{"id": "none"},
+			map[string]interface{}{"id": "near", "embedding": []float32{1, 0.1}},
+			map[string]interface{}{"id": "middle", "embedding": []float32{1, 1}},
+		}
+		result, err := engine.ExecuteFunction(ctx, "rank", []float32{1, 0}, records, 2)
+		require.NoError(t, err)
+		ranked := result.([]interface{})
+		require.Len(t, ranked, 2)
+		assert.Equal(t, float64(3), ranked[0].(map[string]interface{})["index"])
+		assert.Equal(t, float64(4), ranked[1].(map[string]interface{})["index"])
+		assert.InDelta(t, 0.7071, ranked[1].(map[string]interface{})["score"], 0.0001)
+	})
+	
+	t.Run("Vectors encode as JSON arrays", func(t *testing.T) {
+		result, err := engine.ExecuteFunction(ctx, "encode", []float32{0.5, 1})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"embedding": [0.5, 1]}`, result.(string))
+	})
+}
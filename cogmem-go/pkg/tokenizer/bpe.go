@@ -0,0 +1,248 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go-loader/assets"
+)
+
+// Encoding names of the embedded vocabularies
+const (
+	// EncodingCL100K is used by GPT-4, GPT-3.5 and the text-embedding-3 and ada-002 models
+	EncodingCL100K = "cl100k_base"
+	
+	// EncodingO200K is used by GPT-4o, GPT-4.1 and the o-series models
+	EncodingO200K = "o200k_base"
+)
+
+// Pre-tokenization patterns. The upstream patterns end with the alternatives
+// `\s+(?!\S)|\s+`; RE2 has no lookahead, so both are matched as `\s+` and
+// splitPieces gives the trailing whitespace character back to the next piece.
+const (
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`
+	
+	o200kPattern = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`
+)
+
+// BPE is a byte-pair encoding Tokenizer compatible with OpenAI's tiktoken
+// encodings. The vocabulary is embedded in the binary and parsed on first use,
+// so no network access is needed at runtime.
+type BPE struct {
+	name    string
+	pattern *regexp.Regexp
+	
+	once  sync.Once
+	ranks map[string]int
+	err   error
+}
+
+var (
+	cl100k = &BPE{name: EncodingCL100K, pattern: regexp.MustCompile(`^(?:` + cl100kPattern + `)`)}
+	o200k  = &BPE{name: EncodingO200K, pattern: regexp.MustCompile(`^(?:` + o200kPattern + `)`)}
+)
+
+// CL100K returns the shared cl100k_base tokenizer.
+func CL100K() *BPE {
+	return cl100k
+}
+
+// O200K returns the shared o200k_base tokenizer.
+func O200K() *BPE {
+	return o200k
+}
+
+// ForEncoding returns the tokenizer for a tiktoken encoding name.
+func ForEncoding(name string) (Tokenizer, error) {
+	switch name {
+	case EncodingCL100K:
+		return CL100K(), nil
+	case EncodingO200K:
+		return O200K(), nil
+	case "heuristic":
+		return NewHeuristic(), nil
+	}
+	return nil, fmt.Errorf("unknown tokenizer encoding: %s", name)
+}
+
+// ForModel returns the tokenizer used by an OpenAI model, falling back to
+// the heuristic tokenizer for models it does not recognize.
+func ForModel(model string) Tokenizer {
+	model = strings.ToLower(model)
+	switch {
+	case strings.HasPrefix(model, "gpt-4o"), strings.HasPrefix(model, "gpt-4.1"), strings.HasPrefix(model, "gpt-4.5"),
+		strings.HasPrefix(model, "gpt-5"), strings.HasPrefix(model, "chatgpt-4o"),
+		strings.HasPrefix(model, "o1"), strings.HasPrefix(model, "o3"), strings.HasPrefix(model, "o4"):
+		return O200K()
+	case strings.HasPrefix(model, "gpt-4"), strings.HasPrefix(model, "gpt-3.5"),
+		strings.HasPrefix(model, "text-embedding-3"), strings.HasPrefix(model, "text-embedding-ada-002"):
+		return CL100K()
+	}
+	return NewHeuristic()
+}
+
+// Name implements the Tokenizer interface.
+func (b *BPE) Name() string {
+	return b.name
+}
+
+// CountTokens implements the Tokenizer interface. If the embedded vocabulary
+// cannot be loaded it falls back to the heuristic count.
+func (b *BPE) CountTokens(text string) int {
+	if err := b.load(); err != nil {
+		return NewHeuristic().CountTokens(text)
+	}
+	
+	count := 0
+	for _, piece := range b.splitPieces(text) {
+		if _, ok := b.ranks[piece]; ok {
+			count++
+			continue
+		}
+		count += len(b.mergePiece([]byte(piece)))
+	}
+	return count
+}
+
+// Encode returns the token ranks (IDs) for text, ignoring special tokens.
+func (b *BPE) Encode(text string) ([]int, error) {
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+	
+	var tokens []int
+	for _, piece := range b.splitPieces(text) {
+		if rank, ok := b.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+		for _, part := range b.mergePiece([]byte(piece)) {
+			tokens = append(tokens, b.ranks[string(part)])
+		}
+	}
+	return tokens, nil
+}
+
+// load parses the embedded vocabulary once.
+func (b *BPE) load() error {
+	b.once.Do(func() {
+		b.ranks, b.err = loadRanks(b.name + ".tiktoken")
+	})
+	return b.err
+}
+
+// loadRanks parses a tiktoken vocabulary file of "base64-token rank" lines.
+func loadRanks(file string) (map[string]int, error) {
+	contents, err := assets.Assets.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vocabulary %s: %w", file, err)
+	}
+	
+	ranks := make(map[string]int, bytes.Count(contents, []byte("\n"))+1)
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		encoded, rankStr, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid vocabulary line in %s: %q", file, line)
+		}
+		token, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token in %s: %w", file, err)
+		}
+		rank, err := strconv.Atoi(rankStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank in %s: %w", file, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse vocabulary %s: %w", file, err)
+	}
+	return ranks, nil
+}
+
+// splitPieces splits text into pre-tokenization pieces with the encoding's pattern.
+func (b *BPE) splitPieces(text string) []string {
+	var pieces []string
+	for pos := 0; pos < len(text); {
+		loc := b.pattern.FindStringIndex(text[pos:])
+		if loc == nil || loc[1] == 0 {
+			// Unmatched input (e.g. invalid UTF-8) becomes a single-rune piece
+			_, size := utf8.DecodeRuneInString(text[pos:])
+			pieces = append(pieces, text[pos:pos+size])
+			pos += size
+			continue
+		}
+		
+		end := pos + loc[1]
+		piece := text[pos:end]
+		
+		// Emulate `\s+(?!\S)`: a run of spaces before a word leaves its last
+		// character to prefix that word. Runs containing line breaks come from
+		// `\s*[\r\n]+` and are kept whole.
+		if end < len(text) && isSpaceRun(piece) && !strings.ContainsAny(piece, "\r\n") {
+			if _, size := utf8.DecodeLastRuneInString(piece); size < len(piece) {
+				end -= size
+				piece = text[pos:end]
+			}
+		}
+		
+		pieces = append(pieces, piece)
+		pos = end
+	}
+	return pieces
+}
+
+// mergePiece applies byte-pair merges to a piece, returning its parts. It
+// repeatedly merges the adjacent pair whose concatenation has the lowest rank.
+func (b *BPE) mergePiece(piece []byte) [][]byte {
+	// bounds[i] is the start of part i; the last entry marks the end of the piece
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	
+	for len(bounds) > 2 {
+		best := -1
+		bestRank := 0
+		for i := 0; i < len(bounds)-2; i++ {
+			if rank, ok := b.ranks[string(piece[bounds[i]:bounds[i+2]])]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	
+	parts := make([][]byte, len(bounds)-1)
+	for i := range parts {
+		parts[i] = piece[bounds[i]:bounds[i+1]]
+	}
+	return parts
+}
+
+// isSpaceRun reports whether s consists only of whitespace.
+func isSpaceRun(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return s != ""
+}
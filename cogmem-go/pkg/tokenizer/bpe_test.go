@@ -0,0 +1,59 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBPE_Encode(t *testing.T) {
+	// Reference token IDs produced by OpenAI's tiktoken
+	tests := []struct {
+		name     string
+		bpe      *BPE
+		text     string
+		expected []int
+	}{
+		{"cl100k words", CL100K(), "hello world", []int{15339, 1917}},
+		{"cl100k punctuation", CL100K(), "tiktoken is great!", []int{83, 1609, 5963, 374, 2294, 0}},
+		{"cl100k digits", CL100K(), "1234567", []int{4513, 10961, 22}},
+		{"o200k words", O200K(), "hello world", []int{24912, 2375}},
+		{"o200k punctuation", O200K(), "tiktoken is great!", []int{83, 8251, 2488, 382, 2212, 0}},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := tt.bpe.Encode(tt.text)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, tokens)
+			assert.Equal(t, len(tt.expected), tt.bpe.CountTokens(tt.text))
+		})
+	}
+}
+
+func TestBPE_SplitPieces(t *testing.T) {
+	// Runs of spaces leave their last space to prefix the following word
+	pieces := CL100K().splitPieces("  leading   spaces\n\n  x")
+	assert.Equal(t, []string{" ", " leading", "  ", " spaces", "\n\n", " ", " x"}, pieces)
+	
+	// Trailing whitespace stays whole
+	assert.Equal(t, []string{"end", "   "}, CL100K().splitPieces("end   "))
+}
+
+func TestForModel(t *testing.T) {
+	assert.Equal(t, EncodingO200K, ForModel("gpt-4o-mini").Name())
+	assert.Equal(t, EncodingO200K, ForModel("o3-mini").Name())
+	assert.Equal(t, EncodingCL100K, ForModel("gpt-4").Name())
+	assert.Equal(t, EncodingCL100K, ForModel("text-embedding-3-small").Name())
+	assert.Equal(t, "heuristic", ForModel("claude-3-opus-20240229").Name())
+}
+
+func TestForEncoding(t *testing.T) {
+	tok, err := ForEncoding(EncodingCL100K)
+	require.NoError(t, err)
+	assert.Same(t, CL100K(), tok)
+	
+	_, err = ForEncoding("p99k_base")
+	assert.Error(t, err)
+}
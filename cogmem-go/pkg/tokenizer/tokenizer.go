@@ -0,0 +1,52 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens a model would see for a piece of text.
+type Tokenizer interface {
+	// Name identifies the tokenizer (e.g. "heuristic")
+	Name() string
+	
+	// CountTokens returns the number of tokens in text
+	CountTokens(text string) int
+}
+
+// Heuristic is a cheap Tokenizer that approximates token counts without a
+// vocabulary. It assumes about four characters per token for ordinary text,
+// which matches common English prose under modern BPE vocabularies, and
+// counts every non-ASCII letter or symbol as its own token so scripts such as
+// CJK are not badly undercounted.
+type Heuristic struct{}
+
+// NewHeuristic creates a heuristic tokenizer.
+func NewHeuristic() *Heuristic {
+	return &Heuristic{}
+}
+
+// Name implements the Tokenizer interface.
+func (h *Heuristic) Name() string {
+	return "heuristic"
+}
+
+// CountTokens implements the Tokenizer interface.
+func (h *Heuristic) CountTokens(text string) int {
+	asciiChars := 0
+	tokens := 0
+	for len(text) > 0 {
+		r, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+		if r < utf8.RuneSelf {
+			asciiChars++
+			continue
+		}
+		if unicode.IsSpace(r) {
+			asciiChars++
+			continue
+		}
+		tokens++
+	}
+	return tokens + (asciiChars+3)/4
+}
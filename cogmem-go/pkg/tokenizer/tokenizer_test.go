@@ -0,0 +1,19 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeuristic_CountTokens(t *testing.T) {
+	h := NewHeuristic()
+	
+	assert.Equal(t, "heuristic", h.Name())
+	assert.Equal(t, 0, h.CountTokens(""))
+	assert.Equal(t, 1, h.CountTokens("cat"))
+	assert.Equal(t, 6, h.CountTokens("the cat sat on the mat"))
+	
+	// Non-ASCII characters count individually
+	assert.Equal(t, 3, h.CountTokens("日本語"))
+}
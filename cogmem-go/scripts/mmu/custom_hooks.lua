@@ -27,6 +27,7 @@ function before_retrieve(query)
 end
 
 -- Called after LTMStore.Retrieve returns results
+-- Receives the full memory records and returns the list the MMU should use
 function after_retrieve(results)
   cogmem.log("info", "Custom after_retrieve hook - Processing " .. #results .. " results")
   
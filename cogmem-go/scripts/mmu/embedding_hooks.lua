@@ -18,9 +18,10 @@ function before_embedding(content)
 end
 
 -- Called to rank semantic search results
--- Gets the results and the original query text
+-- Gets the results, the original query text and the query embedding; record
+-- and query embeddings are cogmem.vec vectors, e.g. for cogmem.vec.top_k
 -- Can return re-ranked results
-function rank_semantic_results(results, query_text)
+function rank_semantic_results(results, query_text, query_embedding)
     -- Basic implementation that demonstrates the hook
     -- In a real implementation, this might apply custom ranking logic
     
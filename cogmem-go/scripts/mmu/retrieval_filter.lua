@@ -18,12 +18,21 @@ function before_retrieve(query)
 end
 
 -- Called after LTMStore.Retrieve returns results
-function after_retrieve(summary)
-  -- Log the summary of results
-  cogmem.log("info", "MMU after_retrieve: " .. summary)
+-- Parameter: results - Array of memory records (id, entity_id, user_id, content, metadata, score, ...)
+-- Returns: The records to use, possibly filtered, reordered or annotated, or nil to keep them.
+--          Records from another entity are rejected by the MMU.
+function after_retrieve(results)
+  cogmem.log("info", "MMU after_retrieve called with " .. #results .. " results")
   
-  -- In Phase 1, we just return the summary as is
-  return summary
+  -- Drop records marked as hidden
+  local visible = {}
+  for _, record in ipairs(results) do
+    if not (record.metadata and record.metadata.hidden) then
+      table.insert(visible, record)
+    end
+  end
+  
+  return visible
 end
 
 -- Called before encoding to LTM (placeholder)